@@ -20,7 +20,7 @@
 #include "../ipc_models.h"
 #include "../zmqsender.h" // 用于 ZMQ 和 MessagePack 发布
 
-const char *ENDPOINT = "ipc:///tmp/zmq_ipc_pubsub.sock";
+const char *ENDPOINT = SCOPE_IPC_ENDPOINT;
 
 // 定义默认的探测路径
 #define DEFAULT_OLLAMA_PATH "/usr/bin/ollama"
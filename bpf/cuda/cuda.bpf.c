@@ -7,6 +7,7 @@
 // --- 可配置参数 ---
 const volatile pid_t filter_pid = 0;
 const volatile char filter_comm[TASK_COMM_LEN] = "";
+const volatile bool capture_stack = false; // 是否采集用户态调用栈
 
 char LICENSE[] SEC("license") = "Dual BSD/GPL";
 
@@ -23,6 +24,13 @@ struct {
 	__type(value, struct malloc_entry_data);
 } malloc_entries SEC(".maps");
 
+struct {
+	__uint(type, BPF_MAP_TYPE_HASH);
+	__uint(max_entries, 10240);
+	__type(key, __u64); // pid_tgid，按线程区分，避免同一进程的并发拷贝互相覆盖
+	__type(value, struct memcpy_entry_data);
+} memcpy_entries SEC(".maps");
+
 struct {
 	__uint(type, BPF_MAP_TYPE_HASH);
 	__uint(max_entries, 10240);
@@ -48,6 +56,16 @@ static __always_inline int process_allowed(pid_t pid, const char *comm) {
 	return 1;
 }
 
+// 采集用户态调用栈，需要目标程序保留帧指针 (-fno-omit-frame-pointer)，否则只有前几帧
+static __always_inline void fill_user_stack(void *ctx, struct event *e) {
+	e->stack_depth = 0;
+	if (!capture_stack)
+		return;
+	long n = bpf_get_stack(ctx, e->stack, sizeof(e->stack), BPF_F_USER_STACK);
+	if (n > 0)
+		e->stack_depth = n / sizeof(e->stack[0]);
+}
+
 // --- 探针函数 ---
 
 // cudaMalloc(void** devPtr, size_t size)
@@ -92,6 +110,7 @@ int BPF_KRETPROBE(uretprobe_cudaMalloc, int ret) { // cudaError_t is typically i
 	e->type = EVENT_TYPE_MALLOC;
 	e->pid = pid;
 	bpf_get_current_comm(&e->comm, sizeof(e->comm));
+	fill_user_stack(ctx, e); // 在返回点采集，栈顶是 cudaMalloc 的调用者
     e->malloc.size = size;
 	e->malloc.retval = ret;
 	e->malloc.allocated_ptr = NULL; // 默认为 NULL
@@ -127,6 +146,7 @@ int BPF_KPROBE(uprobe_cudaFree, void* devPtr) {
 
 	e->type = EVENT_TYPE_FREE;
 	e->pid = pid;
+	e->stack_depth = 0;
 	__builtin_memcpy(&e->comm, comm, sizeof(comm));
 	e->free.dev_ptr = devPtr;
 
@@ -154,6 +174,7 @@ int BPF_KPROBE(uprobe_cudaLaunchKernel, const void* func) {
 	e->pid = pid;
 	__builtin_memcpy(&e->comm, comm, sizeof(comm));
 	e->launch_kernel.func_ptr = func;
+	fill_user_stack(ctx, e);
 
 	bpf_ringbuf_submit(e, 0);
 	return 0;
@@ -177,6 +198,31 @@ int BPF_KPROBE(uprobe_cudaMemcpy, void* dst, const void* src, size_t size, int k
     }
 
 
+	// 存储参数和入口时间戳，在 uretprobe 中计算耗时后再发送事件
+	struct memcpy_entry_data entry = {};
+	entry.src = src;
+	entry.dst = dst;
+	entry.size = size;
+	entry.kind = kind;
+	entry.entry_ts = bpf_ktime_get_ns();
+	__u64 pid_tgid = bpf_get_current_pid_tgid();
+	bpf_map_update_elem(&memcpy_entries, &pid_tgid, &entry, BPF_ANY);
+
+	return 0;
+}
+
+SEC("uretprobe")
+int BPF_KRETPROBE(uretprobe_cudaMemcpy, int ret) {
+	__u64 pid_tgid = bpf_get_current_pid_tgid();
+	pid_t pid = pid_tgid >> 32;
+
+	struct memcpy_entry_data* entry_p = bpf_map_lookup_elem(&memcpy_entries, &pid_tgid);
+	if (!entry_p) {
+		return 0;
+	}
+	struct memcpy_entry_data entry = *entry_p;
+	bpf_map_delete_elem(&memcpy_entries, &pid_tgid);
+
 	struct event* e = bpf_ringbuf_reserve(&rb, sizeof(*e), 0);
 	if (!e) {
 		return 0;
@@ -184,11 +230,13 @@ int BPF_KPROBE(uprobe_cudaMemcpy, void* dst, const void* src, size_t size, int k
 
 	e->type = EVENT_TYPE_MEMCPY;
 	e->pid = pid;
-	__builtin_memcpy(&e->comm, comm, sizeof(comm));
-	e->memcpy.dst = dst;
-	e->memcpy.src = src;
-	e->memcpy.size = size;
-	e->memcpy.kind = (enum cuda_memcpy_kind)kind;
+	e->stack_depth = 0;
+	bpf_get_current_comm(&e->comm, sizeof(e->comm));
+	e->memcpy.dst = entry.dst;
+	e->memcpy.src = entry.src;
+	e->memcpy.size = entry.size;
+	e->memcpy.kind = (enum cuda_memcpy_kind)entry.kind;
+	e->memcpy.duration_ns = bpf_ktime_get_ns() - entry.entry_ts;
 
 	bpf_ringbuf_submit(e, 0);
 	return 0;
@@ -237,6 +285,7 @@ int BPF_KRETPROBE(uretprobe_cudaDeviceSynchronize, int ret) {
 
 	e->type = EVENT_TYPE_SYNC;
 	e->pid = pid;
+	e->stack_depth = 0;
 	bpf_get_current_comm(&e->comm, sizeof(e->comm));
 	e->sync.duration_ns = duration_ns;
 
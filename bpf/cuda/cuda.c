@@ -18,7 +18,7 @@
 #include "../epoch.h" // 用于 UnixNanoNow()
 #include "../ipc_models.h"
 #include "../zmqsender.h" // 用于 ZMQ 和 MessagePack 发布
-const char *ENDPOINT = "ipc:///tmp/zmq_ipc_pubsub.sock";
+const char *ENDPOINT = SCOPE_IPC_ENDPOINT;
 
 // 定义默认的 CUDA Runtime 库路径 (可能需要根据系统调整)
 // #define DEFAULT_CUDA_LIB_PATH "/usr/local/cuda/lib64/libcudart.so"
@@ -38,6 +38,7 @@ static struct env {
     char filter_comm[TASK_COMM_LEN]; // 过滤进程名
     char target_path[PATH_MAX];      // 目标 CUDA 库路径
     bool verbose;                    // 详细日志
+    bool stack;                      // 采集用户态调用栈
 } env = {
     .pid = 0,
     .filter_comm = "",
@@ -51,7 +52,7 @@ const char argp_program_doc[] =
     "cuda: Monitor CUDA Runtime API calls using eBPF.\n\n"
     "Traces cudaMalloc, cudaFree, cudaLaunchKernel, cudaMemcpy, "
     "cudaDeviceSynchronize.\n\n"
-    "USAGE: ./cuda [-p PID] [-c COMM] [-f FILE_PATH] [-v]\n";
+    "USAGE: ./cuda [-p PID] [-c COMM] [-f FILE_PATH] [-s] [-v]\n";
 
 // 命令行选项
 static const struct argp_option opts[] = {
@@ -59,6 +60,9 @@ static const struct argp_option opts[] = {
     {"comm", 'c', "COMMAND", 0, "Filter by process command name"},
     {"file", 'f', "FILE_PATH", 0,
      "Path to the target libcudart.so (default: " DEFAULT_CUDA_LIB_PATH ")"},
+    {"stack", 's', NULL, 0,
+     "Capture user stacks of cudaMalloc and cudaLaunchKernel (needs frame "
+     "pointers in the target)"},
     {"verbose", 'v', NULL, 0, "Verbose debug output"},
     {},
 };
@@ -94,6 +98,9 @@ static error_t parse_arg(int key, char *arg, struct argp_state *state) {
         strncpy(env.target_path, arg, PATH_MAX);
         env.target_path[PATH_MAX - 1] = '\0';
         break;
+    case 's':
+        env.stack = true;
+        break;
     case 'v':
         env.verbose = true;
         break;
@@ -139,6 +146,15 @@ static const char *memcpy_kind_to_str(enum cuda_memcpy_kind kind) {
     }
 }
 
+// 复制 BPF 采集的调用栈，深度按缓冲区大小截断
+static void copy_stack(uint64_t *dst, uint32_t *depth, const struct event *e) {
+    uint32_t n = e->stack_depth > 0 ? (uint32_t)e->stack_depth : 0;
+    if (n > MAX_STACK_DEPTH)
+        n = MAX_STACK_DEPTH;
+    memcpy(dst, e->stack, n * sizeof(dst[0]));
+    *depth = n;
+}
+
 // Ring buffer 事件处理回调
 static int handle_event(void *ctx, void *data, size_t data_sz) {
     if (exiting)
@@ -183,9 +199,9 @@ static int handle_event(void *ctx, void *data, size_t data_sz) {
             break;
         case EVENT_TYPE_MEMCPY:
             // "%d %s cudaMemcpy<Kind> %p -> %p %d\n"
-            printf("cudaMemcpy %s(src=%p, dst=%p, size=%zu)\n",
+            printf("cudaMemcpy %s(src=%p, dst=%p, size=%zu) cost %lu ns\n",
                    memcpy_kind_to_str(e->memcpy.kind), e->memcpy.src,
-                   e->memcpy.dst, e->memcpy.size);
+                   e->memcpy.dst, e->memcpy.size, e->memcpy.duration_ns);
             break;
         case EVENT_TYPE_SYNC:
             // "%d %s call cudaDeviceSynchronize at %u\n" (bpftrace used nsecs,
@@ -211,6 +227,7 @@ static int handle_event(void *ctx, void *data, size_t data_sz) {
             .retval = e->malloc.retval,
         };
         strncpy(event.comm, e->comm, sizeof(event.comm));
+        copy_stack(event.stack, &event.stack_depth, e);
         zmq_pub_send(zmq_handle, "cudaMalloc", &event, cuda_malloc_event_pack);
     } else if (e->type == EVENT_TYPE_FREE) {
         struct cuda_free_event event = {
@@ -229,6 +246,7 @@ static int handle_event(void *ctx, void *data, size_t data_sz) {
             .func_ptr = (uint64_t)e->launch_kernel.func_ptr,
         };
         strncpy(event.comm, e->comm, sizeof(event.comm));
+        copy_stack(event.stack, &event.stack_depth, e);
         zmq_pub_send(zmq_handle, "cudaLaunchKernel", &event,
                      cuda_launch_kernel_event_pack);
     } else if (e->type == EVENT_TYPE_MEMCPY) {
@@ -240,6 +258,7 @@ static int handle_event(void *ctx, void *data, size_t data_sz) {
             .dst = (uint64_t)e->memcpy.dst,
             .size = e->memcpy.size,
             .kind = e->memcpy.kind,
+            .duration_ns = e->memcpy.duration_ns,
         };
         strncpy(event.comm, e->comm, sizeof(event.comm));
         zmq_pub_send(zmq_handle, "cudaMemcpy", &event, cuda_memcpy_event_pack);
@@ -294,6 +313,7 @@ int main(int argc, char **argv) {
     // 设置 BPF 程序过滤参数
     skel->rodata->filter_pid = env.pid;
     strncpy((char *)skel->rodata->filter_comm, env.filter_comm, TASK_COMM_LEN);
+    skel->rodata->capture_stack = env.stack;
 
     err = cuda_bpf__load(skel);
     if (err) {
@@ -365,8 +385,9 @@ int main(int argc, char **argv) {
     // Attach cudaLaunchKernel (uprobe only - 调用不变)
     ATTACH_UPROBE(skel, TARGET_FUNC_LAUNCH, uprobe_cudaLaunchKernel);
 
-    // Attach cudaMemcpy (uprobe only - 调用不变)
-    ATTACH_UPROBE(skel, TARGET_FUNC_MEMCPY, uprobe_cudaMemcpy);
+    // Attach cudaMemcpy (uprobe + uretprobe, 用于计算拷贝耗时)
+    ATTACH_UPROBE_URETPROBE(skel, TARGET_FUNC_MEMCPY, uprobe_cudaMemcpy,
+                            uretprobe_cudaMemcpy);
 
     // Attach cudaDeviceSynchronize (uprobe + uretprobe)
     // Pass both the uprobe and uretprobe member names
@@ -2,6 +2,7 @@
 
 #define TASK_COMM_LEN 16
 #define CUDA_LIB_PATH_MAX 256 // CUDA 库路径最大长度
+#define MAX_STACK_DEPTH 32    // 用户态调用栈的最大深度
 
 // CUDA Memcpy Kind Enum (mirrors cudaMemcpyKind)
 enum cuda_memcpy_kind {
@@ -26,6 +27,8 @@ struct event {
 	enum event_type type;      // 事件类型
 	int pid;                   // 进程 ID
 	char comm[TASK_COMM_LEN];  // 进程名
+	int stack_depth;           // stack 中有效的帧数，未采集调用栈时为 0
+	uint64_t stack[MAX_STACK_DEPTH]; // 用户态调用栈 (返回地址，从栈顶开始)，仅 cudaMalloc 和 cudaLaunchKernel
 
 	union {
 		// cudaMalloc 返回
@@ -45,12 +48,13 @@ struct event {
 			const void* func_ptr; // 内核函数指针 (在设备上的地址)
 		} launch_kernel;
 
-		// cudaMemcpy 入口
+		// cudaMemcpy 返回
 		struct {
 			const void* src;
 			void* dst;
 			size_t size;
 			enum cuda_memcpy_kind kind; // 传输类型
+			uint64_t duration_ns;       // cudaMemcpy 执行耗时 (纳秒)
 		} memcpy;
 
 		// cudaDeviceSynchronize 返回
@@ -66,6 +70,15 @@ struct malloc_entry_data {
     size_t size;
 };
 
+// 用于在 cudaMemcpy uprobe 和 uretprobe 之间传递参数和时间戳
+struct memcpy_entry_data {
+	const void* src;
+	void* dst;
+	size_t size;
+	int kind;
+	uint64_t entry_ts; // 进入函数时的时间戳
+};
+
 // 用于在 cudaDeviceSynchronize uprobe 和 uretprobe 之间传递时间戳
 struct sync_entry_data {
 	uint64_t entry_ts; // 进入函数时的时间戳
@@ -18,7 +18,7 @@
 #include "../epoch.h" // 用于 UnixNanoNow()
 #include "../ipc_models.h"
 #include "../zmqsender.h" // 用于 ZMQ 和 MessagePack 发布
-const char *ENDPOINT = "ipc:///tmp/zmq_ipc_pubsub.sock";
+const char *ENDPOINT = SCOPE_IPC_ENDPOINT;
 
 // Environment configuration struct to store command-line arguments
 static struct env {
@@ -6,6 +6,7 @@
 
 const volatile pid_t filter_pid = 0;
 const volatile char filter_comm[TASK_COMM_LEN];
+const volatile bool capture_stack = false; // 是否采集用户态调用栈
 
 char LICENSE[] SEC("license") = "Dual BSD/GPL";
 
@@ -102,6 +103,13 @@ int BPF_KRETPROBE(uretprobe_ggml_aligned_malloc, void *ret) {
     bpf_get_current_comm(&e->comm, sizeof(e->comm));
     e->size = size;
     e->ptr = (unsigned long long)ret; // 将指针转换为 u64
+    e->stack_depth = 0;
+    if (capture_stack) {
+        // 在返回点采集，栈顶是 ggml_aligned_malloc 的调用者；需要目标程序保留帧指针
+        long n = bpf_get_stack(ctx, e->stack, sizeof(e->stack), BPF_F_USER_STACK);
+        if (n > 0)
+            e->stack_depth = n / sizeof(e->stack[0]);
+    }
     bpf_ringbuf_submit(e, 0);
     return 0;
 }
@@ -135,6 +143,7 @@ int BPF_KPROBE(uprobe_ggml_aligned_free, void *ptr, size_t size) {
     __builtin_memcpy(e->comm, comm, sizeof(e->comm));
     e->size = size;
     e->ptr = (unsigned long long)ptr; // 将指针转换为 u64
+    e->stack_depth = 0;
 
     bpf_ringbuf_submit(e, 0);
     return 0;
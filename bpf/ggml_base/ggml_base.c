@@ -16,7 +16,7 @@
 #include "../epoch.h" // 用于 UnixNanoNow()
 #include "../ipc_models.h"
 #include "../zmqsender.h" // 用于 ZMQ 和 MessagePack 发布
-const char *ENDPOINT = "ipc:///tmp/zmq_ipc_pubsub.sock";
+const char *ENDPOINT = SCOPE_IPC_ENDPOINT;
 
 #define DEFAULT_TARGET_LIB "/usr/lib/ollama/libggml-base.so"
 #define MALLOC_FUNC "ggml_aligned_malloc"
@@ -28,6 +28,7 @@ static struct env {
     char filter_comm[TASK_COMM_LEN]; // 过滤进程名
     char target_lib[PATH_MAX];       // 目标库路径
     bool verbose;                    // 详细日志
+    bool stack;                      // 采集用户态调用栈
 } env = {
     .pid = 0,
     .filter_comm = "",
@@ -40,7 +41,7 @@ const char *argp_program_bug_address = "DeltaMail@qq.com";
 const char argp_program_doc[] =
     "ggml_base: Monitor ggml_aligned_malloc/free calls in a shared library "
     "using eBPF.\n\n"
-    "USAGE: ./ggml_base [-p PID] [-c COMM] [-l LIBRARY_PATH] [-v]\n";
+    "USAGE: ./ggml_base [-p PID] [-c COMM] [-l LIBRARY_PATH] [-s] [-v]\n";
 
 // 命令行选项定义
 static const struct argp_option opts[] = {
@@ -49,6 +50,9 @@ static const struct argp_option opts[] = {
      "Filter by process command name (max 15 chars)"},
     {"lib", 'l', "LIBRARY_PATH", 0,
      "Path to the target shared library (default: " DEFAULT_TARGET_LIB ")"},
+    {"stack", 's', NULL, 0,
+     "Capture user stacks of ggml_aligned_malloc (needs frame pointers in the "
+     "target)"},
     {"verbose", 'v', NULL, 0, "Verbose debug output"},
     {},
 };
@@ -84,6 +88,9 @@ static error_t parse_arg(int key, char *arg, struct argp_state *state) {
         strncpy(env.target_lib, arg, PATH_MAX - 1);
         env.target_lib[PATH_MAX - 1] = '\0';
         break;
+    case 's':
+        env.stack = true;
+        break;
     case 'v':
         env.verbose = true;
         break;
@@ -149,8 +156,14 @@ static int handle_event(void *ctx, void *data, size_t data_sz) {
         .type = (e->type == EVENT_MALLOC) ? EVENT_MALLOC : EVENT_FREE,
         .size = e->size,
         .ptr = e->ptr,
+        .stack_depth = 0,
     };
     strncpy(event.comm, e->comm, sizeof(event.comm));
+    if (e->stack_depth > 0) {
+        event.stack_depth = e->stack_depth > MAX_STACK_DEPTH ? MAX_STACK_DEPTH
+                                                             : e->stack_depth;
+        memcpy(event.stack, e->stack, event.stack_depth * sizeof(event.stack[0]));
+    }
 
     zmq_pub_send(zmq_handle, "ggml_base", &event, ggml_base_event_pack);
 
@@ -191,6 +204,7 @@ int main(int argc, char **argv) {
     strncpy((char *)skel->rodata->filter_comm, env.filter_comm, TASK_COMM_LEN);
     // 确保 null 终止 (虽然 rodata 默认是 0，显式设置更安全)
     ((char *)skel->rodata->filter_comm)[TASK_COMM_LEN - 1] = '\0';
+    skel->rodata->capture_stack = env.stack;
 
     err = ggml_base_bpf__load(skel);
     if (err) {
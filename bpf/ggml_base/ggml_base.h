@@ -3,6 +3,7 @@
 
 #define TASK_COMM_LEN 16
 #define MAX_ENTRIES   10240 // Map size, adjust if needed
+#define MAX_STACK_DEPTH 32  // 用户态调用栈的最大深度
 
 // 定义事件类型
 enum event_type {
@@ -17,6 +18,8 @@ struct event {
     char comm[TASK_COMM_LEN];
     size_t size;            // 内存大小
     unsigned long long ptr; // 内存指针地址 (使用 ull 保证足够大小)
+    int stack_depth;        // stack 中有效的帧数，未采集调用栈时为 0
+    unsigned long long stack[MAX_STACK_DEPTH]; // 用户态调用栈 (返回地址，从栈顶开始)，仅 malloc
 };
 
 #endif /* __GGML_BASE_H */
\ No newline at end of file
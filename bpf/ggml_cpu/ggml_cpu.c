@@ -18,7 +18,7 @@
 #include "../ipc_models.h"
 #include "../zmqsender.h" // 用于 ZMQ 和 MessagePack 发布
 
-const char *ENDPOINT = "ipc:///tmp/zmq_ipc_pubsub.sock";
+const char *ENDPOINT = SCOPE_IPC_ENDPOINT;
 
 // Environment struct, argp setup, libbpf_print_fn, sig_handler remain the
 // same...
@@ -20,7 +20,7 @@
 #include "../ipc_models.h"
 #include "../zmqsender.h" // 用于 ZMQ 和 MessagePack 发布
 
-const char *ENDPOINT = "ipc:///tmp/zmq_ipc_pubsub.sock";
+const char *ENDPOINT = SCOPE_IPC_ENDPOINT;
 
 // 定义默认的探测库路径
 #define DEFAULT_TARGET_LIB "/usr/lib/ollama/cuda_v12/libggml-cuda.so"
@@ -16,6 +16,19 @@
 #define MAX_FILENAME_LEN 256
 #endif
 
+#ifndef MAX_STACK_DEPTH
+#define MAX_STACK_DEPTH 32
+#endif
+
+// 用户态调用栈打包为地址数组 (从栈顶开始)，未采集调用栈时为空数组
+static void stack_pack(msgpack_packer *pk, const uint64_t *stack,
+                       uint32_t depth) {
+    msgpack_pack_array(pk, depth);
+    for (uint32_t i = 0; i < depth; i++) {
+        msgpack_pack_uint64(pk, stack[i]);
+    }
+}
+
 //! [vfs_open] START
 
 // --- 定义要通过 ZMQ 发送的数据结构 ---
@@ -248,13 +261,15 @@ struct ggml_base_event {
     int32_t type;  // 0 : aligned_malloc, 1 : aligned_free
     uint64_t size; // 内存大小
     uint64_t ptr;  // 内存指针地址 (使用 ull 保证足够大小)
+    uint32_t stack_depth;
+    uint64_t stack[MAX_STACK_DEPTH]; // 用户态调用栈，仅 malloc 且开启 -s 时
 };
 
 static void ggml_base_event_pack(msgpack_packer *pk, const void *user_data) {
     const struct ggml_base_event *event =
         (const struct ggml_base_event *)user_data;
 
-    msgpack_pack_array(pk, 6);
+    msgpack_pack_array(pk, 7);
 
     msgpack_pack_int64(pk, event->timestamp_ns);
     msgpack_pack_int32(pk, event->pid);
@@ -266,6 +281,7 @@ static void ggml_base_event_pack(msgpack_packer *pk, const void *user_data) {
     msgpack_pack_int32(pk, event->type);
     msgpack_pack_uint64(pk, event->size);
     msgpack_pack_uint64(pk, event->ptr);
+    stack_pack(pk, event->stack, event->stack_depth);
 }
 
 //! execv
@@ -305,12 +321,14 @@ struct cuda_malloc_event {
     uint64_t allocated_ptr; // 实际分配到的设备指针 (成功时)
     size_t size;            // 请求分配的大小
     int retval;             // cudaMalloc 的返回值 (错误码)
+    uint32_t stack_depth;
+    uint64_t stack[MAX_STACK_DEPTH]; // 用户态调用栈，开启 -s 时
 };
 static void cuda_malloc_event_pack(msgpack_packer *pk, const void *user_data) {
     const struct cuda_malloc_event *event =
         (const struct cuda_malloc_event *)user_data;
 
-    msgpack_pack_array(pk, 6);
+    msgpack_pack_array(pk, 7);
 
     msgpack_pack_int64(pk, event->timestamp_ns);
     msgpack_pack_int32(pk, event->pid);
@@ -322,6 +340,7 @@ static void cuda_malloc_event_pack(msgpack_packer *pk, const void *user_data) {
     msgpack_pack_uint64(pk, event->allocated_ptr);
     msgpack_pack_uint64(pk, event->size);
     msgpack_pack_int32(pk, event->retval);
+    stack_pack(pk, event->stack, event->stack_depth);
 }
 
 struct cuda_free_event {
@@ -350,13 +369,15 @@ struct cuda_launch_kernel_event {
     int32_t pid;
     char comm[TASK_COMM_LEN];
     uint64_t func_ptr; // 内核函数指针 (在设备上的地址)
+    uint32_t stack_depth;
+    uint64_t stack[MAX_STACK_DEPTH]; // 用户态调用栈，开启 -s 时
 };
 static void cuda_launch_kernel_event_pack(msgpack_packer *pk,
                                           const void *user_data) {
     const struct cuda_launch_kernel_event *event =
         (const struct cuda_launch_kernel_event *)user_data;
 
-    msgpack_pack_array(pk, 4);
+    msgpack_pack_array(pk, 5);
 
     msgpack_pack_int64(pk, event->timestamp_ns);
     msgpack_pack_int32(pk, event->pid);
@@ -366,6 +387,7 @@ static void cuda_launch_kernel_event_pack(msgpack_packer *pk,
     msgpack_pack_str_body(pk, event->comm, comm_len);
 
     msgpack_pack_uint64(pk, event->func_ptr);
+    stack_pack(pk, event->stack, event->stack_depth);
 }
 struct cuda_memcpy_event {
     int64_t timestamp_ns; // 纳秒时间戳
@@ -384,13 +406,14 @@ struct cuda_memcpy_event {
     CUDA_MEMCPY_DEFAULT = 4,
 };
      */
+    uint64_t duration_ns; // cudaMemcpy 执行耗时 (纳秒)
 };
 static void cuda_memcpy_event_pack(msgpack_packer *pk, const void *user_data) {
 
     const struct cuda_memcpy_event *event =
         (const struct cuda_memcpy_event *)user_data;
 
-    msgpack_pack_array(pk, 7);
+    msgpack_pack_array(pk, 8);
 
     msgpack_pack_int64(pk, event->timestamp_ns);
     msgpack_pack_int32(pk, event->pid);
@@ -403,6 +426,7 @@ static void cuda_memcpy_event_pack(msgpack_packer *pk, const void *user_data) {
     msgpack_pack_uint64(pk, event->dst);
     msgpack_pack_uint64(pk, event->size);
     msgpack_pack_int32(pk, event->kind);
+    msgpack_pack_uint64(pk, event->duration_ns);
 }
 struct cuda_sync_event {
     int64_t timestamp_ns; // 纳秒时间戳
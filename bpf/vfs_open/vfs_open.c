@@ -35,7 +35,7 @@ static struct env {
     .pid = 0,
     .parent_comm = "",
     .verbose = false,
-    .zmq_endpoint = "ipc:///tmp/zmq_ipc_pubsub.sock", // 默认 ZMQ 端点
+    .zmq_endpoint = SCOPE_IPC_ENDPOINT, // 默认 ZMQ 端点
 };
 
 const char *argp_program_version = "vfs_open 0.2 (ZMQ enabled)";
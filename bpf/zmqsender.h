@@ -11,6 +11,10 @@
 #include <sys/stat.h>
 #include <unistd.h>
 #include <zmq.h> // ZeroMQ library
+
+// agent 默认绑定的 IPC 端点，位于只有 root 和 scope 组可以访问的运行时目录
+#define SCOPE_IPC_ENDPOINT "ipc:///run/scope/probes.sock"
+
 // --- 类型定义 ---
 
 // 用于打包用户特定数据的函数指针类型
@@ -121,6 +125,11 @@ static inline zmq_pub_handle_t *zmq_pub_init(const char *endpoint) {
         return NULL;
     }
 
+    // agent 启动探针时通过环境变量 SCOPE_IPC_ENDPOINT 传入实际绑定的端点
+    const char *env_endpoint = getenv("SCOPE_IPC_ENDPOINT");
+    if (env_endpoint && env_endpoint[0])
+        endpoint = env_endpoint;
+
     zmq_pub_handle_t *handle =
         (zmq_pub_handle_t *)malloc(sizeof(zmq_pub_handle_t));
     if (!handle) {
@@ -4,12 +4,13 @@ import (
 	"flag"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
 	"runtime"
 	"scope/database/redis"
 	"scope/internal/agentmanager"
+	"scope/internal/platform"
 	"scope/internal/utils"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -24,11 +25,27 @@ func main() {
 
 	// Parse command line arguments
 	config := agentmanager.Config{
-		IPCEndpoint:   "ipc:///tmp/zmq_ipc_pubsub.sock",
+		IPCEndpoint:   utils.GetEnvOrDefault("IPC_ENDPOINT", agentmanager.DefaultIPCEndpoint),
+		IPCGroup:      utils.GetEnvOrDefault("IPC_GROUP", ""),
+		IPCVerifyPeer: utils.GetEnvAsBoolOrDefault("IPC_VERIFY_PEER", true),
 		RedisAddr:     utils.GetEnvOrDefault("REDIS_ADDR", "localhost:6379"),
 		RedisDB:       1, // 1 for stream message queue
 		RedisPassword: utils.GetEnvOrDefault("REDIS_PASSWORD", ""),
 		StreamKey:     "SCOPE_STREAM",
+
+		SyscallAggInterval: time.Duration(utils.GetEnvAsIntOrDefault("SYSCALL_AGG_INTERVAL_SEC", 0)) * time.Second,
+		SyscallRaw:         utils.GetEnvAsBoolOrDefault("SYSCALL_RAW_EVENTS", true),
+
+		RulesFile:       utils.GetEnvOrDefault("RULES_FILE", ""),
+		RuleAggInterval: time.Duration(utils.GetEnvAsIntOrDefault("RULE_AGG_INTERVAL_SEC", 10)) * time.Second,
+
+		SymbolCacheMB: utils.GetEnvAsIntOrDefault("SYMBOL_CACHE_MB", 256),
+
+		BPFDir:       utils.GetEnvOrDefault("BPF_DIR", "/home/delta/workspace/ebpf-golang/bpf"),
+		ProbeRuntime: utils.GetEnvOrDefault("PROBE_RUNTIME", agentmanager.ProbeRuntimeAuto),
+		ProbeComm:    utils.GetEnvOrDefault("PROBE_COMM", ""),
+		ProbePID:     int32(utils.GetEnvAsIntOrDefault("PROBE_PID", 0)),
+		ProbeStack:   utils.GetEnvAsBoolOrDefault("PROBE_STACK", false),
 	}
 
 	// Define command line flags
@@ -38,6 +55,20 @@ func main() {
 	redisPasswordFlag := flag.String("redis-password", config.RedisPassword, "Redis password")
 	streamKeyFlag := flag.String("stream-key", config.StreamKey, "Redis stream key")
 	ipcEndpointFlag := flag.String("ipc-endpoint", config.IPCEndpoint, "ZMQ IPC endpoint")
+	ipcGroupFlag := flag.String("ipc-group", config.IPCGroup, "Group allowed to connect to the IPC socket (empty: root only)")
+	ipcVerifyFlag := flag.Bool("ipc-verify-peer", config.IPCVerifyPeer, "Only accept IPC messages from probe loaders started by the agent (checked via SO_PEERCRED)")
+	ipcTrustedUIDsFlag := flag.String("ipc-trusted-uids", utils.GetEnvOrDefault("IPC_TRUSTED_UIDS", ""), "Comma separated uids whose externally started probes are also accepted")
+	syscallAggFlag := flag.Duration("syscall-agg-interval", config.SyscallAggInterval, "Roll up syscalls per (pid, syscall) over this interval (0 disables)")
+	syscallRawFlag := flag.Bool("syscall-raw", config.SyscallRaw, "Also publish one raw event per syscall when rolling up")
+	rulesFileFlag := flag.String("rules-file", config.RulesFile, "JSON file holding the event filtering rules (empty disables persistence)")
+	ruleAggFlag := flag.Duration("rule-agg-interval", config.RuleAggInterval, "Flush interval of the aggregate rule action")
+	symbolCacheFlag := flag.Int("symbol-cache-mb", config.SymbolCacheMB, "Memory budget in MiB for cached symbol tables and DWARF")
+	probesFlag := flag.String("probes", utils.GetEnvOrDefault("PROBES", ""), "Comma separated probes to load at startup, e.g. vfs_open,sched,cuda (empty: probes are started externally)")
+	probeRuntimeFlag := flag.String("probe-runtime", config.ProbeRuntime, "How to run probes: auto (in-process, falling back to the C loaders), go or c")
+	probePIDFlag := flag.Int("probe-pid", int(config.ProbePID), "Only trace this process ID (0 traces all)")
+	probeCommFlag := flag.String("probe-comm", config.ProbeComm, "Only trace processes with this command name")
+	probeStackFlag := flag.Bool("probe-stack", config.ProbeStack, "Capture user stacks in the cuda and ggml_base probes")
+	probeTargetsFlag := flag.String("probe-targets", utils.GetEnvOrDefault("PROBE_TARGETS", ""), "Uprobe target overrides, e.g. cuda=/usr/local/cuda/lib64/libcudart.so,ggml_base=/usr/lib/ollama/libggml-base.so")
 
 	// Parse flags
 	flag.Parse()
@@ -49,6 +80,44 @@ func main() {
 	config.RedisPassword = *redisPasswordFlag
 	config.StreamKey = *streamKeyFlag
 	config.IPCEndpoint = *ipcEndpointFlag
+	config.IPCGroup = *ipcGroupFlag
+	config.IPCVerifyPeer = *ipcVerifyFlag
+	trustedUIDs, err := agentmanager.ParseTrustedUIDs(*ipcTrustedUIDsFlag)
+	if err != nil {
+		log.Fatalf("Invalid ipc-trusted-uids: %v", err)
+	}
+	config.IPCTrustedUIDs = trustedUIDs
+	config.SyscallAggInterval = *syscallAggFlag
+	config.SyscallRaw = *syscallRawFlag
+	config.RulesFile = *rulesFileFlag
+	config.RuleAggInterval = *ruleAggFlag
+	if config.RuleAggInterval <= 0 {
+		log.Fatalf("rule-agg-interval must be positive")
+	}
+	config.SymbolCacheMB = *symbolCacheFlag
+	if config.SymbolCacheMB <= 0 {
+		log.Fatalf("symbol-cache-mb must be positive")
+	}
+	platform.SetSymbolCacheLimit(int64(config.SymbolCacheMB) << 20)
+	for _, name := range strings.Split(*probesFlag, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			config.Probes = append(config.Probes, name)
+		}
+	}
+	config.ProbeRuntime = *probeRuntimeFlag
+	switch config.ProbeRuntime {
+	case agentmanager.ProbeRuntimeAuto, agentmanager.ProbeRuntimeGo, agentmanager.ProbeRuntimeC:
+	default:
+		log.Fatalf("probe-runtime must be auto, go or c")
+	}
+	config.ProbePID = int32(*probePIDFlag)
+	config.ProbeComm = *probeCommFlag
+	config.ProbeStack = *probeStackFlag
+	probeTargets, err := agentmanager.ParseProbeTargets(*probeTargetsFlag)
+	if err != nil {
+		log.Fatalf("Invalid probe-targets: %v", err)
+	}
+	config.ProbeTargets = probeTargets
 
 	// Initialize Redis client
 	redisConfig := redis.Config{
@@ -81,6 +150,15 @@ func main() {
 	}
 	defer subscriber.Close()
 
+	// The socket lives in a directory only the agent (root) and IPC_GROUP can enter
+	ipcGID, err := agentmanager.LookupIPCGroup(config.IPCGroup)
+	if err != nil {
+		log.Fatalf("Invalid ipc-group '%s': %v", config.IPCGroup, err)
+	}
+	if err := agentmanager.SecureIPCDir(config.IPCEndpoint, ipcGID); err != nil {
+		log.Fatalf("Failed to prepare IPC directory: %v", err)
+	}
+
 	fmt.Printf("Go Subscriber binding to %s\n", config.IPCEndpoint)
 
 	err = subscriber.Bind(config.IPCEndpoint)
@@ -88,17 +166,15 @@ func main() {
 		log.Fatalf("Failed to bind subscriber to '%s': %v", config.IPCEndpoint, err)
 	}
 
-	// Set IPC Socket permissions
-	if strings.HasPrefix(config.IPCEndpoint, "ipc://") {
-		socketPath := config.IPCEndpoint[len("ipc://"):] // Get file path
-		// Set permissions to 0666 (owner read/write, group read/write, others read/write)
-		err = os.Chmod(socketPath, 0666)
-		if err != nil {
-			log.Printf("WARN: Failed to change permissions of the IPC socket '%s' to 0666: %v. C clients might fail to connect.", socketPath, err)
-		} else if config.Verbose {
-			fmt.Printf("INFO: Set IPC socket permissions for %s to world-writable (0666)\n", socketPath)
-		}
+	if err := agentmanager.SecureIPCSocket(config.IPCEndpoint, ipcGID); err != nil {
+		log.Fatalf("Failed to set IPC socket permissions: %v", err)
 	}
+	if config.Verbose {
+		fmt.Printf("INFO: IPC socket %s is restricted to gid %d (0660)\n", config.IPCEndpoint, ipcGID)
+	}
+
+	// C loaders started by the agent publish to the endpoint it actually bound
+	os.Setenv(agentmanager.IPCEndpointEnv, config.IPCEndpoint)
 
 	err = subscriber.SetSubscribe("") // Subscribe to all topics
 	if err != nil {
@@ -116,44 +192,134 @@ func main() {
 		numProcessors = 1
 	}
 
+	// Start syscall aggregator goroutine
+	var syscallAgg *agentmanager.SyscallAggregator
+	if config.SyscallAggInterval > 0 {
+		syscallAgg = agentmanager.NewSyscallAggregator(config.SyscallAggInterval)
+		wg.Add(1)
+		go syscallAgg.Run(&wg, config, redisClient)
+	}
+
+	// Load filtering rules and start the rule aggregator goroutine
+	rules, err := agentmanager.NewRuleEngine(config.RulesFile, config.RuleAggInterval)
+	if err != nil {
+		log.Fatalf("Failed to load rules: %v", err)
+	}
+	if config.Verbose {
+		log.Printf("Loaded %d filtering rules", len(rules.Status()))
+	}
+	wg.Add(1)
+	go rules.Aggregator().Run(&wg, config, redisClient)
+
 	// Start processor goroutines
 	wg.Add(numProcessors)
 	for range numProcessors {
-		go agentmanager.Processor(msgChan, &wg, config, redisClient)
+		go agentmanager.Processor(msgChan, &wg, config, redisClient, syscallAgg, rules)
 	}
 
+	// Load the probes; in-process probes feed msgChan directly, the C loaders publish over ZMQ
+	var ipcGuard *agentmanager.IPCGuard
+	if config.IPCVerifyPeer {
+		ipcGuard = agentmanager.NewIPCGuard(config.IPCTrustedUIDs)
+	}
+	probes, err := agentmanager.StartProbes(config, msgChan, &wg, ipcGuard)
+	if err != nil {
+		log.Fatalf("Failed to start probes: %v", err)
+	}
+	defer probes.Close()
+
+	// Start process cache reaper goroutine
+	wg.Add(1)
+	go agentmanager.ProcessReaper(&wg, 2*time.Second, config.Verbose)
+
 	// Start receiver goroutine
 	wg.Add(1)
-	go agentmanager.ZMQReceiver(subscriber, msgChan, &wg)
+	go agentmanager.ZMQReceiver(subscriber, msgChan, &wg, ipcGuard)
 
 	if config.Verbose {
 		fmt.Printf("Starting %d processor goroutines...\n", numProcessors)
 	}
 
 	port := utils.GetEnvOrDefault("AGENT_PORT", "18090")
-	chi := agentmanager.SetupRouter()
+	listenIPs, err := utils.ResolveListenIPs(utils.GetEnvOrDefault("AGENT_BIND", ""))
+	if err != nil {
+		log.Fatalf("Invalid AGENT_BIND: %v", err)
+	}
+	tlsConfig, err := agentmanager.LoadServerTLS(utils.GetEnvOrDefault("AGENT_TLS_CERT", ""),
+		utils.GetEnvOrDefault("AGENT_TLS_KEY", ""), utils.GetEnvOrDefault("AGENT_TLS_CLIENT_CA", ""))
+	if err != nil {
+		log.Fatalf("Invalid agent TLS configuration: %v", err)
+	}
+	apiAuth := agentmanager.NewAPIAuth(time.Duration(utils.GetEnvAsIntOrDefault("AGENT_AUTH_MAX_SKEW_SEC", 60)) * time.Second)
+	chi := agentmanager.SetupRouter(rules, ipcGuard, apiAuth)
+
+	// Only advertise the addresses the API actually listens on
 	myips := utils.GetMyIpAddrs()
+	if len(listenIPs) > 0 {
+		bound := make(map[string]bool, len(listenIPs))
+		for _, ip := range listenIPs {
+			bound[ip] = true
+		}
+		for iface, ip := range myips {
+			if !bound[ip] {
+				delete(myips, iface)
+			}
+		}
+	}
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+	}
 	for _, ip := range myips {
-		log.Printf("Starting agent manager on ip http://%s:%s\n", ip, port)
+		log.Printf("Starting agent manager on ip %s://%s:%s\n", scheme, ip, port)
+	}
+
+	portNum, err := strconv.Atoi(port)
+	if err != nil {
+		log.Fatalf("Invalid AGENT_PORT: %v", err)
+	}
+	centerURL := utils.GetEnvOrDefault("CENTER_URL", "http://localhost:18080")
+	enrollment := agentmanager.Enrollment{
+		CredentialFile: utils.GetEnvOrDefault("NODE_CREDENTIAL_FILE", "/var/lib/scope/node_credential"),
+		JoinToken:      utils.GetEnvOrDefault("JOIN_TOKEN", ""),
+		AllowInsecure:  utils.GetEnvAsBoolOrDefault("CENTER_INSECURE", false),
+	}
+	if err := agentmanager.CheckCenterTransport(centerURL, enrollment.AllowInsecure); err != nil {
+		log.Fatal(err)
 	}
 
 	wg.Add(1)
 	go func(wg *sync.WaitGroup) {
 		defer wg.Done()
-		centerURL := utils.GetEnvOrDefault("CENTER_URL", "http://localhost:18080")
 		for {
-			token, err := agentmanager.RegisterNodeToCenter(centerURL)
+			inventory := agentmanager.CollectInventory(probes)
+			_, err := agentmanager.RegisterNodeToCenter(centerURL, myips, portNum, &inventory, enrollment)
 			if err != nil {
 				log.Printf("Failed to register node to center: %v", err)
 				time.Sleep(5 * time.Second)
 			} else {
-				log.Printf("Successfully registered node to center %s , token: %s", centerURL, token)
+				log.Printf("Successfully registered node to center %s", centerURL)
 				break
 			}
 		}
 	}(&wg)
 
-	log.Fatal(http.ListenAndServe(":"+port, chi))
+	// Push signed heartbeats so the center can tell whether this node is alive without polling it
+	if interval := utils.GetEnvAsIntOrDefault("HEARTBEAT_INTERVAL_SEC", 10); interval > 0 {
+		heartbeat := &agentmanager.Heartbeat{
+			CenterURL:         centerURL,
+			CredentialFile:    enrollment.CredentialFile,
+			Interval:          time.Duration(interval) * time.Second,
+			InventoryInterval: time.Duration(utils.GetEnvAsIntOrDefault("INVENTORY_INTERVAL_SEC", 600)) * time.Second,
+			Probes:            probes,
+			IPC:               ipcGuard,
+			Spool:             msgChan,
+		}
+		wg.Add(1)
+		go heartbeat.Run(&wg)
+	}
+
+	log.Fatal(agentmanager.ListenAndServe(listenIPs, port, chi, tlsConfig))
 
 	// Wait for all goroutines to complete
 	wg.Wait()
@@ -14,6 +14,7 @@ import (
 	"scope/internal/backend"
 	"scope/internal/middleware"
 	"scope/internal/utils"
+	"strings"
 	"sync"
 	"time"
 
@@ -52,6 +53,12 @@ func main() {
 		log.Fatalf("刷新令牌密钥未设置")
 	}
 
+	// 节点凭据加密保存在 Redis 中
+	credentialKey := os.Getenv("AES256_KEY")
+	if credentialKey == "" {
+		log.Fatalf("节点凭据加密密钥 AES256_KEY 未设置")
+	}
+
 	// 创建令牌服务
 	tokenConfig := middleware.TokenConfig{
 		AccessTokenSecret:  accessTokenSecret,
@@ -102,17 +109,62 @@ func main() {
 	tokenService := middleware.NewTokenService(tokenConfig)
 	authService := backend.NewAuthService(userStore, tokenService, tokenStore)
 
+	// 连接 TimescaleDB (事件存储与分析查询)
+	timescaledb, err := postgres.NewDB(dbConfig)
+	if err != nil {
+		log.Fatalf("连接TimescaleDB失败: %v", err)
+	}
+	defer timescaledb.Close()
+
+	initCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := postgres.InitializeTSDBSchema(initCtx, timescaledb); err != nil {
+		log.Fatalf("初始化 TimescaleDB schema 失败: %v", err)
+	}
+
 	// 创建认证处理器
 	redisconfig4node := redisConfig
 	redisconfig4node.DB = 2 // 2 for Node Stroe
 
-	backendHandler := backend.NewHandler(authService, redisconfig4node)
+	// 符号仓库：上传的调试文件和只读的 debuginfod 缓存目录，用于查询时离线解析 kernel 名
+	var symbolSearchDirs []string
+	for _, dir := range strings.Split(utils.GetEnvOrDefault("SYMBOL_SEARCH_DIRS", ""), ",") {
+		if dir = strings.TrimSpace(dir); dir != "" {
+			symbolSearchDirs = append(symbolSearchDirs, dir)
+		}
+	}
+	symbolStore := backend.NewSymbolStore(utils.GetEnvOrDefault("SYMBOL_STORE_DIR", "./symbols"), symbolSearchDirs,
+		int64(utils.GetEnvAsIntOrDefault("SYMBOL_STORE_CACHE_MB", 512))<<20)
+
+	// 调用 agent API 的客户端：请求用节点 token 签名，配置 NODE_TLS_CA 时通过 HTTPS 访问
+	agentClient, err := backend.NewAgentClient(utils.GetEnvOrDefault("NODE_TLS_CA", ""),
+		utils.GetEnvOrDefault("NODE_TLS_CERT", ""), utils.GetEnvOrDefault("NODE_TLS_KEY", ""), 10*time.Second)
+	if err != nil {
+		log.Fatalf("创建 agent 客户端失败: %v", err)
+	}
+
+	// 终止 TLS 的反向代理地址，只有来自这些地址的请求才采信 X-Forwarded-Proto
+	trustedProxies, err := backend.ParseTrustedProxies(utils.GetEnvOrDefault("NODE_TRUSTED_PROXIES", ""))
+	if err != nil {
+		log.Fatalf("解析 NODE_TRUSTED_PROXIES 失败: %v", err)
+	}
+
+	backendHandler := backend.NewHandler(authService, redisconfig4node, timescaledb, symbolStore, backend.NodeOptions{
+		AgentClient:    agentClient,
+		CredentialKey:  credentialKey,
+		HeartbeatGrace: time.Duration(utils.GetEnvAsIntOrDefault("NODE_HEARTBEAT_GRACE_SEC", 30)) * time.Second,
+		AllowInsecure:  utils.GetEnvAsBoolOrDefault("NODE_ALLOW_INSECURE", false),
+		TrustedProxies: trustedProxies,
+	})
+
+	// 管理接口 (加入令牌、删除节点) 要求的管理员密钥，为空时这些接口不可用
+	adminMiddleware := middleware.NewAdminMiddleware(utils.GetEnvOrDefault("ADMIN_TOKEN", ""))
 
 	// 创建认证中间件
 	middleware := middleware.NewAuthMiddleware(tokenService)
 
 	// 设置路由
-	router := backend.SetupRouter(backendHandler, middleware)
+	router := backend.SetupRouter(backendHandler, middleware, adminMiddleware)
 
 	router.Get("/swagger/*", httpSwagger.Handler(
 		httpSwagger.URL("http://localhost:18080/swagger/doc.json"), //The url pointing to API definition
@@ -124,18 +176,6 @@ func main() {
 
 	// 接收Redis Stream 来自 agent
 
-	timescaledb, err := postgres.NewDB(dbConfig)
-	if err != nil {
-		log.Fatalf("连接TimescaleDB失败: %v", err)
-	}
-	defer timescaledb.Close()
-
-	initCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	if err := postgres.InitializeTSDBSchema(initCtx, timescaledb); err != nil {
-		log.Fatalf("初始化 TimescaleDB schema 失败: %v", err)
-	}
-
 	streamConfig := redis.Config{
 		Addr:     utils.GetEnvOrDefault("REDIS_ADDR", "localhost:6379"),
 		Password: utils.GetEnvOrDefault("REDIS_PASSWORD", ""),
@@ -150,23 +190,59 @@ func main() {
 
 	var wg sync.WaitGroup
 
-	// 启动Node Ping Checker
-	wg.Add(1)
-	go backend.NodePingChecker(&wg, backendHandler)
+	// 节点状态由 agent 推送的心跳得出；轮询模式可选，用于不推送心跳的旧版本 agent
+	if pollInterval := utils.GetEnvAsIntOrDefault("NODE_POLL_INTERVAL_SEC", 0); pollInterval > 0 {
+		wg.Add(1)
+		go backend.NodePingChecker(&wg, backendHandler, time.Duration(pollInterval)*time.Second,
+			utils.GetEnvAsIntOrDefault("NODE_AGENT_PORT", 18090),
+			time.Duration(utils.GetEnvAsIntOrDefault("NODE_POLL_TIMEOUT_MS", 2000))*time.Millisecond)
+	}
 
 	var cpunum = runtime.NumCPU() / 2
 	if cpunum < 1 {
 		cpunum = 1
 	}
 
+	// 从历史 execv 事件恢复进程树，之后由 Receive 实时更新
+	bootstrapCtx, cancelBootstrap := context.WithTimeout(context.Background(), time.Minute)
+	if err := backendHandler.BootstrapProcessTree(bootstrapCtx,
+		time.Duration(utils.GetEnvAsIntOrDefault("PROCESS_TREE_BOOTSTRAP_SEC", 86400))*time.Second); err != nil {
+		log.Printf("恢复进程树失败: %v", err)
+	}
+	cancelBootstrap()
+
 	for k := range cpunum {
 		wg.Add(1)
-		go backend.Receive(context.Background(), &wg, timescaledb, streamClient, *verbose, k)
+		go backend.Receive(context.Background(), &wg, timescaledb, streamClient, *verbose, k, backendHandler.EventObservers()...)
 	}
 
 	wg.Add(1)
 	go backend.XDelMessages(context.Background(), streamClient, *verbose)
 
+	// 启动 CUDA 显存泄漏周期检测
+	if interval := utils.GetEnvAsIntOrDefault("CUDA_LEAK_CHECK_INTERVAL_SEC", 300); interval > 0 {
+		wg.Add(1)
+		go backend.CudaMemLeakDetector(context.Background(), &wg, backendHandler,
+			time.Duration(interval)*time.Second,
+			time.Duration(utils.GetEnvAsIntOrDefault("CUDA_LEAK_CHECK_LOOKBACK_SEC", 3600))*time.Second,
+			time.Duration(utils.GetEnvAsIntOrDefault("CUDA_LEAK_MIN_AGE_SEC", 600))*time.Second,
+		)
+	} else {
+		log.Println("CUDA_LEAK_CHECK_INTERVAL_SEC <= 0，不运行 CUDA 显存泄漏检测")
+	}
+
+	// 启动推理会话周期重建
+	if interval := utils.GetEnvAsIntOrDefault("INFERENCE_SESSION_BUILD_INTERVAL_SEC", 60); interval > 0 {
+		wg.Add(1)
+		go backend.InferenceSessionBuilder(context.Background(), &wg, backendHandler,
+			time.Duration(interval)*time.Second,
+			time.Duration(utils.GetEnvAsIntOrDefault("INFERENCE_SESSION_LOOKBACK_SEC", 600))*time.Second,
+			time.Duration(utils.GetEnvAsIntOrDefault("INFERENCE_SESSION_IDLE_GAP_MS", 2000))*time.Millisecond,
+		)
+	} else {
+		log.Println("INFERENCE_SESSION_BUILD_INTERVAL_SEC <= 0，不运行推理会话周期重建")
+	}
+
 	log.Fatal(http.ListenAndServe(serverAddr, router))
 	wg.Wait()
 }
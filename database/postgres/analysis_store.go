@@ -0,0 +1,170 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"scope/internal/models"
+)
+
+// AnalysisStore 负责读写各分析任务的结果表
+type AnalysisStore struct {
+	db *sqlx.DB
+}
+
+// NewAnalysisStore 创建一个新的分析结果存储
+func NewAnalysisStore(db *sqlx.DB) *AnalysisStore {
+	return &AnalysisStore{
+		db: db,
+	}
+}
+
+// ListMachineIDs 返回自 filter.Start 起在 table 中出现过事件的机器 ID
+func (s *AnalysisStore) ListMachineIDs(ctx context.Context, table string, filter EventFilter) ([]string, error) {
+	var ids []string
+	query := fmt.Sprintf(`SELECT DISTINCT machine_id FROM %s WHERE ts >= $1 AND ts < $2`, pq.QuoteIdentifier(table))
+	if err := s.db.SelectContext(ctx, &ids, query, filter.Start, filter.End); err != nil {
+		return nil, fmt.Errorf("查询 %s 的机器列表失败: %w", table, err)
+	}
+	return ids, nil
+}
+
+// InsertCudaMemFindings 写入 CUDA 显存分析结果，已存在的 (machine_id, pid, finding_type, cuda_ptr, ts) 会被忽略
+func (s *AnalysisStore) InsertCudaMemFindings(ctx context.Context, findings []models.CudaMemFinding) error {
+	if len(findings) == 0 {
+		return nil
+	}
+	_, err := s.db.NamedExecContext(ctx, `
+		INSERT INTO cuda_mem_findings (
+			ts, machine_id, pid, comm, cmdline, finding_type, cuda_ptr, cuda_size, age_ns, detected_at
+		) VALUES (
+			:ts, :machine_id, :pid, :comm, :cmdline, :finding_type, :cuda_ptr, :cuda_size, :age_ns, :detected_at
+		) ON CONFLICT DO NOTHING`, findings)
+	if err != nil {
+		return fmt.Errorf("写入 cuda_mem_findings 失败: %w", err)
+	}
+	return nil
+}
+
+// ListCudaMemFindings 查询 CUDA 显存分析结果
+func (s *AnalysisStore) ListCudaMemFindings(ctx context.Context, filter EventFilter) ([]models.CudaMemFinding, error) {
+	var findings []models.CudaMemFinding
+	where, args := filter.where()
+	query := fmt.Sprintf(`
+		SELECT ts, machine_id, pid, COALESCE(comm, '') AS comm, COALESCE(cmdline, '') AS cmdline,
+		       finding_type, cuda_ptr, COALESCE(cuda_size, 0) AS cuda_size, COALESCE(age_ns, 0) AS age_ns, detected_at
+		FROM cuda_mem_findings WHERE %s ORDER BY ts ASC LIMIT %d`, where, filter.limit())
+	if err := s.db.SelectContext(ctx, &findings, query, args...); err != nil {
+		return nil, fmt.Errorf("查询 cuda_mem_findings 失败: %w", err)
+	}
+	return findings, nil
+}
+
+// UpsertInferenceSessions 写入推理会话，同一 (machine_id, pid, ts) 的会话以新结果覆盖
+func (s *AnalysisStore) UpsertInferenceSessions(ctx context.Context, sessions []models.InferenceSession) error {
+	if len(sessions) == 0 {
+		return nil
+	}
+	_, err := s.db.NamedExecContext(ctx, `
+		INSERT INTO inference_sessions (
+			ts, end_ts, machine_id, pid, comm, cmdline, duration_ns, graph_computes, cpu_graph_ns,
+			gpu_matmul_ns, gpu_matmul_calls, memcpy_bytes, memcpy_count, sync_wait_ns, sync_count, log_markers
+		) VALUES (
+			:ts, :end_ts, :machine_id, :pid, :comm, :cmdline, :duration_ns, :graph_computes, :cpu_graph_ns,
+			:gpu_matmul_ns, :gpu_matmul_calls, :memcpy_bytes, :memcpy_count, :sync_wait_ns, :sync_count, :log_markers
+		) ON CONFLICT (machine_id, pid, ts) DO UPDATE SET
+			end_ts = EXCLUDED.end_ts, duration_ns = EXCLUDED.duration_ns, graph_computes = EXCLUDED.graph_computes,
+			cpu_graph_ns = EXCLUDED.cpu_graph_ns, gpu_matmul_ns = EXCLUDED.gpu_matmul_ns,
+			gpu_matmul_calls = EXCLUDED.gpu_matmul_calls, memcpy_bytes = EXCLUDED.memcpy_bytes,
+			memcpy_count = EXCLUDED.memcpy_count, sync_wait_ns = EXCLUDED.sync_wait_ns,
+			sync_count = EXCLUDED.sync_count, log_markers = EXCLUDED.log_markers`, sessions)
+	if err != nil {
+		return fmt.Errorf("写入 inference_sessions 失败: %w", err)
+	}
+	return nil
+}
+
+// ListInferenceSessions 查询开始时间落在过滤范围内的推理会话
+func (s *AnalysisStore) ListInferenceSessions(ctx context.Context, filter EventFilter) ([]models.InferenceSession, error) {
+	var sessions []models.InferenceSession
+	where, args := filter.where()
+	query := fmt.Sprintf(`
+		SELECT ts, end_ts, machine_id, pid, COALESCE(comm, '') AS comm, COALESCE(cmdline, '') AS cmdline,
+		       COALESCE(duration_ns, 0) AS duration_ns, COALESCE(graph_computes, 0) AS graph_computes,
+		       COALESCE(cpu_graph_ns, 0) AS cpu_graph_ns, COALESCE(gpu_matmul_ns, 0) AS gpu_matmul_ns,
+		       COALESCE(gpu_matmul_calls, 0) AS gpu_matmul_calls, COALESCE(memcpy_bytes, 0) AS memcpy_bytes,
+		       COALESCE(memcpy_count, 0) AS memcpy_count, COALESCE(sync_wait_ns, 0) AS sync_wait_ns,
+		       COALESCE(sync_count, 0) AS sync_count, COALESCE(log_markers, 0) AS log_markers
+		FROM inference_sessions WHERE %s ORDER BY ts ASC LIMIT %d`, where, filter.limit())
+	if err := s.db.SelectContext(ctx, &sessions, query, args...); err != nil {
+		return nil, fmt.Errorf("查询 inference_sessions 失败: %w", err)
+	}
+	return sessions, nil
+}
+
+// UpsertLLMTokenMetrics 写入推理请求的 token 指标，同一 (machine_id, pid, ts) 以新结果覆盖
+func (s *AnalysisStore) UpsertLLMTokenMetrics(ctx context.Context, metrics []models.LLMTokenMetrics) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	_, err := s.db.NamedExecContext(ctx, `
+		INSERT INTO llm_token_metrics (
+			ts, end_ts, machine_id, pid, comm, cmdline, prefill_steps, prefill_ns, ttft_ns, decode_tokens,
+			decode_ns, tokens_per_sec, itl_avg_ns, itl_p50_ns, itl_p95_ns, itl_max_ns
+		) VALUES (
+			:ts, :end_ts, :machine_id, :pid, :comm, :cmdline, :prefill_steps, :prefill_ns, :ttft_ns, :decode_tokens,
+			:decode_ns, :tokens_per_sec, :itl_avg_ns, :itl_p50_ns, :itl_p95_ns, :itl_max_ns
+		) ON CONFLICT (machine_id, pid, ts) DO UPDATE SET
+			end_ts = EXCLUDED.end_ts, prefill_steps = EXCLUDED.prefill_steps, prefill_ns = EXCLUDED.prefill_ns,
+			ttft_ns = EXCLUDED.ttft_ns, decode_tokens = EXCLUDED.decode_tokens, decode_ns = EXCLUDED.decode_ns,
+			tokens_per_sec = EXCLUDED.tokens_per_sec, itl_avg_ns = EXCLUDED.itl_avg_ns,
+			itl_p50_ns = EXCLUDED.itl_p50_ns, itl_p95_ns = EXCLUDED.itl_p95_ns, itl_max_ns = EXCLUDED.itl_max_ns`, metrics)
+	if err != nil {
+		return fmt.Errorf("写入 llm_token_metrics 失败: %w", err)
+	}
+	return nil
+}
+
+// ListLLMTokenMetrics 查询开始时间落在过滤范围内的请求级 token 指标
+func (s *AnalysisStore) ListLLMTokenMetrics(ctx context.Context, filter EventFilter) ([]models.LLMTokenMetrics, error) {
+	var metrics []models.LLMTokenMetrics
+	where, args := filter.where()
+	query := fmt.Sprintf(`
+		SELECT ts, end_ts, machine_id, pid, COALESCE(comm, '') AS comm, COALESCE(cmdline, '') AS cmdline,
+		       COALESCE(prefill_steps, 0) AS prefill_steps, COALESCE(prefill_ns, 0) AS prefill_ns,
+		       COALESCE(ttft_ns, 0) AS ttft_ns, COALESCE(decode_tokens, 0) AS decode_tokens,
+		       COALESCE(decode_ns, 0) AS decode_ns, COALESCE(tokens_per_sec, 0) AS tokens_per_sec,
+		       COALESCE(itl_avg_ns, 0) AS itl_avg_ns, COALESCE(itl_p50_ns, 0) AS itl_p50_ns,
+		       COALESCE(itl_p95_ns, 0) AS itl_p95_ns, COALESCE(itl_max_ns, 0) AS itl_max_ns
+		FROM llm_token_metrics WHERE %s ORDER BY ts ASC LIMIT %d`, where, filter.limit())
+	if err := s.db.SelectContext(ctx, &metrics, query, args...); err != nil {
+		return nil, fmt.Errorf("查询 llm_token_metrics 失败: %w", err)
+	}
+	return metrics, nil
+}
+
+// LLMTokenMetricsSeries 按 pid 和时间桶汇总请求级 token 指标
+func (s *AnalysisStore) LLMTokenMetricsSeries(ctx context.Context, filter EventFilter, bucket time.Duration) ([]models.LLMTokenMetricsBucket, error) {
+	var series []models.LLMTokenMetricsBucket
+	where, args := filter.where()
+	args = append(args, fmt.Sprintf("%d microseconds", bucket.Microseconds()))
+	query := fmt.Sprintf(`
+		SELECT time_bucket($%d::interval, ts) AS ts, pid, MAX(COALESCE(comm, '')) AS comm,
+		       COUNT(*) AS requests,
+		       COALESCE(SUM(decode_tokens), 0) AS decode_tokens,
+		       COALESCE(SUM(decode_tokens) * 1e9 / NULLIF(SUM(decode_ns), 0), 0) AS tokens_per_sec,
+		       COALESCE(AVG(ttft_ns), 0)::BIGINT AS ttft_avg_ns,
+		       COALESCE(MAX(ttft_ns), 0) AS ttft_max_ns,
+		       COALESCE(SUM(decode_ns) / NULLIF(SUM(decode_tokens), 0), 0)::BIGINT AS itl_avg_ns,
+		       COALESCE(MAX(itl_p95_ns), 0) AS itl_p95_max_ns
+		FROM llm_token_metrics WHERE %s
+		GROUP BY 1, pid ORDER BY 1 ASC, pid ASC LIMIT %d`, len(args), where, filter.limit())
+	if err := s.db.SelectContext(ctx, &series, query, args...); err != nil {
+		return nil, fmt.Errorf("查询 llm_token_metrics 时间序列失败: %w", err)
+	}
+	return series, nil
+}
@@ -0,0 +1,404 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"scope/internal/models"
+)
+
+// maxEventRows 单次查询返回的最大行数，防止一次性把整个 hypertable 读入内存
+const maxEventRows = 500000
+
+// ErrTooManyEvents 表示窗口内的事件超过了单次查询的行数上限，结果只包含按时间升序的前 limit 行
+var ErrTooManyEvents = errors.New("窗口内的事件数超过单次查询上限，请缩小时间范围或增加过滤条件")
+
+// EventFilter 描述对事件表的通用过滤条件
+type EventFilter struct {
+	MachineID string    // 必填，机器 ID
+	PIDs      []int32   // 为空表示不过滤 pid
+	Subtypes  []string  // 为空表示不过滤 event_subtype
+	Start     time.Time // 起始时间 (含)
+	End       time.Time // 结束时间 (不含)
+	Limit     int       // <= 0 时使用 maxEventRows
+
+	// 容器过滤条件，只适用于带有容器字段的表 (events_*, syscall_rollups, event_rollups)
+	ContainerIDs []string // 为空表示不过滤 container_id，可以是完整 ID 或前缀 (如 12 位短 ID)
+	Cgroup       string   // cgroup 路径前缀，为空表示不过滤
+	PodUID       string   // 为空表示不过滤 pod_uid
+}
+
+// where 根据过滤条件生成 WHERE 子句及其参数
+func (f EventFilter) where() (string, []interface{}) {
+	conds := []string{"machine_id = $1", "ts >= $2", "ts < $3"}
+	args := []interface{}{f.MachineID, f.Start, f.End}
+
+	if len(f.PIDs) > 0 {
+		args = append(args, pq.Array(f.PIDs))
+		conds = append(conds, fmt.Sprintf("pid = ANY($%d)", len(args)))
+	}
+	if len(f.Subtypes) > 0 {
+		args = append(args, pq.Array(f.Subtypes))
+		conds = append(conds, fmt.Sprintf("event_subtype = ANY($%d)", len(args)))
+	}
+	if len(f.ContainerIDs) > 0 {
+		// docker ps 等工具显示 12 位短 ID，按前缀匹配。容器 ID 为十六进制，不含 LIKE 的通配符
+		patterns := make([]string, 0, len(f.ContainerIDs))
+		for _, id := range f.ContainerIDs {
+			patterns = append(patterns, id+"%")
+		}
+		args = append(args, pq.Array(patterns))
+		conds = append(conds, fmt.Sprintf("container_id LIKE ANY($%d)", len(args)))
+	}
+	if f.Cgroup != "" {
+		args = append(args, f.Cgroup)
+		conds = append(conds, fmt.Sprintf("left(cgroup, length($%d)) = $%d", len(args), len(args)))
+	}
+	if f.PodUID != "" {
+		args = append(args, f.PodUID)
+		conds = append(conds, fmt.Sprintf("pod_uid = $%d", len(args)))
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// HasContainerFilter 返回是否设置了容器相关的过滤条件
+func (f EventFilter) HasContainerFilter() bool {
+	return len(f.ContainerIDs) > 0 || f.Cgroup != "" || f.PodUID != ""
+}
+
+func (f EventFilter) limit() int {
+	if f.Limit <= 0 || f.Limit > maxEventRows {
+		return maxEventRows
+	}
+	return f.Limit
+}
+
+const (
+	selectOSEventsSQL = `
+SELECT ts, machine_id, event_subtype, pid,
+       COALESCE(comm, '') AS comm, COALESCE(cmdline, '') AS cmdline, COALESCE(proc_uid, '') AS proc_uid,
+       COALESCE(container_id, '') AS container_id, COALESCE(cgroup, '') AS cgroup, COALESCE(pod_uid, '') AS pod_uid,
+       COALESCE(uid, -1) AS uid, COALESCE(euid, -1) AS euid, COALESCE(gid, -1) AS gid, COALESCE(username, '') AS username,
+       COALESCE(mnt_ns, 0) AS mnt_ns, COALESCE(pid_ns, 0) AS pid_ns, COALESCE(exe_path, '') AS exe_path,
+       COALESCE(exe_inode, 0) AS exe_inode, COALESCE(exe_build_id, '') AS exe_build_id, COALESCE(exe_deleted, false) AS exe_deleted,
+       COALESCE(vfs_filename, '') AS vfs_filename, COALESCE(syscall_name, '') AS syscall_name,
+       COALESCE(cpu, -1) AS cpu, COALESCE(sched_type, '') AS sched_type, COALESCE(tgid, pid) AS tgid,
+       COALESCE(ppid, 0) AS ppid, COALESCE(ppid_comm, '') AS ppid_comm, COALESCE(ppid_cmdline, '') AS ppid_cmdline,
+       COALESCE(exec_filename, '') AS exec_filename, COALESCE(exec_args, '') AS exec_args
+FROM events_os`
+
+	selectCudaEventsSQL = `
+SELECT ts, machine_id, event_subtype, pid,
+       COALESCE(comm, '') AS comm, COALESCE(cmdline, '') AS cmdline, COALESCE(proc_uid, '') AS proc_uid,
+       COALESCE(container_id, '') AS container_id, COALESCE(cgroup, '') AS cgroup, COALESCE(pod_uid, '') AS pod_uid,
+       COALESCE(uid, -1) AS uid, COALESCE(euid, -1) AS euid, COALESCE(gid, -1) AS gid, COALESCE(username, '') AS username,
+       COALESCE(mnt_ns, 0) AS mnt_ns, COALESCE(pid_ns, 0) AS pid_ns, COALESCE(exe_path, '') AS exe_path,
+       COALESCE(exe_inode, 0) AS exe_inode, COALESCE(exe_build_id, '') AS exe_build_id, COALESCE(exe_deleted, false) AS exe_deleted,
+       COALESCE(operation, '') AS operation,
+       COALESCE(cuda_ptr, 0) AS cuda_ptr, COALESCE(cuda_size, 0) AS cuda_size, COALESCE(cuda_retval, 0) AS cuda_retval,
+       COALESCE(cuda_func_ptr, 0) AS cuda_func_ptr, COALESCE(cuda_symbol_name, '') AS cuda_symbol_name,
+       COALESCE(cuda_symbol_file, '') AS cuda_symbol_file, COALESCE(cuda_symbol_offset, 0) AS cuda_symbol_offset,
+       COALESCE(cuda_symbol_sourcefile, '') AS cuda_symbol_sourcefile,
+       COALESCE(cuda_symbol_build_id, '') AS cuda_symbol_build_id, COALESCE(cuda_symbol_addr, 0) AS cuda_symbol_addr,
+       COALESCE(cuda_memcpy_src, 0) AS cuda_memcpy_src, COALESCE(cuda_memcpy_dst, 0) AS cuda_memcpy_dst,
+       COALESCE(cuda_memcpy_kind, 0) AS cuda_memcpy_kind, COALESCE(cuda_memcpy_type, '') AS cuda_memcpy_type,
+       COALESCE(cuda_memcpy_duration_ns, 0) AS cuda_memcpy_duration_ns,
+       COALESCE(cuda_sync_duration_ns, 0) AS cuda_sync_duration_ns
+FROM events_cuda`
+
+	selectGGMLEventsSQL = `
+SELECT ts, machine_id, event_subtype, pid,
+       COALESCE(comm, '') AS comm, COALESCE(cmdline, '') AS cmdline, COALESCE(proc_uid, '') AS proc_uid,
+       COALESCE(container_id, '') AS container_id, COALESCE(cgroup, '') AS cgroup, COALESCE(pod_uid, '') AS pod_uid,
+       COALESCE(uid, -1) AS uid, COALESCE(euid, -1) AS euid, COALESCE(gid, -1) AS gid, COALESCE(username, '') AS username,
+       COALESCE(mnt_ns, 0) AS mnt_ns, COALESCE(pid_ns, 0) AS pid_ns, COALESCE(exe_path, '') AS exe_path,
+       COALESCE(exe_inode, 0) AS exe_inode, COALESCE(exe_build_id, '') AS exe_build_id, COALESCE(exe_deleted, false) AS exe_deleted,
+       COALESCE(operation, '') AS operation,
+       COALESCE(ggml_cuda_func_name, '') AS ggml_cuda_func_name, COALESCE(ggml_cuda_duration_ns, 0) AS ggml_cuda_duration_ns,
+       COALESCE(ggml_graph_size, 0) AS ggml_graph_size, COALESCE(ggml_graph_nodes, 0) AS ggml_graph_nodes,
+       COALESCE(ggml_graph_leafs, 0) AS ggml_graph_leafs, COALESCE(ggml_graph_order, '') AS ggml_graph_order,
+       COALESCE(ggml_cost_ns, 0) AS ggml_cost_ns,
+       COALESCE(ggml_mem_size, 0) AS ggml_mem_size, COALESCE(ggml_mem_ptr, 0) AS ggml_mem_ptr
+FROM events_ggml`
+
+	selectAppLogEventsSQL = `
+SELECT ts, machine_id, event_subtype, pid,
+       COALESCE(comm, '') AS comm, COALESCE(cmdline, '') AS cmdline, COALESCE(proc_uid, '') AS proc_uid,
+       COALESCE(container_id, '') AS container_id, COALESCE(cgroup, '') AS cgroup, COALESCE(pod_uid, '') AS pod_uid,
+       COALESCE(uid, -1) AS uid, COALESCE(euid, -1) AS euid, COALESCE(gid, -1) AS gid, COALESCE(username, '') AS username,
+       COALESCE(mnt_ns, 0) AS mnt_ns, COALESCE(pid_ns, 0) AS pid_ns, COALESCE(exe_path, '') AS exe_path,
+       COALESCE(exe_inode, 0) AS exe_inode, COALESCE(exe_build_id, '') AS exe_build_id, COALESCE(exe_deleted, false) AS exe_deleted,
+       COALESCE(log_text, '') AS log_text
+FROM events_app_log`
+)
+
+// EventStore 提供对 TimescaleDB 事件表的只读查询
+type EventStore struct {
+	db *sqlx.DB
+}
+
+// NewEventStore 创建一个新的事件查询存储
+func NewEventStore(db *sqlx.DB) *EventStore {
+	return &EventStore{
+		db: db,
+	}
+}
+
+// selectEvents 执行 selectSQL + 过滤条件，并按时间升序返回结果
+func (s *EventStore) selectEvents(ctx context.Context, dest interface{}, selectSQL string, filter EventFilter) error {
+	where, args := filter.where()
+	return s.selectLimited(ctx, dest, fmt.Sprintf("%s WHERE %s", selectSQL, where), args, filter.limit())
+}
+
+// selectLimited 按时间升序最多读取 limit 行到 dest (指向切片的指针)。多读一行用于判断结果是否被截断，
+// 截断时 dest 中保留前 limit 行并返回 ErrTooManyEvents
+func (s *EventStore) selectLimited(ctx context.Context, dest interface{}, query string, args []interface{}, limit int) error {
+	query = fmt.Sprintf("%s ORDER BY ts ASC LIMIT %d", query, limit+1)
+	if err := s.db.SelectContext(ctx, dest, query, args...); err != nil {
+		return err
+	}
+	rows := reflect.ValueOf(dest).Elem()
+	if rows.Len() > limit {
+		rows.Set(rows.Slice(0, limit))
+		return ErrTooManyEvents
+	}
+	return nil
+}
+
+// ListOSEvents 查询 events_os 表，超过行数上限时返回前 limit 行和 ErrTooManyEvents
+func (s *EventStore) ListOSEvents(ctx context.Context, filter EventFilter) ([]models.OSEvent, error) {
+	var events []models.OSEvent
+	err := s.selectEvents(ctx, &events, selectOSEventsSQL, filter)
+	if err != nil && !errors.Is(err, ErrTooManyEvents) {
+		return nil, fmt.Errorf("查询 events_os 失败: %w", err)
+	}
+	return events, err
+}
+
+// ListCudaEvents 查询 events_cuda 表，超过行数上限时返回前 limit 行和 ErrTooManyEvents
+func (s *EventStore) ListCudaEvents(ctx context.Context, filter EventFilter) ([]models.CudaEvent, error) {
+	var events []models.CudaEvent
+	err := s.selectEvents(ctx, &events, selectCudaEventsSQL, filter)
+	if err != nil && !errors.Is(err, ErrTooManyEvents) {
+		return nil, fmt.Errorf("查询 events_cuda 失败: %w", err)
+	}
+	return events, err
+}
+
+// ListGGMLEvents 查询 events_ggml 表，超过行数上限时返回前 limit 行和 ErrTooManyEvents
+func (s *EventStore) ListGGMLEvents(ctx context.Context, filter EventFilter) ([]models.GGMLEvent, error) {
+	var events []models.GGMLEvent
+	err := s.selectEvents(ctx, &events, selectGGMLEventsSQL, filter)
+	if err != nil && !errors.Is(err, ErrTooManyEvents) {
+		return nil, fmt.Errorf("查询 events_ggml 失败: %w", err)
+	}
+	return events, err
+}
+
+// ListAppLogEvents 查询 events_app_log 表，超过行数上限时返回前 limit 行和 ErrTooManyEvents
+func (s *EventStore) ListAppLogEvents(ctx context.Context, filter EventFilter) ([]models.AppLogEvent, error) {
+	var events []models.AppLogEvent
+	err := s.selectEvents(ctx, &events, selectAppLogEventsSQL, filter)
+	if err != nil && !errors.Is(err, ErrTooManyEvents) {
+		return nil, fmt.Errorf("查询 events_app_log 失败: %w", err)
+	}
+	return events, err
+}
+
+// cudaKernelNameSQL 在符号无法解析时以 kernel 函数地址作为名字，带有 build-id 的由后端查询时从符号仓库解析
+const cudaKernelNameSQL = `COALESCE(NULLIF(cuda_symbol_name, ''), '0x' || to_hex(COALESCE(cuda_func_ptr, 0)))`
+
+// CudaKernelStats 按 pid、kernel 和所在库统计 cudaLaunchKernel 次数
+func (s *EventStore) CudaKernelStats(ctx context.Context, filter EventFilter) ([]models.CudaKernelStat, error) {
+	var stats []models.CudaKernelStat
+	filter.Subtypes = []string{models.CudaLaunchKernelTopic}
+	where, args := filter.where()
+	query := fmt.Sprintf(`
+		SELECT pid, MAX(COALESCE(comm, '')) AS comm, %s AS symbol_name,
+		       COALESCE(cuda_symbol_file, '') AS symbol_file, COALESCE(cuda_symbol_build_id, '') AS build_id,
+		       COALESCE(cuda_symbol_addr, 0) AS symbol_addr, COUNT(*) AS launches
+		FROM events_cuda WHERE %s
+		GROUP BY pid, 3, 4, 5, 6 ORDER BY launches DESC LIMIT %d`, cudaKernelNameSQL, where, filter.limit())
+	if err := s.db.SelectContext(ctx, &stats, query, args...); err != nil {
+		return nil, fmt.Errorf("统计 cudaLaunchKernel 失败: %w", err)
+	}
+	return stats, nil
+}
+
+// CudaKernelTimeline 按时间桶、pid 和 kernel 统计 cudaLaunchKernel 次数
+func (s *EventStore) CudaKernelTimeline(ctx context.Context, filter EventFilter, bucket time.Duration) ([]models.CudaKernelSample, error) {
+	var samples []models.CudaKernelSample
+	filter.Subtypes = []string{models.CudaLaunchKernelTopic}
+	where, args := filter.where()
+	args = append(args, fmt.Sprintf("%d microseconds", bucket.Microseconds()))
+	query := fmt.Sprintf(`
+		SELECT time_bucket($%d::interval, ts) AS ts, pid, %s AS symbol_name,
+		       COALESCE(cuda_symbol_build_id, '') AS build_id, COALESCE(cuda_symbol_addr, 0) AS symbol_addr, COUNT(*) AS launches
+		FROM events_cuda WHERE %s
+		GROUP BY 1, pid, 3, 4, 5 ORDER BY 1 ASC LIMIT %d`, len(args), cudaKernelNameSQL, where, filter.limit())
+	if err := s.db.SelectContext(ctx, &samples, query, args...); err != nil {
+		return nil, fmt.Errorf("查询 cudaLaunchKernel 时间线失败: %w", err)
+	}
+	return samples, nil
+}
+
+// stackSources 是可以统计调用栈的操作：表、event_subtype、ggml 的 operation 以及分配大小的列
+var stackSources = map[string]struct {
+	table, subtype, operation, size string
+}{
+	models.CudaMallocTopic:       {"events_cuda", models.CudaMallocTopic, "", "cuda_size"},
+	models.CudaLaunchKernelTopic: {"events_cuda", models.CudaLaunchKernelTopic, "", "0"},
+	"ggml_aligned_malloc":        {"events_ggml", models.GGMLBaseTopic, "ggml_aligned_malloc", "ggml_mem_size"},
+}
+
+// IsStackOperation 返回 operation 是否带有调用栈 (见 StackCounts)
+func IsStackOperation(operation string) bool {
+	_, ok := stackSources[operation]
+	return ok
+}
+
+// StackCounts 按 pid 和调用栈统计 operation 的事件数和分配字节数，只包含探针采集了调用栈的事件
+func (s *EventStore) StackCounts(ctx context.Context, filter EventFilter, operation string) ([]models.StackCount, error) {
+	src, ok := stackSources[operation]
+	if !ok {
+		return nil, fmt.Errorf("不支持调用栈统计的操作: %s", operation)
+	}
+	filter.Subtypes = []string{src.subtype}
+	where, args := filter.where()
+	if src.operation != "" {
+		args = append(args, src.operation)
+		where += fmt.Sprintf(" AND operation = $%d", len(args))
+	}
+	query := fmt.Sprintf(`
+		SELECT pid, MAX(COALESCE(comm, '')) AS comm, stack, COUNT(*) AS count, COALESCE(SUM(%s), 0)::BIGINT AS bytes
+		FROM %s WHERE %s AND stack IS NOT NULL
+		GROUP BY pid, stack ORDER BY count DESC LIMIT %d`, src.size, src.table, where, filter.limit())
+	var rows []struct {
+		PID   int32          `db:"pid"`
+		Comm  string         `db:"comm"`
+		Stack pq.StringArray `db:"stack"`
+		Count int64          `db:"count"`
+		Bytes int64          `db:"bytes"`
+	}
+	if err := s.db.SelectContext(ctx, &rows, query, args...); err != nil {
+		return nil, fmt.Errorf("统计 %s 调用栈失败: %w", operation, err)
+	}
+	counts := make([]models.StackCount, 0, len(rows))
+	for _, row := range rows {
+		counts = append(counts, models.StackCount{PID: row.PID, Comm: row.Comm, Stack: row.Stack, Count: row.Count, Bytes: row.Bytes})
+	}
+	return counts, nil
+}
+
+// ListSchedEvents 查询 sched 事件。sched 的 pid 是线程 ID，因此 filter.PIDs 按所属进程 (tgid) 过滤，
+// 旧数据没有 tgid 时退化为按 pid 过滤。超过行数上限时返回前 limit 行和 ErrTooManyEvents
+func (s *EventStore) ListSchedEvents(ctx context.Context, filter EventFilter) ([]models.OSEvent, error) {
+	var events []models.OSEvent
+	pids := filter.PIDs
+	filter.PIDs = nil
+	filter.Subtypes = []string{models.SchedTopic}
+	where, args := filter.where()
+	if len(pids) > 0 {
+		args = append(args, pq.Array(pids))
+		where += fmt.Sprintf(" AND COALESCE(tgid, pid) = ANY($%d)", len(args))
+	}
+	err := s.selectLimited(ctx, &events, fmt.Sprintf("%s WHERE %s", selectOSEventsSQL, where), args, filter.limit())
+	if err != nil && !errors.Is(err, ErrTooManyEvents) {
+		return nil, fmt.Errorf("查询 sched 事件失败: %w", err)
+	}
+	return events, err
+}
+
+// SyscallCounts 按 pid 和系统调用汇总 syscall_rollups
+func (s *EventStore) SyscallCounts(ctx context.Context, filter EventFilter) ([]models.SyscallCount, error) {
+	var counts []models.SyscallCount
+	where, args := filter.where()
+	query := fmt.Sprintf(`
+		SELECT pid, MAX(COALESCE(comm, '')) AS comm, syscall_name, SUM(count)::BIGINT AS count
+		FROM syscall_rollups WHERE %s
+		GROUP BY pid, syscall_name ORDER BY count DESC LIMIT %d`, where, filter.limit())
+	if err := s.db.SelectContext(ctx, &counts, query, args...); err != nil {
+		return nil, fmt.Errorf("统计系统调用失败: %w", err)
+	}
+	return counts, nil
+}
+
+// SyscallCountsByComm 按进程名和系统调用汇总 syscall_rollups，用于跨 pid 的历史基线。
+// filter.PIDs 被忽略，comms 为空时不过滤进程名。
+func (s *EventStore) SyscallCountsByComm(ctx context.Context, filter EventFilter, comms []string) ([]models.SyscallCount, error) {
+	var counts []models.SyscallCount
+	filter.PIDs = nil
+	where, args := filter.where()
+	if len(comms) > 0 {
+		args = append(args, pq.Array(comms))
+		where += fmt.Sprintf(" AND comm = ANY($%d)", len(args))
+	}
+	query := fmt.Sprintf(`
+		SELECT 0 AS pid, COALESCE(comm, '') AS comm, syscall_name, SUM(count)::BIGINT AS count
+		FROM syscall_rollups WHERE %s
+		GROUP BY 2, syscall_name ORDER BY count DESC LIMIT %d`, where, filter.limit())
+	if err := s.db.SelectContext(ctx, &counts, query, args...); err != nil {
+		return nil, fmt.Errorf("统计系统调用基线失败: %w", err)
+	}
+	return counts, nil
+}
+
+// SyscallTimeline 按时间桶、pid 和系统调用汇总 syscall_rollups。
+// 汇总周期大于 bucket 时，一个周期的次数全部计入其开始时间所在的桶。
+func (s *EventStore) SyscallTimeline(ctx context.Context, filter EventFilter, bucket time.Duration) ([]models.SyscallSample, error) {
+	var samples []models.SyscallSample
+	where, args := filter.where()
+	args = append(args, fmt.Sprintf("%d microseconds", bucket.Microseconds()))
+	query := fmt.Sprintf(`
+		SELECT time_bucket($%d::interval, ts) AS ts, pid, syscall_name, SUM(count)::BIGINT AS count
+		FROM syscall_rollups WHERE %s
+		GROUP BY 1, pid, syscall_name ORDER BY 1 ASC LIMIT %d`, len(args), where, filter.limit())
+	if err := s.db.SelectContext(ctx, &samples, query, args...); err != nil {
+		return nil, fmt.Errorf("查询系统调用时间线失败: %w", err)
+	}
+	return samples, nil
+}
+
+// FilePathFilter 描述对 vfs_open 文件路径的过滤条件，空字段表示不过滤
+type FilePathFilter struct {
+	Path   string // 精确匹配
+	Prefix string // 路径前缀
+	Regex  string // POSIX 正则表达式
+}
+
+// FileAccessStats 按 pid 和文件路径统计 vfs_open 次数及首次/最后一次打开时间
+func (s *EventStore) FileAccessStats(ctx context.Context, filter EventFilter, paths FilePathFilter) ([]models.FileAccessStat, error) {
+	var stats []models.FileAccessStat
+	filter.Subtypes = []string{models.VfsOpenTopic}
+	where, args := filter.where()
+	where += " AND vfs_filename IS NOT NULL"
+	if paths.Path != "" {
+		args = append(args, paths.Path)
+		where += fmt.Sprintf(" AND vfs_filename = $%d", len(args))
+	}
+	if paths.Prefix != "" {
+		// 使用 left() 而不是 LIKE，避免转义前缀中的 % 和 _
+		args = append(args, paths.Prefix)
+		where += fmt.Sprintf(" AND left(vfs_filename, length($%d)) = $%d", len(args), len(args))
+	}
+	if paths.Regex != "" {
+		args = append(args, paths.Regex)
+		where += fmt.Sprintf(" AND vfs_filename ~ $%d", len(args))
+	}
+	query := fmt.Sprintf(`
+		SELECT pid, MAX(COALESCE(comm, '')) AS comm, MAX(COALESCE(cmdline, '')) AS cmdline,
+		       vfs_filename AS path, COUNT(*) AS opens, MIN(ts) AS first_ts, MAX(ts) AS last_ts
+		FROM events_os WHERE %s
+		GROUP BY pid, vfs_filename ORDER BY opens DESC LIMIT %d`, where, filter.limit())
+	if err := s.db.SelectContext(ctx, &stats, query, args...); err != nil {
+		return nil, fmt.Errorf("统计 vfs_open 失败: %w", err)
+	}
+	return stats, nil
+}
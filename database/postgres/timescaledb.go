@@ -20,6 +20,20 @@ CREATE TABLE events_os (
     pid INT,                          -- 进程 ID
     comm TEXT,                        -- 进程名
     cmdline TEXT,                     -- 完整命令行
+    proc_uid TEXT,                    -- 进程标识 machine_id:pid:启动时间(ns)，pid 复用后不同
+    container_id TEXT,                -- 容器 ID (来自 /proc/<pid>/cgroup，不在容器中时为 NULL)
+    cgroup TEXT,                      -- 进程所在的 cgroup 路径
+    pod_uid TEXT,                     -- Kubernetes pod UID (仅 kubelet 的 cgroup 布局可识别)
+    uid INT,                          -- 进程的真实 UID / 有效 UID / 真实 GID (来自 /proc/<pid>/status)
+    euid INT,
+    gid INT,
+    username TEXT,                    -- 按 agent 主机用户数据库解析的用户名
+    mnt_ns BIGINT,                    -- mount 命名空间 inode
+    pid_ns BIGINT,                    -- pid 命名空间 inode
+    exe_path TEXT,                    -- /proc/<pid>/exe 指向的可执行文件路径
+    exe_inode BIGINT,                 -- 可执行文件的 inode
+    exe_build_id TEXT,                -- 可执行文件的 GNU build-id
+    exe_deleted BOOLEAN,              -- 可执行文件在进程启动后已被删除或替换
 
     -- vfs_open 特定字段 (来自 eventData["filename"])
     vfs_filename TEXT,
@@ -29,6 +43,7 @@ CREATE TABLE events_os (
 
     -- sched 特定字段 (来自 eventData["cpu"], eventData["type"])
     cpu INT,                          -- 调度 CPU ID
+    tgid INT,                         -- sched 事件中 pid 为线程 ID，tgid 为所属进程 ID
     sched_type TEXT,                  -- 调度类型 ('switch_in', 'switch_out', 'unknown') - 使用 TEXT
 
     -- execv 特定字段 (来自 eventData["ppid*"], eventData["filename"], eventData["args"])
@@ -51,7 +66,7 @@ CREATE INDEX ix_events_os_pid_ts ON events_os (pid, ts DESC);
 **2. CUDA/GPU 通用事件表 (`events_cuda`)**
 
 *   **包含事件 Topics:** `cudaMalloc`, `cudaFree`, `cudaLaunchKernel`, `cudaMemcpy`, `cudaDeviceSynchronize`
-*   **对应 `eventData` 关键字段:** `topic` (->`event_subtype`), `timestamp`, `pid`, `comm`, `cmdline`, `machineid`, `operation` (cudaOperation), `ptr` (cudaMalloc/Free), `size` (Malloc/Memcpy), `retval`, `func_ptr`, `symbol_*`, `src`, `dst`, `kind`, `type` (Memcpy), `duration_ns` (Sync)
+*   **对应 `eventData` 关键字段:** `topic` (->`event_subtype`), `timestamp`, `pid`, `comm`, `cmdline`, `machineid`, `operation` (cudaOperation), `ptr` (cudaMalloc/Free), `size` (Malloc/Memcpy), `retval`, `func_ptr`, `symbol_*`, `src`, `dst`, `kind`, `type` (Memcpy), `duration_ns` (Memcpy/Sync)
 *   **SQL 定义:**
 
 ```sql
@@ -78,15 +93,21 @@ CREATE TABLE events_cuda (
     cuda_symbol_file TEXT,            -- 符号所在文件
     cuda_symbol_offset BIGINT,        -- 符号偏移 - Use BIGINT for uint64/offset
     cuda_symbol_sourcefile TEXT,      -- 源码位置 (e.g., "file.cu:123")
+    cuda_symbol_build_id TEXT,        -- 符号所在文件的 GNU build-id，用于在后端离线解析
+    cuda_symbol_addr BIGINT,          -- 核函数入口在 ELF 中的虚拟地址
 
     -- cudaMemcpy 特定字段
     cuda_memcpy_src BIGINT,           -- 源地址 (重命名自 eventData["src"]) - Use BIGINT for uint64
     cuda_memcpy_dst BIGINT,           -- 目标地址 (重命名自 eventData["dst"]) - Use BIGINT for uint64
     cuda_memcpy_kind INT,             -- 原始拷贝类型 (来自 eventData["kind"])
     cuda_memcpy_type TEXT,            -- 人类可读拷贝类型 (来自 eventData["type"])
+    cuda_memcpy_duration_ns BIGINT,   -- 拷贝耗时 (cudaMemcpy 的 eventData["duration_ns"])
 
     -- cudaDeviceSynchronize 特定字段
-    cuda_sync_duration_ns BIGINT      -- 同步耗时 (重命名自 eventData["duration_ns"])
+    cuda_sync_duration_ns BIGINT,     -- 同步耗时 (cudaDeviceSynchronize 的 eventData["duration_ns"])
+
+    -- 用户态调用栈 (cudaMalloc / cudaLaunchKernel，探针开启 -s 时)，从栈顶到栈底，每帧为函数名或 "文件名+0x偏移"
+    stack TEXT[]
 );
 
 -- 转换为 Hypertable
@@ -134,7 +155,10 @@ CREATE TABLE events_ggml (
 
     -- ggml_base 特定字段 (来自 eventData["size"], eventData["ptr"])
     ggml_mem_size BIGINT,             -- (重命名 size) - Use BIGINT for uint64
-    ggml_mem_ptr BIGINT               -- (重命名 ptr) - Use BIGINT for uint64
+    ggml_mem_ptr BIGINT,              -- (重命名 ptr) - Use BIGINT for uint64
+
+    -- 用户态调用栈 (ggml_aligned_malloc，探针开启 -s 时)，格式同 events_cuda.stack
+    stack TEXT[]
 );
 
 -- 转换为 Hypertable
@@ -228,10 +252,25 @@ CREATE TABLE events_os (
     pid INT NOT NULL,
     comm TEXT,
     cmdline TEXT,
+    proc_uid TEXT,
+    container_id TEXT,
+    cgroup TEXT,
+    pod_uid TEXT,
+    uid INT,
+    euid INT,
+    gid INT,
+    username TEXT,
+    mnt_ns BIGINT,
+    pid_ns BIGINT,
+    exe_path TEXT,
+    exe_inode BIGINT,
+    exe_build_id TEXT,
+    exe_deleted BOOLEAN,
     vfs_filename TEXT,
     syscall_name TEXT,
     cpu INT,
     sched_type TEXT,
+    tgid INT,
     ppid INT,
     ppid_comm TEXT,
     ppid_cmdline TEXT,
@@ -250,6 +289,20 @@ CREATE TABLE events_cuda (
     pid INT NOT NULL,
     comm TEXT,
     cmdline TEXT,
+    proc_uid TEXT,
+    container_id TEXT,
+    cgroup TEXT,
+    pod_uid TEXT,
+    uid INT,
+    euid INT,
+    gid INT,
+    username TEXT,
+    mnt_ns BIGINT,
+    pid_ns BIGINT,
+    exe_path TEXT,
+    exe_inode BIGINT,
+    exe_build_id TEXT,
+    exe_deleted BOOLEAN,
     operation TEXT,
     cuda_ptr BIGINT,
     cuda_size BIGINT,
@@ -259,11 +312,15 @@ CREATE TABLE events_cuda (
     cuda_symbol_file TEXT,
     cuda_symbol_offset BIGINT,
     cuda_symbol_sourcefile TEXT,
+    cuda_symbol_build_id TEXT,
+    cuda_symbol_addr BIGINT,
     cuda_memcpy_src BIGINT,
     cuda_memcpy_dst BIGINT,
     cuda_memcpy_kind INT,
     cuda_memcpy_type TEXT,
-    cuda_sync_duration_ns BIGINT
+    cuda_memcpy_duration_ns BIGINT,
+    cuda_sync_duration_ns BIGINT,
+    stack TEXT[]
 );`
 	createEventsCudaHypertableSQL     = `SELECT create_hypertable('events_cuda', by_range('ts'));`
 	createEventsCudaSetCompressionSQL = `ALTER TABLE events_cuda SET (timescaledb.compress = true);`
@@ -277,6 +334,20 @@ CREATE TABLE events_ggml (
     pid INT NOT NULL,
     comm TEXT,
     cmdline TEXT,
+    proc_uid TEXT,
+    container_id TEXT,
+    cgroup TEXT,
+    pod_uid TEXT,
+    uid INT,
+    euid INT,
+    gid INT,
+    username TEXT,
+    mnt_ns BIGINT,
+    pid_ns BIGINT,
+    exe_path TEXT,
+    exe_inode BIGINT,
+    exe_build_id TEXT,
+    exe_deleted BOOLEAN,
     operation TEXT,
     ggml_cuda_func_name TEXT,
     ggml_cuda_duration_ns BIGINT,
@@ -286,7 +357,8 @@ CREATE TABLE events_ggml (
     ggml_graph_order TEXT,
     ggml_cost_ns BIGINT,
     ggml_mem_size BIGINT,
-    ggml_mem_ptr BIGINT
+    ggml_mem_ptr BIGINT,
+    stack TEXT[]
 );`
 	createEventsGgmlHypertableSQL     = `SELECT create_hypertable('events_ggml', by_range('ts'));`
 	createEventsGgmlSetCompressionSQL = `ALTER TABLE events_ggml SET (timescaledb.compress = true);`
@@ -300,10 +372,127 @@ CREATE TABLE events_app_log (
     pid INT NOT NULL,
     comm TEXT,
     cmdline TEXT,
+    proc_uid TEXT,
+    container_id TEXT,
+    cgroup TEXT,
+    pod_uid TEXT,
+    uid INT,
+    euid INT,
+    gid INT,
+    username TEXT,
+    mnt_ns BIGINT,
+    pid_ns BIGINT,
+    exe_path TEXT,
+    exe_inode BIGINT,
+    exe_build_id TEXT,
+    exe_deleted BOOLEAN,
     log_text TEXT
 );`
 	createEventsAppLogHypertableSQL     = `SELECT create_hypertable('events_app_log', by_range('ts'));`
 	createEventsAppLogSetCompressionSQL = `ALTER TABLE events_app_log SET (timescaledb.compress = true);`
+
+	// --- cuda_mem_findings (由 CUDA 显存泄漏检测任务写入) ---
+	createCudaMemFindingsTableSQL = `
+CREATE TABLE cuda_mem_findings (
+    ts TIMESTAMPTZ NOT NULL,
+    machine_id TEXT NOT NULL,
+    pid INT NOT NULL,
+    comm TEXT,
+    cmdline TEXT,
+    finding_type TEXT NOT NULL,
+    cuda_ptr BIGINT NOT NULL,
+    cuda_size BIGINT,
+    age_ns BIGINT,
+    detected_at TIMESTAMPTZ NOT NULL
+);`
+	createCudaMemFindingsHypertableSQL  = `SELECT create_hypertable('cuda_mem_findings', by_range('ts'));`
+	createCudaMemFindingsUniqueIndexSQL = `CREATE UNIQUE INDEX IF NOT EXISTS ux_cuda_mem_findings ON cuda_mem_findings (machine_id, pid, finding_type, cuda_ptr, ts);`
+
+	// --- inference_sessions (由推理会话重建任务写入, ts 为会话开始时间) ---
+	createInferenceSessionsTableSQL = `
+CREATE TABLE inference_sessions (
+    ts TIMESTAMPTZ NOT NULL,
+    end_ts TIMESTAMPTZ NOT NULL,
+    machine_id TEXT NOT NULL,
+    pid INT NOT NULL,
+    comm TEXT,
+    cmdline TEXT,
+    duration_ns BIGINT,
+    graph_computes INT,
+    cpu_graph_ns BIGINT,
+    gpu_matmul_ns BIGINT,
+    gpu_matmul_calls INT,
+    memcpy_bytes BIGINT,
+    memcpy_count INT,
+    sync_wait_ns BIGINT,
+    sync_count INT,
+    log_markers INT
+);`
+	createInferenceSessionsHypertableSQL  = `SELECT create_hypertable('inference_sessions', by_range('ts'));`
+	createInferenceSessionsUniqueIndexSQL = `CREATE UNIQUE INDEX IF NOT EXISTS ux_inference_sessions ON inference_sessions (machine_id, pid, ts);`
+
+	// --- llm_token_metrics (每个推理请求一行, ts 为请求开始时间) ---
+	createLLMTokenMetricsTableSQL = `
+CREATE TABLE llm_token_metrics (
+    ts TIMESTAMPTZ NOT NULL,
+    end_ts TIMESTAMPTZ NOT NULL,
+    machine_id TEXT NOT NULL,
+    pid INT NOT NULL,
+    comm TEXT,
+    cmdline TEXT,
+    prefill_steps INT,
+    prefill_ns BIGINT,
+    ttft_ns BIGINT,
+    decode_tokens INT,
+    decode_ns BIGINT,
+    tokens_per_sec DOUBLE PRECISION,
+    itl_avg_ns BIGINT,
+    itl_p50_ns BIGINT,
+    itl_p95_ns BIGINT,
+    itl_max_ns BIGINT
+);`
+	createLLMTokenMetricsHypertableSQL  = `SELECT create_hypertable('llm_token_metrics', by_range('ts'));`
+	createLLMTokenMetricsUniqueIndexSQL = `CREATE UNIQUE INDEX IF NOT EXISTS ux_llm_token_metrics ON llm_token_metrics (machine_id, pid, ts);`
+
+	// --- syscall_rollups (agent 按 (pid, syscall) 周期汇总的系统调用次数, ts 为汇总周期开始时间) ---
+	createSyscallRollupsTableSQL = `
+CREATE TABLE syscall_rollups (
+    ts TIMESTAMPTZ NOT NULL,
+    machine_id TEXT NOT NULL,
+    pid INT NOT NULL,
+    comm TEXT,
+    cmdline TEXT,
+    proc_uid TEXT,
+    container_id TEXT,
+    cgroup TEXT,
+    pod_uid TEXT,
+    syscall_name TEXT NOT NULL,
+    interval_ns BIGINT,
+    count BIGINT NOT NULL
+);`
+	createSyscallRollupsHypertableSQL = `SELECT create_hypertable('syscall_rollups', by_range('ts'));`
+	createSyscallRollupsIndexSQL      = `CREATE INDEX IF NOT EXISTS ix_syscall_rollups_machine_id_ts ON syscall_rollups (machine_id, ts DESC);`
+
+	// --- event_rollups (agent 规则引擎 aggregate 动作周期汇总的事件次数, ts 为汇总周期开始时间) ---
+	// pid 只在规则按 pid 分组时有值，否则为 0；group_values 为分组字段及其取值
+	createEventRollupsTableSQL = `
+CREATE TABLE event_rollups (
+    ts TIMESTAMPTZ NOT NULL,
+    machine_id TEXT NOT NULL,
+    rule_name TEXT NOT NULL,
+    event_topic TEXT NOT NULL,
+    pid INT NOT NULL,
+    comm TEXT,
+    proc_uid TEXT,
+    container_id TEXT,
+    cgroup TEXT,
+    pod_uid TEXT,
+    group_values JSONB,
+    interval_ns BIGINT,
+    count BIGINT NOT NULL
+);`
+	createEventRollupsHypertableSQL = `SELECT create_hypertable('event_rollups', by_range('ts'));`
+	createEventRollupsIndexSQL      = `CREATE INDEX IF NOT EXISTS ix_event_rollups_machine_id_ts ON event_rollups (machine_id, ts DESC);`
 )
 
 // InitializeTSDBSchema ensures the required TimescaleDB extension and tables exist.
@@ -330,6 +519,11 @@ func InitializeTSDBSchema(ctx context.Context, db *sqlx.DB) error {
 	}); err != nil {
 		return err
 	}
+	if err := addMissingColumns(ctx, db, "events_cuda", []string{
+		"cuda_memcpy_duration_ns BIGINT",
+	}); err != nil {
+		return err
+	}
 
 	if err := initializeTableGroup(ctx, db, "events_ggml", createEventsGgmlTableSQL, createEventsGgmlHypertableSQL, []string{
 		createEventsGgmlSetCompressionSQL,
@@ -343,6 +537,76 @@ func InitializeTSDBSchema(ctx context.Context, db *sqlx.DB) error {
 		return err
 	}
 
+	if err := addMissingColumns(ctx, db, "events_os", []string{
+		"tgid INT",
+	}); err != nil {
+		return err
+	}
+
+	// proc_uid 在后续版本加入，为已存在的事件表补充
+	for _, table := range []string{"events_os", "events_cuda", "events_ggml", "events_app_log"} {
+		if err := addMissingColumns(ctx, db, table, []string{"proc_uid TEXT"}); err != nil {
+			return err
+		}
+	}
+
+	if err := initializeTableGroup(ctx, db, "cuda_mem_findings", createCudaMemFindingsTableSQL, createCudaMemFindingsHypertableSQL, []string{
+		createCudaMemFindingsUniqueIndexSQL,
+	}); err != nil {
+		return err
+	}
+
+	if err := initializeTableGroup(ctx, db, "inference_sessions", createInferenceSessionsTableSQL, createInferenceSessionsHypertableSQL, []string{
+		createInferenceSessionsUniqueIndexSQL,
+	}); err != nil {
+		return err
+	}
+
+	if err := initializeTableGroup(ctx, db, "llm_token_metrics", createLLMTokenMetricsTableSQL, createLLMTokenMetricsHypertableSQL, []string{
+		createLLMTokenMetricsUniqueIndexSQL,
+	}); err != nil {
+		return err
+	}
+
+	if err := initializeTableGroup(ctx, db, "syscall_rollups", createSyscallRollupsTableSQL, createSyscallRollupsHypertableSQL, []string{
+		createSyscallRollupsIndexSQL,
+	}); err != nil {
+		return err
+	}
+
+	if err := initializeTableGroup(ctx, db, "event_rollups", createEventRollupsTableSQL, createEventRollupsHypertableSQL, []string{
+		createEventRollupsIndexSQL,
+	}); err != nil {
+		return err
+	}
+
+	// container_id / cgroup / pod_uid 在后续版本加入，为已存在的表补充
+	for _, table := range []string{"events_os", "events_cuda", "events_ggml", "events_app_log", "syscall_rollups", "event_rollups"} {
+		if err := addMissingColumns(ctx, db, table, []string{"container_id TEXT", "cgroup TEXT", "pod_uid TEXT"}); err != nil {
+			return err
+		}
+	}
+
+	// 进程身份字段在后续版本加入，为已存在的事件表补充
+	for _, table := range []string{"events_os", "events_cuda", "events_ggml", "events_app_log"} {
+		if err := addMissingColumns(ctx, db, table, []string{
+			"uid INT", "euid INT", "gid INT", "username TEXT", "mnt_ns BIGINT", "pid_ns BIGINT",
+			"exe_path TEXT", "exe_inode BIGINT", "exe_build_id TEXT", "exe_deleted BOOLEAN",
+		}); err != nil {
+			return err
+		}
+	}
+
+	if err := addMissingColumns(ctx, db, "events_cuda", []string{"cuda_symbol_build_id TEXT", "cuda_symbol_addr BIGINT"}); err != nil {
+		return err
+	}
+
+	for _, table := range []string{"events_cuda", "events_ggml"} {
+		if err := addMissingColumns(ctx, db, table, []string{"stack TEXT[]"}); err != nil {
+			return err
+		}
+	}
+
 	log.Println("数据库 schema 初始化完成.")
 	return nil
 }
@@ -427,6 +691,17 @@ func initializeTableGroup(ctx context.Context, db *sqlx.DB, tableName, createTab
 	return nil
 }
 
+// addMissingColumns 为已存在的表补充后续版本新增的列 (列定义形如 "name TYPE")
+func addMissingColumns(ctx context.Context, db *sqlx.DB, tableName string, columnDefs []string) error {
+	for _, def := range columnDefs {
+		query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s", pq.QuoteIdentifier(tableName), def)
+		if _, err := db.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("为表 '%s' 添加列 (%s) 失败: %w", tableName, def, err)
+		}
+	}
+	return nil
+}
+
 // tableExists checks if a table exists in a given schema.
 func tableExists(ctx context.Context, db *sqlx.DB, schemaName, tableName string) (bool, error) {
 	query := `SELECT EXISTS (
@@ -3,7 +3,9 @@ package redis
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"scope/internal/models"
+	"strconv"
 
 	"github.com/redis/go-redis/v9"
 )
@@ -42,8 +44,13 @@ func (n *NodeStore) GetNode(ctx context.Context, id string) (models.NodeInfo, er
 	return node, nil
 }
 
+// DeleteNode 删除节点及其凭据，之后该节点需要新的加入令牌重新注册
 func (n *NodeStore) DeleteNode(ctx context.Context, id string) error {
-	return n.client.HDel(ctx, "nodes", id).Err()
+	pipe := n.client.TxPipeline()
+	pipe.HDel(ctx, "nodes", id)
+	pipe.HDel(ctx, "node_credentials", id)
+	_, err := pipe.Exec(ctx)
+	return err
 }
 
 func (n *NodeStore) ListNodes(ctx context.Context) ([]models.NodeInfo, error) {
@@ -62,3 +69,87 @@ func (n *NodeStore) ListNodes(ctx context.Context) ([]models.NodeInfo, error) {
 	}
 	return nodes, nil
 }
+
+// SetNodeCredentialNX 保存节点凭据 (已加密)，节点已有凭据时不覆盖并返回 false
+func (n *NodeStore) SetNodeCredentialNX(ctx context.Context, id, encrypted string) (bool, error) {
+	return n.client.HSetNX(ctx, "node_credentials", id, encrypted).Result()
+}
+
+// GetNodeCredential 返回节点凭据 (已加密)，节点未注册时返回 redis.Nil
+func (n *NodeStore) GetNodeCredential(ctx context.Context, id string) (string, error) {
+	return n.client.HGet(ctx, "node_credentials", id).Result()
+}
+
+// DeleteNodeCredential 删除节点凭据
+func (n *NodeStore) DeleteNodeCredential(ctx context.Context, id string) error {
+	return n.client.HDel(ctx, "node_credentials", id).Err()
+}
+
+// joinTokenRecord 是保存在 Redis 中的加入令牌，secret 只保存哈希；使用次数单独保存在 join_token_uses 中以便原子递增
+type joinTokenRecord struct {
+	models.JoinToken
+	SecretHash string `json:"secret_hash"`
+}
+
+// SaveJoinToken 保存加入令牌
+func (n *NodeStore) SaveJoinToken(ctx context.Context, token models.JoinToken, secretHash string) error {
+	v, err := json.Marshal(joinTokenRecord{JoinToken: token, SecretHash: secretHash})
+	if err != nil {
+		return err
+	}
+	return n.client.HSet(ctx, "join_tokens", token.ID, v).Err()
+}
+
+// GetJoinToken 返回加入令牌及其 secret 的哈希，不存在时返回 redis.Nil
+func (n *NodeStore) GetJoinToken(ctx context.Context, id string) (models.JoinToken, string, error) {
+	v, err := n.client.HGet(ctx, "join_tokens", id).Result()
+	if err != nil {
+		return models.JoinToken{}, "", err
+	}
+	var record joinTokenRecord
+	if err := json.Unmarshal([]byte(v), &record); err != nil {
+		return models.JoinToken{}, "", err
+	}
+	uses, err := n.client.HGet(ctx, "join_token_uses", id).Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return models.JoinToken{}, "", err
+	}
+	record.Uses = uses
+	return record.JoinToken, record.SecretHash, nil
+}
+
+// ListJoinTokens 返回所有加入令牌 (不含 secret 的哈希)
+func (n *NodeStore) ListJoinTokens(ctx context.Context) ([]models.JoinToken, error) {
+	v, err := n.client.HGetAll(ctx, "join_tokens").Result()
+	if err != nil {
+		return nil, err
+	}
+	uses, err := n.client.HGetAll(ctx, "join_token_uses").Result()
+	if err != nil {
+		return nil, err
+	}
+	tokens := make([]models.JoinToken, 0, len(v))
+	for id, v := range v {
+		var record joinTokenRecord
+		if err := json.Unmarshal([]byte(v), &record); err != nil {
+			return nil, err
+		}
+		record.Uses, _ = strconv.ParseInt(uses[id], 10, 64)
+		tokens = append(tokens, record.JoinToken)
+	}
+	return tokens, nil
+}
+
+// UseJoinToken 原子地把加入令牌的使用次数加一，返回加一之后的次数
+func (n *NodeStore) UseJoinToken(ctx context.Context, id string) (int64, error) {
+	return n.client.HIncrBy(ctx, "join_token_uses", id, 1).Result()
+}
+
+// DeleteJoinToken 吊销加入令牌，已经用它注册的节点不受影响
+func (n *NodeStore) DeleteJoinToken(ctx context.Context, id string) error {
+	pipe := n.client.TxPipeline()
+	pipe.HDel(ctx, "join_tokens", id)
+	pipe.HDel(ctx, "join_token_uses", id)
+	_, err := pipe.Exec(ctx)
+	return err
+}
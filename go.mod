@@ -3,12 +3,14 @@ module scope
 go 1.23.0
 
 require (
+	github.com/cilium/ebpf v0.17.3
 	github.com/denisbrodbeck/machineid v1.0.1
 	github.com/go-chi/chi/v5 v5.2.1
 	github.com/go-chi/cors v1.2.1
 	github.com/go-playground/validator/v10 v10.26.0
 	github.com/golang-jwt/jwt/v5 v5.2.2
 	github.com/google/uuid v1.6.0
+	github.com/ianlancetaylor/demangle v0.0.0-20260724033716-83e58baca724
 	github.com/joho/godotenv v1.5.1
 	github.com/pebbe/zmq4 v1.3.0
 	github.com/swaggo/http-swagger v1.3.4
@@ -0,0 +1,136 @@
+package agentmanager
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"scope/internal/utils"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	tokenMu sync.RWMutex
+	token   string // center 在注册时下发的节点 token，也是 agent API 签名的密钥
+)
+
+// NodeToken 返回 center 下发的节点 token，注册成功之前为空
+func NodeToken() string {
+	tokenMu.RLock()
+	defer tokenMu.RUnlock()
+	return token
+}
+
+func setNodeToken(t string) {
+	tokenMu.Lock()
+	token = t
+	tokenMu.Unlock()
+}
+
+// APIAuth 校验 center 对 agent API 的请求签名 (HMAC-SHA256，带时间戳和 nonce 防重放)，
+// 密钥为注册时下发的节点 token
+type APIAuth struct {
+	nodeID   string
+	maxSkew  time.Duration
+	nonces   *utils.NonceCache
+	rejected atomic.Uint64
+}
+
+// NewAPIAuth 创建签名校验器，maxSkew 为允许的 center 与 agent 的时钟偏差
+func NewAPIAuth(maxSkew time.Duration) *APIAuth {
+	return &APIAuth{
+		nodeID:  getMachineID(),
+		maxSkew: maxSkew,
+		nonces:  utils.NewNonceCache(2 * maxSkew),
+	}
+}
+
+// Rejected 返回被拒绝的请求数
+func (a *APIAuth) Rejected() uint64 {
+	return a.rejected.Load()
+}
+
+// Middleware 拒绝没有有效签名的请求
+func (a *APIAuth) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := NodeToken()
+		if key == "" {
+			http.Error(w, "node is not registered to the center yet", http.StatusServiceUnavailable)
+			return
+		}
+		if err := utils.VerifyRequest(r, a.nodeID, []byte(key), time.Now(), a.maxSkew, a.nonces); err != nil {
+			a.rejected.Add(1)
+			log.Printf("Rejected unsigned or invalid request %s %s from %s: %v", r.Method, r.URL.Path, r.RemoteAddr, err)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// LoadServerTLS 加载 agent API 的证书。certFile 为空时返回 nil (明文 HTTP)；
+// clientCAFile 不为空时要求 center 出示由该 CA 签发的客户端证书 (双向 TLS)。
+func LoadServerTLS(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	if certFile == "" {
+		if clientCAFile != "" {
+			return nil, fmt.Errorf("a client CA requires a server certificate")
+		}
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if clientCAFile != "" {
+		pem, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", clientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// ListenAndServe 在 ips 的每个地址上监听 port，ips 为空时监听所有地址。
+// tlsConfig 不为 nil 时使用 HTTPS。任何一个监听失败时返回。
+func ListenAndServe(ips []string, port string, handler http.Handler, tlsConfig *tls.Config) error {
+	addrs := []string{":" + port}
+	if len(ips) > 0 {
+		addrs = addrs[:0]
+		for _, ip := range ips {
+			addrs = append(addrs, net.JoinHostPort(ip, port))
+		}
+	}
+	errc := make(chan error, len(addrs))
+	for _, addr := range addrs {
+		server := &http.Server{
+			Addr:              addr,
+			Handler:           handler,
+			TLSConfig:         tlsConfig,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		go func() {
+			if tlsConfig != nil {
+				// 证书已经在 TLSConfig 中
+				errc <- server.ListenAndServeTLS("", "")
+			} else {
+				errc <- server.ListenAndServe()
+			}
+		}()
+	}
+	return <-errc
+}
@@ -0,0 +1,81 @@
+package agentmanager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"scope/internal/utils"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAPIAuthMiddleware(t *testing.T) {
+	auth := NewAPIAuth(time.Minute)
+	handler := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	serve := func(r *http.Request) int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// 注册之前没有密钥，所有请求都不可用
+	setNodeToken("")
+	if code := serve(newSignedRequest(t, http.MethodGet, "/rules", "")); code != http.StatusServiceUnavailable {
+		t.Errorf("unregistered: got %d, want %d", code, http.StatusServiceUnavailable)
+	}
+	setNodeToken(testNodeToken)
+	defer setNodeToken("")
+
+	tests := []struct {
+		name   string
+		tamper func(r *http.Request)
+		want   int
+	}{
+		{"valid", func(r *http.Request) {}, http.StatusOK},
+		{"bad mac", func(r *http.Request) { r.Header.Set(utils.HeaderSignature, "00ff") }, http.StatusUnauthorized},
+		{"unsigned", func(r *http.Request) { r.Header.Del(utils.HeaderSignature) }, http.StatusUnauthorized},
+		{"stale timestamp", func(r *http.Request) {
+			r.Header.Set(utils.HeaderTimestamp, strconv.FormatInt(time.Now().Add(-2*time.Minute).Unix(), 10))
+		}, http.StatusUnauthorized},
+		{"other node", func(r *http.Request) { r.Header.Set(utils.HeaderNodeID, "other") }, http.StatusUnauthorized},
+	}
+	rejected := auth.Rejected()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newSignedRequest(t, http.MethodPut, "/rules", `{"rules":[]}`)
+			tt.tamper(r)
+			if code := serve(r); code != tt.want {
+				t.Errorf("got %d, want %d", code, tt.want)
+			}
+		})
+	}
+	if got := auth.Rejected() - rejected; got != 4 {
+		t.Errorf("rejected %d requests, want 4", got)
+	}
+
+	t.Run("replayed nonce", func(t *testing.T) {
+		r := newSignedRequest(t, http.MethodGet, "/rules", "")
+		replay := r.Clone(r.Context())
+		if code := serve(r); code != http.StatusOK {
+			t.Fatalf("first request: got %d", code)
+		}
+		if code := serve(replay); code != http.StatusUnauthorized {
+			t.Errorf("replay: got %d, want %d", code, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("nonce not consumed by a bad mac", func(t *testing.T) {
+		genuine := newSignedRequest(t, http.MethodGet, "/rules", "")
+		forged := genuine.Clone(genuine.Context())
+		forged.Header.Set(utils.HeaderSignature, "00ff")
+		if code := serve(forged); code != http.StatusUnauthorized {
+			t.Fatalf("forged request: got %d", code)
+		}
+		// 伪造的请求用了同一个 nonce，真实请求仍然要能通过
+		if code := serve(genuine); code != http.StatusOK {
+			t.Errorf("genuine request after a forged one: got %d, want %d", code, http.StatusOK)
+		}
+	})
+}
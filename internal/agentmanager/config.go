@@ -1,17 +1,42 @@
 package agentmanager
 
+import (
+	"scope/internal/probe"
+	"time"
+)
+
 // --- Struct to pass raw messages between goroutines ---
 type RawMessage struct {
-	Topic   []byte // Received raw topic bytes (might be msgpack encoded)
-	Payload []byte // Received raw payload bytes
+	Topic   []byte       // Received raw topic bytes (might be msgpack encoded)
+	Payload []byte       // Received raw payload bytes
+	Event   *probe.Event // 进程内探针解码好的事件，非 nil 时忽略 Topic 和 Payload
 }
 
 // --- Configuration struct for the application ---
 type Config struct {
-	Verbose       bool   // Whether to print verbose output
-	RedisAddr     string // Redis server address
-	RedisDB       int    // Redis database number
-	RedisPassword string // Redis password
-	StreamKey     string // Redis stream key
-	IPCEndpoint   string // ZMQ IPC endpoint
+	Verbose        bool   // Whether to print verbose output
+	RedisAddr      string // Redis server address
+	RedisDB        int    // Redis database number
+	RedisPassword  string // Redis password
+	StreamKey      string // Redis stream key
+	IPCEndpoint    string // ZMQ IPC endpoint
+	IPCGroup       string // 可以连接 IPC socket 的组，为空时只有 root 可以连接
+	IPCTrustedUIDs []int  // 除 agent 启动的 C 加载程序外，还接受这些 uid 发送的 IPC 消息
+	IPCVerifyPeer  bool   // 按 SO_PEERCRED 校验 IPC 消息的发送方
+
+	SyscallAggInterval time.Duration // syscalls 汇总周期，0 表示不汇总
+	SyscallRaw         bool          // 汇总时是否仍然写入每次系统调用的原始事件
+
+	RulesFile       string        // 过滤规则的持久化文件，为空时不持久化
+	RuleAggInterval time.Duration // 规则 aggregate 动作的汇总周期
+
+	SymbolCacheMB int // 模块级符号缓存 (符号表和 DWARF) 的内存上限，单位 MiB
+
+	BPFDir       string            // bpf 目录，探针对象和 C 加载程序位于其下的 build/
+	Probes       []string          // 启动时加载的探针，为空时不加载 (由外部启动)
+	ProbeRuntime string            // ProbeRuntimeAuto、ProbeRuntimeGo 或 ProbeRuntimeC
+	ProbePID     int32             // 探针的 pid 过滤，0 表示不过滤
+	ProbeComm    string            // 探针的进程名过滤
+	ProbeStack   bool              // cuda 和 ggml_base 采集用户态调用栈
+	ProbeTargets map[string]string // 探针名 -> uprobe 目标文件，未指定时使用默认路径
 }
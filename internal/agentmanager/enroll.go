@@ -0,0 +1,124 @@
+package agentmanager
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"scope/internal/utils"
+	"strings"
+	"time"
+)
+
+// Enrollment 是 agent 向 center 注册所需的凭据配置
+type Enrollment struct {
+	CredentialFile string // 长期节点凭据的保存路径，只有 root 可读
+	JoinToken      string // 首次注册时出示的加入令牌，已有凭据时忽略
+	AllowInsecure  bool   // 允许通过明文 HTTP 向非本机的 center 注册
+}
+
+// CheckCenterTransport 拒绝通过明文 HTTP 向非本机的 center 注册：注册响应中的节点凭据和会话 token
+// 是签名密钥，被截获后可以伪造 center 对 agent 的 /runEBPF、PUT /rules 等请求。
+func CheckCenterTransport(centerURL string, allowInsecure bool) error {
+	u, err := url.Parse(centerEndpoint(centerURL, ""))
+	if err != nil {
+		return fmt.Errorf("invalid center URL %q: %w", centerURL, err)
+	}
+	if u.Scheme == "https" || allowInsecure {
+		return nil
+	}
+	host := u.Hostname()
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("refusing to enroll with %s over plain HTTP: the node credential and session token would be sent in cleartext; use https or set CENTER_INSECURE=true", u.Host)
+}
+
+// loadCredential 读取节点凭据，文件不存在时返回空字符串
+func loadCredential(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read node credential: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// saveCredential 以 0600 权限原子地写入节点凭据
+func saveCredential(path, credential string) error {
+	if credential == "" {
+		return errors.New("center returned an empty node credential")
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create credential directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, ".node_credential-*")
+	if err != nil {
+		return fmt.Errorf("failed to save node credential: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0600); err == nil {
+		_, err = tmp.WriteString(credential + "\n")
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save node credential: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// centerEndpoint 把 CENTER_URL 和接口路径拼成完整 URL，CENTER_URL 可以省略 scheme
+func centerEndpoint(centerURL, path string) string {
+	if !strings.HasPrefix(centerURL, "http://") && !strings.HasPrefix(centerURL, "https://") {
+		centerURL = "http://" + centerURL
+	}
+	// 兼容旧配置中带有注册接口路径的 CENTER_URL
+	centerURL = strings.TrimSuffix(centerURL, "/api/v1/node/up")
+	return strings.TrimSuffix(centerURL, "/") + path
+}
+
+// postToCenter 以 JSON 发送 request 并把响应解码到 response。credential 不为空时用它对请求签名。
+func postToCenter(centerURL, path string, request, response interface{}, credential string) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, centerEndpoint(centerURL, path), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if credential != "" {
+		if err := utils.SignRequest(req, getMachineID(), []byte(credential), body); err != nil {
+			return err
+		}
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("center returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
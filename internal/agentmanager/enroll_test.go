@@ -0,0 +1,24 @@
+package agentmanager
+
+import "testing"
+
+func TestCheckCenterTransport(t *testing.T) {
+	tests := []struct {
+		url      string
+		insecure bool
+		ok       bool
+	}{
+		{"https://center.example.com", false, true},
+		{"http://localhost:18080", false, true},
+		{"127.0.0.1:18080", false, true},
+		{"http://[::1]:18080/api/v1/node/up", false, true},
+		{"http://10.0.0.5:18080", false, false},
+		{"center.example.com:18080", false, false}, // 省略 scheme 时为 http
+		{"http://10.0.0.5:18080", true, true},
+	}
+	for _, tt := range tests {
+		if err := CheckCenterTransport(tt.url, tt.insecure); (err == nil) != tt.ok {
+			t.Errorf("CheckCenterTransport(%q, %v) = %v, want ok=%v", tt.url, tt.insecure, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package agentmanager
+
+import (
+	"fmt"
+	"log"
+	"scope/internal/models"
+	"scope/internal/platform"
+	"sync"
+	"time"
+)
+
+// Version 是 agent 的版本，发布构建时通过 -ldflags "-X scope/internal/agentmanager.Version=..." 设置
+var Version = "dev"
+
+// spoolHighWater 是事件缓冲区的积压比例，超过时心跳上报 degraded
+const spoolHighWater = 0.8
+
+// Heartbeat 周期性地向 center 推送用节点凭据签名的心跳，center 根据最近一次心跳判断节点是否在线。
+// agent 主动连接 center，位于 NAT 之后的节点也能上报。
+// 心跳中每隔 InventoryInterval 附带一次主机清单，清单变化不频繁，不需要每次都上报。
+type Heartbeat struct {
+	CenterURL         string
+	CredentialFile    string
+	Interval          time.Duration
+	InventoryInterval time.Duration
+	Probes            *ProbeManager
+	IPC               *IPCGuard // 未启用 IPC 校验时为 nil
+	Spool             chan RawMessage
+
+	started       time.Time
+	inventorySent time.Time
+}
+
+// Run 每隔 Interval 发送一次心跳，注册完成 (拿到节点凭据) 之前不发送。连续失败时只记录第一次。
+func (h *Heartbeat) Run(wg *sync.WaitGroup) {
+	defer wg.Done()
+	h.started = time.Now()
+	ticker := time.NewTicker(h.Interval)
+	defer ticker.Stop()
+	failing := false
+	for range ticker.C {
+		if NodeToken() == "" {
+			continue
+		}
+		err := h.send()
+		if err != nil && !failing {
+			log.Printf("Failed to send heartbeat: %v", err)
+		} else if err == nil && failing {
+			log.Printf("Heartbeat to %s recovered", h.CenterURL)
+		}
+		failing = err != nil
+	}
+}
+
+func (h *Heartbeat) send() error {
+	credential, err := loadCredential(h.CredentialFile)
+	if err != nil {
+		return err
+	}
+	if credential == "" {
+		return fmt.Errorf("no node credential in %s", h.CredentialFile)
+	}
+	hb := h.collect()
+	if h.inventorySent.IsZero() || (h.InventoryInterval > 0 && time.Since(h.inventorySent) >= h.InventoryInterval) {
+		inventory := CollectInventory(h.Probes)
+		hb.Inventory = &inventory
+	}
+	var response map[string]string
+	if err := postToCenter(h.CenterURL, "/api/v1/node/heartbeat", hb, &response, credential); err != nil {
+		return err
+	}
+	if hb.Inventory != nil {
+		h.inventorySent = time.Now()
+	}
+	return nil
+}
+
+// CollectInventory 采集主机清单，并附上 agent 版本和探针版本
+func CollectInventory(probes *ProbeManager) models.NodeInventory {
+	inventory := platform.CollectHostInventory("")
+	inventory.AgentVersion = Version
+	inventory.Probes = probes.Status()
+	return inventory
+}
+
+// collect 汇总探针状态、事件积压和 IPC 拒绝数，并据此给出健康状态
+func (h *Heartbeat) collect() models.NodeHeartbeat {
+	hb := models.NodeHeartbeat{
+		Timestamp:     time.Now(),
+		Version:       Version,
+		UptimeSec:     int64(time.Since(h.started).Seconds()),
+		Health:        models.NodeHealthOK,
+		Probes:        h.Probes.Status(),
+		SpoolDepth:    len(h.Spool),
+		SpoolCapacity: cap(h.Spool),
+	}
+	if h.IPC != nil {
+		for _, n := range h.IPC.Stats().Rejected {
+			hb.IPCRejected += n
+		}
+	}
+	for _, p := range hb.Probes {
+		if !p.Running {
+			hb.Problems = append(hb.Problems, fmt.Sprintf("probe %s is not running", p.Name))
+		}
+	}
+	if hb.SpoolCapacity > 0 && float64(hb.SpoolDepth) >= spoolHighWater*float64(hb.SpoolCapacity) {
+		hb.Problems = append(hb.Problems, fmt.Sprintf("event spool %d/%d full", hb.SpoolDepth, hb.SpoolCapacity))
+	}
+	if len(hb.Problems) > 0 {
+		hb.Health = models.NodeHealthDegraded
+	}
+	return hb
+}
@@ -0,0 +1,253 @@
+package agentmanager
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// DefaultIPCEndpoint 是 C 加载程序发布事件的默认端点，与 bpf/zmqsender.h 中的 SCOPE_IPC_ENDPOINT 一致
+const DefaultIPCEndpoint = "ipc:///run/scope/probes.sock"
+
+// IPCEndpointEnv 是传给 C 加载程序的端点环境变量，agent 启动的加载程序继承该变量
+const IPCEndpointEnv = "SCOPE_IPC_ENDPOINT"
+
+// 拒绝消息的原因
+const (
+	IPCRejectNoCredentials = "no_credentials" // 拿不到发送方的 SO_PEERCRED (非 ipc:// 端点或 libzmq 不支持)
+	IPCRejectUnknownPeer   = "unknown_peer"   // 发送方既不是 agent 启动的加载程序，也不属于受信任的 uid
+)
+
+// parentPID 返回进程的父进程 pid，读取失败时返回 0。测试时可以替换。
+var parentPID = func(pid int) int {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0
+	}
+	// comm 中可能有空格，从最后一个 ')' 之后开始解析: state ppid ...
+	i := strings.LastIndexByte(string(data), ')')
+	if i < 0 {
+		return 0
+	}
+	fields := strings.Fields(string(data[i+1:]))
+	if len(fields) < 2 {
+		return 0
+	}
+	ppid, _ := strconv.Atoi(fields[1])
+	return ppid
+}
+
+// LookupIPCGroup 返回组名对应的 gid，组名为空时返回 0 (只有 root 可以连接)
+func LookupIPCGroup(name string) (int, error) {
+	if name == "" {
+		return 0, nil
+	}
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(g.Gid)
+}
+
+// SecureIPCDir 创建 ipc:// 端点所在的运行时目录: 属主为 agent (root)，属组为 gid，权限 0750。
+// 目录已存在但属于其他用户、或者是符号链接时拒绝使用，避免其他用户预先创建目录后替换 socket。
+func SecureIPCDir(endpoint string, gid int) error {
+	path, ok := strings.CutPrefix(endpoint, "ipc://")
+	if !ok {
+		return nil
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return fmt.Errorf("failed to create IPC directory %s: %w", dir, err)
+	}
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("IPC directory %s is not a directory", dir)
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok && int(st.Uid) != os.Geteuid() {
+		return fmt.Errorf("IPC directory %s is owned by uid %d, not by the agent", dir, st.Uid)
+	}
+	if err := os.Chown(dir, os.Geteuid(), gid); err != nil {
+		return fmt.Errorf("failed to chown IPC directory %s: %w", dir, err)
+	}
+	return os.Chmod(dir, 0750)
+}
+
+// SecureIPCSocket 把 bind 之后创建的 socket 文件设置为属组 gid、权限 0660
+func SecureIPCSocket(endpoint string, gid int) error {
+	path, ok := strings.CutPrefix(endpoint, "ipc://")
+	if !ok {
+		return nil
+	}
+	if err := os.Chown(path, os.Geteuid(), gid); err != nil {
+		return fmt.Errorf("failed to chown IPC socket %s: %w", path, err)
+	}
+	return os.Chmod(path, 0660)
+}
+
+// PeerCred 是 IPC 发送方的 SO_PEERCRED
+type PeerCred struct {
+	PID int `json:"pid"`
+	UID int `json:"uid"`
+	GID int `json:"gid"`
+}
+
+// ParsePeerAddress 解析消息元数据中的 Peer-Address。对于 ipc:// 连接，支持 SO_PEERCRED 的 libzmq
+// 把它设置为 "<地址>:uid:gid:pid"。
+func ParsePeerAddress(addr string) (PeerCred, bool) {
+	parts := strings.Split(addr, ":")
+	if len(parts) < 4 {
+		return PeerCred{}, false
+	}
+	var ids [3]int
+	for i, s := range parts[len(parts)-3:] {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return PeerCred{}, false
+		}
+		ids[i] = n
+	}
+	if ids[2] == 0 {
+		return PeerCred{}, false
+	}
+	return PeerCred{UID: ids[0], GID: ids[1], PID: ids[2]}, true
+}
+
+// IPCStats 是 IPC 消息的接收和拒绝统计
+type IPCStats struct {
+	Accepted     uint64            `json:"accepted"`
+	Rejected     map[string]uint64 `json:"rejected"` // 原因 -> 次数
+	AllowedPIDs  []int             `json:"allowed_pids"`
+	TrustedUIDs  []int             `json:"trusted_uids"`
+	LastRejected *PeerCred         `json:"last_rejected,omitempty"`
+	LastRejectAt time.Time         `json:"last_rejected_at"`
+}
+
+// IPCGuard 校验每条 IPC 消息的发送方: 只接受 agent 启动的 C 加载程序 (登记的 pid 或 agent 的子进程)，
+// 以及 trustedUIDs 中的用户启动的探针 (用于手动运行的加载程序)
+type IPCGuard struct {
+	mu           sync.RWMutex
+	pids         map[int]bool
+	trustedUIDs  map[int]bool
+	lastRejected *PeerCred
+	lastRejectAt time.Time
+
+	accepted      atomic.Uint64
+	noCredentials atomic.Uint64
+	unknownPeer   atomic.Uint64
+}
+
+// NewIPCGuard 创建校验器，trustedUIDs 为空时只接受 agent 启动的加载程序
+func NewIPCGuard(trustedUIDs []int) *IPCGuard {
+	g := &IPCGuard{pids: make(map[int]bool), trustedUIDs: make(map[int]bool)}
+	for _, uid := range trustedUIDs {
+		g.trustedUIDs[uid] = true
+	}
+	return g
+}
+
+// ParseTrustedUIDs 解析逗号分隔的 uid 列表
+func ParseTrustedUIDs(s string) ([]int, error) {
+	var uids []int
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		uid, err := strconv.Atoi(item)
+		if err != nil || uid < 0 {
+			return nil, fmt.Errorf("invalid uid %q", item)
+		}
+		uids = append(uids, uid)
+	}
+	return uids, nil
+}
+
+// Spawn 在持有写锁时调用 start 启动 C 加载程序并登记它返回的 pid (小于等于 0 表示启动失败)。
+// Check 在此期间阻塞，加载程序启动后立即发送的消息不会因为 pid 尚未登记而被拒绝。
+func (g *IPCGuard) Spawn(start func() int) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	pid := start()
+	if pid > 0 {
+		g.pids[pid] = true
+	}
+	return pid
+}
+
+// Allow 接受 pid 发送的消息，用于不经过 Spawn 启动的加载程序
+func (g *IPCGuard) Allow(pid int) {
+	g.mu.Lock()
+	g.pids[pid] = true
+	g.mu.Unlock()
+}
+
+// Revoke 不再接受 pid 发送的消息，在停止 C 加载程序时调用
+func (g *IPCGuard) Revoke(pid int) {
+	g.mu.Lock()
+	delete(g.pids, pid)
+	g.mu.Unlock()
+}
+
+// Check 根据消息的 Peer-Address 元数据判断是否接受，拒绝时计数
+func (g *IPCGuard) Check(peerAddress string) bool {
+	cred, ok := ParsePeerAddress(peerAddress)
+	if !ok {
+		g.noCredentials.Add(1)
+		return false
+	}
+	g.mu.RLock()
+	allowed := g.pids[cred.PID] || g.trustedUIDs[cred.UID]
+	g.mu.RUnlock()
+	if !allowed && parentPID(cred.PID) == os.Getpid() {
+		// 未登记的子进程，例如通过 API 启动的加载程序
+		allowed = true
+	}
+	if !allowed {
+		g.unknownPeer.Add(1)
+		g.mu.Lock()
+		g.lastRejected = &cred
+		g.lastRejectAt = time.Now()
+		g.mu.Unlock()
+		return false
+	}
+	g.accepted.Add(1)
+	return true
+}
+
+// Stats 返回当前的统计
+func (g *IPCGuard) Stats() IPCStats {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	stats := IPCStats{
+		Accepted: g.accepted.Load(),
+		Rejected: map[string]uint64{
+			IPCRejectNoCredentials: g.noCredentials.Load(),
+			IPCRejectUnknownPeer:   g.unknownPeer.Load(),
+		},
+		AllowedPIDs:  make([]int, 0, len(g.pids)),
+		TrustedUIDs:  make([]int, 0, len(g.trustedUIDs)),
+		LastRejected: g.lastRejected,
+		LastRejectAt: g.lastRejectAt,
+	}
+	for pid := range g.pids {
+		stats.AllowedPIDs = append(stats.AllowedPIDs, pid)
+	}
+	for uid := range g.trustedUIDs {
+		stats.TrustedUIDs = append(stats.TrustedUIDs, uid)
+	}
+	sort.Ints(stats.AllowedPIDs)
+	sort.Ints(stats.TrustedUIDs)
+	return stats
+}
@@ -0,0 +1,89 @@
+package agentmanager
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParsePeerAddress(t *testing.T) {
+	tests := []struct {
+		addr string
+		want PeerCred
+		ok   bool
+	}{
+		{"/run/scope/probes.sock:0:0:4242", PeerCred{UID: 0, GID: 0, PID: 4242}, true},
+		{":1000:1000:17", PeerCred{UID: 1000, GID: 1000, PID: 17}, true},
+		{"", PeerCred{}, false},
+		{"127.0.0.1:5555", PeerCred{}, false},     // tcp 连接没有凭据
+		{"/run/x.sock:0:0:0", PeerCred{}, false},  // pid 为 0 表示拿不到凭据
+		{"/run/x.sock:0:-1:9", PeerCred{}, false}, // 负数
+		{"/run/x.sock:a:0:9", PeerCred{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParsePeerAddress(tt.addr)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("ParsePeerAddress(%q) = %+v, %v, want %+v, %v", tt.addr, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestIPCGuard(t *testing.T) {
+	parents := map[int]int{300: os.Getpid()}
+	defer func(orig func(int) int) { parentPID = orig }(parentPID)
+	parentPID = func(pid int) int { return parents[pid] }
+
+	g := NewIPCGuard([]int{1000})
+	g.Allow(100)
+	tests := []struct {
+		name string
+		addr string
+		want bool
+	}{
+		{"allowed pid", "/run/x.sock:0:0:100", true},
+		{"trusted uid", "/run/x.sock:1000:1000:200", true},
+		{"child of the agent", "/run/x.sock:0:0:300", true},
+		{"unknown peer", "/run/x.sock:0:0:400", false},
+		{"no credentials", "", false},
+	}
+	for _, tt := range tests {
+		if got := g.Check(tt.addr); got != tt.want {
+			t.Errorf("%s: Check(%q) = %v, want %v", tt.name, tt.addr, got, tt.want)
+		}
+	}
+
+	g.Revoke(100)
+	if g.Check("/run/x.sock:0:0:100") {
+		t.Errorf("revoked pid should be rejected")
+	}
+	stats := g.Stats()
+	if stats.Accepted != 3 || stats.Rejected[IPCRejectUnknownPeer] != 2 || stats.Rejected[IPCRejectNoCredentials] != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+	if stats.LastRejected == nil || stats.LastRejected.PID != 100 {
+		t.Errorf("last rejected = %+v, want pid 100", stats.LastRejected)
+	}
+}
+
+func TestIPCGuardSpawn(t *testing.T) {
+	defer func(orig func(int) int) { parentPID = orig }(parentPID)
+	parentPID = func(int) int { return 0 }
+
+	g := NewIPCGuard(nil)
+	started := make(chan struct{})
+	result := make(chan bool)
+	pid := g.Spawn(func() int {
+		// 加载程序启动后立即发送消息，此时 pid 还没有返回
+		close(started)
+		go func() { result <- g.Check("/run/x.sock:0:0:500") }()
+		time.Sleep(10 * time.Millisecond)
+		return 500
+	})
+	<-started
+	if pid != 500 || !<-result {
+		t.Errorf("message sent while the loader was being registered should be accepted")
+	}
+	if g.Spawn(func() int { return -1 }) != -1 || len(g.Stats().AllowedPIDs) != 1 {
+		t.Errorf("failed spawn should not register a pid")
+	}
+}
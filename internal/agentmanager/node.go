@@ -6,78 +6,68 @@ import (
 	"log"
 	"net/http"
 	"scope/internal/models"
-	"scope/internal/utils"
-	"strings"
+	"scope/internal/platform"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
 
-var Token string
-
-// RegisterNodeToCenter registers this node to the center node
-func RegisterNodeToCenter(centerURL string) (string, error) {
+// RegisterNodeToCenter registers this node to the center node, advertising ips (interface name -> IP),
+// the port of the agent API and the host inventory.
+// 没有节点凭据时用加入令牌首次注册 (/api/v1/node/enroll) 并保存换得的凭据，
+// 之后用凭据对 /api/v1/node/up 请求签名。返回 center 下发的会话 token。
+func RegisterNodeToCenter(centerURL string, ips map[string]string, port int, inventory *models.NodeInventory, enrollment Enrollment) (string, error) {
 	// Get machine ID
 	machineID := getMachineID()
 
-	// Get IP addresses
-	ips := utils.GetMyIpAddrs()
-
 	// Create agent info
 	agentInfo := models.NodeInfo{
-		ID:       machineID,
-		IPs:      ips,
-		LastSeen: time.Now(),
-		Status:   "online",
-	}
-
-	// Convert to JSON
-	jsonData, err := json.Marshal(agentInfo)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal agent info: %w", err)
+		ID:        machineID,
+		IPs:       ips,
+		LastSeen:  time.Now(),
+		Status:    "online",
+		Port:      port,
+		Inventory: inventory,
 	}
 
-	// 	r.Route("/api/v1/node", func(r chi.Router) {
-	// 		r.Post("/up", handler.nodeHandler.NodeUp)
-	// 		r.Post("/down", handler.nodeHandler.NodeDown)
-
-	// Ensure the URL has the correct format
-	if !strings.HasPrefix(centerURL, "http://") && !strings.HasPrefix(centerURL, "https://") {
-		centerURL = "http://" + centerURL
+	if err := CheckCenterTransport(centerURL, enrollment.AllowInsecure); err != nil {
+		return "", err
 	}
-
-	// Ensure the URL has the register endpoint
-	if !strings.HasSuffix(centerURL, "/api/v1/node/up") {
-		if strings.HasSuffix(centerURL, "/") {
-			centerURL = centerURL + "api/v1/node/up"
-		} else {
-			centerURL = centerURL + "/api/v1/node/up"
-		}
-	}
-
-	// Send registration request
-	resp, err := http.Post(centerURL, "application/json", strings.NewReader(string(jsonData)))
+	credential, err := loadCredential(enrollment.CredentialFile)
 	if err != nil {
-		return "", fmt.Errorf("failed to register with center: %w", err)
+		return "", err
 	}
-	defer resp.Body.Close()
 
-	// Check response
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("center returned non-OK status: %s", resp.Status)
-	}
-
-	var response map[string]string
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
+	var token string
+	if credential == "" {
+		if enrollment.JoinToken == "" {
+			return "", fmt.Errorf("no node credential in %s and no join token configured", enrollment.CredentialFile)
+		}
+		var response models.NodeEnrollResponse
+		request := models.NodeEnrollRequest{Node: agentInfo, JoinToken: enrollment.JoinToken}
+		if err := postToCenter(centerURL, "/api/v1/node/enroll", request, &response, ""); err != nil {
+			return "", fmt.Errorf("failed to enroll with center: %w", err)
+		}
+		if err := saveCredential(enrollment.CredentialFile, response.Credential); err != nil {
+			return "", err
+		}
+		log.Printf("Node %s enrolled, credential saved to %s", machineID, enrollment.CredentialFile)
+		token = response.Token
+	} else {
+		var response map[string]string
+		if err := postToCenter(centerURL, "/api/v1/node/up", agentInfo, &response, credential); err != nil {
+			return "", fmt.Errorf("failed to register with center: %w", err)
+		}
+		token = response["token"]
 	}
 
-	Token = response["token"]
-	return Token, nil
+	setNodeToken(token)
+	return token, nil
 }
 
-func SetupRouter() *chi.Mux {
+// SetupRouter 创建 agent API 的路由。除 /、/ping 和 /health 外的接口都要求 center 的请求签名。
+func SetupRouter(rules *RuleEngine, ipcGuard *IPCGuard, auth *APIAuth) *chi.Mux {
 
 	r := chi.NewRouter()
 	r.Use(middleware.RequestID)
@@ -101,20 +91,70 @@ func SetupRouter() *chi.Mux {
 		json.NewEncoder(w).Encode(data)
 	})
 
-	r.Post("/runEBPF", func(w http.ResponseWriter, r *http.Request) {
-		data := map[string]string{}
-		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
-		log.Println(data)
-		if data["token"] != Token {
-			w.WriteHeader(http.StatusUnauthorized)
-			return
-		}
-		// app := data["app"]
-		// args := data["args"]
-		w.WriteHeader(http.StatusOK)
+	r.Group(func(r chi.Router) {
+		r.Use(auth.Middleware)
+
+		r.Post("/runEBPF", func(w http.ResponseWriter, r *http.Request) {
+			data := map[string]string{}
+			if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			// app := data["app"]
+			// args := data["args"]
+			w.WriteHeader(http.StatusOK)
+		})
+
+		// 被拒绝的未签名或签名无效的请求数
+		r.Get("/stats/auth", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]uint64{"rejected": auth.Rejected()})
+		})
+
+		// 符号缓存的容量和命中统计
+		r.Get("/stats/symbols", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(platform.GetSymbolCacheStats())
+		})
+
+		// IPC 消息的接收和拒绝统计
+		r.Get("/stats/ipc", func(w http.ResponseWriter, r *http.Request) {
+			if ipcGuard == nil {
+				http.Error(w, "IPC peer verification is disabled", http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(ipcGuard.Stats())
+		})
+
+		// 查看当前的过滤规则及命中统计
+		r.Get("/rules", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(rules.Status())
+		})
+
+		// 整体替换过滤规则，立即对之后的事件生效
+		r.Put("/rules", func(w http.ResponseWriter, r *http.Request) {
+			var data struct {
+				Rules []Rule `json:"rules"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+				http.Error(w, "invalid request body", http.StatusBadRequest)
+				return
+			}
+			if err := rules.SetRules(data.Rules); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			log.Printf("Filtering rules updated: %d rules", len(data.Rules))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(rules.Status())
+		})
 	})
 
 	return r
@@ -0,0 +1,211 @@
+package agentmanager
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"scope/internal/models"
+	"scope/internal/probe"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 探针的运行方式
+const (
+	ProbeRuntimeAuto = "auto" // 优先在进程内加载，失败时启动 C 加载程序
+	ProbeRuntimeGo   = "go"   // 只在进程内加载
+	ProbeRuntimeC    = "c"    // 只启动 C 加载程序，事件经 ZMQ IPC 发布
+)
+
+// ProbeManager 管理 agent 启动时加载的探针
+type ProbeManager struct {
+	mu       sync.Mutex
+	inproc   map[string]*probe.Probe
+	external map[string]int    // 探针名 -> C 加载程序的 pid
+	versions map[string]string // 探针名 -> 对象文件或加载程序的摘要
+	guard    *IPCGuard         // 只接受这里启动的 C 加载程序发送的 IPC 消息
+}
+
+// ParseProbeTargets 解析 "cuda=/path/libcudart.so,ggml_base=/path/libggml-base.so" 形式的 uprobe 目标
+func ParseProbeTargets(s string) (map[string]string, error) {
+	targets := make(map[string]string)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, path, ok := strings.Cut(item, "=")
+		if !ok || path == "" {
+			return nil, fmt.Errorf("invalid probe target %q, want name=path", item)
+		}
+		if _, known := probe.Specs[name]; !known {
+			return nil, fmt.Errorf("unknown probe %q", name)
+		}
+		targets[name] = path
+	}
+	return targets, nil
+}
+
+// probeArgs 把探针参数转换为 C 加载程序的命令行参数
+func probeArgs(spec *probe.Spec, opts probe.Options) []string {
+	var args []string
+	if opts.PID > 0 {
+		args = append(args, "-p", strconv.Itoa(int(opts.PID)))
+	}
+	if opts.Comm != "" {
+		args = append(args, "-c", opts.Comm)
+	}
+	if opts.Target != "" && spec.TargetFlag != "" {
+		args = append(args, spec.TargetFlag, opts.Target)
+	}
+	if opts.Stack && spec.Stack {
+		args = append(args, "-s")
+	}
+	return args
+}
+
+// StartProbes 按 config.Probes 加载探针。进程内加载的探针把事件直接送入 msgChan，由 Processor 处理；
+// config.ProbeRuntime 为 auto 时加载失败 (例如内核不支持或对象文件不存在) 则启动对应的 C 加载程序，
+// 由 guard.Spawn 启动并登记 pid。
+func StartProbes(config Config, msgChan chan<- RawMessage, wg *sync.WaitGroup, guard *IPCGuard) (*ProbeManager, error) {
+	m := &ProbeManager{
+		inproc:   make(map[string]*probe.Probe),
+		external: make(map[string]int),
+		versions: make(map[string]string),
+		guard:    guard,
+	}
+	for _, name := range config.Probes {
+		spec, ok := probe.Specs[name]
+		if !ok {
+			m.Close()
+			return nil, fmt.Errorf("unknown probe %q (available: %s)", name, strings.Join(probe.Names(), ", "))
+		}
+		opts := probe.Options{
+			PID:    config.ProbePID,
+			Comm:   config.ProbeComm,
+			Target: config.ProbeTargets[name],
+			Stack:  config.ProbeStack,
+		}
+
+		if config.ProbeRuntime != ProbeRuntimeC {
+			object := probe.ObjectPath(config.BPFDir, spec.Name)
+			p, err := probe.Load(object, spec, opts)
+			if err == nil {
+				m.mu.Lock()
+				m.inproc[name] = p
+				m.versions[name] = fileDigest(object)
+				m.mu.Unlock()
+				wg.Add(1)
+				go func(name string, p *probe.Probe) {
+					defer wg.Done()
+					err := p.Run(func(event probe.Event) {
+						msgChan <- RawMessage{Event: &event}
+					})
+					if err != nil {
+						log.Printf("Probe %s stopped: %v", name, err)
+					}
+				}(name, p)
+				log.Printf("Loaded probe %s in-process", name)
+				continue
+			}
+			if config.ProbeRuntime == ProbeRuntimeGo {
+				m.Close()
+				return nil, fmt.Errorf("failed to load probe %s: %w", name, err)
+			}
+			log.Printf("Failed to load probe %s in-process, falling back to the C loader: %v", name, err)
+		}
+
+		// 由 guard 在持锁时启动并登记，加载程序连接后发送的第一条消息就能通过校验
+		start := func() int { return RunEBPF(spec.Name, probeArgs(spec, opts)) }
+		var pid int
+		if guard != nil {
+			pid = guard.Spawn(start)
+		} else {
+			pid = start()
+		}
+		if pid < 0 {
+			m.Close()
+			return nil, fmt.Errorf("failed to start C loader of probe %s", name)
+		}
+		m.mu.Lock()
+		m.external[name] = pid
+		m.versions[name] = fileDigest(filepath.Join(config.BPFDir, "build", spec.Name))
+		m.mu.Unlock()
+		log.Printf("Started C loader of probe %s (pid %d)", name, pid)
+	}
+	return m, nil
+}
+
+// Close 卸载进程内的探针并停止启动的 C 加载程序
+func (m *ProbeManager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, p := range m.inproc {
+		if err := p.Close(); err != nil {
+			log.Printf("Error closing probe %s: %v", name, err)
+		}
+		delete(m.inproc, name)
+	}
+	for name, pid := range m.external {
+		if _, err := StopProcess(pid); err != nil {
+			log.Printf("Error stopping C loader of probe %s: %v", name, err)
+		}
+		if m.guard != nil {
+			m.guard.Revoke(pid)
+		}
+		delete(m.external, name)
+	}
+}
+
+// Status 返回每个探针的运行状态，按探针名排序
+func (m *ProbeManager) Status() []models.ProbeStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	status := make([]models.ProbeStatus, 0, len(m.inproc)+len(m.external))
+	for name := range m.inproc {
+		status = append(status, models.ProbeStatus{Name: name, Runtime: ProbeRuntimeGo, Running: true, Version: m.versions[name]})
+	}
+	for name, pid := range m.external {
+		status = append(status, models.ProbeStatus{Name: name, Runtime: ProbeRuntimeC, PID: pid, Running: processRunning(pid), Version: m.versions[name]})
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].Name < status[j].Name })
+	return status
+}
+
+// fileDigest 返回文件 SHA-256 的前 12 位，用作探针版本；探针没有单独的版本号，同一次构建的对象文件摘要相同。
+// 读取失败时返回空字符串。
+func fileDigest(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// processRunning 判断进程是否仍在运行。RunEBPF 不回收子进程，退出的加载程序会以僵尸进程的形式留下，
+// 所以不能只用 signal 0 判断。
+func processRunning(pid int) bool {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+	// 第三个字段是状态，comm 中可能有空格，从最后一个 ')' 之后开始解析
+	i := bytes.LastIndexByte(data, ')')
+	if i < 0 || i+2 >= len(data) {
+		return false
+	}
+	state := data[i+2]
+	return state != 'Z' && state != 'X'
+}
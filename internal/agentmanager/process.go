@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"reflect"
 	"scope/internal/models"
 	"scope/internal/platform"
 	"sync"
@@ -32,21 +33,37 @@ func getMachineID() string {
 	return cachedMachineID
 }
 
+// decodePayload 把消息解码到 event 指向的 models 结构体: 进程内探针的事件已经是该结构体，直接赋值；
+// ZMQ 消息按 C 打包的数组格式解码
+func decodePayload(rawMsg RawMessage, event interface{}) error {
+	if rawMsg.Event == nil {
+		return msgpack.Unmarshal(rawMsg.Payload, event)
+	}
+	dst := reflect.ValueOf(event).Elem()
+	src := reflect.ValueOf(rawMsg.Event.Data)
+	if !src.IsValid() || src.Type() != dst.Type() {
+		return fmt.Errorf("event data %T does not match topic %s", rawMsg.Event.Data, rawMsg.Event.Topic)
+	}
+	dst.Set(src)
+	return nil
+}
+
 // --- Processor Goroutine (Handles Different Message Types, including Array) ---
 // Reads raw messages, unmarshals topic and payload, and processes.
-func Processor(msgChan <-chan RawMessage, wg *sync.WaitGroup, config Config, redisClient *goredis.Client) {
+// syscallAgg 不为 nil 时 syscalls 事件按 (pid, syscall) 汇总，config.SyscallRaw 为 false 时不再写入原始事件。
+// rules 不为 nil 时，写入 Redis Stream 之前按规则过滤、采样或汇总事件。
+func Processor(msgChan <-chan RawMessage, wg *sync.WaitGroup, config Config, redisClient *goredis.Client, syscallAgg *SyscallAggregator, rules *RuleEngine) {
 	defer wg.Done()
 
 	ctx := context.Background()
 
 	for rawMsg := range msgChan {
-		payloadBytes := rawMsg.Payload
-
 		// --- Unmarshal the Topic first ---
-		// (Topic is still expected to be a msgpack encoded string)
+		// (Topic is still expected to be a msgpack encoded string; in-process probes pass it decoded)
 		var topic string
-		err := msgpack.Unmarshal(rawMsg.Topic, &topic)
-		if err != nil {
+		if rawMsg.Event != nil {
+			topic = rawMsg.Event.Topic
+		} else if err := msgpack.Unmarshal(rawMsg.Topic, &topic); err != nil {
 			log.Printf("Processor: Error unmarshaling topic: %v (Raw Topic Bytes: %x)", err, rawMsg.Topic)
 			continue // Skip message with unparseable topic
 		}
@@ -60,7 +77,7 @@ func Processor(msgChan <-chan RawMessage, wg *sync.WaitGroup, config Config, red
 		case models.VfsOpenTopic:
 			// Use the untagged struct expecting an array format based on field order.
 			var event models.VfsOpenEvent
-			err := msgpack.Unmarshal(payloadBytes, &event)
+			err := decodePayload(rawMsg, &event)
 			if err != nil {
 				// If this error occurs often, double-check C packing order vs Go struct order
 				log.Printf("Processor: Error unmarshaling VfsOpenEvent (Array Format): %v", err)
@@ -91,11 +108,17 @@ func Processor(msgChan <-chan RawMessage, wg *sync.WaitGroup, config Config, red
 
 		case models.SyscallsTopic:
 			var event models.SyscallsEvent
-			err := msgpack.Unmarshal(payloadBytes, &event)
+			err := decodePayload(rawMsg, &event)
 			if err != nil {
 				log.Printf("Processor: Error unmarshaling SyscallsEvent (Array Format): %v", err)
 				continue
 			}
+			if syscallAgg != nil {
+				syscallAgg.Add(event.PID, event.Comm, event.SyscallName)
+				if !config.SyscallRaw {
+					continue
+				}
+			}
 			cmdline, _ := platform.GetCmdline(int(event.PID))
 			tsFormatted := time.Unix(0, event.TimestampNs).Format(time.RFC1123)
 			// Create event data for Redis
@@ -121,7 +144,7 @@ func Processor(msgChan <-chan RawMessage, wg *sync.WaitGroup, config Config, red
 
 		case models.SchedTopic:
 			var event models.SchedEvent
-			err := msgpack.Unmarshal(payloadBytes, &event)
+			err := decodePayload(rawMsg, &event)
 			if err != nil {
 				log.Printf("Processor: Error unmarshaling SchedEvent (Array Format): %v", err)
 				continue
@@ -137,6 +160,10 @@ func Processor(msgChan <-chan RawMessage, wg *sync.WaitGroup, config Config, red
 				"cpu":       event.Cpu,
 				"type":      "switch_in",
 			}
+			// sched_switch 上报的是线程 ID，补充所属进程 ID 以便按进程汇总
+			if tgid, err := platform.GetTgid(int(event.PID)); err == nil {
+				eventData["tgid"] = int32(tgid)
+			}
 			if event.Type == 0 {
 				// Create event data for Redis
 				eventData["type"] = "switch_in"
@@ -166,7 +193,7 @@ func Processor(msgChan <-chan RawMessage, wg *sync.WaitGroup, config Config, red
 
 		case models.OllamabinTopic:
 			var event models.LlamaLogEvent
-			err := msgpack.Unmarshal(payloadBytes, &event)
+			err := decodePayload(rawMsg, &event)
 			if err != nil {
 				log.Printf("Processor: Error unmarshaling LlamaLogEvent (Array Format): %v", err)
 				continue
@@ -192,7 +219,7 @@ func Processor(msgChan <-chan RawMessage, wg *sync.WaitGroup, config Config, red
 			}
 		case models.GGMLCudaTopic:
 			var event models.GGMLCudaEvent
-			err := msgpack.Unmarshal(payloadBytes, &event)
+			err := decodePayload(rawMsg, &event)
 			if err != nil {
 				log.Printf("Processor: Error unmarshaling GGMLCudaEvent (Array Format): %v", err)
 				continue
@@ -221,7 +248,7 @@ func Processor(msgChan <-chan RawMessage, wg *sync.WaitGroup, config Config, red
 
 		case models.GGMLCpuTopic:
 			var event models.GGMLCpuEvent
-			err := msgpack.Unmarshal(payloadBytes, &event)
+			err := decodePayload(rawMsg, &event)
 			if err != nil {
 				log.Printf("Processor: Error unmarshaling GGMLCpuEvent (Array Format): %v", err)
 				continue
@@ -268,7 +295,7 @@ func Processor(msgChan <-chan RawMessage, wg *sync.WaitGroup, config Config, red
 			}
 		case models.GGMLBaseTopic:
 			var event models.GGMLBaseEvent
-			err := msgpack.Unmarshal(payloadBytes, &event)
+			err := decodePayload(rawMsg, &event)
 			if err != nil {
 				log.Printf("Processor: Error unmarshaling GGMLBaseEvent (Array Format): %v", err)
 				continue
@@ -285,6 +312,9 @@ func Processor(msgChan <-chan RawMessage, wg *sync.WaitGroup, config Config, red
 				"size":      event.Size,
 				"ptr":       event.Ptr,
 			}
+			if len(event.Stack) > 0 {
+				eventData["stack"] = platform.SymbolizeStack(int(event.PID), event.Stack)
+			}
 
 			if event.Type == 0 {
 				// Add operation type for malloc
@@ -307,11 +337,13 @@ func Processor(msgChan <-chan RawMessage, wg *sync.WaitGroup, config Config, red
 			}
 		case models.ExecvTopic:
 			var event models.ExecvEvent
-			err := msgpack.Unmarshal(payloadBytes, &event)
+			err := decodePayload(rawMsg, &event)
 			if err != nil {
 				log.Printf("Processor: Error unmarshaling ExecvEvent (Array Format): %v", err)
 				continue
 			}
+			// exec 之后 comm 和 cmdline 已变化，丢弃该 pid 的缓存
+			platform.InvalidatePid(int(event.PID))
 			ppidcomm, _ := platform.GetComm(int(event.Ppid))
 			ppidcmdline, _ := platform.GetCmdline(int(event.Ppid))
 			pidcomm, _ := platform.GetComm(int(event.PID))
@@ -337,7 +369,7 @@ func Processor(msgChan <-chan RawMessage, wg *sync.WaitGroup, config Config, red
 			}
 		case models.CudaMallocTopic:
 			var event models.CudaMallocEvent
-			err := msgpack.Unmarshal(payloadBytes, &event)
+			err := decodePayload(rawMsg, &event)
 			if err != nil {
 				log.Printf("Processor: Error unmarshaling CudaMallocEvent (Array Format): %v", err)
 				continue
@@ -356,6 +388,10 @@ func Processor(msgChan <-chan RawMessage, wg *sync.WaitGroup, config Config, red
 				"size":      event.Size,
 				"retval":    event.Retval,
 			}
+			// 探针开启 -s 时带有调用栈，在进程仍然存在时解析为帧名
+			if len(event.Stack) > 0 {
+				eventData["stack"] = platform.SymbolizeStack(int(event.PID), event.Stack)
+			}
 
 			if config.Verbose {
 				fmt.Printf("Processed [%s]: Time=%s, PID=%d, Comm='%s', Cmdline='%s', CudaMalloc AllocatedPtr=0x%x, Size=%d, Retval=%d\n",
@@ -363,7 +399,7 @@ func Processor(msgChan <-chan RawMessage, wg *sync.WaitGroup, config Config, red
 			}
 		case models.CudaFreeTopic:
 			var event models.CudaFreeEvent
-			err := msgpack.Unmarshal(payloadBytes, &event)
+			err := decodePayload(rawMsg, &event)
 			if err != nil {
 				log.Printf("Processor: Error unmarshaling CudaFreeEvent (Array Format): %v", err)
 				continue
@@ -387,7 +423,7 @@ func Processor(msgChan <-chan RawMessage, wg *sync.WaitGroup, config Config, red
 			}
 		case models.CudaLaunchKernelTopic:
 			var event models.CudaLaunchKernelEvent
-			err := msgpack.Unmarshal(payloadBytes, &event)
+			err := decodePayload(rawMsg, &event)
 			if err != nil {
 				log.Printf("Processor: Error unmarshaling CudaLaunchKernelEvent (Array Format): %v", err)
 				continue
@@ -395,11 +431,14 @@ func Processor(msgChan <-chan RawMessage, wg *sync.WaitGroup, config Config, red
 			cmdline, _ := platform.GetCmdline(int(event.PID))
 			tsFormatted := time.Unix(0, event.TimestampNs).Format(time.RFC1123)
 
-			// 通过读取 /proc/PID/maps 可以获取到 funcptr 属于哪个库, 使用 addr2line 可以获取到函数名
+			// 通过读取 /proc/PID/maps 可以获取到 funcptr 属于哪个库, 再从该 ELF 文件的符号表和 DWARF 中获取函数名
 			symbol, err := platform.FindSymbolFromPidPtr(int(event.PID), uintptr(event.FuncPtr))
 			if err != nil {
 				fmt.Printf("Symbol: Error finding symbol: %v\n", err)
 			}
+			if symbol == nil {
+				symbol = &platform.SymbolInfo{}
+			}
 
 			// Create event data for Redis
 			eventData = map[string]interface{}{
@@ -410,11 +449,23 @@ func Processor(msgChan <-chan RawMessage, wg *sync.WaitGroup, config Config, red
 				"operation":     "cudaLaunchKernel",
 				"cmdline":       cmdline,
 				"func_ptr":      event.FuncPtr,
-				"symbol_name":   symbol.SymbolName,
 				"symbol_file":   symbol.FilePath,
 				"symbol_offset": symbol.Offset,
 			}
 
+			if len(event.Stack) > 0 {
+				eventData["stack"] = platform.SymbolizeStack(int(event.PID), event.Stack)
+			}
+
+			// 未解析时不上报占位名，后端可以用 (build-id, ELF 地址) 从符号仓库中离线解析
+			if symbol.Resolved {
+				eventData["symbol_name"] = symbol.SymbolName
+			}
+			if symbol.BuildID != "" {
+				eventData["symbol_build_id"] = symbol.BuildID
+				eventData["symbol_addr"] = symbol.Address
+			}
+
 			// Add source file information if available
 			if symbol.SourceLine != 0 {
 				eventData["symbol_sourcefile"] = fmt.Sprintf("%s:%d", symbol.SourceFile, symbol.SourceLine)
@@ -432,7 +483,7 @@ func Processor(msgChan <-chan RawMessage, wg *sync.WaitGroup, config Config, red
 
 		case models.CudaMemcpyTopic:
 			var event models.CudaMemcpyEvent
-			err := msgpack.Unmarshal(payloadBytes, &event)
+			err := decodePayload(rawMsg, &event)
 			if err != nil {
 				log.Printf("Processor: Error unmarshaling CudaMemcpyEvent (Array Format): %v", err)
 				continue
@@ -442,16 +493,17 @@ func Processor(msgChan <-chan RawMessage, wg *sync.WaitGroup, config Config, red
 
 			// Create event data for Redis with common fields
 			eventData = map[string]interface{}{
-				"topic":     topic,
-				"timestamp": event.TimestampNs,
-				"pid":       event.PID,
-				"comm":      event.Comm,
-				"operation": "cudaMemcpy",
-				"cmdline":   cmdline,
-				"src":       event.Src,
-				"dst":       event.Dst,
-				"size":      event.Size,
-				"kind":      event.Kind,
+				"topic":       topic,
+				"timestamp":   event.TimestampNs,
+				"pid":         event.PID,
+				"comm":        event.Comm,
+				"operation":   "cudaMemcpy",
+				"cmdline":     cmdline,
+				"src":         event.Src,
+				"dst":         event.Dst,
+				"size":        event.Size,
+				"kind":        event.Kind,
+				"duration_ns": event.DurationNs,
 			}
 
 			// Add a human-readable transfer type based on kind
@@ -511,7 +563,7 @@ func Processor(msgChan <-chan RawMessage, wg *sync.WaitGroup, config Config, red
 			}
 		case models.CudaSyncTopic:
 			var event models.CudaSyncEvent
-			err := msgpack.Unmarshal(payloadBytes, &event)
+			err := decodePayload(rawMsg, &event)
 			if err != nil {
 				log.Printf("Processor: Error unmarshaling CudaSyncEvent (Array Format): %v", err)
 				continue
@@ -543,26 +595,45 @@ func Processor(msgChan <-chan RawMessage, wg *sync.WaitGroup, config Config, red
 			eventData = map[string]interface{}{
 				"topic":     topic,
 				"timestamp": time.Now().UnixNano(),
-				"payload":   string(payloadBytes),
+				"payload":   string(rawMsg.Payload),
 			}
 		}
 
-		// Send data to Redis Stream if we have event data
+		// 按线程上报的事件使用所属进程的 pid
+		pid, hasPid := eventData["pid"].(int32)
+		if tgid, isThread := eventData["tgid"].(int32); isThread {
+			pid = tgid
+		}
 
-		eventData["machineid"] = getMachineID()
+		// 容器和身份信息从 /proc 读取 (按 pid 缓存)。规则按 container_id / cgroup / uid / exe 等过滤或分组时
+		// 必须在应用规则之前补充，否则先应用规则，被丢弃或汇总的事件不再读取 /proc
+		enrichFirst := hasPid && rules != nil && rules.NeedsProcFields()
+		if enrichFirst {
+			addContainerFields(eventData, int(pid))
+			addIdentityFields(eventData, int(pid))
+		}
 
-		eventJson, err := json.Marshal(eventData)
-		if err != nil {
-			log.Printf("Error json marshaling event data: %v", err)
+		if rules != nil && !rules.Apply(topic, eventData) {
 			continue
 		}
 
-		_, err = redisClient.XAdd(ctx, &goredis.XAddArgs{
-			Stream: config.StreamKey,
-			Values: map[string]interface{}{"data": string(eventJson)},
-		}).Result()
+		if hasPid && !enrichFirst {
+			addContainerFields(eventData, int(pid))
+			addIdentityFields(eventData, int(pid))
+		}
 
-		if err != nil {
+		// Send data to Redis Stream if we have event data
+
+		eventData["machineid"] = getMachineID()
+
+		// proc_uid = machine_id:pid:启动时间，pid 被复用后不同，用于跨表、跨时间关联同一进程。
+		if hasPid {
+			if procUID, err := platform.GetProcUID(getMachineID(), int(pid)); err == nil {
+				eventData["proc_uid"] = procUID
+			}
+		}
+
+		if err := publishEvent(ctx, redisClient, config.StreamKey, eventData); err != nil {
 			log.Printf("Error adding event to Redis Stream: %v", err)
 		}
 
@@ -570,3 +641,76 @@ func Processor(msgChan <-chan RawMessage, wg *sync.WaitGroup, config Config, red
 
 	log.Println("Processor goroutine finished (channel closed).")
 }
+
+// addContainerFields 补充进程所在的 cgroup 及容器 ID、pod UID (能识别时)
+func addContainerFields(eventData map[string]interface{}, pid int) {
+	info, err := platform.GetContainerInfo(pid)
+	if err != nil {
+		return
+	}
+	if info.CgroupPath != "" {
+		eventData["cgroup"] = info.CgroupPath
+	}
+	if info.ContainerID != "" {
+		eventData["container_id"] = info.ContainerID
+	}
+	if info.PodUID != "" {
+		eventData["pod_uid"] = info.PodUID
+	}
+}
+
+// addIdentityFields 补充进程的用户、命名空间和可执行文件信息
+func addIdentityFields(eventData map[string]interface{}, pid int) {
+	id, err := platform.GetProcessIdentity(pid)
+	if err != nil {
+		return
+	}
+	eventData["uid"] = id.UID
+	eventData["euid"] = id.EUID
+	eventData["gid"] = id.GID
+	if id.Username != "" {
+		eventData["username"] = id.Username
+	}
+	if id.MntNS != 0 {
+		eventData["mnt_ns"] = id.MntNS
+	}
+	if id.PidNS != 0 {
+		eventData["pid_ns"] = id.PidNS
+	}
+	if id.ExePath != "" {
+		eventData["exe"] = id.ExePath
+		eventData["exe_inode"] = id.ExeInode
+	}
+	if id.ExeDeleted {
+		eventData["exe_deleted"] = true
+	}
+	if id.BuildID != "" {
+		eventData["exe_build_id"] = id.BuildID
+	}
+}
+
+// publishEvent 把事件以 JSON 写入 Redis Stream 的 data 字段
+func publishEvent(ctx context.Context, redisClient *goredis.Client, streamKey string, eventData map[string]interface{}) error {
+	eventJson, err := json.Marshal(eventData)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	return redisClient.XAdd(ctx, &goredis.XAddArgs{
+		Stream: streamKey,
+		Values: map[string]interface{}{"data": string(eventJson)},
+	}).Err()
+}
+
+// ProcessReaper 周期性清除已退出或 pid 被复用的进程的 cmdline/comm/启动时间缓存，
+// 否则复用了 pid 的新进程会沿用旧进程的缓存
+func ProcessReaper(wg *sync.WaitGroup, interval time.Duration, verbose bool) {
+	defer wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if n := platform.ReapExitedPids(); n > 0 && verbose {
+			log.Printf("ProcessReaper: invalidated cache of %d exited processes", n)
+		}
+	}
+}
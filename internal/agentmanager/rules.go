@@ -0,0 +1,488 @@
+package agentmanager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"regexp"
+	"scope/internal/models"
+	"scope/internal/platform"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// 规则动作
+const (
+	RuleActionKeep      = "keep"      // 照常写入 Redis Stream
+	RuleActionDrop      = "drop"      // 丢弃
+	RuleActionSample    = "sample"    // 每 SampleN 条保留 1 条
+	RuleActionAggregate = "aggregate" // 按 AggregateBy 字段周期计数，写入 rule_agg 事件代替原始事件
+)
+
+// RulePredicate 是对事件中一个字段的判断。字段为 Processor 解码后写入 Redis 的字段 (如 comm, filename,
+// syscall, duration_ns) 以及从 /proc 补充的容器和身份字段 (如 container_id, uid, exe)，
+// 事件中没有该字段时判断结果为 false。
+//
+// Op 取值:
+//   - eq, ne: Value 为数字时按数值比较，否则按字符串比较
+//   - gt, ge, lt, le: Value 必须为数字
+//   - regex: Value 为正则表达式 (RE2 语法)
+//   - prefix: Value 为字符串前缀
+//   - in, not_in: Value 为数组，按字符串比较
+type RulePredicate struct {
+	Field string      `json:"field"`
+	Op    string      `json:"op"`
+	Value interface{} `json:"value"`
+}
+
+// Rule 是一条过滤规则。Topic 为空或 "*" 时匹配所有 topic，Match 中的判断全部成立时规则命中。
+type Rule struct {
+	Name        string          `json:"name"`
+	Topic       string          `json:"topic,omitempty"`
+	Match       []RulePredicate `json:"match,omitempty"`
+	Action      string          `json:"action"`
+	SampleN     int64           `json:"sample_n,omitempty"`     // sample 动作的采样间隔
+	AggregateBy []string        `json:"aggregate_by,omitempty"` // aggregate 动作的分组字段，默认 ["pid"]
+}
+
+// RuleStatus 是一条规则及其自加载以来的命中统计
+type RuleStatus struct {
+	Rule
+	Matched   uint64 `json:"matched"`
+	Forwarded uint64 `json:"forwarded"` // 命中后仍写入 Redis Stream 的原始事件数
+}
+
+type rulePredicate struct {
+	RulePredicate
+	num    float64
+	isNum  bool
+	str    string
+	regex  *regexp.Regexp
+	values map[string]bool
+}
+
+type compiledRule struct {
+	Rule
+	predicates []rulePredicate
+	procFields bool // 匹配或分组用到了需要从 /proc 补充的字段
+	matched    atomic.Uint64
+	forwarded  atomic.Uint64
+}
+
+// RuleEngine 在 Processor 写入 Redis Stream 之前按规则过滤、采样或汇总事件。
+// 规则按顺序匹配，第一条命中的规则决定动作，没有命中任何规则的事件照常写入。
+// 规则可以通过 agent API 热更新，更新时整体替换，命中统计重新开始。
+type RuleEngine struct {
+	rules      atomic.Pointer[[]*compiledRule]
+	aggregator *RuleAggregator
+	path       string // 规则持久化文件，为空时不持久化
+	saveMu     sync.Mutex
+}
+
+// NewRuleEngine 创建规则引擎，path 不为空且文件存在时从中加载规则
+func NewRuleEngine(path string, aggInterval time.Duration) (*RuleEngine, error) {
+	e := &RuleEngine{
+		aggregator: NewRuleAggregator(aggInterval),
+		path:       path,
+	}
+	e.rules.Store(&[]*compiledRule{})
+	if path == "" {
+		return e, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return e, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules file %s: %w", path, err)
+	}
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse rules file %s: %w", path, err)
+	}
+	compiled, err := compileRules(rules)
+	if err != nil {
+		return nil, err
+	}
+	e.rules.Store(&compiled)
+	return e, nil
+}
+
+// Aggregator 返回 aggregate 动作使用的汇总器
+func (e *RuleEngine) Aggregator() *RuleAggregator {
+	return e.aggregator
+}
+
+// SetRules 校验并替换全部规则。设置了持久化文件时同时写入文件，写入失败只记录日志，新规则仍然生效。
+func (e *RuleEngine) SetRules(rules []Rule) error {
+	compiled, err := compileRules(rules)
+	if err != nil {
+		return err
+	}
+	e.rules.Store(&compiled)
+	if e.path != "" {
+		if err := e.save(rules); err != nil {
+			log.Printf("WARN: Failed to save rules to %s: %v", e.path, err)
+		}
+	}
+	return nil
+}
+
+func (e *RuleEngine) save(rules []Rule) error {
+	e.saveMu.Lock()
+	defer e.saveMu.Unlock()
+	data, err := json.MarshalIndent(rules, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := e.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, e.path)
+}
+
+// Status 返回当前规则及命中统计
+func (e *RuleEngine) Status() []RuleStatus {
+	rules := *e.rules.Load()
+	status := make([]RuleStatus, 0, len(rules))
+	for _, r := range rules {
+		status = append(status, RuleStatus{Rule: r.Rule, Matched: r.matched.Load(), Forwarded: r.forwarded.Load()})
+	}
+	return status
+}
+
+// procFieldNames 是 Processor 从 /proc 补充的容器和身份字段，见 addContainerFields 与 addIdentityFields
+var procFieldNames = map[string]bool{
+	"cgroup": true, "container_id": true, "pod_uid": true,
+	"uid": true, "euid": true, "gid": true, "username": true, "mnt_ns": true, "pid_ns": true,
+	"exe": true, "exe_inode": true, "exe_deleted": true, "exe_build_id": true,
+}
+
+// NeedsProcFields 返回当前规则是否引用了从 /proc 补充的字段。
+// 引用时 Processor 需要在应用规则之前补充这些字段，否则只为保留下来的事件读取 /proc。
+func (e *RuleEngine) NeedsProcFields() bool {
+	for _, r := range *e.rules.Load() {
+		if r.procFields {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply 对一条事件应用规则，返回是否仍需写入 Redis Stream
+func (e *RuleEngine) Apply(topic string, eventData map[string]interface{}) bool {
+	for _, r := range *e.rules.Load() {
+		if !r.matches(topic, eventData) {
+			continue
+		}
+		n := r.matched.Add(1)
+		forward := false
+		switch r.Action {
+		case RuleActionKeep:
+			forward = true
+		case RuleActionSample:
+			forward = (n-1)%uint64(r.SampleN) == 0
+		case RuleActionAggregate:
+			e.aggregator.Add(r.Name, topic, r.AggregateBy, eventData)
+		}
+		if forward {
+			r.forwarded.Add(1)
+		}
+		return forward
+	}
+	return true
+}
+
+func compileRules(rules []Rule) ([]*compiledRule, error) {
+	compiled := make([]*compiledRule, 0, len(rules))
+	names := make(map[string]bool)
+	for i, rule := range rules {
+		if rule.Name == "" {
+			rule.Name = "rule-" + strconv.Itoa(i)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("duplicate rule name %q", rule.Name)
+		}
+		names[rule.Name] = true
+		if rule.Topic == "*" {
+			rule.Topic = ""
+		}
+
+		switch rule.Action {
+		case RuleActionKeep, RuleActionDrop:
+		case RuleActionSample:
+			if rule.SampleN < 1 {
+				return nil, fmt.Errorf("rule %q: sample_n must be >= 1", rule.Name)
+			}
+		case RuleActionAggregate:
+			if len(rule.AggregateBy) == 0 {
+				rule.AggregateBy = []string{"pid"}
+			}
+		default:
+			return nil, fmt.Errorf("rule %q: unknown action %q", rule.Name, rule.Action)
+		}
+
+		cr := &compiledRule{Rule: rule}
+		for _, p := range rule.Match {
+			cp, err := compilePredicate(p)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: %w", rule.Name, err)
+			}
+			cr.predicates = append(cr.predicates, cp)
+			cr.procFields = cr.procFields || procFieldNames[p.Field]
+		}
+		for _, field := range rule.AggregateBy {
+			cr.procFields = cr.procFields || procFieldNames[field]
+		}
+		compiled = append(compiled, cr)
+	}
+	return compiled, nil
+}
+
+func compilePredicate(p RulePredicate) (rulePredicate, error) {
+	cp := rulePredicate{RulePredicate: p}
+	if p.Field == "" {
+		return cp, fmt.Errorf("predicate field is required")
+	}
+	cp.num, cp.isNum = toFloat(p.Value)
+	cp.str = ruleValueString(p.Value)
+
+	switch p.Op {
+	case "eq", "ne":
+	case "gt", "ge", "lt", "le":
+		if !cp.isNum {
+			return cp, fmt.Errorf("%s on %q needs a numeric value", p.Op, p.Field)
+		}
+	case "regex":
+		s, ok := p.Value.(string)
+		if !ok {
+			return cp, fmt.Errorf("regex on %q needs a string value", p.Field)
+		}
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return cp, fmt.Errorf("invalid regex on %q: %w", p.Field, err)
+		}
+		cp.regex = re
+	case "prefix":
+		if _, ok := p.Value.(string); !ok {
+			return cp, fmt.Errorf("prefix on %q needs a string value", p.Field)
+		}
+	case "in", "not_in":
+		values, ok := p.Value.([]interface{})
+		if !ok {
+			return cp, fmt.Errorf("%s on %q needs an array value", p.Op, p.Field)
+		}
+		cp.values = make(map[string]bool, len(values))
+		for _, v := range values {
+			cp.values[ruleValueString(v)] = true
+		}
+	default:
+		return cp, fmt.Errorf("unknown op %q on %q", p.Op, p.Field)
+	}
+	return cp, nil
+}
+
+func (r *compiledRule) matches(topic string, eventData map[string]interface{}) bool {
+	if r.Topic != "" && r.Topic != topic {
+		return false
+	}
+	for i := range r.predicates {
+		if !r.predicates[i].eval(eventData) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *rulePredicate) eval(eventData map[string]interface{}) bool {
+	v, ok := eventData[p.Field]
+	if !ok {
+		return false
+	}
+	switch p.Op {
+	case "eq", "ne":
+		var equal bool
+		if f, isNum := toFloat(v); p.isNum && isNum {
+			equal = f == p.num
+		} else {
+			equal = ruleValueString(v) == p.str
+		}
+		return equal == (p.Op == "eq")
+	case "gt", "ge", "lt", "le":
+		f, isNum := toFloat(v)
+		if !isNum {
+			return false
+		}
+		switch p.Op {
+		case "gt":
+			return f > p.num
+		case "ge":
+			return f >= p.num
+		case "lt":
+			return f < p.num
+		default:
+			return f <= p.num
+		}
+	case "regex":
+		return p.regex.MatchString(fmt.Sprint(v))
+	case "prefix":
+		return strings.HasPrefix(fmt.Sprint(v), p.str)
+	case "in":
+		return p.values[ruleValueString(v)]
+	case "not_in":
+		return !p.values[ruleValueString(v)]
+	}
+	return false
+}
+
+// toFloat 把事件中的数值字段 (int32, uint64, ...) 和 JSON 解码的数字转换为 float64
+func toFloat(v interface{}) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+// ruleValueString 把字段值转换为字符串，数值统一格式化，使 JSON 中的 1000000 与事件中的 int64(1000000) 相等
+func ruleValueString(v interface{}) string {
+	if f, ok := toFloat(v); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+type ruleAggValue struct {
+	rule  string
+	topic string
+	group map[string]string
+	pid   int32
+	comm  string
+	count int64
+}
+
+// RuleAggregator 按 (规则, topic, 分组字段的值) 汇总 aggregate 动作命中的事件，
+// 每个周期向 Redis Stream 写入 rule_agg 事件
+type RuleAggregator struct {
+	mu          sync.Mutex
+	interval    time.Duration
+	windowStart time.Time
+	counts      map[string]*ruleAggValue
+}
+
+func NewRuleAggregator(interval time.Duration) *RuleAggregator {
+	return &RuleAggregator{
+		interval:    interval,
+		windowStart: time.Now(),
+		counts:      make(map[string]*ruleAggValue),
+	}
+}
+
+// Add 计入一条事件
+func (a *RuleAggregator) Add(rule, topic string, groupBy []string, eventData map[string]interface{}) {
+	group := make(map[string]string, len(groupBy))
+	var sb strings.Builder
+	sb.WriteString(rule + "\x00" + topic)
+	for _, field := range groupBy {
+		v := ""
+		if raw, ok := eventData[field]; ok {
+			v = fmt.Sprint(raw)
+		}
+		group[field] = v
+		sb.WriteString("\x00" + v)
+	}
+	key := sb.String()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if v, ok := a.counts[key]; ok {
+		v.count++
+		return
+	}
+	v := &ruleAggValue{rule: rule, topic: topic, group: group, count: 1}
+	// 只有按 pid 分组时 pid 和 comm 才有意义
+	if _, ok := group["pid"]; ok {
+		v.pid, _ = eventData["pid"].(int32)
+		v.comm, _ = eventData["comm"].(string)
+	}
+	a.counts[key] = v
+}
+
+// Flush 取出当前周期的汇总并开始新的周期
+func (a *RuleAggregator) Flush() []map[string]interface{} {
+	now := time.Now()
+	a.mu.Lock()
+	counts := a.counts
+	start := a.windowStart
+	a.counts = make(map[string]*ruleAggValue, len(counts))
+	a.windowStart = now
+	a.mu.Unlock()
+
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	events := make([]map[string]interface{}, 0, len(counts))
+	for _, key := range keys {
+		v := counts[key]
+		eventData := map[string]interface{}{
+			"topic":       models.RuleAggTopic,
+			"timestamp":   start.UnixNano(),
+			"pid":         v.pid,
+			"rule":        v.rule,
+			"event_topic": v.topic,
+			"group":       v.group,
+			"count":       v.count,
+			"interval_ns": now.Sub(start).Nanoseconds(),
+			"machineid":   getMachineID(),
+		}
+		if v.comm != "" {
+			eventData["comm"] = v.comm
+		}
+		if v.pid > 0 {
+			if procUID, err := platform.GetProcUID(getMachineID(), int(v.pid)); err == nil {
+				eventData["proc_uid"] = procUID
+			}
+			addContainerFields(eventData, int(v.pid))
+		}
+		events = append(events, eventData)
+	}
+	return events
+}
+
+// Run 每个周期把汇总结果写入 Redis Stream
+func (a *RuleAggregator) Run(wg *sync.WaitGroup, config Config, redisClient *goredis.Client) {
+	defer wg.Done()
+	ctx := context.Background()
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		events := a.Flush()
+		for _, eventData := range events {
+			if err := publishEvent(ctx, redisClient, config.StreamKey, eventData); err != nil {
+				log.Printf("Error adding rule rollup to Redis Stream: %v", err)
+			}
+		}
+		if config.Verbose && len(events) > 0 {
+			log.Printf("RuleAggregator: flushed %d rule rollups", len(events))
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package agentmanager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRulePredicateEval(t *testing.T) {
+	event := map[string]interface{}{
+		"pid":         int32(42),
+		"comm":        "ollama",
+		"filename":    "/usr/lib/libcuda.so",
+		"duration_ns": uint64(1500000),
+	}
+	tests := []struct {
+		name string
+		pred RulePredicate
+		want bool
+	}{
+		{"eq number", RulePredicate{"pid", "eq", float64(42)}, true},
+		{"eq number mismatch", RulePredicate{"pid", "eq", float64(43)}, false},
+		{"eq string", RulePredicate{"comm", "eq", "ollama"}, true},
+		{"eq number as string", RulePredicate{"pid", "eq", "42"}, true},
+		{"ne", RulePredicate{"comm", "ne", "python"}, true},
+		{"ne equal", RulePredicate{"comm", "ne", "ollama"}, false},
+		{"gt", RulePredicate{"duration_ns", "gt", float64(1000000)}, true},
+		{"gt equal", RulePredicate{"duration_ns", "gt", float64(1500000)}, false},
+		{"ge", RulePredicate{"duration_ns", "ge", float64(1500000)}, true},
+		{"lt", RulePredicate{"pid", "lt", float64(100)}, true},
+		{"le", RulePredicate{"pid", "le", float64(41)}, false},
+		{"regex", RulePredicate{"filename", "regex", `libcu(da|blas)\.so`}, true},
+		{"regex no match", RulePredicate{"comm", "regex", `^py`}, false},
+		{"prefix", RulePredicate{"filename", "prefix", "/usr/lib/"}, true},
+		{"prefix no match", RulePredicate{"filename", "prefix", "/proc/"}, false},
+		{"in", RulePredicate{"pid", "in", []interface{}{float64(1), float64(42)}}, true},
+		{"in strings", RulePredicate{"comm", "in", []interface{}{"python", "vllm"}}, false},
+		{"not_in", RulePredicate{"comm", "not_in", []interface{}{"python", "vllm"}}, true},
+		{"not_in present", RulePredicate{"pid", "not_in", []interface{}{float64(42)}}, false},
+		// 事件中没有该字段时判断不成立，not_in 也一样
+		{"missing field", RulePredicate{"syscall", "ne", "read"}, false},
+		{"missing field not_in", RulePredicate{"syscall", "not_in", []interface{}{"read"}}, false},
+		// 数值比较遇到字符串字段时不成立
+		{"numeric op on string field", RulePredicate{"comm", "gt", float64(0)}, false},
+		{"numeric op on string field le", RulePredicate{"comm", "le", float64(1e18)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := compilePredicate(tt.pred)
+			if err != nil {
+				t.Fatalf("compilePredicate: %v", err)
+			}
+			if got := p.eval(event); got != tt.want {
+				t.Errorf("eval = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileRulesInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+	}{
+		{"numeric op with string value", Rule{Action: RuleActionDrop, Match: []RulePredicate{{"pid", "gt", "ten"}}}},
+		{"invalid regex", Rule{Action: RuleActionDrop, Match: []RulePredicate{{"comm", "regex", "("}}}},
+		{"regex with number", Rule{Action: RuleActionDrop, Match: []RulePredicate{{"comm", "regex", float64(1)}}}},
+		{"in without array", Rule{Action: RuleActionDrop, Match: []RulePredicate{{"comm", "in", "ollama"}}}},
+		{"unknown op", Rule{Action: RuleActionDrop, Match: []RulePredicate{{"comm", "contains", "o"}}}},
+		{"missing field", Rule{Action: RuleActionDrop, Match: []RulePredicate{{"", "eq", "o"}}}},
+		{"sample_n 0", Rule{Action: RuleActionSample, SampleN: 0}},
+		{"unknown action", Rule{Action: "forward"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := compileRules([]Rule{tt.rule}); err == nil {
+				t.Errorf("compileRules accepted %+v", tt.rule)
+			}
+		})
+	}
+	if _, err := compileRules([]Rule{{Name: "a", Action: RuleActionDrop}, {Name: "a", Action: RuleActionKeep}}); err == nil {
+		t.Errorf("compileRules accepted duplicate rule names")
+	}
+}
+
+func TestRuleEngineApply(t *testing.T) {
+	tests := []struct {
+		name        string
+		rules       []Rule
+		events      int
+		wantForward int
+	}{
+		{"no rules", nil, 5, 5},
+		{"drop", []Rule{{Action: RuleActionDrop}}, 5, 0},
+		{"keep", []Rule{{Action: RuleActionKeep}}, 5, 5},
+		{"sample_n 1 keeps all", []Rule{{Action: RuleActionSample, SampleN: 1}}, 5, 5},
+		{"sample_n 3", []Rule{{Action: RuleActionSample, SampleN: 3}}, 7, 3},
+		{"other topic", []Rule{{Topic: "execv", Action: RuleActionDrop}}, 5, 5},
+		{"first match wins", []Rule{{Name: "k", Action: RuleActionKeep}, {Name: "d", Action: RuleActionDrop}}, 5, 5},
+		{"aggregate", []Rule{{Action: RuleActionAggregate}}, 5, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := NewRuleEngine("", time.Minute)
+			if err != nil {
+				t.Fatalf("NewRuleEngine: %v", err)
+			}
+			if err := e.SetRules(tt.rules); err != nil {
+				t.Fatalf("SetRules: %v", err)
+			}
+			forwarded := 0
+			for i := 0; i < tt.events; i++ {
+				if e.Apply("openat2", map[string]interface{}{"pid": int32(1), "comm": "ollama"}) {
+					forwarded++
+				}
+			}
+			if forwarded != tt.wantForward {
+				t.Errorf("forwarded %d events, want %d", forwarded, tt.wantForward)
+			}
+		})
+	}
+}
+
+func TestRuleEngineNeedsProcFields(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []Rule
+		want  bool
+	}{
+		{"no rules", nil, false},
+		{"event fields only", []Rule{{Match: []RulePredicate{{Field: "comm", Op: "eq", Value: "ollama"}}, Action: RuleActionDrop}}, false},
+		{"match on container_id", []Rule{{Match: []RulePredicate{{Field: "container_id", Op: "prefix", Value: "abc"}}, Action: RuleActionKeep}}, true},
+		{"aggregate by exe", []Rule{{Action: RuleActionAggregate, AggregateBy: []string{"exe"}}}, true},
+		{"aggregate by default pid", []Rule{{Action: RuleActionAggregate}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := NewRuleEngine("", time.Minute)
+			if err != nil {
+				t.Fatalf("NewRuleEngine: %v", err)
+			}
+			if err := e.SetRules(tt.rules); err != nil {
+				t.Fatalf("SetRules: %v", err)
+			}
+			if got := e.NeedsProcFields(); got != tt.want {
+				t.Errorf("NeedsProcFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleEnginePersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	e, err := NewRuleEngine(path, time.Minute)
+	if err != nil {
+		t.Fatalf("NewRuleEngine: %v", err)
+	}
+	rules := []Rule{
+		{Name: "drop-proc", Topic: "openat2", Action: RuleActionDrop, Match: []RulePredicate{{"filename", "prefix", "/proc/"}}},
+		{Name: "sample-read", Action: RuleActionSample, SampleN: 10, Match: []RulePredicate{{"syscall", "in", []interface{}{"read", "write"}}}},
+	}
+	if err := e.SetRules(rules); err != nil {
+		t.Fatalf("SetRules: %v", err)
+	}
+	if matches, _ := filepath.Glob(path + ".tmp"); len(matches) != 0 {
+		t.Errorf("temporary file left behind: %v", matches)
+	}
+
+	reloaded, err := NewRuleEngine(path, time.Minute)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	status := reloaded.Status()
+	if len(status) != len(rules) {
+		t.Fatalf("reloaded %d rules, want %d", len(status), len(rules))
+	}
+	for i, s := range status {
+		if s.Name != rules[i].Name || s.Action != rules[i].Action || s.SampleN != rules[i].SampleN || len(s.Match) != len(rules[i].Match) {
+			t.Errorf("rule %d = %+v, want %+v", i, s.Rule, rules[i])
+		}
+	}
+	if reloaded.Apply("openat2", map[string]interface{}{"filename": "/proc/self/stat"}) {
+		t.Errorf("reloaded drop rule did not apply")
+	}
+}
+
+func TestPutRulesRejectsInvalidRegex(t *testing.T) {
+	setNodeToken(testNodeToken)
+	defer setNodeToken("")
+	engine, err := NewRuleEngine("", time.Minute)
+	if err != nil {
+		t.Fatalf("NewRuleEngine: %v", err)
+	}
+	if err := engine.SetRules([]Rule{{Name: "keep", Action: RuleActionKeep}}); err != nil {
+		t.Fatalf("SetRules: %v", err)
+	}
+	router := SetupRouter(engine, nil, NewAPIAuth(time.Minute))
+
+	body := `{"rules":[{"name":"bad","action":"drop","match":[{"field":"comm","op":"regex","value":"("}]}]}`
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, newSignedRequest(t, http.MethodPut, "/rules", body))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid regex") {
+		t.Errorf("PUT /rules = %d %q, want 400 invalid regex", w.Code, w.Body.String())
+	}
+	// 校验失败时原有规则不变
+	if status := engine.Status(); len(status) != 1 || status[0].Name != "keep" {
+		t.Errorf("rules changed after a rejected PUT: %+v", status)
+	}
+}
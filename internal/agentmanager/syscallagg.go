@@ -0,0 +1,128 @@
+package agentmanager
+
+import (
+	"context"
+	"log"
+	"scope/internal/models"
+	"scope/internal/platform"
+	"sync"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+type syscallAggKey struct {
+	pid     int32
+	syscall string
+}
+
+type syscallAggValue struct {
+	comm      string
+	cmdline   string
+	procUID   string
+	container platform.ContainerInfo
+	count     int64
+}
+
+// SyscallAggregator 在 agent 中按 (pid, syscall) 汇总 syscalls 事件，每个周期向 Redis Stream
+// 写入一条 syscalls_agg 事件，代替每次系统调用一条的原始事件
+type SyscallAggregator struct {
+	mu          sync.Mutex
+	interval    time.Duration
+	windowStart time.Time
+	counts      map[syscallAggKey]*syscallAggValue
+}
+
+func NewSyscallAggregator(interval time.Duration) *SyscallAggregator {
+	return &SyscallAggregator{
+		interval:    interval,
+		windowStart: time.Now(),
+		counts:      make(map[syscallAggKey]*syscallAggValue),
+	}
+}
+
+// Add 计入一次系统调用，cmdline、proc_uid 和容器信息只在该 (pid, syscall) 本周期第一次出现时读取
+func (a *SyscallAggregator) Add(pid int32, comm, syscall string) {
+	key := syscallAggKey{pid: pid, syscall: syscall}
+
+	a.mu.Lock()
+	v, ok := a.counts[key]
+	if ok {
+		v.count++
+		a.mu.Unlock()
+		return
+	}
+	a.mu.Unlock()
+
+	cmdline, _ := platform.GetCmdline(int(pid))
+	procUID, _ := platform.GetProcUID(getMachineID(), int(pid))
+	container, _ := platform.GetContainerInfo(int(pid))
+
+	a.mu.Lock()
+	if v, ok := a.counts[key]; ok {
+		v.count++
+	} else {
+		a.counts[key] = &syscallAggValue{comm: comm, cmdline: cmdline, procUID: procUID, container: container, count: 1}
+	}
+	a.mu.Unlock()
+}
+
+// Flush 取出当前周期的汇总并开始新的周期。返回的每条事件的 timestamp 为周期开始时间。
+func (a *SyscallAggregator) Flush() []map[string]interface{} {
+	now := time.Now()
+	a.mu.Lock()
+	counts := a.counts
+	start := a.windowStart
+	a.counts = make(map[syscallAggKey]*syscallAggValue, len(counts))
+	a.windowStart = now
+	a.mu.Unlock()
+
+	events := make([]map[string]interface{}, 0, len(counts))
+	for key, v := range counts {
+		eventData := map[string]interface{}{
+			"topic":       models.SyscallsAggTopic,
+			"timestamp":   start.UnixNano(),
+			"pid":         key.pid,
+			"comm":        v.comm,
+			"cmdline":     v.cmdline,
+			"syscall":     key.syscall,
+			"count":       v.count,
+			"interval_ns": now.Sub(start).Nanoseconds(),
+			"machineid":   getMachineID(),
+		}
+		if v.procUID != "" {
+			eventData["proc_uid"] = v.procUID
+		}
+		if v.container.CgroupPath != "" {
+			eventData["cgroup"] = v.container.CgroupPath
+		}
+		if v.container.ContainerID != "" {
+			eventData["container_id"] = v.container.ContainerID
+		}
+		if v.container.PodUID != "" {
+			eventData["pod_uid"] = v.container.PodUID
+		}
+		events = append(events, eventData)
+	}
+	return events
+}
+
+// Run 每个周期把汇总结果写入 Redis Stream
+func (a *SyscallAggregator) Run(wg *sync.WaitGroup, config Config, redisClient *goredis.Client) {
+	defer wg.Done()
+	ctx := context.Background()
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		events := a.Flush()
+		for _, eventData := range events {
+			if err := publishEvent(ctx, redisClient, config.StreamKey, eventData); err != nil {
+				log.Printf("Error adding syscall rollup to Redis Stream: %v", err)
+			}
+		}
+		if config.Verbose && len(events) > 0 {
+			log.Printf("SyscallAggregator: flushed %d (pid, syscall) rollups", len(events))
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package agentmanager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"scope/internal/utils"
+	"strings"
+	"testing"
+)
+
+const testNodeToken = "test-node-token"
+
+// newSignedRequest 创建用节点 token 签名的 agent API 请求，调用前需要 setNodeToken(testNodeToken)
+func newSignedRequest(t *testing.T, method, path, body string) *http.Request {
+	t.Helper()
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if err := utils.SignRequest(r, getMachineID(), []byte(testNodeToken), []byte(body)); err != nil {
+		t.Fatalf("SignRequest: %v", err)
+	}
+	return r
+}
@@ -11,7 +11,8 @@ import (
 )
 
 // Reads from ZMQ socket and sends raw messages to the channel.
-func ZMQReceiver(subscriber *zmq.Socket, msgChan chan<- RawMessage, wg *sync.WaitGroup) {
+// guard 非 nil 时按发送方的 SO_PEERCRED 丢弃不是由 agent 启动的探针发送的消息。
+func ZMQReceiver(subscriber *zmq.Socket, msgChan chan<- RawMessage, wg *sync.WaitGroup, guard *IPCGuard) {
 	defer wg.Done()
 	defer close(msgChan)
 
@@ -38,7 +39,7 @@ func ZMQReceiver(subscriber *zmq.Socket, msgChan chan<- RawMessage, wg *sync.Wai
 		}
 
 		if len(polledSockets) > 0 {
-			msgParts, err := subscriber.RecvMessageBytes(0)
+			msgParts, metadata, err := subscriber.RecvMessageBytesWithMetadata(0, "Peer-Address")
 			if err != nil {
 				if zmq.AsErrno(err) == zmq.ETERM {
 					fmt.Println("Receiver: Context terminated during receive, exiting.")
@@ -49,6 +50,10 @@ func ZMQReceiver(subscriber *zmq.Socket, msgChan chan<- RawMessage, wg *sync.Wai
 				continue
 			}
 
+			if guard != nil && !guard.Check(metadata["Peer-Address"]) {
+				continue
+			}
+
 			if len(msgParts) != 2 {
 				log.Printf("Receiver: Error: Received message with %d parts, expected 2 (EncodedTopic, Payload)", len(msgParts))
 				continue
@@ -0,0 +1,69 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"scope/internal/models"
+	"scope/internal/utils"
+)
+
+// AgentClient 调用节点 agent 的 API: 每个请求用节点注册时下发的 token 做 HMAC 签名，
+// 配置了 CA 时通过 HTTPS 访问并校验 agent 证书，可选出示客户端证书 (双向 TLS)
+type AgentClient struct {
+	client *http.Client
+	scheme string
+}
+
+// NewAgentClient 创建 agent 客户端。caFile 为空时使用明文 HTTP；certFile 和 keyFile 为 center 的客户端证书。
+func NewAgentClient(caFile, certFile, keyFile string, timeout time.Duration) (*AgentClient, error) {
+	c := &AgentClient{client: &http.Client{Timeout: timeout}, scheme: "http"}
+	if caFile == "" {
+		if certFile != "" {
+			return nil, fmt.Errorf("客户端证书需要同时配置 agent 的 CA")
+		}
+		return c, nil
+	}
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("读取 agent CA 失败: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%s 中没有证书", caFile)
+	}
+	tlsConfig := &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("加载客户端证书失败: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	c.client.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+	c.scheme = "https"
+	return c, nil
+}
+
+// Do 向节点 node 的 host (ip:port) 发送签名请求
+func (c *AgentClient) Do(ctx context.Context, node models.NodeInfo, host, method, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.scheme+"://"+host+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if node.Token != "" {
+		if err := utils.SignRequest(req, node.ID, []byte(node.Token), body); err != nil {
+			return nil, err
+		}
+	}
+	return c.client.Do(req)
+}
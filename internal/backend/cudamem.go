@@ -0,0 +1,373 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"scope/database/postgres"
+	"scope/internal/models"
+)
+
+// CudaAllocation 是一次仍存活的 cudaMalloc 分配
+type CudaAllocation struct {
+	Ptr     int64     `json:"ptr"`
+	Size    int64     `json:"size"`
+	AllocTs time.Time `json:"alloc_ts"`
+	AgeNs   int64     `json:"age_ns"` // 截至分析窗口结束时的存活时长
+}
+
+// CudaMemSample 是某个时间桶结束时的显存占用
+type CudaMemSample struct {
+	Ts               time.Time `json:"ts"`
+	OutstandingBytes int64     `json:"outstanding_bytes"`
+	PeakBytes        int64     `json:"peak_bytes"` // 桶内的最大占用
+}
+
+// CudaMemProcessReport 是单个进程的显存分配重建结果
+type CudaMemProcessReport struct {
+	PID              int32                   `json:"pid"`
+	Comm             string                  `json:"comm"`
+	Cmdline          string                  `json:"cmdline"`
+	Mallocs          int                     `json:"mallocs"`
+	FailedMallocs    int                     `json:"failed_mallocs"`
+	Frees            int                     `json:"frees"`
+	OutstandingBytes int64                   `json:"outstanding_bytes"`
+	PeakBytes        int64                   `json:"peak_bytes"`
+	LiveAllocations  int                     `json:"live_allocations"`
+	Timeline         []CudaMemSample         `json:"timeline"`
+	Findings         []models.CudaMemFinding `json:"findings"`
+
+	live map[int64]CudaAllocation // 截至窗口结束仍存活的分配，供泄漏检测延续到下一次运行
+}
+
+// CudaMemReport 是一台机器在一个时间窗口内的显存分析结果
+type CudaMemReport struct {
+	MachineID string                 `json:"machine_id"`
+	Start     time.Time              `json:"start"`
+	End       time.Time              `json:"end"`
+	Processes []CudaMemProcessReport `json:"processes"`
+}
+
+type CudaMemService struct {
+	eventStore    *postgres.EventStore
+	analysisStore *postgres.AnalysisStore
+
+	leakMu    sync.Mutex
+	leakState map[string]*cudaLeakState // 机器 ID -> 泄漏检测在两次运行之间保留的状态
+}
+
+// cudaLeakSettleDelay 是泄漏检测等待事件写入的时间，只分析该时间之前的事件，避免漏掉迟到的事件
+const cudaLeakSettleDelay = 30 * time.Second
+
+// cudaLeakState 是一台机器的增量泄漏检测状态。每次运行只读取上次检查之后的事件，
+// 并把上次仍存活的分配作为起点，这样窗口开始前分配、窗口内释放的指针不会被报告为 unknown_free，
+// 同一个问题也不会在每次运行时重复写入。
+type cudaLeakState struct {
+	checkedUntil time.Time
+	initialEnd   time.Time // 第一次运行的窗口结束时间，第一次运行分页读取时每一页都按第一次运行处理
+	procs        map[int32]*cudaLeakProc
+}
+
+type cudaLeakProc struct {
+	comm, cmdline string
+	live          map[int64]CudaAllocation
+	reported      map[int64]int64 // 已报告为 long_lived 的分配: 指针 -> 分配时间 (纳秒)
+	lastTs        time.Time
+	// fullyObserved 表示进程在检测开始之后才出现，且第一个事件是 cudaMalloc，它的所有分配都被看到了。
+	// 只有这样的进程才报告 unknown_free，其余进程的未知指针可能是检测开始前分配的。
+	fullyObserved bool
+}
+
+// Analyze 重建窗口内每个进程的显存分配。
+// 窗口应覆盖进程的完整生命周期，否则窗口开始前分配的指针被释放时会被报告为 unknown_free。
+func (s *CudaMemService) Analyze(ctx context.Context, filter postgres.EventFilter, minAge, bucket time.Duration) (*CudaMemReport, error) {
+	filter.Subtypes = []string{models.CudaMallocTopic, models.CudaFreeTopic}
+	events, err := s.eventStore.ListCudaEvents(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	report := analyzeCudaMemory(filter.MachineID, events, filter.Start, filter.End, minAge, bucket, time.Now().UTC())
+	return report, nil
+}
+
+// ListFindings 查询检测任务写入的历史结果
+func (s *CudaMemService) ListFindings(ctx context.Context, filter postgres.EventFilter) ([]models.CudaMemFinding, error) {
+	return s.analysisStore.ListCudaMemFindings(ctx, filter)
+}
+
+// RunLeakCheck 对所有有 CUDA 事件的机器增量检测显存问题，并把新发现的问题写入 cuda_mem_findings。
+// 第一次运行分析最近 lookback 时间，之后从上次检查结束的时间继续。
+func (s *CudaMemService) RunLeakCheck(ctx context.Context, lookback, minAge time.Duration) error {
+	s.leakMu.Lock()
+	defer s.leakMu.Unlock()
+	if s.leakState == nil {
+		s.leakState = make(map[string]*cudaLeakState)
+	}
+
+	now := time.Now().UTC()
+	end := now.Add(-cudaLeakSettleDelay)
+	machineIDs, err := s.analysisStore.ListMachineIDs(ctx, "events_cuda", postgres.EventFilter{Start: end.Add(-lookback), End: end})
+	if err != nil {
+		return err
+	}
+	for _, machineID := range machineIDs {
+		state, ok := s.leakState[machineID]
+		if !ok {
+			state = &cudaLeakState{initialEnd: end, procs: make(map[int32]*cudaLeakProc)}
+			s.leakState[machineID] = state
+		}
+		start := state.checkedUntil
+		if start.IsZero() || start.Before(end.Add(-lookback)) {
+			start = end.Add(-lookback)
+		}
+		// 事件超过单次查询上限时按时间分页，每页分析到读到的最后一个时间戳为止
+		for start.Before(end) {
+			pageEnd := end
+			events, err := s.eventStore.ListCudaEvents(ctx, postgres.EventFilter{
+				MachineID: machineID,
+				Start:     start,
+				End:       end,
+				Subtypes:  []string{models.CudaMallocTopic, models.CudaFreeTopic},
+			})
+			if errors.Is(err, postgres.ErrTooManyEvents) {
+				events, pageEnd = truncateAtLastTs(events, func(e models.CudaEvent) time.Time { return e.Ts })
+				if !pageEnd.After(start) {
+					return fmt.Errorf("机器 %s 在 %v 的 CUDA 事件超过单次查询上限: %w", machineID, start, err)
+				}
+			} else if err != nil {
+				return err
+			}
+			findings := state.check(machineID, events, start, pageEnd, lookback, minAge, now)
+			if err := s.analysisStore.InsertCudaMemFindings(ctx, findings); err != nil {
+				return err
+			}
+			start = pageEnd
+		}
+	}
+	return nil
+}
+
+// check 从上次的存活分配继续分析 [start, end) 内的事件，返回新发现的问题并更新状态。
+// 超过 idle 没有事件的进程被丢弃，pid 可能已被复用。
+func (st *cudaLeakState) check(machineID string, events []models.CudaEvent, start, end time.Time, idle, minAge time.Duration, detectedAt time.Time) []models.CudaMemFinding {
+	initial := st.checkedUntil.IsZero() || st.checkedUntil.Before(st.initialEnd)
+	st.checkedUntil = end
+
+	for _, e := range events {
+		p, ok := st.procs[e.PID]
+		if !ok {
+			p = &cudaLeakProc{
+				live:          make(map[int64]CudaAllocation),
+				reported:      make(map[int64]int64),
+				fullyObserved: !initial && e.EventSubtype == models.CudaMallocTopic && e.CudaRetval == 0,
+			}
+			st.procs[e.PID] = p
+		}
+		p.lastTs = e.Ts
+	}
+
+	// 上次仍存活的分配作为分配事件放在最前面
+	var carried []models.CudaEvent
+	for pid, p := range st.procs {
+		for _, alloc := range p.live {
+			carried = append(carried, models.CudaEvent{
+				Ts: alloc.AllocTs, EventSubtype: models.CudaMallocTopic, PID: pid, Comm: p.comm, Cmdline: p.cmdline,
+				CudaPtr: alloc.Ptr, CudaSize: alloc.Size,
+			})
+		}
+	}
+	sort.Slice(carried, func(i, j int) bool { return carried[i].Ts.Before(carried[j].Ts) })
+	report := analyzeCudaMemory(machineID, append(carried, events...), start, end, minAge, end.Sub(start), detectedAt)
+
+	var findings []models.CudaMemFinding
+	for _, proc := range report.Processes {
+		p := st.procs[proc.PID]
+		p.comm, p.cmdline = proc.Comm, proc.Cmdline
+		p.live = proc.live
+		for _, f := range proc.Findings {
+			switch f.FindingType {
+			case models.CudaMemFindingUnknownFree:
+				if !p.fullyObserved {
+					continue
+				}
+			case models.CudaMemFindingLongLived:
+				if allocNs, ok := p.reported[f.CudaPtr]; ok && allocNs == f.Ts.UnixNano() {
+					continue
+				}
+				p.reported[f.CudaPtr] = f.Ts.UnixNano()
+			}
+			findings = append(findings, f)
+		}
+		for ptr := range p.reported {
+			if _, ok := p.live[ptr]; !ok {
+				delete(p.reported, ptr)
+			}
+		}
+	}
+	for pid, p := range st.procs {
+		if end.Sub(p.lastTs) > idle {
+			delete(st.procs, pid)
+		}
+	}
+	return findings
+}
+
+// analyzeCudaMemory 按 pid 配对 cudaMalloc/cudaFree。events 需按时间升序排列。
+//
+// 返回值非零的 cudaMalloc 被忽略；cudaFree(NULL) 是合法的空操作也被忽略。
+// 对已释放指针的再次释放记为 double_free，对从未见过的指针的释放记为 unknown_free，
+// 截至 end 仍存活且存活时间不小于 minAge 的分配记为 long_lived。
+func analyzeCudaMemory(machineID string, events []models.CudaEvent, start, end time.Time, minAge, bucket time.Duration, detectedAt time.Time) *CudaMemReport {
+	type procState struct {
+		report  *CudaMemProcessReport
+		live    map[int64]CudaAllocation
+		freed   map[int64]bool
+		current int64
+		// 当前时间桶
+		bucketEnd  time.Time
+		bucketPeak int64
+	}
+	if bucket <= 0 {
+		bucket = time.Second
+	}
+
+	procs := make(map[int32]*procState)
+	getProc := func(e models.CudaEvent) *procState {
+		p, ok := procs[e.PID]
+		if !ok {
+			p = &procState{
+				report: &CudaMemProcessReport{PID: e.PID, Comm: e.Comm, Cmdline: e.Cmdline},
+				live:   make(map[int64]CudaAllocation),
+				freed:  make(map[int64]bool),
+			}
+			procs[e.PID] = p
+		}
+		if p.report.Cmdline == "" {
+			p.report.Cmdline = e.Cmdline
+		}
+		return p
+	}
+	flushBucket := func(p *procState) {
+		if p.bucketEnd.IsZero() {
+			return
+		}
+		p.report.Timeline = append(p.report.Timeline, CudaMemSample{
+			Ts:               p.bucketEnd,
+			OutstandingBytes: p.current,
+			PeakBytes:        p.bucketPeak,
+		})
+	}
+	advance := func(p *procState, ts time.Time) {
+		if !p.bucketEnd.IsZero() && ts.Before(p.bucketEnd) {
+			return
+		}
+		flushBucket(p)
+		p.bucketEnd = start.Add((ts.Sub(start)/bucket + 1) * bucket)
+		p.bucketPeak = p.current
+	}
+	finding := func(p *procState, ts time.Time, kind string, ptr, size, ageNs int64) {
+		p.report.Findings = append(p.report.Findings, models.CudaMemFinding{
+			Ts:          ts,
+			MachineID:   machineID,
+			PID:         p.report.PID,
+			Comm:        p.report.Comm,
+			Cmdline:     p.report.Cmdline,
+			FindingType: kind,
+			CudaPtr:     ptr,
+			CudaSize:    size,
+			AgeNs:       ageNs,
+			DetectedAt:  detectedAt,
+		})
+	}
+
+	for _, e := range events {
+		p := getProc(e)
+		advance(p, e.Ts)
+		switch e.EventSubtype {
+		case models.CudaMallocTopic:
+			if e.CudaRetval != 0 || e.CudaPtr == 0 {
+				p.report.FailedMallocs++
+				continue
+			}
+			p.report.Mallocs++
+			if old, ok := p.live[e.CudaPtr]; ok {
+				// 漏掉了对应的 cudaFree 事件，以新分配覆盖
+				p.current -= old.Size
+			}
+			p.live[e.CudaPtr] = CudaAllocation{Ptr: e.CudaPtr, Size: e.CudaSize, AllocTs: e.Ts}
+			delete(p.freed, e.CudaPtr)
+			p.current += e.CudaSize
+		case models.CudaFreeTopic:
+			if e.CudaPtr == 0 {
+				continue
+			}
+			p.report.Frees++
+			alloc, ok := p.live[e.CudaPtr]
+			switch {
+			case ok:
+				p.current -= alloc.Size
+				delete(p.live, e.CudaPtr)
+				p.freed[e.CudaPtr] = true
+			case p.freed[e.CudaPtr]:
+				finding(p, e.Ts, models.CudaMemFindingDoubleFree, e.CudaPtr, 0, 0)
+			default:
+				finding(p, e.Ts, models.CudaMemFindingUnknownFree, e.CudaPtr, 0, 0)
+			}
+		}
+		if p.current > p.bucketPeak {
+			p.bucketPeak = p.current
+		}
+		if p.current > p.report.PeakBytes {
+			p.report.PeakBytes = p.current
+		}
+	}
+
+	report := &CudaMemReport{MachineID: machineID, Start: start, End: end}
+	for _, p := range procs {
+		flushBucket(p)
+		p.report.OutstandingBytes = p.current
+		p.report.LiveAllocations = len(p.live)
+		p.report.live = p.live
+
+		var longLived []CudaAllocation
+		for _, alloc := range p.live {
+			alloc.AgeNs = end.Sub(alloc.AllocTs).Nanoseconds()
+			if alloc.AgeNs >= minAge.Nanoseconds() {
+				longLived = append(longLived, alloc)
+			}
+		}
+		sort.Slice(longLived, func(i, j int) bool { return longLived[i].AllocTs.Before(longLived[j].AllocTs) })
+		for _, alloc := range longLived {
+			finding(p, alloc.AllocTs, models.CudaMemFindingLongLived, alloc.Ptr, alloc.Size, alloc.AgeNs)
+		}
+		report.Processes = append(report.Processes, *p.report)
+	}
+	sort.Slice(report.Processes, func(i, j int) bool {
+		return report.Processes[i].OutstandingBytes > report.Processes[j].OutstandingBytes
+	})
+	return report
+}
+
+// CudaMemLeakDetector 周期性运行 CUDA 显存泄漏检测
+func CudaMemLeakDetector(ctx context.Context, wg *sync.WaitGroup, handler *Handler, interval, lookback, minAge time.Duration) {
+	defer wg.Done()
+	service := handler.cudaMemHandler.cudaMemService
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := service.RunLeakCheck(ctx, lookback, minAge); err != nil {
+				log.Printf("Error running CUDA memory leak check: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"scope/internal/models"
+)
+
+func TestAnalyzeCudaMemory(t *testing.T) {
+	end := at(10 * time.Minute)
+
+	events := []models.CudaEvent{
+		{Ts: at(1 * time.Second), EventSubtype: models.CudaMallocTopic, PID: 7, CudaPtr: 0x1000, CudaSize: 100},
+		{Ts: at(2 * time.Second), EventSubtype: models.CudaMallocTopic, PID: 7, CudaPtr: 0x2000, CudaSize: 200},
+		{Ts: at(3 * time.Second), EventSubtype: models.CudaMallocTopic, PID: 7, CudaPtr: 0, CudaSize: 1 << 40, CudaRetval: 2},
+		{Ts: at(4 * time.Second), EventSubtype: models.CudaFreeTopic, PID: 7, CudaPtr: 0x2000},
+		{Ts: at(5 * time.Second), EventSubtype: models.CudaFreeTopic, PID: 7, CudaPtr: 0x2000},
+		{Ts: at(6 * time.Second), EventSubtype: models.CudaFreeTopic, PID: 7, CudaPtr: 0x9000},
+		{Ts: at(9 * time.Minute), EventSubtype: models.CudaMallocTopic, PID: 7, CudaPtr: 0x3000, CudaSize: 50},
+	}
+
+	report := analyzeCudaMemory("m1", events, testBase, end, 5*time.Minute, time.Second, end)
+	if len(report.Processes) != 1 {
+		t.Fatalf("got %d processes, want 1", len(report.Processes))
+	}
+	p := report.Processes[0]
+
+	if p.Mallocs != 3 || p.FailedMallocs != 1 || p.Frees != 3 {
+		t.Errorf("counts = mallocs %d failed %d frees %d, want 3/1/3", p.Mallocs, p.FailedMallocs, p.Frees)
+	}
+	if p.OutstandingBytes != 150 {
+		t.Errorf("outstanding = %d, want 150", p.OutstandingBytes)
+	}
+	if p.PeakBytes != 300 {
+		t.Errorf("peak = %d, want 300", p.PeakBytes)
+	}
+
+	kinds := map[string]int64{}
+	for _, f := range p.Findings {
+		kinds[f.FindingType] = f.CudaPtr
+	}
+	if kinds[models.CudaMemFindingDoubleFree] != 0x2000 {
+		t.Errorf("missing double_free for 0x2000: %+v", p.Findings)
+	}
+	if kinds[models.CudaMemFindingUnknownFree] != 0x9000 {
+		t.Errorf("missing unknown_free for 0x9000: %+v", p.Findings)
+	}
+	if kinds[models.CudaMemFindingLongLived] != 0x1000 {
+		t.Errorf("only 0x1000 should be long-lived: %+v", p.Findings)
+	}
+	if len(p.Findings) != 3 {
+		t.Errorf("got %d findings, want 3", len(p.Findings))
+	}
+}
+
+func TestCudaLeakStateCheck(t *testing.T) {
+	malloc := func(d time.Duration, pid int32, ptr, size int64) models.CudaEvent {
+		return models.CudaEvent{Ts: at(d), EventSubtype: models.CudaMallocTopic, PID: pid, CudaPtr: ptr, CudaSize: size}
+	}
+	free := func(d time.Duration, pid int32, ptr int64) models.CudaEvent {
+		return models.CudaEvent{Ts: at(d), EventSubtype: models.CudaFreeTopic, PID: pid, CudaPtr: ptr}
+	}
+	kinds := func(findings []models.CudaMemFinding) map[string][]int64 {
+		m := map[string][]int64{}
+		for _, f := range findings {
+			m[f.FindingType] = append(m[f.FindingType], f.CudaPtr)
+		}
+		return m
+	}
+	state := &cudaLeakState{procs: make(map[int32]*cudaLeakProc)}
+	idle, minAge := time.Hour, 5*time.Minute
+
+	// 第一次运行: 0x100 在窗口开始前分配，它的释放不能报告为 unknown_free
+	first := state.check("m1", []models.CudaEvent{
+		free(time.Second, 7, 0x100),
+		malloc(2*time.Second, 7, 0x200, 10),
+		malloc(3*time.Second, 7, 0x300, 20),
+	}, testBase, at(10*time.Minute), idle, minAge, at(10*time.Minute))
+	if got := kinds(first); len(got[models.CudaMemFindingUnknownFree]) != 0 || len(got[models.CudaMemFindingLongLived]) != 2 {
+		t.Errorf("first run findings = %v, want only 2 long_lived", got)
+	}
+
+	// 第二次运行: 释放上次存活的 0x200 不是 unknown_free，仍存活的 0x300 不再重复报告；
+	// 检测开始后出现的进程 8 的所有分配都被看到，它的未知释放是真实问题
+	second := state.check("m1", []models.CudaEvent{
+		free(11*time.Minute, 7, 0x200),
+		malloc(11*time.Minute, 8, 0x400, 5),
+		free(12*time.Minute, 8, 0x500),
+		free(12*time.Minute, 7, 0x600),
+	}, at(10*time.Minute), at(15*time.Minute), idle, minAge, at(15*time.Minute))
+	got := kinds(second)
+	if len(got[models.CudaMemFindingLongLived]) != 0 {
+		t.Errorf("long_lived allocations should only be reported once: %v", got)
+	}
+	if u := got[models.CudaMemFindingUnknownFree]; len(u) != 1 || u[0] != 0x500 {
+		t.Errorf("unknown_free = %v, want only 0x500 of the fully observed process", u)
+	}
+	if live := state.procs[7].live; len(live) != 1 || live[0x300].Size != 20 {
+		t.Errorf("carried allocations of pid 7 = %+v, want only 0x300", live)
+	}
+
+	// 超过 idle 没有事件的进程被丢弃
+	state.check("m1", nil, at(15*time.Minute), at(2*time.Hour), idle, minAge, at(2*time.Hour))
+	if len(state.procs) != 0 {
+		t.Errorf("idle processes should be dropped, got %d", len(state.procs))
+	}
+}
+
+func TestCudaLeakStatePagedInitialRun(t *testing.T) {
+	state := &cudaLeakState{initialEnd: at(10 * time.Minute), procs: make(map[int32]*cudaLeakProc)}
+	idle, minAge := time.Hour, 5*time.Minute
+
+	// 第一次运行被分成两页: 第二页才出现的进程可能在窗口开始前就有分配，不能报告 unknown_free
+	state.check("m1", []models.CudaEvent{
+		{Ts: at(time.Second), EventSubtype: models.CudaMallocTopic, PID: 7, CudaPtr: 0x100, CudaSize: 10},
+	}, testBase, at(5*time.Minute), idle, minAge, at(10*time.Minute))
+	second := state.check("m1", []models.CudaEvent{
+		{Ts: at(6 * time.Minute), EventSubtype: models.CudaMallocTopic, PID: 8, CudaPtr: 0x200, CudaSize: 10},
+		{Ts: at(7 * time.Minute), EventSubtype: models.CudaFreeTopic, PID: 8, CudaPtr: 0x300},
+	}, at(5*time.Minute), at(10*time.Minute), idle, minAge, at(10*time.Minute))
+	for _, f := range second {
+		if f.FindingType == models.CudaMemFindingUnknownFree {
+			t.Errorf("unknown_free reported for a process first seen during the initial run: %+v", f)
+		}
+	}
+	if state.procs[8].fullyObserved {
+		t.Errorf("process first seen on a later page of the initial run should not be fully observed")
+	}
+}
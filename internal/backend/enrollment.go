@@ -0,0 +1,275 @@
+package backend
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"scope/internal/models"
+	"scope/internal/utils"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrJoinTokenInvalid  = errors.New("加入令牌无效")
+	ErrJoinTokenExpired  = errors.New("加入令牌已过期")
+	ErrJoinTokenUsed     = errors.New("加入令牌已被使用")
+	ErrNodeEnrolled      = errors.New("节点已注册，请先删除节点再重新注册")
+	ErrNodeNotEnrolled   = errors.New("节点未注册")
+	ErrNodeSignature     = errors.New("节点签名无效")
+	ErrInsecureTransport = errors.New("拒绝通过明文 HTTP 注册节点: 响应中的凭据和 token 会被截获，请通过 HTTPS 访问 (经反向代理时配置 NODE_TRUSTED_PROXIES) 或设置 NODE_ALLOW_INSECURE=true")
+)
+
+// nodeSignatureMaxSkew 是节点签名时间戳允许的时钟偏差
+const nodeSignatureMaxSkew = 5 * time.Minute
+
+// CreateJoinTokenRequest 是创建加入令牌的请求，至少需要单次使用或设置有效期
+type CreateJoinTokenRequest struct {
+	Description string            `json:"description"`
+	Labels      map[string]string `json:"labels"`
+	SingleUse   bool              `json:"single_use"`
+	TTLSec      int64             `json:"ttl_sec"` // 有效期 (单位: 秒)，0 表示不过期
+}
+
+// CreateJoinTokenResponse 返回令牌的元数据和完整令牌，完整令牌只返回这一次
+type CreateJoinTokenResponse struct {
+	models.JoinToken
+	Token string `json:"token"`
+}
+
+// hashSecret 返回加入令牌 secret 的 SHA-256
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// parseJoinToken 把 "<id>.<secret>" 拆成 id 和 secret
+func parseJoinToken(raw string) (id, secret string, ok bool) {
+	id, secret, ok = strings.Cut(strings.TrimSpace(raw), ".")
+	if !ok || id == "" || secret == "" {
+		return "", "", false
+	}
+	return id, secret, true
+}
+
+// checkJoinToken 检查令牌在 now 是否仍然可用
+func checkJoinToken(token models.JoinToken, now time.Time) error {
+	if !token.ExpiresAt.IsZero() && now.After(token.ExpiresAt) {
+		return ErrJoinTokenExpired
+	}
+	if token.SingleUse && token.Uses >= 1 {
+		return ErrJoinTokenUsed
+	}
+	return nil
+}
+
+// CreateJoinToken 创建加入令牌，返回的完整令牌之后无法再次获取
+func (s *NodeService) CreateJoinToken(ctx context.Context, req CreateJoinTokenRequest, createdBy string) (CreateJoinTokenResponse, error) {
+	if !req.SingleUse && req.TTLSec <= 0 {
+		return CreateJoinTokenResponse{}, errors.New("加入令牌必须是单次使用或设置有效期")
+	}
+	id, err := utils.GenerateRandomString(8)
+	if err != nil {
+		return CreateJoinTokenResponse{}, err
+	}
+	secret, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return CreateJoinTokenResponse{}, err
+	}
+	now := time.Now()
+	token := models.JoinToken{
+		ID:          id,
+		Description: req.Description,
+		Labels:      req.Labels,
+		SingleUse:   req.SingleUse,
+		CreatedAt:   now,
+		CreatedBy:   createdBy,
+	}
+	if req.TTLSec > 0 {
+		token.ExpiresAt = now.Add(time.Duration(req.TTLSec) * time.Second)
+	}
+	if err := s.nodeStore.SaveJoinToken(ctx, token, hashSecret(secret)); err != nil {
+		return CreateJoinTokenResponse{}, err
+	}
+	return CreateJoinTokenResponse{JoinToken: token, Token: id + "." + secret}, nil
+}
+
+func (s *NodeService) ListJoinTokens(ctx context.Context) ([]models.JoinToken, error) {
+	return s.nodeStore.ListJoinTokens(ctx)
+}
+
+func (s *NodeService) DeleteJoinToken(ctx context.Context, id string) error {
+	return s.nodeStore.DeleteJoinToken(ctx, id)
+}
+
+// Enroll 校验加入令牌，为首次启动的节点签发长期凭据。凭据用 AES256_KEY 加密后保存；
+// 已注册的节点不能用加入令牌覆盖，需要先删除。
+func (s *NodeService) Enroll(ctx context.Context, req models.NodeEnrollRequest) (models.NodeEnrollResponse, error) {
+	id, secret, ok := parseJoinToken(req.JoinToken)
+	if !ok {
+		return models.NodeEnrollResponse{}, ErrJoinTokenInvalid
+	}
+	token, secretHash, err := s.nodeStore.GetJoinToken(ctx, id)
+	if errors.Is(err, goredis.Nil) {
+		return models.NodeEnrollResponse{}, ErrJoinTokenInvalid
+	}
+	if err != nil {
+		return models.NodeEnrollResponse{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(secretHash)) != 1 {
+		return models.NodeEnrollResponse{}, ErrJoinTokenInvalid
+	}
+	if err := checkJoinToken(token, time.Now()); err != nil {
+		return models.NodeEnrollResponse{}, err
+	}
+
+	credential, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return models.NodeEnrollResponse{}, err
+	}
+	encrypted, err := utils.Encrypt([]byte(credential), s.credentialKey)
+	if err != nil {
+		return models.NodeEnrollResponse{}, fmt.Errorf("加密节点凭据失败: %w", err)
+	}
+	created, err := s.nodeStore.SetNodeCredentialNX(ctx, req.Node.ID, hex.EncodeToString(encrypted))
+	if err != nil {
+		return models.NodeEnrollResponse{}, err
+	}
+	if !created {
+		return models.NodeEnrollResponse{}, ErrNodeEnrolled
+	}
+	// 先占用节点再计数，并发使用单次令牌时只有一个节点成功
+	uses, err := s.nodeStore.UseJoinToken(ctx, token.ID)
+	if err == nil && token.SingleUse && uses > 1 {
+		err = ErrJoinTokenUsed
+	}
+	if err != nil {
+		s.nodeStore.DeleteNodeCredential(ctx, req.Node.ID)
+		return models.NodeEnrollResponse{}, err
+	}
+
+	node := req.Node
+	node.Labels = token.Labels
+	node.EnrolledAt = time.Now()
+	sessionToken, err := s.issueToken(ctx, node)
+	if err != nil {
+		return models.NodeEnrollResponse{}, err
+	}
+	return models.NodeEnrollResponse{Credential: credential, Token: sessionToken}, nil
+}
+
+// peerAddrKey 是请求上下文中 TCP 连接对端地址的键
+type peerAddrKey struct{}
+
+// PeerAddr 在 middleware.RealIP 之前记录 TCP 连接的对端地址。
+// RealIP 会用客户端可以任意填写的 X-Forwarded-For / X-Real-IP 覆盖 RemoteAddr，安全检查只能使用这里记录的地址。
+func PeerAddr(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), peerAddrKey{}, r.RemoteAddr)))
+	})
+}
+
+// peerIP 返回 TCP 连接对端的 IP，没有经过 PeerAddr 时使用 RemoteAddr
+func peerIP(r *http.Request) net.IP {
+	addr, ok := r.Context().Value(peerAddrKey{}).(string)
+	if !ok {
+		addr = r.RemoteAddr
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	return net.ParseIP(host)
+}
+
+// ParseTrustedProxies 解析逗号分隔的反向代理地址，每一项为 IP 或 CIDR
+func ParseTrustedProxies(s string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("无效的代理地址 %q", item)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("无效的代理地址 %q: %w", item, err)
+		}
+		proxies = append(proxies, ipNet)
+	}
+	return proxies, nil
+}
+
+func (s *NodeService) trustedProxy(ip net.IP) bool {
+	for _, proxy := range s.trustedProxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// secureTransport 判断注册请求是否经过 TLS (直接或由可信的反向代理终止)，或直接来自本机。
+// /enroll 和 /up 的响应中有节点凭据和会话 token，后者是 center 调用 agent API 的签名密钥，不能明文传输。
+// X-Forwarded-Proto 只在连接来自 trustedProxies 时采信，此时也不再按本机地址放行 (代理可能和 center 在同一台机器上)。
+func (s *NodeService) secureTransport(r *http.Request) bool {
+	if s.allowInsecure || r.TLS != nil {
+		return true
+	}
+	ip := peerIP(r)
+	if ip == nil {
+		return false
+	}
+	if s.trustedProxy(ip) {
+		// 代理追加而不是覆盖该请求头时，最后一项才是代理自己写入的
+		protos := strings.Split(r.Header.Get("X-Forwarded-Proto"), ",")
+		return strings.EqualFold(strings.TrimSpace(protos[len(protos)-1]), "https")
+	}
+	return ip.IsLoopback()
+}
+
+// VerifyNodeRequest 校验节点用凭据对请求的签名，返回节点 ID
+func (s *NodeService) VerifyNodeRequest(r *http.Request) (string, error) {
+	nodeID := r.Header.Get(utils.HeaderNodeID)
+	if nodeID == "" {
+		return "", ErrNodeSignature
+	}
+	encrypted, err := s.nodeStore.GetNodeCredential(r.Context(), nodeID)
+	if errors.Is(err, goredis.Nil) {
+		return "", ErrNodeNotEnrolled
+	}
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := hex.DecodeString(encrypted)
+	if err != nil {
+		return "", fmt.Errorf("节点凭据损坏: %w", err)
+	}
+	credential, err := utils.Decrypt(ciphertext, s.credentialKey)
+	if err != nil {
+		return "", fmt.Errorf("解密节点凭据失败: %w", err)
+	}
+	if err := utils.VerifyRequest(r, nodeID, credential, time.Now(), nodeSignatureMaxSkew, s.nonces); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrNodeSignature, err)
+	}
+	return nodeID, nil
+}
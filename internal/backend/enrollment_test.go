@@ -0,0 +1,137 @@
+package backend
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"scope/internal/models"
+)
+
+func TestParseJoinToken(t *testing.T) {
+	tests := []struct {
+		raw        string
+		id, secret string
+		ok         bool
+	}{
+		{"abcd.s3cret", "abcd", "s3cret", true},
+		{" abcd.s3cret\n", "abcd", "s3cret", true},
+		{"abcd", "", "", false},
+		{".s3cret", "", "", false},
+		{"abcd.", "", "", false},
+	}
+	for _, tt := range tests {
+		id, secret, ok := parseJoinToken(tt.raw)
+		if id != tt.id || secret != tt.secret || ok != tt.ok {
+			t.Errorf("parseJoinToken(%q) = %q, %q, %v, want %q, %q, %v", tt.raw, id, secret, ok, tt.id, tt.secret, tt.ok)
+		}
+	}
+}
+
+func TestCheckJoinToken(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name  string
+		token models.JoinToken
+		want  error
+	}{
+		{"unused single-use", models.JoinToken{SingleUse: true}, nil},
+		{"used single-use", models.JoinToken{SingleUse: true, Uses: 1}, ErrJoinTokenUsed},
+		{"reusable before expiry", models.JoinToken{ExpiresAt: now.Add(time.Hour), Uses: 5}, nil},
+		{"expired", models.JoinToken{ExpiresAt: now.Add(-time.Second)}, ErrJoinTokenExpired},
+	}
+	for _, tt := range tests {
+		if err := checkJoinToken(tt.token, now); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestSecureTransport(t *testing.T) {
+	request := func(remote, proto string, overTLS bool) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/node/up", nil)
+		r.RemoteAddr = remote
+		if proto != "" {
+			r.Header.Set("X-Forwarded-Proto", proto)
+		}
+		if overTLS {
+			r.TLS = &tls.ConnectionState{}
+		}
+		return r
+	}
+	proxies, err := ParseTrustedProxies("10.0.0.1, 192.168.10.0/24")
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies: %v", err)
+	}
+	tests := []struct {
+		name     string
+		r        *http.Request
+		insecure bool
+		want     bool
+	}{
+		{"remote plain http", request("10.0.0.5:41000", "", false), false, false},
+		// 客户端自己填写的 X-Forwarded-Proto 不能采信
+		{"remote spoofed proto", request("10.0.0.5:41000", "https", false), false, false},
+		{"trusted proxy https", request("10.0.0.1:41000", "https", false), false, true},
+		{"trusted proxy subnet https", request("192.168.10.7:41000", "https", false), false, true},
+		{"trusted proxy http", request("10.0.0.1:41000", "http", false), false, false},
+		{"trusted proxy appended proto", request("10.0.0.1:41000", "https, http", false), false, false},
+		{"direct tls", request("10.0.0.5:41000", "", true), false, true},
+		{"loopback", request("127.0.0.1:41000", "", false), false, true},
+		{"ipv6 loopback", request("[::1]:41000", "", false), false, true},
+		{"explicitly allowed", request("10.0.0.5:41000", "", false), true, true},
+	}
+	for _, tt := range tests {
+		s := &NodeService{allowInsecure: tt.insecure, trustedProxies: proxies}
+		if got := s.secureTransport(tt.r); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// 同机的代理: 按代理转发的协议判断，不再因为对端是本机而放行
+	local, _ := ParseTrustedProxies("127.0.0.1")
+	s := &NodeService{trustedProxies: local}
+	if s.secureTransport(request("127.0.0.1:41000", "http", false)) {
+		t.Errorf("plain http through a local proxy was accepted")
+	}
+
+	if _, err := ParseTrustedProxies("10.0.0.1, proxy.local"); err == nil {
+		t.Errorf("ParseTrustedProxies accepted a host name")
+	}
+}
+
+func TestSecureTransportIgnoresRealIP(t *testing.T) {
+	var got bool
+	s := &NodeService{}
+	router := SetupRouter(&Handler{}, nil, nil)
+	router.Post("/test/secure", func(w http.ResponseWriter, r *http.Request) { got = s.secureTransport(r) })
+
+	tests := []struct {
+		name   string
+		remote string
+		header string
+		value  string
+		want   bool
+	}{
+		{"loopback", "127.0.0.1:41000", "", "", true},
+		{"loopback with forwarded for", "127.0.0.1:41000", "X-Forwarded-For", "10.0.0.5", true},
+		// RealIP 会把 RemoteAddr 改成这些请求头的值
+		{"spoofed x-forwarded-for", "10.0.0.5:41000", "X-Forwarded-For", "127.0.0.1", false},
+		{"spoofed x-real-ip", "10.0.0.5:41000", "X-Real-IP", "::1", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/test/secure", nil)
+		r.RemoteAddr = tt.remote
+		if tt.header != "" {
+			r.Header.Set(tt.header, tt.value)
+		}
+		got = !tt.want
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		if got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
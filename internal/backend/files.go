@@ -0,0 +1,297 @@
+package backend
+
+import (
+	"context"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"scope/database/postgres"
+	"scope/internal/models"
+)
+
+// 模型文件类型
+const (
+	ModelKindGGUF        = "gguf"
+	ModelKindGGML        = "ggml"
+	ModelKindSafetensors = "safetensors"
+	ModelKindONNX        = "onnx"
+	ModelKindPyTorch     = "pytorch"
+	ModelKindOllamaBlob  = "ollama_blob" // ~/.ollama/models/blobs/sha256-*，ollama 以内容哈希命名 GGUF 权重
+)
+
+var modelFileExtensions = map[string]string{
+	".gguf":        ModelKindGGUF,
+	".ggml":        ModelKindGGML,
+	".safetensors": ModelKindSafetensors,
+	".onnx":        ModelKindONNX,
+	".pt":          ModelKindPyTorch,
+	".pth":         ModelKindPyTorch,
+}
+
+// modelFileKind 根据路径判断文件是否为模型权重，不是时返回空字符串
+func modelFileKind(p string) string {
+	if kind, ok := modelFileExtensions[strings.ToLower(filepath.Ext(p))]; ok {
+		return kind
+	}
+	// 用户安装在 ~/.ollama，系统服务安装在 /usr/share/ollama/.ollama
+	if strings.Contains(p, "/.ollama/models/blobs/") && strings.HasPrefix(filepath.Base(p), "sha256") {
+		return ModelKindOllamaBlob
+	}
+	return ""
+}
+
+// globToRegex 把路径 glob 转换为锚定的 POSIX 正则表达式。
+// * 和 ? 不匹配 '/'，** 匹配任意字符 (包括 '/')，[...] 为字符集合，[!...] 为取反。
+func globToRegex(glob string) (string, error) {
+	if _, err := path.Match(glob, ""); err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				sb.WriteString(".*")
+				i++
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + class + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+			}
+			sb.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	if _, err := regexp.Compile(sb.String()); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// FileAccessEntry 是一个进程打开某个文件的统计
+type FileAccessEntry struct {
+	Path      string    `json:"path"`
+	Opens     int64     `json:"opens"`
+	FirstTs   time.Time `json:"first_ts"`
+	LastTs    time.Time `json:"last_ts"`
+	ModelKind string    `json:"model_kind,omitempty"`
+}
+
+// FilePathSummary 是一个文件在窗口内被所有进程打开的汇总
+type FilePathSummary struct {
+	FileAccessEntry
+	Processes int `json:"processes"` // 打开过该文件的进程数
+}
+
+// FileProcessProfile 是一个进程在窗口内打开文件最多的路径
+type FileProcessProfile struct {
+	PID      int32             `json:"pid"`
+	Comm     string            `json:"comm"`
+	Cmdline  string            `json:"cmdline"`
+	Opens    int64             `json:"opens"`
+	Paths    int               `json:"paths"` // 打开过的不同路径数
+	TopPaths []FileAccessEntry `json:"top_paths"`
+}
+
+// FileOpener 是打开过某个文件的一个进程
+type FileOpener struct {
+	PID     int32     `json:"pid"`
+	Comm    string    `json:"comm"`
+	Cmdline string    `json:"cmdline"`
+	Opens   int64     `json:"opens"`
+	FirstTs time.Time `json:"first_ts"`
+	LastTs  time.Time `json:"last_ts"`
+}
+
+// ModelLoad 是一个进程打开模型文件的记录，用于把模型加载归属到进程
+type ModelLoad struct {
+	FileOpener
+	Path      string `json:"path"`
+	ModelKind string `json:"model_kind"`
+}
+
+// FileAccessReport 是一台机器在一个时间窗口内的文件访问分析结果
+type FileAccessReport struct {
+	MachineID  string               `json:"machine_id"`
+	Start      time.Time            `json:"start"`
+	End        time.Time            `json:"end"`
+	Files      []FilePathSummary    `json:"files"`
+	Processes  []FileProcessProfile `json:"processes"`
+	ModelLoads []ModelLoad          `json:"model_loads"`
+}
+
+// FileOpenersReport 列出在窗口内打开过某个文件的进程
+type FileOpenersReport struct {
+	MachineID string       `json:"machine_id"`
+	Path      string       `json:"path"`
+	ModelKind string       `json:"model_kind,omitempty"`
+	Start     time.Time    `json:"start"`
+	End       time.Time    `json:"end"`
+	Processes []FileOpener `json:"processes"`
+}
+
+// FileAccessOptions 控制文件访问分析的参数
+type FileAccessOptions struct {
+	Prefix     string // 路径前缀过滤
+	Glob       string // 路径 glob 过滤，见 globToRegex
+	ModelsOnly bool   // 只统计模型文件
+	Top        int    // Files 和每个进程 TopPaths 的最大条数
+}
+
+// FileService 基于 vfs_open 事件生成文件访问分析
+type FileService struct {
+	eventStore *postgres.EventStore
+}
+
+// Analyze 统计窗口内被打开最多的文件、每个进程打开最多的文件以及模型文件的加载记录
+func (s *FileService) Analyze(ctx context.Context, filter postgres.EventFilter, opts FileAccessOptions) (*FileAccessReport, error) {
+	paths := postgres.FilePathFilter{Prefix: opts.Prefix}
+	if opts.Glob != "" {
+		regex, err := globToRegex(opts.Glob)
+		if err != nil {
+			return nil, err
+		}
+		paths.Regex = regex
+	}
+	stats, err := s.eventStore.FileAccessStats(ctx, filter, paths)
+	if err != nil {
+		return nil, err
+	}
+	return analyzeFileAccess(filter.MachineID, stats, filter.Start, filter.End, opts), nil
+}
+
+// Openers 列出窗口内打开过 path 的进程
+func (s *FileService) Openers(ctx context.Context, filter postgres.EventFilter, path string) (*FileOpenersReport, error) {
+	stats, err := s.eventStore.FileAccessStats(ctx, filter, postgres.FilePathFilter{Path: path})
+	if err != nil {
+		return nil, err
+	}
+	report := &FileOpenersReport{
+		MachineID: filter.MachineID,
+		Path:      path,
+		ModelKind: modelFileKind(path),
+		Start:     filter.Start,
+		End:       filter.End,
+		Processes: make([]FileOpener, 0, len(stats)),
+	}
+	for _, st := range stats {
+		report.Processes = append(report.Processes, fileOpener(st))
+	}
+	sort.Slice(report.Processes, func(i, j int) bool {
+		return report.Processes[i].FirstTs.Before(report.Processes[j].FirstTs)
+	})
+	return report, nil
+}
+
+func fileOpener(st models.FileAccessStat) FileOpener {
+	return FileOpener{PID: st.PID, Comm: st.Comm, Cmdline: st.Cmdline, Opens: st.Opens, FirstTs: st.FirstTs, LastTs: st.LastTs}
+}
+
+func analyzeFileAccess(machineID string, stats []models.FileAccessStat, start, end time.Time, opts FileAccessOptions) *FileAccessReport {
+	if opts.Top <= 0 {
+		opts.Top = 20
+	}
+	report := &FileAccessReport{
+		MachineID:  machineID,
+		Start:      start,
+		End:        end,
+		Files:      []FilePathSummary{},
+		Processes:  []FileProcessProfile{},
+		ModelLoads: []ModelLoad{},
+	}
+
+	byOpens := func(a, b FileAccessEntry) bool {
+		if a.Opens != b.Opens {
+			return a.Opens > b.Opens
+		}
+		return a.Path < b.Path
+	}
+	files := make(map[string]*FilePathSummary)
+	procs := make(map[int32]*FileProcessProfile)
+	for _, st := range stats {
+		kind := modelFileKind(st.Path)
+		if opts.ModelsOnly && kind == "" {
+			continue
+		}
+		entry := FileAccessEntry{Path: st.Path, Opens: st.Opens, FirstTs: st.FirstTs, LastTs: st.LastTs, ModelKind: kind}
+
+		f, ok := files[st.Path]
+		if !ok {
+			f = &FilePathSummary{FileAccessEntry: FileAccessEntry{Path: st.Path, FirstTs: st.FirstTs, LastTs: st.LastTs, ModelKind: kind}}
+			files[st.Path] = f
+		}
+		f.Opens += st.Opens
+		f.Processes++
+		if st.FirstTs.Before(f.FirstTs) {
+			f.FirstTs = st.FirstTs
+		}
+		if st.LastTs.After(f.LastTs) {
+			f.LastTs = st.LastTs
+		}
+
+		p, ok := procs[st.PID]
+		if !ok {
+			p = &FileProcessProfile{PID: st.PID, Comm: st.Comm, Cmdline: st.Cmdline}
+			procs[st.PID] = p
+		}
+		p.Opens += st.Opens
+		p.Paths++
+		p.TopPaths = append(p.TopPaths, entry)
+
+		if kind != "" {
+			report.ModelLoads = append(report.ModelLoads, ModelLoad{FileOpener: fileOpener(st), Path: st.Path, ModelKind: kind})
+		}
+	}
+
+	for _, f := range files {
+		report.Files = append(report.Files, *f)
+	}
+	sort.Slice(report.Files, func(i, j int) bool { return byOpens(report.Files[i].FileAccessEntry, report.Files[j].FileAccessEntry) })
+	if len(report.Files) > opts.Top {
+		report.Files = report.Files[:opts.Top]
+	}
+
+	for _, p := range procs {
+		sort.Slice(p.TopPaths, func(i, j int) bool { return byOpens(p.TopPaths[i], p.TopPaths[j]) })
+		if len(p.TopPaths) > opts.Top {
+			p.TopPaths = p.TopPaths[:opts.Top]
+		}
+		report.Processes = append(report.Processes, *p)
+	}
+	sort.Slice(report.Processes, func(i, j int) bool {
+		a, b := report.Processes[i], report.Processes[j]
+		if a.Opens != b.Opens {
+			return a.Opens > b.Opens
+		}
+		return a.PID < b.PID
+	})
+
+	// 按首次打开时间排列，即模型加载的先后顺序
+	sort.Slice(report.ModelLoads, func(i, j int) bool {
+		a, b := report.ModelLoads[i], report.ModelLoads[j]
+		if !a.FirstTs.Equal(b.FirstTs) {
+			return a.FirstTs.Before(b.FirstTs)
+		}
+		return a.PID < b.PID
+	})
+	return report
+}
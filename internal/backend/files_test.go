@@ -0,0 +1,79 @@
+package backend
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"scope/internal/models"
+)
+
+func TestModelFileKind(t *testing.T) {
+	cases := map[string]string{
+		"/home/u/models/llama-3-8b.Q4_K_M.gguf":                            ModelKindGGUF,
+		"/data/model.SAFETENSORS":                                          ModelKindSafetensors,
+		"/home/u/.ollama/models/blobs/sha256-6a0746a1ec1aef3e7ec53868f220": ModelKindOllamaBlob,
+		"/usr/share/ollama/.ollama/models/blobs/sha256-1234":               ModelKindOllamaBlob,
+		"/home/u/.ollama/models/manifests/registry.ollama.ai/library/x":    "",
+		"/etc/ld.so.cache": "",
+	}
+	for path, want := range cases {
+		if got := modelFileKind(path); got != want {
+			t.Errorf("modelFileKind(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestGlobToRegex(t *testing.T) {
+	cases := []struct {
+		glob  string
+		path  string
+		match bool
+	}{
+		{"/etc/*.conf", "/etc/resolv.conf", true},
+		{"/etc/*.conf", "/etc/ssl/openssl.conf", false},
+		{"/home/**/*.gguf", "/home/u/models/a.gguf", true},
+		{"/dev/nvidia?", "/dev/nvidia0", true},
+		{"/dev/nvidia[!c]*", "/dev/nvidiactl", false},
+		{"/tmp/a+b.(1)", "/tmp/a+b.(1)", true},
+	}
+	for _, c := range cases {
+		regex, err := globToRegex(c.glob)
+		if err != nil {
+			t.Fatalf("globToRegex(%q): %v", c.glob, err)
+		}
+		if got := regexp.MustCompile(regex).MatchString(c.path); got != c.match {
+			t.Errorf("%q (%s) on %q = %v, want %v", c.glob, regex, c.path, got, c.match)
+		}
+	}
+	if _, err := globToRegex("/etc/[a"); err == nil {
+		t.Error("unterminated class should be rejected")
+	}
+}
+
+func TestAnalyzeFileAccess(t *testing.T) {
+	blob := "/home/u/.ollama/models/blobs/sha256-abc"
+	stats := []models.FileAccessStat{
+		{PID: 1, Comm: "ollama", Path: "/etc/hosts", Opens: 50, FirstTs: at(time.Second), LastTs: at(9 * time.Second)},
+		{PID: 2, Comm: "curl", Path: "/etc/hosts", Opens: 5, FirstTs: at(0), LastTs: at(3 * time.Second)},
+		{PID: 1, Comm: "ollama", Path: blob, Opens: 2, FirstTs: at(4 * time.Second), LastTs: at(5 * time.Second)},
+		{PID: 3, Comm: "runner", Path: blob, Opens: 1, FirstTs: at(2 * time.Second), LastTs: at(2 * time.Second)},
+	}
+
+	report := analyzeFileAccess("m1", stats, testBase, at(10*time.Second), FileAccessOptions{Top: 1})
+	if len(report.Files) != 1 || report.Files[0].Path != "/etc/hosts" || report.Files[0].Opens != 55 ||
+		report.Files[0].Processes != 2 || !report.Files[0].FirstTs.Equal(at(0)) || !report.Files[0].LastTs.Equal(at(9*time.Second)) {
+		t.Errorf("files = %+v", report.Files)
+	}
+	if p := report.Processes[0]; p.PID != 1 || p.Opens != 52 || p.Paths != 2 || len(p.TopPaths) != 1 {
+		t.Errorf("process 1 = %+v", p)
+	}
+	if len(report.ModelLoads) != 2 || report.ModelLoads[0].PID != 3 || report.ModelLoads[1].ModelKind != ModelKindOllamaBlob {
+		t.Errorf("model loads = %+v", report.ModelLoads)
+	}
+
+	modelsOnly := analyzeFileAccess("m1", stats, testBase, at(10*time.Second), FileAccessOptions{ModelsOnly: true})
+	if len(modelsOnly.Files) != 1 || modelsOnly.Files[0].Path != blob || len(modelsOnly.Processes) != 2 {
+		t.Errorf("models only = %+v", modelsOnly)
+	}
+}
@@ -0,0 +1,134 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"scope/database/postgres"
+	"scope/internal/models"
+)
+
+// 火焰图的权重
+const (
+	FlameGraphWeightCount = "count" // 事件数
+	FlameGraphWeightBytes = "bytes" // 分配字节数，仅 cudaMalloc 和 ggml_aligned_malloc
+)
+
+// FlameGraphNode 是火焰图中的一帧，Value 包含所有子帧
+type FlameGraphNode struct {
+	Name     string            `json:"name"`
+	Value    int64             `json:"value"`
+	Children []*FlameGraphNode `json:"children,omitempty"`
+}
+
+// FlameGraph 是一个时间窗口内某个操作的调用栈火焰图，根节点下第一层为进程 ("comm (pid)")
+type FlameGraph struct {
+	MachineID string          `json:"machine_id"`
+	Operation string          `json:"operation"`
+	Weight    string          `json:"weight"`
+	Start     time.Time       `json:"start"`
+	End       time.Time       `json:"end"`
+	Total     int64           `json:"total"`
+	Root      *FlameGraphNode `json:"root"`
+}
+
+// FoldedStack 是折叠格式 (flamegraph.pl / speedscope) 的一行: 从栈底到栈顶以 ';' 连接的帧及其权重
+type FoldedStack struct {
+	Stack string
+	Value int64
+}
+
+// FlameGraphService 根据探针采集的用户态调用栈生成火焰图
+type FlameGraphService struct {
+	eventStore *postgres.EventStore
+}
+
+// Folded 返回窗口内 operation 的折叠调用栈，按调用栈排序
+func (s *FlameGraphService) Folded(ctx context.Context, filter postgres.EventFilter, operation, weight string) ([]FoldedStack, error) {
+	counts, err := s.eventStore.StackCounts(ctx, filter, operation)
+	if err != nil {
+		return nil, err
+	}
+	return foldStacks(counts, weight), nil
+}
+
+// Build 返回窗口内 operation 的火焰图
+func (s *FlameGraphService) Build(ctx context.Context, filter postgres.EventFilter, operation, weight string) (*FlameGraph, error) {
+	folded, err := s.Folded(ctx, filter, operation, weight)
+	if err != nil {
+		return nil, err
+	}
+	root := buildFlameTree(folded)
+	return &FlameGraph{
+		MachineID: filter.MachineID,
+		Operation: operation,
+		Weight:    weight,
+		Start:     filter.Start,
+		End:       filter.End,
+		Total:     root.Value,
+		Root:      root,
+	}, nil
+}
+
+// foldStacks 把栈顶在前的调用栈反转为栈底在前，并以 "comm (pid)" 作为最底层的帧，合并相同的行。
+// 帧名中的 ';' 是折叠格式的分隔符，替换为 ':'。
+func foldStacks(counts []models.StackCount, weight string) []FoldedStack {
+	values := make(map[string]int64)
+	for _, c := range counts {
+		value := c.Count
+		if weight == FlameGraphWeightBytes {
+			value = c.Bytes
+		}
+		if value <= 0 {
+			continue
+		}
+		frames := make([]string, 0, len(c.Stack)+1)
+		frames = append(frames, fmt.Sprintf("%s (%d)", c.Comm, c.PID))
+		for i := len(c.Stack) - 1; i >= 0; i-- {
+			frames = append(frames, strings.ReplaceAll(c.Stack[i], ";", ":"))
+		}
+		values[strings.Join(frames, ";")] += value
+	}
+	folded := make([]FoldedStack, 0, len(values))
+	for stack, value := range values {
+		folded = append(folded, FoldedStack{Stack: stack, Value: value})
+	}
+	sort.Slice(folded, func(i, j int) bool { return folded[i].Stack < folded[j].Stack })
+	return folded
+}
+
+// buildFlameTree 把折叠调用栈合并成树，子帧按权重降序排列
+func buildFlameTree(folded []FoldedStack) *FlameGraphNode {
+	root := &FlameGraphNode{Name: "all"}
+	for _, f := range folded {
+		node := root
+		node.Value += f.Value
+		for _, name := range strings.Split(f.Stack, ";") {
+			var child *FlameGraphNode
+			for _, c := range node.Children {
+				if c.Name == name {
+					child = c
+					break
+				}
+			}
+			if child == nil {
+				child = &FlameGraphNode{Name: name}
+				node.Children = append(node.Children, child)
+			}
+			child.Value += f.Value
+			node = child
+		}
+	}
+	var sortChildren func(n *FlameGraphNode)
+	sortChildren = func(n *FlameGraphNode) {
+		sort.SliceStable(n.Children, func(i, j int) bool { return n.Children[i].Value > n.Children[j].Value })
+		for _, c := range n.Children {
+			sortChildren(c)
+		}
+	}
+	sortChildren(root)
+	return root
+}
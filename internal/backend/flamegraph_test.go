@@ -0,0 +1,46 @@
+package backend
+
+import (
+	"reflect"
+	"testing"
+
+	"scope/internal/models"
+)
+
+func TestFoldStacks(t *testing.T) {
+	counts := []models.StackCount{
+		{PID: 10, Comm: "ollama", Stack: []string{"cudaMalloc", "ggml_backend_cuda_buffer_alloc", "main"}, Count: 3, Bytes: 3 << 20},
+		{PID: 10, Comm: "ollama", Stack: []string{"cudaMalloc", "ggml_cuda_pool_alloc", "main"}, Count: 1, Bytes: 1 << 20},
+		{PID: 10, Comm: "ollama", Stack: []string{"cudaMalloc", "a;b", "main"}, Count: 2, Bytes: 0},
+		{PID: 11, Comm: "llama", Stack: []string{"cudaMalloc"}, Count: 5, Bytes: 5},
+	}
+
+	folded := foldStacks(counts, FlameGraphWeightCount)
+	want := []FoldedStack{
+		{"llama (11);cudaMalloc", 5},
+		{"ollama (10);main;a:b;cudaMalloc", 2},
+		{"ollama (10);main;ggml_backend_cuda_buffer_alloc;cudaMalloc", 3},
+		{"ollama (10);main;ggml_cuda_pool_alloc;cudaMalloc", 1},
+	}
+	if !reflect.DeepEqual(folded, want) {
+		t.Errorf("foldStacks(count) = %+v, want %+v", folded, want)
+	}
+
+	// 按字节统计时跳过大小为 0 的调用栈
+	if folded := foldStacks(counts, FlameGraphWeightBytes); len(folded) != 3 {
+		t.Errorf("foldStacks(bytes) = %+v, want 3 stacks", folded)
+	}
+
+	root := buildFlameTree(foldStacks(counts, FlameGraphWeightCount))
+	if root.Value != 11 || len(root.Children) != 2 {
+		t.Fatalf("root = %+v", root)
+	}
+	ollama := root.Children[0]
+	if ollama.Name != "ollama (10)" || ollama.Value != 6 || len(ollama.Children) != 1 {
+		t.Fatalf("first process = %+v, want ollama (10) with 6", ollama)
+	}
+	main := ollama.Children[0]
+	if main.Name != "main" || len(main.Children) != 3 || main.Children[0].Name != "ggml_backend_cuda_buffer_alloc" {
+		t.Errorf("main = %+v, want children ordered by value", main)
+	}
+}
@@ -0,0 +1,303 @@
+package backend
+
+import (
+	"math/bits"
+	"sort"
+	"sync"
+	"time"
+
+	"scope/internal/models"
+)
+
+const (
+	ggmlHeapTimelineLen  = 600              // 每个进程保留的时间线采样点数 (1s 一个, 即 10 分钟)
+	ggmlHeapMaxLongLived = 100              // 快照中最多返回的长期存活分配数
+	ggmlHeapIdleTimeout  = 30 * time.Minute // 超过该时间没有事件的进程会被清理
+	ggmlHeapPlateauAfter = 10 * time.Second // 峰值在该时间内未再增长即认为内存已进入平台期
+	// Receive 的多个消费者并发投递事件，同一进程的 free 可能先于对应的 malloc 到达。
+	// 找不到分配的 free 在该时间内 (按事件时间) 等待迟到的 malloc，之后才确认为未知释放。
+	ggmlHeapReorderWindow = 10 * time.Second
+)
+
+// GGMLAllocation 是一次仍存活的 ggml_aligned_malloc 分配
+type GGMLAllocation struct {
+	Ptr     int64     `json:"ptr"`
+	Size    int64     `json:"size"`
+	AllocTs time.Time `json:"alloc_ts"`
+	AgeNs   int64     `json:"age_ns"`
+}
+
+// GGMLHeapSample 是某一秒结束时的堆占用
+type GGMLHeapSample struct {
+	Ts    time.Time `json:"ts"`
+	Bytes int64     `json:"bytes"`
+}
+
+// HistogramBucket 统计大小落在 [LowerBytes, UpperBytes) 的分配次数
+type HistogramBucket struct {
+	LowerBytes int64 `json:"lower_bytes"`
+	UpperBytes int64 `json:"upper_bytes"`
+	Count      int64 `json:"count"`
+}
+
+// GGMLHeapSnapshot 是一个进程当前的 GGML 主机内存状态
+type GGMLHeapSnapshot struct {
+	MachineID       string            `json:"machine_id"`
+	PID             int32             `json:"pid"`
+	Comm            string            `json:"comm"`
+	Cmdline         string            `json:"cmdline"`
+	CurrentBytes    int64             `json:"current_bytes"`
+	PeakBytes       int64             `json:"peak_bytes"`
+	PeakTs          time.Time         `json:"peak_ts"`
+	Plateaued       bool              `json:"plateaued"` // 最近 ggmlHeapPlateauAfter 内峰值没有增长
+	LiveAllocations int               `json:"live_allocations"`
+	Allocs          int64             `json:"allocs"`
+	Frees           int64             `json:"frees"`
+	UnknownFrees    int64             `json:"unknown_frees"`
+	LastEventTs     time.Time         `json:"last_event_ts"`
+	Histogram       []HistogramBucket `json:"histogram"`
+	LongLived       []GGMLAllocation  `json:"long_lived"`
+	Timeline        []GGMLHeapSample  `json:"timeline"`
+}
+
+type heapKey struct {
+	machineID string
+	pid       int32
+}
+
+type ggmlHeapState struct {
+	comm, cmdline string
+	live          map[int64]GGMLAllocation
+	pendingFrees  map[int64]time.Time // 没有匹配到分配的 free，等待迟到的 malloc
+	current, peak int64
+	peakTs        time.Time
+	allocs, frees int64
+	unknownFrees  int64
+	lastEventTs   time.Time
+	lastSeen      time.Time // 墙上时间，用于清理
+	histogram     [65]int64 // 下标为 bits.Len64(size)
+	timeline      []GGMLHeapSample
+}
+
+// GGMLHeapTracker 根据流入的 ggml_base 事件增量重建每个进程的主机内存堆。
+// 它实现 EventObserver，由 Receive 在消费 Redis Stream 时调用。
+type GGMLHeapTracker struct {
+	mu          sync.Mutex
+	heaps       map[heapKey]*ggmlHeapState
+	subscribers map[heapKey]map[chan struct{}]struct{}
+	lastPrune   time.Time
+}
+
+func NewGGMLHeapTracker() *GGMLHeapTracker {
+	return &GGMLHeapTracker{
+		heaps:       make(map[heapKey]*ggmlHeapState),
+		subscribers: make(map[heapKey]map[chan struct{}]struct{}),
+		lastPrune:   time.Now(),
+	}
+}
+
+// ObserveEvent 处理一条来自 agent 的事件
+func (t *GGMLHeapTracker) ObserveEvent(topic string, eventData map[string]interface{}) {
+	if topic != models.GGMLBaseTopic {
+		return
+	}
+	machineID, _ := eventData["machineid"].(string)
+	operation, _ := eventData["operation"].(string)
+	pid, _ := eventData["pid"].(float64)
+	timestamp, _ := eventData["timestamp"].(float64)
+	ptr, _ := eventData["ptr"].(float64)
+	size, _ := eventData["size"].(float64)
+	comm, _ := eventData["comm"].(string)
+	cmdline, _ := eventData["cmdline"].(string)
+
+	t.observe(heapKey{machineID: machineID, pid: int32(pid)}, operation, time.Unix(0, int64(timestamp)).UTC(), int64(ptr), int64(size), comm, cmdline)
+}
+
+func (t *GGMLHeapTracker) observe(key heapKey, operation string, ts time.Time, ptr, size int64, comm, cmdline string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h, ok := t.heaps[key]
+	if !ok {
+		h = &ggmlHeapState{live: make(map[int64]GGMLAllocation), pendingFrees: make(map[int64]time.Time)}
+		t.heaps[key] = h
+	}
+	if comm != "" {
+		h.comm = comm
+	}
+	if cmdline != "" {
+		h.cmdline = cmdline
+	}
+	h.lastSeen = time.Now()
+	if ts.After(h.lastEventTs) {
+		h.lastEventTs = ts
+	}
+
+	switch operation {
+	case "ggml_aligned_malloc":
+		if ptr == 0 {
+			return
+		}
+		h.allocs++
+		h.histogram[bits.Len64(uint64(size))]++
+		if freeTs, ok := h.pendingFrees[ptr]; ok && !freeTs.Before(ts) {
+			// 对应的 free 已经先到达，这次分配已经释放
+			delete(h.pendingFrees, ptr)
+			h.unknownFrees--
+			break
+		}
+		old, ok := h.live[ptr]
+		if ok && old.AllocTs.After(ts) {
+			// 地址被复用后较早的一次分配迟到，它的 free 也在 live 中的分配之前
+			break
+		}
+		if ok {
+			h.current -= old.Size
+		}
+		h.live[ptr] = GGMLAllocation{Ptr: ptr, Size: size, AllocTs: ts}
+		h.current += size
+		if h.current > h.peak {
+			h.peak = h.current
+			h.peakTs = ts
+		}
+	case "ggml_aligned_free":
+		if ptr == 0 {
+			return
+		}
+		h.frees++
+		alloc, ok := h.live[ptr]
+		switch {
+		case ok && alloc.AllocTs.After(ts):
+			// 释放的是地址被复用之前的分配，它已经被 live 中较新的分配替换
+		case ok:
+			h.current -= alloc.Size
+			delete(h.live, ptr)
+		default:
+			h.unknownFrees++
+			h.pendingFrees[ptr] = ts
+		}
+	default:
+		return
+	}
+
+	// 按秒更新时间线
+	second := ts.Truncate(time.Second).Add(time.Second)
+	if n := len(h.timeline); n > 0 && !second.After(h.timeline[n-1].Ts) {
+		h.timeline[n-1].Bytes = h.current
+	} else {
+		h.timeline = append(h.timeline, GGMLHeapSample{Ts: second, Bytes: h.current})
+		if len(h.timeline) > ggmlHeapTimelineLen {
+			h.timeline = h.timeline[len(h.timeline)-ggmlHeapTimelineLen:]
+		}
+		// 每秒清理一次超出重排窗口的 free，之后到达的同地址 malloc 视为新的分配
+		for p, freeTs := range h.pendingFrees {
+			if h.lastEventTs.Sub(freeTs) > ggmlHeapReorderWindow {
+				delete(h.pendingFrees, p)
+			}
+		}
+	}
+
+	for ch := range t.subscribers[key] {
+		select {
+		case ch <- struct{}{}:
+		default: // 订阅者尚未处理上一次通知，合并
+		}
+	}
+
+	if time.Since(t.lastPrune) > time.Minute {
+		t.pruneLocked()
+	}
+}
+
+// pruneLocked 清理长时间没有事件且无人订阅的进程
+func (t *GGMLHeapTracker) pruneLocked() {
+	t.lastPrune = time.Now()
+	for key, h := range t.heaps {
+		if time.Since(h.lastSeen) > ggmlHeapIdleTimeout && len(t.subscribers[key]) == 0 {
+			delete(t.heaps, key)
+		}
+	}
+}
+
+// Snapshots 返回某台机器上的进程堆快照，pid 为 0 时返回全部进程
+func (t *GGMLHeapTracker) Snapshots(machineID string, pid int32, minAge time.Duration) []GGMLHeapSnapshot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var snapshots []GGMLHeapSnapshot
+	for key, h := range t.heaps {
+		if key.machineID != machineID || (pid != 0 && key.pid != pid) {
+			continue
+		}
+		snapshots = append(snapshots, h.snapshot(key, minAge))
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].CurrentBytes > snapshots[j].CurrentBytes })
+	return snapshots
+}
+
+// Subscribe 返回一个在该进程堆发生变化时收到通知的 channel，调用方需在结束时调用 cancel
+func (t *GGMLHeapTracker) Subscribe(machineID string, pid int32) (<-chan struct{}, func()) {
+	key := heapKey{machineID: machineID, pid: pid}
+	ch := make(chan struct{}, 1)
+
+	t.mu.Lock()
+	if t.subscribers[key] == nil {
+		t.subscribers[key] = make(map[chan struct{}]struct{})
+	}
+	t.subscribers[key][ch] = struct{}{}
+	t.mu.Unlock()
+
+	cancel := func() {
+		t.mu.Lock()
+		delete(t.subscribers[key], ch)
+		if len(t.subscribers[key]) == 0 {
+			delete(t.subscribers, key)
+		}
+		t.mu.Unlock()
+	}
+	return ch, cancel
+}
+
+func (h *ggmlHeapState) snapshot(key heapKey, minAge time.Duration) GGMLHeapSnapshot {
+	s := GGMLHeapSnapshot{
+		MachineID:       key.machineID,
+		PID:             key.pid,
+		Comm:            h.comm,
+		Cmdline:         h.cmdline,
+		CurrentBytes:    h.current,
+		PeakBytes:       h.peak,
+		PeakTs:          h.peakTs,
+		Plateaued:       h.peak > 0 && h.lastEventTs.Sub(h.peakTs) >= ggmlHeapPlateauAfter,
+		LiveAllocations: len(h.live),
+		Allocs:          h.allocs,
+		Frees:           h.frees,
+		UnknownFrees:    h.unknownFrees,
+		LastEventTs:     h.lastEventTs,
+		Timeline:        append([]GGMLHeapSample(nil), h.timeline...),
+	}
+
+	for i, count := range h.histogram {
+		if count == 0 {
+			continue
+		}
+		bucket := HistogramBucket{Count: count, UpperBytes: 1}
+		if i > 0 {
+			bucket.LowerBytes = 1 << (i - 1)
+			bucket.UpperBytes = 1 << i
+		}
+		s.Histogram = append(s.Histogram, bucket)
+	}
+
+	// 存活时长以该进程最后一个事件的时间为基准，避免受事件传输延迟影响
+	for _, alloc := range h.live {
+		alloc.AgeNs = h.lastEventTs.Sub(alloc.AllocTs).Nanoseconds()
+		if alloc.AgeNs >= minAge.Nanoseconds() {
+			s.LongLived = append(s.LongLived, alloc)
+		}
+	}
+	sort.Slice(s.LongLived, func(i, j int) bool { return s.LongLived[i].AllocTs.Before(s.LongLived[j].AllocTs) })
+	if len(s.LongLived) > ggmlHeapMaxLongLived {
+		s.LongLived = s.LongLived[:ggmlHeapMaxLongLived]
+	}
+	return s
+}
@@ -0,0 +1,82 @@
+package backend
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGGMLHeapTracker(t *testing.T) {
+	tracker := NewGGMLHeapTracker()
+	key := heapKey{machineID: "m1", pid: 9}
+
+	tracker.observe(key, "ggml_aligned_malloc", testBase, 0x10, 1024, "ollama", "ollama serve")
+	tracker.observe(key, "ggml_aligned_malloc", at(time.Second), 0x20, 3000, "ollama", "")
+	tracker.observe(key, "ggml_aligned_free", at(2*time.Second), 0x20, 0, "ollama", "")
+	tracker.observe(key, "ggml_aligned_free", at(20*time.Second), 0x30, 0, "ollama", "")
+
+	snapshots := tracker.Snapshots("m1", 0, 10*time.Second)
+	if len(snapshots) != 1 {
+		t.Fatalf("got %d snapshots, want 1", len(snapshots))
+	}
+	s := snapshots[0]
+	if s.CurrentBytes != 1024 || s.PeakBytes != 4024 {
+		t.Errorf("current/peak = %d/%d, want 1024/4024", s.CurrentBytes, s.PeakBytes)
+	}
+	if s.UnknownFrees != 1 {
+		t.Errorf("unknown frees = %d, want 1", s.UnknownFrees)
+	}
+	if !s.Plateaued {
+		t.Errorf("heap should be plateaued 19s after the peak")
+	}
+	if s.Cmdline != "ollama serve" {
+		t.Errorf("cmdline = %q", s.Cmdline)
+	}
+	if len(s.LongLived) != 1 || s.LongLived[0].Ptr != 0x10 {
+		t.Errorf("long-lived = %+v, want only 0x10", s.LongLived)
+	}
+	if len(s.Histogram) != 2 || s.Histogram[0].LowerBytes != 1024 || s.Histogram[1].LowerBytes != 2048 {
+		t.Errorf("histogram = %+v", s.Histogram)
+	}
+	if len(s.Timeline) != 4 {
+		t.Errorf("timeline has %d samples, want 4", len(s.Timeline))
+	}
+
+	updates, cancel := tracker.Subscribe("m1", 9)
+	defer cancel()
+	tracker.observe(key, "ggml_aligned_malloc", at(21*time.Second), 0x40, 8, "ollama", "")
+	select {
+	case <-updates:
+	default:
+		t.Errorf("subscriber was not notified")
+	}
+}
+
+func TestGGMLHeapTrackerOutOfOrder(t *testing.T) {
+	tracker := NewGGMLHeapTracker()
+	key := heapKey{machineID: "m1", pid: 9}
+
+	// free 先于对应的 malloc 到达
+	tracker.observe(key, "ggml_aligned_free", at(2*time.Second), 0x10, 0, "ollama", "")
+	tracker.observe(key, "ggml_aligned_malloc", at(time.Second), 0x10, 1024, "ollama", "")
+	// 地址被复用: 第二次分配先到达，第一次分配和它的 free 迟到
+	tracker.observe(key, "ggml_aligned_malloc", at(5*time.Second), 0x20, 300, "ollama", "")
+	tracker.observe(key, "ggml_aligned_malloc", at(3*time.Second), 0x20, 200, "ollama", "")
+	tracker.observe(key, "ggml_aligned_free", at(4*time.Second), 0x20, 0, "ollama", "")
+
+	s := tracker.Snapshots("m1", 9, 0)[0]
+	if s.CurrentBytes != 300 || s.LiveAllocations != 1 {
+		t.Errorf("current = %d in %d allocations, want 300 in 1", s.CurrentBytes, s.LiveAllocations)
+	}
+	if s.Allocs != 3 || s.Frees != 2 || s.UnknownFrees != 0 {
+		t.Errorf("allocs/frees/unknown = %d/%d/%d, want 3/2/0", s.Allocs, s.Frees, s.UnknownFrees)
+	}
+
+	// 超出重排窗口的 free 不再匹配之后到达的 malloc
+	tracker.observe(key, "ggml_aligned_free", at(6*time.Second), 0x30, 0, "ollama", "")
+	tracker.observe(key, "ggml_aligned_malloc", at(6*time.Second+ggmlHeapReorderWindow+2*time.Second), 0x40, 8, "ollama", "")
+	tracker.observe(key, "ggml_aligned_malloc", at(5*time.Second), 0x30, 100, "ollama", "")
+	s = tracker.Snapshots("m1", 9, 0)[0]
+	if s.UnknownFrees != 1 || s.CurrentBytes != 408 {
+		t.Errorf("unknown frees = %d, current = %d, want 1 and 408", s.UnknownFrees, s.CurrentBytes)
+	}
+}
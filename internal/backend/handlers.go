@@ -1,15 +1,27 @@
 package backend
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"scope/database/postgres"
 	"scope/database/redis"
+	"scope/internal/middleware"
 	"scope/internal/models"
+	"scope/internal/utils"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/validator/v10"
+	"github.com/jmoiron/sqlx"
+	goredis "github.com/redis/go-redis/v9"
 )
 
 // 请求和响应结构体
@@ -55,14 +67,90 @@ type NodeHandler struct {
 	nodeService *NodeService
 }
 
+type TraceHandler struct {
+	traceService *TraceService
+}
+
+type CudaMemHandler struct {
+	cudaMemService *CudaMemService
+}
+
+type GGMLHeapHandler struct {
+	tracker *GGMLHeapTracker
+}
+
+type InferenceHandler struct {
+	inferenceService *InferenceService
+}
+
+type MemcpyHandler struct {
+	memcpyService *MemcpyService
+}
+
+type ProcessTreeHandler struct {
+	tree *ProcessTree
+}
+
+type KernelHandler struct {
+	kernelService *KernelService
+}
+
+type MetricsHandler struct {
+	inferenceService *InferenceService
+}
+
+type SchedHandler struct {
+	schedService *SchedService
+}
+
+type SyscallHandler struct {
+	syscallService *SyscallService
+}
+
+type FileHandler struct {
+	fileService *FileService
+}
+
+type FlameGraphHandler struct {
+	flameGraphService *FlameGraphService
+}
+
+type SymbolHandler struct {
+	store *SymbolStore
+}
+
 // Handler 处理认证相关的请求
 type Handler struct {
-	authService *AuthService
-	nodeHandler *NodeHandler
+	authService      *AuthService
+	nodeHandler      *NodeHandler
+	traceHandler     *TraceHandler
+	cudaMemHandler   *CudaMemHandler
+	ggmlHeapHandler  *GGMLHeapHandler
+	inferenceHandler *InferenceHandler
+	metricsHandler   *MetricsHandler
+	kernelHandler    *KernelHandler
+	memcpyHandler    *MemcpyHandler
+	processHandler   *ProcessTreeHandler
+	schedHandler     *SchedHandler
+	syscallHandler   *SyscallHandler
+	fileHandler      *FileHandler
+	symbolHandler    *SymbolHandler
+	flameHandler     *FlameGraphHandler
+	eventStore       *postgres.EventStore
+	analysisStore    *postgres.AnalysisStore
+}
+
+// NodeOptions 是节点管理的配置
+type NodeOptions struct {
+	AgentClient    *AgentClient  // 调用 agent API 的客户端
+	CredentialKey  string        // 加密节点凭据的 AES-256 密钥 (hex)
+	HeartbeatGrace time.Duration // 超过该时间没有心跳的节点视为离线
+	AllowInsecure  bool          // 允许非本机的节点通过明文 HTTP 注册
+	TrustedProxies []*net.IPNet  // 终止 TLS 的反向代理，只采信这些地址发来的 X-Forwarded-Proto
 }
 
 // NewHandler 创建一个新的认证处理器
-func NewHandler(authService *AuthService, redisconf4node redis.Config) *Handler {
+func NewHandler(authService *AuthService, redisconf4node redis.Config, tsdb *sqlx.DB, symbolStore *SymbolStore, nodeOptions NodeOptions) *Handler {
 	handler := Handler{
 		authService: authService,
 	}
@@ -72,14 +160,99 @@ func NewHandler(authService *AuthService, redisconf4node redis.Config) *Handler
 	client, _ := redis.NewClient(redisconf4node)
 	nodestore := redis.NewNodeStore(client)
 	nodeservice := NodeService{
-		nodeStore: nodestore,
+		nodeStore:      nodestore,
+		agentClient:    nodeOptions.AgentClient,
+		credentialKey:  nodeOptions.CredentialKey,
+		nonces:         utils.NewNonceCache(2 * nodeSignatureMaxSkew),
+		grace:          nodeOptions.HeartbeatGrace,
+		allowInsecure:  nodeOptions.AllowInsecure,
+		trustedProxies: nodeOptions.TrustedProxies,
 	}
 	handler.nodeHandler = &NodeHandler{
 		nodeService: &nodeservice,
 	}
+	eventStore := postgres.NewEventStore(tsdb)
+	analysisStore := postgres.NewAnalysisStore(tsdb)
+	handler.traceHandler = &TraceHandler{
+		traceService: &TraceService{
+			eventStore: eventStore,
+			symbols:    symbolStore,
+		},
+	}
+	handler.cudaMemHandler = &CudaMemHandler{
+		cudaMemService: &CudaMemService{
+			eventStore:    eventStore,
+			analysisStore: analysisStore,
+		},
+	}
+	handler.ggmlHeapHandler = &GGMLHeapHandler{
+		tracker: NewGGMLHeapTracker(),
+	}
+	inferenceService := &InferenceService{
+		eventStore:    eventStore,
+		analysisStore: analysisStore,
+	}
+	handler.inferenceHandler = &InferenceHandler{
+		inferenceService: inferenceService,
+	}
+	handler.metricsHandler = &MetricsHandler{
+		inferenceService: inferenceService,
+	}
+	handler.kernelHandler = &KernelHandler{
+		kernelService: &KernelService{
+			eventStore: eventStore,
+			symbols:    symbolStore,
+		},
+	}
+	handler.memcpyHandler = &MemcpyHandler{
+		memcpyService: &MemcpyService{
+			eventStore: eventStore,
+		},
+	}
+	handler.schedHandler = &SchedHandler{
+		schedService: &SchedService{
+			eventStore: eventStore,
+		},
+	}
+	handler.syscallHandler = &SyscallHandler{
+		syscallService: &SyscallService{
+			eventStore: eventStore,
+		},
+	}
+	handler.fileHandler = &FileHandler{
+		fileService: &FileService{
+			eventStore: eventStore,
+		},
+	}
+	handler.symbolHandler = &SymbolHandler{
+		store: symbolStore,
+	}
+	handler.flameHandler = &FlameGraphHandler{
+		flameGraphService: &FlameGraphService{
+			eventStore: eventStore,
+		},
+	}
+	handler.processHandler = &ProcessTreeHandler{
+		tree: NewProcessTree(),
+	}
+	handler.eventStore = eventStore
+	handler.analysisStore = analysisStore
 	return &handler
 }
 
+// EventObservers 返回需要跟随 Redis Stream 实时接收事件的分析器，传给 Receive
+func (h *Handler) EventObservers() []EventObserver {
+	return []EventObserver{
+		h.ggmlHeapHandler.tracker,
+		h.processHandler.tree,
+	}
+}
+
+// BootstrapProcessTree 从 events_os 恢复最近 lookback 时间内的进程树，应在 Receive 启动前调用
+func (h *Handler) BootstrapProcessTree(ctx context.Context, lookback time.Duration) error {
+	return h.processHandler.tree.Bootstrap(ctx, h.eventStore, h.analysisStore, lookback)
+}
+
 // Login 处理用户登录请求
 //
 // @Summary      User login
@@ -267,7 +440,7 @@ func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
 // NodeUp registers a node as online
 //
 // @Summary      Register node as online
-// @Description  Updates a node's status to online and returns a token
+// @Description  Re-registers an enrolled node and returns a new session token. The request must be HMAC-signed with the node credential (X-Scope-Node, X-Scope-Timestamp, X-Scope-Nonce, X-Scope-Signature)
 // @Tags         node
 // @Accept       json
 // @Produce      json
@@ -275,8 +448,24 @@ func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
 // @Router       /api/v1/node/up [post]
 // @Success      200 {object} map[string]string "Returns token"
 // @Failure      400 {object} string "Invalid request body or incomplete node information"
+// @Failure      401 {object} string "Node not enrolled or invalid signature"
+// @Failure      403 {object} string "Plain HTTP from a remote node"
 // @Failure      500 {object} string "Failed to update node"
 func (h *NodeHandler) NodeUp(w http.ResponseWriter, r *http.Request) {
+	if !h.nodeService.secureTransport(r) {
+		http.Error(w, ErrInsecureTransport.Error(), http.StatusForbidden)
+		return
+	}
+	nodeID, err := h.nodeService.VerifyNodeRequest(r)
+	if err != nil {
+		log.Printf("Node up rejected: %v", err)
+		if errors.Is(err, ErrNodeNotEnrolled) || errors.Is(err, ErrNodeSignature) {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		} else {
+			http.Error(w, "校验节点签名失败", http.StatusInternalServerError)
+		}
+		return
+	}
 
 	var node models.NodeInfo
 	if err := json.NewDecoder(r.Body).Decode(&node); err != nil {
@@ -288,6 +477,10 @@ func (h *NodeHandler) NodeUp(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "节点信息不完整", http.StatusBadRequest)
 		return
 	}
+	if node.ID != nodeID {
+		http.Error(w, "节点 ID 与签名不一致", http.StatusUnauthorized)
+		return
+	}
 
 	token, err := h.nodeService.NodeUp(r.Context(), node)
 	if err != nil {
@@ -299,6 +492,57 @@ func (h *NodeHandler) NodeUp(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"token": token})
 }
 
+// NodeEnroll enrolls a new node with a join token
+//
+// @Summary      Enroll node
+// @Description  First registration of a node. Consumes an admin-issued join token and returns a long-lived node credential used to sign later /node/up requests
+// @Tags         node
+// @Accept       json
+// @Produce      json
+// @Param        request body models.NodeEnrollRequest true "Node information and join token"
+// @Router       /api/v1/node/enroll [post]
+// @Success      200 {object} models.NodeEnrollResponse
+// @Failure      400 {object} string "Invalid request body or incomplete node information"
+// @Failure      401 {object} string "Invalid, expired or used join token"
+// @Failure      403 {object} string "Plain HTTP from a remote node"
+// @Failure      409 {object} string "Node already enrolled"
+// @Failure      500 {object} string "Failed to enroll node"
+func (h *NodeHandler) NodeEnroll(w http.ResponseWriter, r *http.Request) {
+	if !h.nodeService.secureTransport(r) {
+		http.Error(w, ErrInsecureTransport.Error(), http.StatusForbidden)
+		return
+	}
+	var req models.NodeEnrollRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "无效的请求体", http.StatusBadRequest)
+		return
+	}
+	node := req.Node
+	if node.Status != "online" || node.ID == "" || len(node.IPs) == 0 || node.LastSeen.IsZero() || req.JoinToken == "" {
+		http.Error(w, "节点信息不完整", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := h.nodeService.Enroll(r.Context(), req)
+	switch {
+	case errors.Is(err, ErrJoinTokenInvalid), errors.Is(err, ErrJoinTokenExpired), errors.Is(err, ErrJoinTokenUsed):
+		log.Printf("Node %s enrollment rejected: %v", node.ID, err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	case errors.Is(err, ErrNodeEnrolled):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("Failed to enroll node %s: %v", node.ID, err)
+		http.Error(w, "注册节点失败", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Node %s enrolled", node.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
 // NodeDown registers a node as offline
 //
 // @Summary      Register node as offline
@@ -359,7 +603,1284 @@ func (h *NodeHandler) NodeList(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "获取节点列表失败", http.StatusInternalServerError)
 		return
 	}
+	// token 是调用 agent API 的签名密钥，不返回给前端
+	for i := range nodes {
+		nodes[i].Token = ""
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(nodes)
 }
+
+// NodeInventoryList returns the inventory of nodes matching the query filters
+//
+// @Summary      List node inventory
+// @Description  Returns kernel, BTF, CPU, memory, GPU, CUDA runtime, LLM binary, agent and probe versions of each node, filtered by the query parameters. Nodes that have not reported an inventory only match when no inventory filter is given
+// @Tags         node
+// @Produce      json
+// @Param        label   query string false "Label filter key=value, repeatable"
+// @Param        status  query string false "online or offline"
+// @Param        kernel  query string false "Kernel version prefix"
+// @Param        gpu     query string false "GPU model substring (case-insensitive)"
+// @Param        has_gpu query bool   false "Whether the node has an NVIDIA GPU"
+// @Param        btf     query bool   false "Whether the kernel exposes BTF"
+// @Param        cuda    query bool   false "Whether a CUDA runtime was found"
+// @Param        binary  query string false "LLM binary name, e.g. ollama or llama-server"
+// @Param        probe   query string false "Name of a running probe"
+// @Router       /api/v1/node/inventory [get]
+// @Security     ApiKeyAuth
+// @Success      200 {array} NodeInventoryItem
+// @Failure      400 {object} string "Invalid filter"
+// @Failure      500 {object} string "Failed to get node inventory"
+func (h *NodeHandler) NodeInventoryList(w http.ResponseWriter, r *http.Request) {
+	filter, err := ParseInventoryFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	items, err := h.nodeService.ListInventory(r.Context(), filter)
+	if err != nil {
+		http.Error(w, "获取节点清单失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(items)
+}
+
+// NodeInventory returns the inventory of one node
+//
+// @Summary      Get node inventory
+// @Description  Returns the last inventory reported by the node; inventory is null if the node has not reported one yet
+// @Tags         node
+// @Produce      json
+// @Param        id path string true "Node ID"
+// @Router       /api/v1/node/{id}/inventory [get]
+// @Security     ApiKeyAuth
+// @Success      200 {object} NodeInventoryItem
+// @Failure      404 {object} string "Node not found"
+// @Failure      500 {object} string "Failed to get node inventory"
+func (h *NodeHandler) NodeInventory(w http.ResponseWriter, r *http.Request) {
+	item, err := h.nodeService.GetInventory(r.Context(), chi.URLParam(r, "id"))
+	if errors.Is(err, goredis.Nil) {
+		http.Error(w, "节点不存在", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "获取节点清单失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(item)
+}
+
+// NodeHeartbeat records a heartbeat pushed by an agent
+//
+// @Summary      Node heartbeat
+// @Description  Agents push health, probe status, spool depth and version periodically. The request must be HMAC-signed with the node credential; node status is derived from the time of the last heartbeat
+// @Tags         node
+// @Accept       json
+// @Produce      json
+// @Param        heartbeat body models.NodeHeartbeat true "Heartbeat"
+// @Router       /api/v1/node/heartbeat [post]
+// @Success      200 {object} map[string]string
+// @Failure      400 {object} string "Invalid request body"
+// @Failure      401 {object} string "Node not enrolled or invalid signature"
+// @Failure      500 {object} string "Failed to record heartbeat"
+func (h *NodeHandler) NodeHeartbeat(w http.ResponseWriter, r *http.Request) {
+	nodeID, err := h.nodeService.VerifyNodeRequest(r)
+	if err != nil {
+		if errors.Is(err, ErrNodeNotEnrolled) || errors.Is(err, ErrNodeSignature) {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		} else {
+			http.Error(w, "校验节点签名失败", http.StatusInternalServerError)
+		}
+		return
+	}
+	var hb models.NodeHeartbeat
+	if err := json.NewDecoder(r.Body).Decode(&hb); err != nil {
+		http.Error(w, "无效的请求体", http.StatusBadRequest)
+		return
+	}
+	if err := h.nodeService.RecordHeartbeat(r.Context(), nodeID, hb); err != nil {
+		log.Printf("Failed to record heartbeat of node %s: %v", nodeID, err)
+		http.Error(w, "保存心跳失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": NodeStatusOnline})
+}
+
+// DeleteNode removes a node and its credential
+//
+// @Summary      Delete node
+// @Description  Removes a node and revokes its credential; the machine needs a new join token to enroll again
+// @Tags         node
+// @Param        id path string true "Node ID"
+// @Param        X-Admin-Token header string true "Admin token (ADMIN_TOKEN)"
+// @Router       /api/v1/node/{id} [delete]
+// @Security     ApiKeyAuth
+// @Success      204 "No Content"
+// @Failure      403 {object} string "Admin token missing or invalid"
+// @Failure      500 {object} string "Failed to delete node"
+func (h *NodeHandler) DeleteNode(w http.ResponseWriter, r *http.Request) {
+	if err := h.nodeService.DeleteNode(r.Context(), chi.URLParam(r, "id")); err != nil {
+		http.Error(w, "删除节点失败", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateJoinToken creates a node join token
+//
+// @Summary      Create join token
+// @Description  Creates a single-use and/or expiring join token, optionally carrying labels for the nodes enrolled with it. The full token is only returned once
+// @Tags         node
+// @Accept       json
+// @Produce      json
+// @Param        request body CreateJoinTokenRequest true "Join token options"
+// @Param        X-Admin-Token header string true "Admin token (ADMIN_TOKEN)"
+// @Router       /api/v1/node/join-tokens [post]
+// @Security     ApiKeyAuth
+// @Success      201 {object} CreateJoinTokenResponse
+// @Failure      400 {object} string "Invalid request body or neither single-use nor expiring"
+// @Failure      403 {object} string "Admin token missing or invalid"
+// @Failure      500 {object} string "Failed to create join token"
+func (h *NodeHandler) CreateJoinToken(w http.ResponseWriter, r *http.Request) {
+	var req CreateJoinTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "无效的请求体", http.StatusBadRequest)
+		return
+	}
+	if !req.SingleUse && req.TTLSec <= 0 {
+		http.Error(w, "加入令牌必须是单次使用或设置有效期", http.StatusBadRequest)
+		return
+	}
+	userID, _ := middleware.GetUserID(r.Context())
+	resp, err := h.nodeService.CreateJoinToken(r.Context(), req, userID)
+	if err != nil {
+		http.Error(w, "创建加入令牌失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ListJoinTokens lists node join tokens
+//
+// @Summary      List join tokens
+// @Description  Returns the metadata and use count of every join token (without the secret)
+// @Tags         node
+// @Produce      json
+// @Param        X-Admin-Token header string true "Admin token (ADMIN_TOKEN)"
+// @Router       /api/v1/node/join-tokens [get]
+// @Security     ApiKeyAuth
+// @Success      200 {array} models.JoinToken
+// @Failure      403 {object} string "Admin token missing or invalid"
+// @Failure      500 {object} string "Failed to list join tokens"
+func (h *NodeHandler) ListJoinTokens(w http.ResponseWriter, r *http.Request) {
+	tokens, err := h.nodeService.ListJoinTokens(r.Context())
+	if err != nil {
+		http.Error(w, "获取加入令牌失败", http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].CreatedAt.After(tokens[j].CreatedAt) })
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// DeleteJoinToken revokes a node join token
+//
+// @Summary      Revoke join token
+// @Description  Revokes a join token; nodes already enrolled with it are not affected
+// @Tags         node
+// @Param        id path string true "Join token ID"
+// @Param        X-Admin-Token header string true "Admin token (ADMIN_TOKEN)"
+// @Router       /api/v1/node/join-tokens/{id} [delete]
+// @Security     ApiKeyAuth
+// @Success      204 "No Content"
+// @Failure      403 {object} string "Admin token missing or invalid"
+// @Failure      500 {object} string "Failed to revoke join token"
+func (h *NodeHandler) DeleteJoinToken(w http.ResponseWriter, r *http.Request) {
+	if err := h.nodeService.DeleteJoinToken(r.Context(), chi.URLParam(r, "id")); err != nil {
+		http.Error(w, "吊销加入令牌失败", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ExportChromeTrace exports a traced time window as a Chrome trace
+//
+// @Summary      Export Chrome / Perfetto trace
+// @Description  Converts sched, ggml and CUDA events of a machine, pid set and time range into Chrome trace JSON that can be opened in ui.perfetto.dev
+// @Tags         trace
+// @Produce      json
+// @Param        machine_id   query string true  "Machine ID"
+// @Param        pids         query string false "Comma separated pid list"
+// @Param        start        query string true  "Start time (RFC3339 or unix ns)"
+// @Param        end          query string true  "End time (RFC3339 or unix ns)"
+// @Param        container_id query string false "Comma separated container ids (full or short prefix)"
+// @Param        cgroup       query string false "Cgroup path prefix"
+// @Param        pod_uid      query string false "Kubernetes pod UID"
+// @Router       /api/v1/trace/chrome [get]
+// @Security     ApiKeyAuth
+// @Success      200 {object} ChromeTrace
+// @Failure      400 {object} string "Invalid query parameters"
+// @Failure      422 {object} string "Too many events in the window; narrow the time range or filters"
+// @Failure      500 {object} string "Failed to build trace"
+func (h *TraceHandler) ExportChromeTrace(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseEventFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	trace, err := h.traceService.BuildChromeTrace(r.Context(), filter)
+	if err != nil {
+		if tooManyEvents(w, err) {
+			return
+		}
+		log.Printf("Error building chrome trace: %v", err)
+		http.Error(w, "生成 trace 失败", http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("scope-%s-%d.json", filter.MachineID, filter.Start.Unix())
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(trace)
+}
+
+// AnalyzeCudaMemory reconstructs live CUDA device allocations
+//
+// @Summary      Analyze CUDA device memory
+// @Description  Pairs cudaMalloc/cudaFree per process and reports outstanding bytes over time, long-lived allocations, double frees and frees of unknown pointers
+// @Tags         analysis
+// @Produce      json
+// @Param        machine_id   query string true  "Machine ID"
+// @Param        pids         query string false "Comma separated pid list"
+// @Param        start        query string true  "Start time (RFC3339 or unix ns)"
+// @Param        end          query string true  "End time (RFC3339 or unix ns)"
+// @Param        container_id query string false "Comma separated container ids (full or short prefix)"
+// @Param        cgroup       query string false "Cgroup path prefix"
+// @Param        pod_uid      query string false "Kubernetes pod UID"
+// @Param        min_age      query string false "Report live allocations older than this (default 5m)"
+// @Param        bucket       query string false "Timeline bucket size (default 1s)"
+// @Router       /api/v1/analysis/cuda/memory [get]
+// @Security     ApiKeyAuth
+// @Success      200 {object} CudaMemReport
+// @Failure      400 {object} string "Invalid query parameters"
+// @Failure      422 {object} string "Too many events in the window; narrow the time range or filters"
+// @Failure      500 {object} string "Failed to analyze"
+func (h *CudaMemHandler) AnalyzeCudaMemory(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseEventFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	minAge, err := parseDurationParam(r.URL.Query().Get("min_age"), 5*time.Minute)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	bucket, err := parseDurationParam(r.URL.Query().Get("bucket"), time.Second)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.cudaMemService.Analyze(r.Context(), filter, minAge, bucket)
+	if err != nil {
+		if tooManyEvents(w, err) {
+			return
+		}
+		log.Printf("Error analyzing CUDA memory: %v", err)
+		http.Error(w, "分析 CUDA 显存失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(report)
+}
+
+// ListCudaMemFindings returns findings written by the periodic leak check
+//
+// @Summary      List CUDA memory findings
+// @Description  Returns long-lived allocations, double frees and unknown frees recorded by the periodic leak check
+// @Tags         analysis
+// @Produce      json
+// @Param        machine_id query string true  "Machine ID"
+// @Param        pids       query string false "Comma separated pid list"
+// @Param        start      query string true  "Start time (RFC3339 or unix ns)"
+// @Param        end        query string true  "End time (RFC3339 or unix ns)"
+// @Router       /api/v1/analysis/cuda/memory/findings [get]
+// @Security     ApiKeyAuth
+// @Success      200 {array} models.CudaMemFinding
+// @Failure      400 {object} string "Invalid query parameters"
+// @Failure      500 {object} string "Failed to query findings"
+func (h *CudaMemHandler) ListCudaMemFindings(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseEventFilterWithoutContainer(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	findings, err := h.cudaMemService.ListFindings(r.Context(), filter)
+	if err != nil {
+		log.Printf("Error listing CUDA memory findings: %v", err)
+		http.Error(w, "查询 CUDA 显存问题失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(findings)
+}
+
+// parseHeapQuery 解析 machine_id, pid, min_age 参数
+func parseHeapQuery(r *http.Request) (string, int32, time.Duration, error) {
+	q := r.URL.Query()
+	machineID := q.Get("machine_id")
+	if machineID == "" {
+		return "", 0, 0, fmt.Errorf("缺少 machine_id 参数")
+	}
+	var pid int32
+	if q.Get("pid") != "" {
+		pids, err := parsePIDsParam(q.Get("pid"))
+		if err != nil || len(pids) != 1 {
+			return "", 0, 0, fmt.Errorf("无效的 pid %q", q.Get("pid"))
+		}
+		pid = pids[0]
+	}
+	minAge, err := parseDurationParam(q.Get("min_age"), time.Minute)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	return machineID, pid, minAge, nil
+}
+
+// GetGGMLHeap returns the live GGML host heap of processes on a machine
+//
+// @Summary      GGML host heap snapshot
+// @Description  Live heap reconstructed from ggml_aligned_malloc/free events: current and peak usage, size histogram and long-lived allocations
+// @Tags         analysis
+// @Produce      json
+// @Param        machine_id query string true  "Machine ID"
+// @Param        pid        query int    false "Process ID (all processes if omitted)"
+// @Param        min_age    query string false "Report live allocations older than this (default 1m)"
+// @Router       /api/v1/analysis/ggml/heap [get]
+// @Security     ApiKeyAuth
+// @Success      200 {array} GGMLHeapSnapshot
+// @Failure      400 {object} string "Invalid query parameters"
+func (h *GGMLHeapHandler) GetGGMLHeap(w http.ResponseWriter, r *http.Request) {
+	machineID, pid, minAge, err := parseHeapQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	snapshots := h.tracker.Snapshots(machineID, pid, minAge)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(snapshots)
+}
+
+// StreamGGMLHeap streams heap snapshots of one process as server-sent events
+//
+// @Summary      Stream GGML host heap
+// @Description  Pushes a GGMLHeapSnapshot (at most every 500ms) whenever new ggml_base events of the process arrive
+// @Tags         analysis
+// @Produce      text/event-stream
+// @Param        machine_id query string true  "Machine ID"
+// @Param        pid        query int    true  "Process ID"
+// @Param        min_age    query string false "Report live allocations older than this (default 1m)"
+// @Router       /api/v1/analysis/ggml/heap/stream [get]
+// @Security     ApiKeyAuth
+// @Success      200 {object} GGMLHeapSnapshot
+// @Failure      400 {object} string "Invalid query parameters"
+func (h *GGMLHeapHandler) StreamGGMLHeap(w http.ResponseWriter, r *http.Request) {
+	machineID, pid, minAge, err := parseHeapQuery(r)
+	if err != nil || pid == 0 {
+		http.Error(w, "缺少或无效的 machine_id / pid 参数", http.StatusBadRequest)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "不支持流式响应", http.StatusInternalServerError)
+		return
+	}
+
+	updates, cancel := h.tracker.Subscribe(machineID, pid)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	send := func() {
+		for _, snapshot := range h.tracker.Snapshots(machineID, pid, minAge) {
+			data, _ := json.Marshal(snapshot)
+			fmt.Fprintf(w, "data: %s\n\n", data)
+		}
+		flusher.Flush()
+	}
+	send()
+
+	throttle := time.NewTicker(500 * time.Millisecond)
+	defer throttle.Stop()
+	pending := false
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-updates:
+			pending = true
+		case <-throttle.C:
+			if pending {
+				send()
+				pending = false
+			}
+		}
+	}
+}
+
+// ListInferenceSessions returns inference sessions written by the session builder
+//
+// @Summary      List inference sessions
+// @Description  Returns inference requests reconstructed from llamaLog markers and ggml_graph_compute bursts, with GPU matmul time, CPU graph time, memcpy bytes and sync waits attributed to each request
+// @Tags         analysis
+// @Produce      json
+// @Param        machine_id query string true  "Machine ID"
+// @Param        pids       query string false "Comma separated pid list"
+// @Param        start      query string true  "Start time (RFC3339 or unix ns)"
+// @Param        end        query string true  "End time (RFC3339 or unix ns)"
+// @Router       /api/v1/analysis/inference/sessions [get]
+// @Security     ApiKeyAuth
+// @Success      200 {array} models.InferenceSession
+// @Failure      400 {object} string "Invalid query parameters"
+// @Failure      500 {object} string "Failed to query sessions"
+func (h *InferenceHandler) ListInferenceSessions(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseEventFilterWithoutContainer(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sessions, err := h.inferenceService.ListSessions(r.Context(), filter)
+	if err != nil {
+		log.Printf("Error listing inference sessions: %v", err)
+		http.Error(w, "查询推理会话失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// RebuildInferenceSessions reconstructs inference sessions of a time range and stores them
+//
+// @Summary      Rebuild inference sessions
+// @Description  Reconstructs inference sessions from raw events of the given range, upserts them and their token metrics into inference_sessions and llm_token_metrics, and returns the sessions
+// @Tags         analysis
+// @Produce      json
+// @Param        machine_id query string true  "Machine ID"
+// @Param        pids       query string false "Comma separated pid list"
+// @Param        start      query string true  "Start time (RFC3339 or unix ns)"
+// @Param        end        query string true  "End time (RFC3339 or unix ns)"
+// @Param        idle_gap   query string false "Gap between graph computes that splits two requests (default 2s)"
+// @Router       /api/v1/analysis/inference/sessions/rebuild [post]
+// @Security     ApiKeyAuth
+// @Success      200 {array} models.InferenceSession
+// @Failure      400 {object} string "Invalid query parameters"
+// @Failure      422 {object} string "Too many events in the window; narrow the time range or filters"
+// @Failure      500 {object} string "Failed to rebuild sessions"
+func (h *InferenceHandler) RebuildInferenceSessions(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseEventFilterWithoutContainer(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	idleGap, err := parseDurationParam(r.URL.Query().Get("idle_gap"), defaultInferenceIdleGap)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sessions, err := h.inferenceService.Reconstruct(r.Context(), filter, idleGap, true)
+	if err != nil {
+		if tooManyEvents(w, err) {
+			return
+		}
+		log.Printf("Error rebuilding inference sessions: %v", err)
+		http.Error(w, "重建推理会话失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// ListLLMRequestMetrics returns per-request token metrics
+//
+// @Summary      LLM request token metrics
+// @Description  Per inference request prefill steps, time-to-first-token, decode tokens, tokens/sec and inter-token latency derived from ggml_graph_compute
+// @Tags         metrics
+// @Produce      json
+// @Param        machine_id query string true  "Machine ID"
+// @Param        pids       query string false "Comma separated pid list"
+// @Param        start      query string true  "Start time (RFC3339 or unix ns)"
+// @Param        end        query string true  "End time (RFC3339 or unix ns)"
+// @Router       /api/v1/metrics/llm/requests [get]
+// @Security     ApiKeyAuth
+// @Success      200 {array} models.LLMTokenMetrics
+// @Failure      400 {object} string "Invalid query parameters"
+// @Failure      500 {object} string "Failed to query metrics"
+func (h *MetricsHandler) ListLLMRequestMetrics(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseEventFilterWithoutContainer(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	metrics, err := h.inferenceService.ListTokenMetrics(r.Context(), filter)
+	if err != nil {
+		log.Printf("Error listing LLM token metrics: %v", err)
+		http.Error(w, "查询 token 指标失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(metrics)
+}
+
+// GetLLMMetricsSeries returns token metrics aggregated per process and time bucket
+//
+// @Summary      LLM token metrics time series
+// @Description  Requests, decode tokens, tokens/sec, TTFT and inter-token latency per process, bucketed by request start time
+// @Tags         metrics
+// @Produce      json
+// @Param        machine_id query string true  "Machine ID"
+// @Param        pids       query string false "Comma separated pid list"
+// @Param        start      query string true  "Start time (RFC3339 or unix ns)"
+// @Param        end        query string true  "End time (RFC3339 or unix ns)"
+// @Param        bucket     query string false "Bucket size (default 1m)"
+// @Router       /api/v1/metrics/llm/series [get]
+// @Security     ApiKeyAuth
+// @Success      200 {array} models.LLMTokenMetricsBucket
+// @Failure      400 {object} string "Invalid query parameters"
+// @Failure      500 {object} string "Failed to query metrics"
+func (h *MetricsHandler) GetLLMMetricsSeries(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseEventFilterWithoutContainer(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	bucket, err := parseDurationParam(r.URL.Query().Get("bucket"), time.Minute)
+	if err != nil || bucket < time.Second {
+		http.Error(w, "无效的 bucket 参数 (至少 1s)", http.StatusBadRequest)
+		return
+	}
+	series, err := h.inferenceService.TokenMetricsSeries(r.Context(), filter, bucket)
+	if err != nil {
+		log.Printf("Error querying LLM token metrics series: %v", err)
+		http.Error(w, "查询 token 指标失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(series)
+}
+
+// GetCudaKernelProfile returns the CUDA kernel hot-spot profile of a time window
+//
+// @Summary      CUDA kernel profile
+// @Description  Per process and kernel cudaLaunchKernel counts, share of launches, launch rate and backing library, optionally with a launch-count timeline
+// @Tags         analysis
+// @Produce      json
+// @Param        machine_id   query string true  "Machine ID"
+// @Param        pids         query string false "Comma separated pid list"
+// @Param        start        query string true  "Start time (RFC3339 or unix ns)"
+// @Param        end          query string true  "End time (RFC3339 or unix ns)"
+// @Param        container_id query string false "Comma separated container ids (full or short prefix)"
+// @Param        cgroup       query string false "Cgroup path prefix"
+// @Param        pod_uid      query string false "Kubernetes pod UID"
+// @Param        bucket       query string false "Timeline bucket size, e.g. 10s (no timeline if omitted)"
+// @Router       /api/v1/analysis/cuda/kernels [get]
+// @Security     ApiKeyAuth
+// @Success      200 {object} KernelProfile
+// @Failure      400 {object} string "Invalid query parameters"
+// @Failure      500 {object} string "Failed to build profile"
+func (h *KernelHandler) GetCudaKernelProfile(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseEventFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	bucket, err := parseDurationParam(r.URL.Query().Get("bucket"), 0)
+	if err != nil || (bucket > 0 && bucket < time.Millisecond) {
+		http.Error(w, "无效的 bucket 参数", http.StatusBadRequest)
+		return
+	}
+	profile, err := h.kernelService.Profile(r.Context(), filter, bucket)
+	if err != nil {
+		log.Printf("Error building CUDA kernel profile: %v", err)
+		http.Error(w, "生成 kernel 热点失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(profile)
+}
+
+// DiffCudaKernelProfiles compares the CUDA kernel mix of two time windows
+//
+// @Summary      Diff CUDA kernel profiles
+// @Description  Compares per-kernel launch share and rate between a base window and a target window (e.g. before and after an Ollama upgrade)
+// @Tags         analysis
+// @Produce      json
+// @Param        machine_id query string true  "Machine ID"
+// @Param        pids       query string false "Comma separated pid list, applied to both windows"
+// @Param        base_start query string true  "Base window start (RFC3339 or unix ns)"
+// @Param        base_end   query string true  "Base window end (RFC3339 or unix ns)"
+// @Param        start      query string true  "Target window start (RFC3339 or unix ns)"
+// @Param        end        query string true  "Target window end (RFC3339 or unix ns)"
+// @Router       /api/v1/analysis/cuda/kernels/diff [get]
+// @Security     ApiKeyAuth
+// @Success      200 {object} KernelDiff
+// @Failure      400 {object} string "Invalid query parameters"
+// @Failure      500 {object} string "Failed to diff profiles"
+func (h *KernelHandler) DiffCudaKernelProfiles(w http.ResponseWriter, r *http.Request) {
+	target, err := parseEventFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	if q.Get("base_start") == "" || q.Get("base_end") == "" {
+		http.Error(w, "缺少 base_start 或 base_end 参数", http.StatusBadRequest)
+		return
+	}
+	base := target
+	if base.Start, err = parseTimeParam(q.Get("base_start")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if base.End, err = parseTimeParam(q.Get("base_end")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !base.End.After(base.Start) || base.End.Sub(base.Start) > maxQueryRange {
+		http.Error(w, fmt.Sprintf("base 窗口无效或超过 %s", maxQueryRange), http.StatusBadRequest)
+		return
+	}
+
+	diff, err := h.kernelService.Diff(r.Context(), base, target)
+	if err != nil {
+		log.Printf("Error diffing CUDA kernel profiles: %v", err)
+		http.Error(w, "比较 kernel 热点失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(diff)
+}
+
+// AnalyzeCudaMemcpy reports host/device transfer bandwidth
+//
+// @Summary      Analyze cudaMemcpy bandwidth
+// @Description  Per process and direction transfer counts, bytes, effective bandwidth and small high-frequency transfer detection, plus a bytes/sec timeline per process
+// @Tags         analysis
+// @Produce      json
+// @Param        machine_id   query string true  "Machine ID"
+// @Param        pids         query string false "Comma separated pid list"
+// @Param        start        query string true  "Start time (RFC3339 or unix ns)"
+// @Param        end          query string true  "End time (RFC3339 or unix ns)"
+// @Param        container_id query string false "Comma separated container ids (full or short prefix)"
+// @Param        cgroup       query string false "Cgroup path prefix"
+// @Param        pod_uid      query string false "Kubernetes pod UID"
+// @Param        bucket       query string false "Timeline bucket size (default 1s)"
+// @Param        small_bytes  query int    false "Transfers smaller than this are small (default 65536)"
+// @Param        storm_rate   query number false "Flag small transfers at or above this rate per second (default 100)"
+// @Router       /api/v1/analysis/cuda/memcpy [get]
+// @Security     ApiKeyAuth
+// @Success      200 {object} MemcpyReport
+// @Failure      400 {object} string "Invalid query parameters"
+// @Failure      422 {object} string "Too many events in the window; narrow the time range or filters"
+// @Failure      500 {object} string "Failed to analyze"
+func (h *MemcpyHandler) AnalyzeCudaMemcpy(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseEventFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	opts := MemcpyOptions{SmallTransferBytes: 64 * 1024, StormRatePerSec: 100}
+	if opts.Bucket, err = parseDurationParam(q.Get("bucket"), time.Second); err != nil || opts.Bucket < time.Millisecond {
+		http.Error(w, "无效的 bucket 参数", http.StatusBadRequest)
+		return
+	}
+	if v := q.Get("small_bytes"); v != "" {
+		if opts.SmallTransferBytes, err = strconv.ParseInt(v, 10, 64); err != nil || opts.SmallTransferBytes < 0 {
+			http.Error(w, "无效的 small_bytes 参数", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("storm_rate"); v != "" {
+		if opts.StormRatePerSec, err = strconv.ParseFloat(v, 64); err != nil || opts.StormRatePerSec < 0 {
+			http.Error(w, "无效的 storm_rate 参数", http.StatusBadRequest)
+			return
+		}
+	}
+
+	report, err := h.memcpyService.Analyze(r.Context(), filter, opts)
+	if err != nil {
+		if tooManyEvents(w, err) {
+			return
+		}
+		log.Printf("Error analyzing cudaMemcpy: %v", err)
+		http.Error(w, "分析 cudaMemcpy 失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(report)
+}
+
+// GetProcessAncestry returns the ancestry of a process
+//
+// @Summary      Process ancestry
+// @Description  Walks the execv parent chain of a pid as it existed at the given time, e.g. to find which shell spawned a CUDA process. The first element is the process itself
+// @Tags         analysis
+// @Produce      json
+// @Param        machine_id query string true  "Machine ID"
+// @Param        pid        query int    true  "Process ID"
+// @Param        at         query string false "Point in time (RFC3339 or unix ns, default now)"
+// @Router       /api/v1/analysis/processes/ancestry [get]
+// @Security     ApiKeyAuth
+// @Success      200 {array} ProcessNode
+// @Failure      400 {object} string "Invalid query parameters"
+// @Failure      404 {object} string "Process not found"
+func (h *ProcessTreeHandler) GetProcessAncestry(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	pids, err := parsePIDsParam(q.Get("pid"))
+	if q.Get("machine_id") == "" || err != nil || len(pids) != 1 {
+		http.Error(w, "缺少或无效的 machine_id / pid 参数", http.StatusBadRequest)
+		return
+	}
+	at := time.Now().UTC()
+	if q.Get("at") != "" {
+		if at, err = parseTimeParam(q.Get("at")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	chain := h.tree.Ancestry(q.Get("machine_id"), pids[0], at)
+	if len(chain) == 0 {
+		http.Error(w, "未找到该进程", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(chain)
+}
+
+// GetProcessDescendants returns the processes spawned by a pid within a time range
+//
+// @Summary      Process descendants
+// @Description  Returns the subtree of processes started by the pid (directly or transitively) within [start, end)
+// @Tags         analysis
+// @Produce      json
+// @Param        machine_id query string true "Machine ID"
+// @Param        pids       query string true "Process ID"
+// @Param        start      query string true "Start time (RFC3339 or unix ns)"
+// @Param        end        query string true "End time (RFC3339 or unix ns)"
+// @Router       /api/v1/analysis/processes/descendants [get]
+// @Security     ApiKeyAuth
+// @Success      200 {object} ProcessTreeNode
+// @Failure      400 {object} string "Invalid query parameters"
+// @Failure      404 {object} string "Process not found"
+func (h *ProcessTreeHandler) GetProcessDescendants(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseEventFilterWithoutContainer(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(filter.PIDs) != 1 {
+		http.Error(w, "pids 参数必须且只能包含一个 pid", http.StatusBadRequest)
+		return
+	}
+
+	tree := h.tree.Descendants(filter.MachineID, filter.PIDs[0], filter.Start, filter.End)
+	if tree == nil {
+		http.Error(w, "未找到该进程", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tree)
+}
+
+// GetSchedReport reports CPU scheduling per process and per CPU
+//
+// @Summary      CPU scheduling analysis
+// @Description  Pairs sched switch_in/switch_out events into on-CPU intervals and reports per-process CPU time and migrations, per-CPU utilization, and processes whose cudaDeviceSynchronize waits were descheduled. With pids, CPU utilization only covers those processes
+// @Tags         analysis
+// @Produce      json
+// @Param        machine_id   query string true  "Machine ID"
+// @Param        pids         query string false "Comma separated pid list"
+// @Param        start        query string true  "Start time (RFC3339 or unix ns)"
+// @Param        end          query string true  "End time (RFC3339 or unix ns)"
+// @Param        container_id query string false "Comma separated container ids (full or short prefix)"
+// @Param        cgroup       query string false "Cgroup path prefix"
+// @Param        pod_uid      query string false "Kubernetes pod UID"
+// @Router       /api/v1/analysis/sched [get]
+// @Security     ApiKeyAuth
+// @Success      200 {object} SchedReport
+// @Failure      400 {object} string "Invalid query parameters"
+// @Failure      422 {object} string "Too many events in the window; narrow the time range or filters"
+// @Failure      500 {object} string "Failed to analyze"
+func (h *SchedHandler) GetSchedReport(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseEventFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.schedService.Analyze(r.Context(), filter)
+	if err != nil {
+		if tooManyEvents(w, err) {
+			return
+		}
+		log.Printf("Error analyzing sched events: %v", err)
+		http.Error(w, "分析调度事件失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(report)
+}
+
+// GetSchedTimeline returns the on-CPU intervals of a process
+//
+// @Summary      Process scheduling timeline
+// @Description  On-CPU intervals of every thread of the process and the scheduling state of each cudaDeviceSynchronize wait
+// @Tags         analysis
+// @Produce      json
+// @Param        machine_id   query string true  "Machine ID"
+// @Param        pids         query string true  "Process ID"
+// @Param        start        query string true  "Start time (RFC3339 or unix ns)"
+// @Param        end          query string true  "End time (RFC3339 or unix ns)"
+// @Param        container_id query string false "Comma separated container ids (full or short prefix)"
+// @Param        cgroup       query string false "Cgroup path prefix"
+// @Param        pod_uid      query string false "Kubernetes pod UID"
+// @Router       /api/v1/analysis/sched/timeline [get]
+// @Security     ApiKeyAuth
+// @Success      200 {object} SchedTimeline
+// @Failure      400 {object} string "Invalid query parameters"
+// @Failure      404 {object} string "No sched events for the process"
+// @Failure      422 {object} string "Too many events in the window; narrow the time range or filters"
+// @Failure      500 {object} string "Failed to query"
+func (h *SchedHandler) GetSchedTimeline(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseEventFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(filter.PIDs) != 1 {
+		http.Error(w, "pids 参数必须且只能包含一个 pid", http.StatusBadRequest)
+		return
+	}
+
+	timeline, err := h.schedService.Timeline(r.Context(), filter, filter.PIDs[0])
+	if err != nil {
+		if tooManyEvents(w, err) {
+			return
+		}
+		log.Printf("Error building sched timeline: %v", err)
+		http.Error(w, "查询调度时间线失败", http.StatusInternalServerError)
+		return
+	}
+	if timeline == nil {
+		http.Error(w, "该进程在时间范围内没有调度事件", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(timeline)
+}
+
+// GetSyscallProfile reports the syscall mix of each process
+//
+// @Summary      Syscall profile
+// @Description  Syscall counts per process and syscall from the agent's per-interval rollups, optionally with a count timeline
+// @Tags         analysis
+// @Produce      json
+// @Param        machine_id   query string true  "Machine ID"
+// @Param        pids         query string false "Comma separated pid list"
+// @Param        start        query string true  "Start time (RFC3339 or unix ns)"
+// @Param        end          query string true  "End time (RFC3339 or unix ns)"
+// @Param        container_id query string false "Comma separated container ids (full or short prefix)"
+// @Param        cgroup       query string false "Cgroup path prefix"
+// @Param        pod_uid      query string false "Kubernetes pod UID"
+// @Param        bucket       query string false "Timeline bucket size, e.g. 1m (no timeline if omitted)"
+// @Router       /api/v1/analysis/syscalls [get]
+// @Security     ApiKeyAuth
+// @Success      200 {object} SyscallProfile
+// @Failure      400 {object} string "Invalid query parameters"
+// @Failure      500 {object} string "Failed to analyze"
+func (h *SyscallHandler) GetSyscallProfile(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseEventFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	bucket, err := parseDurationParam(r.URL.Query().Get("bucket"), 0)
+	if err != nil || (bucket > 0 && bucket < time.Second) {
+		http.Error(w, "无效的 bucket 参数", http.StatusBadRequest)
+		return
+	}
+
+	profile, err := h.syscallService.Profile(r.Context(), filter, bucket)
+	if err != nil {
+		log.Printf("Error building syscall profile: %v", err)
+		http.Error(w, "统计系统调用失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(profile)
+}
+
+// GetSyscallAnomalies flags processes whose syscall mix deviates from their history
+//
+// @Summary      Syscall mix anomalies
+// @Description  Compares each process's syscall distribution in [start, end) with processes of the same name in [start - baseline, start) and flags those whose total variation distance reaches the threshold
+// @Tags         analysis
+// @Produce      json
+// @Param        machine_id   query string true  "Machine ID"
+// @Param        pids         query string false "Comma separated pid list"
+// @Param        start        query string true  "Start time (RFC3339 or unix ns)"
+// @Param        end          query string true  "End time (RFC3339 or unix ns)"
+// @Param        container_id query string false "Comma separated container ids (full or short prefix)"
+// @Param        cgroup       query string false "Cgroup path prefix"
+// @Param        pod_uid      query string false "Kubernetes pod UID"
+// @Param        baseline     query string false "Baseline window length before start (default 24h, at most 720h)"
+// @Param        threshold    query number false "Distance in [0, 1] at which a process is flagged (default 0.3)"
+// @Param        min_calls    query int    false "Skip processes with fewer calls in either window (default 100)"
+// @Router       /api/v1/analysis/syscalls/anomalies [get]
+// @Security     ApiKeyAuth
+// @Success      200 {object} SyscallAnomalyReport
+// @Failure      400 {object} string "Invalid query parameters"
+// @Failure      500 {object} string "Failed to analyze"
+func (h *SyscallHandler) GetSyscallAnomalies(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseEventFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	opts := SyscallAnomalyOptions{Threshold: 0.3, MinCalls: 100}
+	if opts.Baseline, err = parseDurationParam(q.Get("baseline"), 24*time.Hour); err != nil || opts.Baseline <= 0 || opts.Baseline > 30*24*time.Hour {
+		http.Error(w, "无效的 baseline 参数", http.StatusBadRequest)
+		return
+	}
+	if v := q.Get("threshold"); v != "" {
+		if opts.Threshold, err = strconv.ParseFloat(v, 64); err != nil || opts.Threshold < 0 || opts.Threshold > 1 {
+			http.Error(w, "无效的 threshold 参数", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("min_calls"); v != "" {
+		if opts.MinCalls, err = strconv.ParseInt(v, 10, 64); err != nil || opts.MinCalls < 0 {
+			http.Error(w, "无效的 min_calls 参数", http.StatusBadRequest)
+			return
+		}
+	}
+
+	report, err := h.syscallService.Anomalies(r.Context(), filter, opts)
+	if err != nil {
+		log.Printf("Error detecting syscall anomalies: %v", err)
+		http.Error(w, "检测系统调用异常失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(report)
+}
+
+// GetFileAccess reports which files were opened and by whom
+//
+// @Summary      File access analytics
+// @Description  Top opened paths, per process top paths with first/last open time, and model file loads (.gguf, ~/.ollama/models/blobs, ...) from vfs_open events
+// @Tags         analysis
+// @Produce      json
+// @Param        machine_id   query string true  "Machine ID"
+// @Param        pids         query string false "Comma separated pid list"
+// @Param        start        query string true  "Start time (RFC3339 or unix ns)"
+// @Param        end          query string true  "End time (RFC3339 or unix ns)"
+// @Param        container_id query string false "Comma separated container ids (full or short prefix)"
+// @Param        cgroup       query string false "Cgroup path prefix"
+// @Param        pod_uid      query string false "Kubernetes pod UID"
+// @Param        prefix       query string false "Only paths starting with this prefix"
+// @Param        glob         query string false "Only paths matching this glob (* and ? do not match '/', ** does)"
+// @Param        models_only  query bool   false "Only model files"
+// @Param        top          query int    false "Max files and per process paths returned (default 20, at most 1000)"
+// @Router       /api/v1/analysis/files [get]
+// @Security     ApiKeyAuth
+// @Success      200 {object} FileAccessReport
+// @Failure      400 {object} string "Invalid query parameters"
+// @Failure      500 {object} string "Failed to analyze"
+func (h *FileHandler) GetFileAccess(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseEventFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	opts := FileAccessOptions{Prefix: q.Get("prefix"), Glob: q.Get("glob"), Top: 20}
+	if opts.Glob != "" {
+		if _, err := globToRegex(opts.Glob); err != nil {
+			http.Error(w, "无效的 glob 参数", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("models_only"); v != "" {
+		if opts.ModelsOnly, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "无效的 models_only 参数", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("top"); v != "" {
+		if opts.Top, err = strconv.Atoi(v); err != nil || opts.Top <= 0 || opts.Top > 1000 {
+			http.Error(w, "无效的 top 参数", http.StatusBadRequest)
+			return
+		}
+	}
+
+	report, err := h.fileService.Analyze(r.Context(), filter, opts)
+	if err != nil {
+		log.Printf("Error analyzing file access: %v", err)
+		http.Error(w, "分析文件访问失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(report)
+}
+
+// GetFileOpeners lists the processes that opened a file
+//
+// @Summary      File openers
+// @Description  Processes that opened the exact path in the window, with open counts and first/last open time, ordered by first open
+// @Tags         analysis
+// @Produce      json
+// @Param        machine_id   query string true  "Machine ID"
+// @Param        pids         query string false "Comma separated pid list"
+// @Param        start        query string true  "Start time (RFC3339 or unix ns)"
+// @Param        end          query string true  "End time (RFC3339 or unix ns)"
+// @Param        container_id query string false "Comma separated container ids (full or short prefix)"
+// @Param        cgroup       query string false "Cgroup path prefix"
+// @Param        pod_uid      query string false "Kubernetes pod UID"
+// @Param        path         query string true  "Absolute file path"
+// @Router       /api/v1/analysis/files/openers [get]
+// @Security     ApiKeyAuth
+// @Success      200 {object} FileOpenersReport
+// @Failure      400 {object} string "Invalid query parameters"
+// @Failure      500 {object} string "Failed to analyze"
+func (h *FileHandler) GetFileOpeners(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseEventFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		http.Error(w, "缺少 path 参数", http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.fileService.Openers(r.Context(), filter, path)
+	if err != nil {
+		log.Printf("Error listing file openers: %v", err)
+		http.Error(w, "查询文件访问失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(report)
+}
+
+// maxSymbolUploadBytes 限制上传的调试文件大小，CUDA 库的分离调试信息可达数百 MiB
+const maxSymbolUploadBytes = 4 << 30
+
+// UploadSymbolFile stores a debug file in the symbol store
+//
+// @Summary      Upload symbol file
+// @Description  Stores an ELF file (separate .debug file or unstripped binary) under its GNU build-id, used to symbolize kernels at query time
+// @Tags         symbols
+// @Accept       application/octet-stream
+// @Produce      json
+// @Param        file body string true "ELF file content"
+// @Router       /api/v1/symbols [post]
+// @Security     ApiKeyAuth
+// @Success      200 {object} SymbolFile
+// @Failure      400 {object} string "Not an ELF file with a GNU build-id"
+// @Failure      413 {object} string "File too large"
+func (h *SymbolHandler) UploadSymbolFile(w http.ResponseWriter, r *http.Request) {
+	body := http.MaxBytesReader(w, r.Body, maxSymbolUploadBytes)
+	file, err := h.store.Upload(body)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			http.Error(w, "上传的文件过大", http.StatusRequestEntityTooLarge)
+			return
+		}
+		log.Printf("Error uploading symbol file: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(file)
+}
+
+// ListSymbolFiles lists the files uploaded to the symbol store
+//
+// @Summary      List symbol files
+// @Description  Files uploaded to the symbol store, ordered by build-id (read-only debuginfod directories are not listed)
+// @Tags         symbols
+// @Produce      json
+// @Router       /api/v1/symbols [get]
+// @Security     ApiKeyAuth
+// @Success      200 {array} SymbolFile
+// @Failure      500 {object} string "Failed to list"
+func (h *SymbolHandler) ListSymbolFiles(w http.ResponseWriter, r *http.Request) {
+	files, err := h.store.List()
+	if err != nil {
+		log.Printf("Error listing symbol files: %v", err)
+		http.Error(w, "读取符号仓库失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(files)
+}
+
+// LookupSymbol symbolizes an address of a module identified by build-id
+//
+// @Summary      Look up symbol
+// @Description  Resolves the function name, source location and inline chain of an ELF virtual address, as recorded in cuda_symbol_build_id / cuda_symbol_addr
+// @Tags         symbols
+// @Produce      json
+// @Param        build_id query string true "GNU build-id (hex)"
+// @Param        addr     query string true "ELF virtual address (hex with 0x prefix or decimal)"
+// @Router       /api/v1/symbols/lookup [get]
+// @Security     ApiKeyAuth
+// @Success      200 {object} platform.SymbolInfo
+// @Failure      400 {object} string "Invalid query parameters"
+// @Failure      404 {object} string "Symbol file not found"
+// @Failure      500 {object} string "Failed to load symbol file"
+func (h *SymbolHandler) LookupSymbol(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	buildID := strings.ToLower(q.Get("build_id"))
+	if !validBuildID(buildID) {
+		http.Error(w, "无效的 build_id 参数", http.StatusBadRequest)
+		return
+	}
+	addr, err := strconv.ParseUint(q.Get("addr"), 0, 64)
+	if err != nil {
+		http.Error(w, "无效的 addr 参数", http.StatusBadRequest)
+		return
+	}
+	info, err := h.store.Lookup(buildID, addr)
+	if errors.Is(err, ErrSymbolFileNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error looking up symbol: %v", err)
+		http.Error(w, "加载符号文件失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(info)
+}
+
+// GetFlameGraph returns the user stack flame graph of an operation
+//
+// @Summary      Stack flame graph
+// @Description  Aggregates the user stacks captured by the probes (started with -s) for cudaMalloc, cudaLaunchKernel or ggml_aligned_malloc into a flame graph, one subtree per process. format=folded returns flamegraph.pl / speedscope folded lines instead of JSON
+// @Tags         analysis
+// @Produce      json
+// @Produce      plain
+// @Param        machine_id   query string true  "Machine ID"
+// @Param        pids         query string false "Comma separated pid list"
+// @Param        start        query string true  "Start time (RFC3339 or unix ns)"
+// @Param        end          query string true  "End time (RFC3339 or unix ns)"
+// @Param        container_id query string false "Comma separated container ids (full or short prefix)"
+// @Param        cgroup       query string false "Cgroup path prefix"
+// @Param        pod_uid      query string false "Kubernetes pod UID"
+// @Param        operation    query string true  "cudaMalloc, cudaLaunchKernel or ggml_aligned_malloc"
+// @Param        weight       query string false "count (default) or bytes (allocations only)"
+// @Param        format       query string false "json (default) or folded"
+// @Router       /api/v1/analysis/flamegraph [get]
+// @Security     ApiKeyAuth
+// @Success      200 {object} FlameGraph
+// @Failure      400 {object} string "Invalid query parameters"
+// @Failure      500 {object} string "Failed to build flame graph"
+func (h *FlameGraphHandler) GetFlameGraph(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseEventFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	operation := q.Get("operation")
+	if !postgres.IsStackOperation(operation) {
+		http.Error(w, "无效的 operation 参数 (cudaMalloc, cudaLaunchKernel 或 ggml_aligned_malloc)", http.StatusBadRequest)
+		return
+	}
+	weight := q.Get("weight")
+	switch weight {
+	case "":
+		weight = FlameGraphWeightCount
+	case FlameGraphWeightCount:
+	case FlameGraphWeightBytes:
+		if operation == models.CudaLaunchKernelTopic {
+			http.Error(w, "cudaLaunchKernel 没有分配字节数，不能按 bytes 统计", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "无效的 weight 参数 (count 或 bytes)", http.StatusBadRequest)
+		return
+	}
+
+	switch q.Get("format") {
+	case "", "json":
+		graph, err := h.flameGraphService.Build(r.Context(), filter, operation, weight)
+		if err != nil {
+			log.Printf("Error building flame graph: %v", err)
+			http.Error(w, "生成火焰图失败", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(graph)
+	case "folded":
+		folded, err := h.flameGraphService.Folded(r.Context(), filter, operation, weight)
+		if err != nil {
+			log.Printf("Error folding stacks: %v", err)
+			http.Error(w, "生成火焰图失败", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		for _, f := range folded {
+			fmt.Fprintf(w, "%s %d\n", f.Stack, f.Value)
+		}
+	default:
+		http.Error(w, "无效的 format 参数 (json 或 folded)", http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,40 @@
+package backend
+
+import (
+	"context"
+	"time"
+
+	"scope/internal/models"
+)
+
+// 节点状态
+const (
+	NodeStatusOnline  = "online"
+	NodeStatusOffline = "offline"
+)
+
+// deriveNodeStatus 根据最近一次心跳 (或轮询成功) 的时间判断节点状态：超过 grace 没有消息即视为离线，
+// 节点主动下线 (NodeDown) 之后保持离线直到下一次心跳
+func deriveNodeStatus(node models.NodeInfo, now time.Time, grace time.Duration) string {
+	if node.Status == NodeStatusOffline || now.Sub(node.LastSeen) > grace {
+		return NodeStatusOffline
+	}
+	return NodeStatusOnline
+}
+
+// RecordHeartbeat 保存节点的心跳并刷新最后在线时间，调用前已经用 VerifyNodeRequest 校验了签名。
+// 心跳附带的主机清单单独保存在 node.Inventory 中，没有附带时沿用之前的清单。
+func (s *NodeService) RecordHeartbeat(ctx context.Context, nodeID string, hb models.NodeHeartbeat) error {
+	node, err := s.nodeStore.GetNode(ctx, nodeID)
+	if err != nil {
+		return err
+	}
+	node.LastSeen = time.Now()
+	node.Status = NodeStatusOnline
+	if hb.Inventory != nil {
+		node.Inventory = hb.Inventory
+		hb.Inventory = nil
+	}
+	node.Heartbeat = &hb
+	return s.nodeStore.UpdateNode(ctx, node)
+}
@@ -0,0 +1,29 @@
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"scope/internal/models"
+)
+
+func TestDeriveNodeStatus(t *testing.T) {
+	now := time.Now()
+	grace := 30 * time.Second
+	tests := []struct {
+		name string
+		node models.NodeInfo
+		want string
+	}{
+		{"recent heartbeat", models.NodeInfo{Status: NodeStatusOnline, LastSeen: now.Add(-10 * time.Second)}, NodeStatusOnline},
+		{"within grace", models.NodeInfo{Status: NodeStatusOnline, LastSeen: now.Add(-grace)}, NodeStatusOnline},
+		{"missed heartbeats", models.NodeInfo{Status: NodeStatusOnline, LastSeen: now.Add(-grace - time.Second)}, NodeStatusOffline},
+		{"went down", models.NodeInfo{Status: NodeStatusOffline, LastSeen: now}, NodeStatusOffline},
+		{"never seen", models.NodeInfo{Status: NodeStatusOnline}, NodeStatusOffline},
+	}
+	for _, tt := range tests {
+		if got := deriveNodeStatus(tt.node, now, grace); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,409 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"scope/database/postgres"
+	"scope/internal/models"
+)
+
+// defaultInferenceIdleGap 两次 ggml_graph_compute 之间超过该间隔即认为是两个不同的推理请求
+const defaultInferenceIdleGap = 2 * time.Second
+
+// inferenceMaxBuildWindow 是周期重建时从上次的起点继续读取的最长时间，
+// 持续更久仍未结束的会话放弃等待，从最近 lookback 重新开始
+const inferenceMaxBuildWindow = 24 * time.Hour
+
+// inferenceMarkerRegex 匹配 llama.cpp / ollama 在请求开始或结束时打印的日志
+var inferenceMarkerRegex = regexp.MustCompile(`(?i)(launch_slot|new prompt|processing task|print_timings|prompt eval time|slot released|/api/(generate|chat|embed))`)
+
+// InferenceService 从 llamaLog、ggml 和 CUDA 事件重建推理会话
+type InferenceService struct {
+	eventStore    *postgres.EventStore
+	analysisStore *postgres.AnalysisStore
+
+	buildMu      sync.Mutex
+	buildCursors map[string]time.Time // 机器 ID -> 下一次周期重建的起点，该时间点上没有跨越的会话
+}
+
+// loadEvents 读取会话重建所需的 llamaLog、ggml 和 CUDA 事件。
+// 任何一张表超过单次查询上限时返回 postgres.ErrTooManyEvents，此时三张表的事件都截断到 cut (不含) 之前
+func (s *InferenceService) loadEvents(ctx context.Context, filter postgres.EventFilter) (logs []models.AppLogEvent, ggml []models.GGMLEvent, cuda []models.CudaEvent, cut time.Time, err error) {
+	truncated := false
+	// 被截断的表中最后一个时间戳之后的事件没有读到，cut 取其中最早的
+	clip := func(err error, last time.Time) error {
+		if !errors.Is(err, postgres.ErrTooManyEvents) {
+			return err
+		}
+		if !truncated || last.Before(cut) {
+			cut = last
+		}
+		truncated = true
+		return nil
+	}
+
+	logs, err = s.eventStore.ListAppLogEvents(ctx, filter)
+	if len(logs) > 0 {
+		err = clip(err, logs[len(logs)-1].Ts)
+	}
+	if err != nil {
+		return nil, nil, nil, time.Time{}, err
+	}
+
+	ggmlFilter := filter
+	ggmlFilter.Subtypes = []string{models.GGMLCpuTopic, models.GGMLCudaTopic}
+	ggml, err = s.eventStore.ListGGMLEvents(ctx, ggmlFilter)
+	if len(ggml) > 0 {
+		err = clip(err, ggml[len(ggml)-1].Ts)
+	}
+	if err != nil {
+		return nil, nil, nil, time.Time{}, err
+	}
+
+	cudaFilter := filter
+	cudaFilter.Subtypes = []string{models.CudaMemcpyTopic, models.CudaSyncTopic}
+	cuda, err = s.eventStore.ListCudaEvents(ctx, cudaFilter)
+	if len(cuda) > 0 {
+		err = clip(err, cuda[len(cuda)-1].Ts)
+	}
+	if err != nil {
+		return nil, nil, nil, time.Time{}, err
+	}
+
+	if !truncated {
+		return logs, ggml, cuda, time.Time{}, nil
+	}
+	logs = eventsBefore(logs, cut, func(e models.AppLogEvent) time.Time { return e.Ts })
+	ggml = eventsBefore(ggml, cut, func(e models.GGMLEvent) time.Time { return e.Ts })
+	cuda = eventsBefore(cuda, cut, func(e models.CudaEvent) time.Time { return e.Ts })
+	return logs, ggml, cuda, cut, postgres.ErrTooManyEvents
+}
+
+// Reconstruct 重建窗口内的推理会话，persist 为 true 时同时把会话和 token 指标写入数据库
+func (s *InferenceService) Reconstruct(ctx context.Context, filter postgres.EventFilter, idleGap time.Duration, persist bool) ([]models.InferenceSession, error) {
+	logs, ggml, cuda, _, err := s.loadEvents(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := reconstructInferenceSessions(filter.MachineID, logs, ggml, cuda, idleGap)
+	if persist {
+		if err := s.analysisStore.UpsertInferenceSessions(ctx, sessions); err != nil {
+			return nil, err
+		}
+		if err := s.analysisStore.UpsertLLMTokenMetrics(ctx, deriveLLMTokenMetrics(filter.MachineID, logs, ggml, idleGap)); err != nil {
+			return nil, err
+		}
+	}
+	return sessions, nil
+}
+
+// ListSessions 查询已写入 inference_sessions 的会话
+func (s *InferenceService) ListSessions(ctx context.Context, filter postgres.EventFilter) ([]models.InferenceSession, error) {
+	return s.analysisStore.ListInferenceSessions(ctx, filter)
+}
+
+// RunSessionBuild 对所有有 ggml 事件的机器重建会话和 token 指标，只写入已经结束的会话。
+// 每台机器从上次运行留下的起点 (最早的未结束会话的开始) 继续读取，因此持续时间超过 lookback 的会话
+// 也会在结束后被完整写入；第一次运行或起点早于 inferenceMaxBuildWindow 时读取最近 lookback 时间。
+func (s *InferenceService) RunSessionBuild(ctx context.Context, lookback, idleGap time.Duration) error {
+	s.buildMu.Lock()
+	defer s.buildMu.Unlock()
+	if s.buildCursors == nil {
+		s.buildCursors = make(map[string]time.Time)
+	}
+
+	now := time.Now().UTC()
+	machineIDs, err := s.analysisStore.ListMachineIDs(ctx, "events_ggml", postgres.EventFilter{Start: now.Add(-lookback), End: now})
+	if err != nil {
+		return err
+	}
+	for machineID := range s.buildCursors {
+		if !containsString(machineIDs, machineID) {
+			machineIDs = append(machineIDs, machineID)
+		}
+	}
+
+	for _, machineID := range machineIDs {
+		// 事件超过单次查询上限时按时间分页，直到读完 now 之前的事件
+		for {
+			truncated, err := s.buildSessions(ctx, machineID, now, lookback, idleGap)
+			if err != nil {
+				return err
+			}
+			if !truncated {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// buildSessions 从机器的起点读取一页事件，写入已结束的会话和 token 指标并更新起点。
+// 事件超过单次查询上限时只处理到截断处，返回 truncated 为 true，调用方从新的起点继续读取下一页
+func (s *InferenceService) buildSessions(ctx context.Context, machineID string, now time.Time, lookback, idleGap time.Duration) (truncated bool, err error) {
+	filter := postgres.EventFilter{MachineID: machineID, Start: now.Add(-lookback), End: now}
+	cursor, bounded := s.buildCursors[machineID]
+	if bounded && now.Sub(cursor) <= inferenceMaxBuildWindow {
+		filter.Start = cursor
+	} else {
+		bounded = false
+	}
+	logs, ggml, cuda, cut, err := s.loadEvents(ctx, filter)
+	if errors.Is(err, postgres.ErrTooManyEvents) {
+		if !cut.After(filter.Start) {
+			return false, fmt.Errorf("机器 %s 在 %v 的推理事件超过单次查询上限: %w", machineID, filter.Start, err)
+		}
+		truncated = true
+		filter.End = cut
+	} else if err != nil {
+		return false, err
+	}
+
+	sessions, next, ok := completeInferenceSessions(reconstructInferenceSessions(machineID, logs, ggml, cuda, idleGap), filter.Start, filter.End, idleGap, bounded)
+	if err := s.analysisStore.UpsertInferenceSessions(ctx, sessions); err != nil {
+		return false, err
+	}
+
+	var metrics []models.LLMTokenMetrics
+	for _, m := range deriveLLMTokenMetrics(machineID, logs, ggml, idleGap) {
+		if inferenceWindowComplete(m.Ts, m.EndTs, filter.Start, filter.End, idleGap, bounded) {
+			metrics = append(metrics, m)
+		}
+	}
+	if err := s.analysisStore.UpsertLLMTokenMetrics(ctx, metrics); err != nil {
+		return false, err
+	}
+
+	if truncated && (!ok || !next.After(filter.Start)) {
+		// 一页之内只有一个未结束的会话，它的事件超过了单次查询上限，无法完整重建，从截断处继续
+		log.Printf("WARN: 机器 %s 从 %v 开始的推理会话事件超过单次查询上限，跳过该会话", machineID, filter.Start)
+		next, ok = cut, true
+	}
+	if !ok || (len(logs) == 0 && len(ggml) == 0 && len(cuda) == 0) {
+		// 没有事件或无法确定起点时不保留起点
+		delete(s.buildCursors, machineID)
+	} else {
+		s.buildCursors[machineID] = next
+	}
+	return truncated, nil
+}
+
+// inferenceWindowComplete 判断 [ts, endTs] 是否已经完整落在窗口 [start, end) 中: 结束时间距窗口结束至少 idleGap
+// (之后不会再有属于它的事件)；bounded 为 false 时开始时间也需距窗口开始至少 idleGap (之前可能有属于它的事件)
+func inferenceWindowComplete(ts, endTs, start, end time.Time, idleGap time.Duration, bounded bool) bool {
+	return end.Sub(endTs) >= idleGap && (bounded || ts.Sub(start) >= idleGap)
+}
+
+// completeInferenceSessions 返回可以写入的已结束会话，以及下一次重建的起点:
+// 最早的未结束会话的开始时间，并向前移到不在任何会话中间的位置；没有未结束的会话时为 end - idleGap。
+// 起点落在被窗口截断的会话上时无法确定会话的真实开始，ok 为 false，下一次仍读取最近 lookback 时间。
+func completeInferenceSessions(sessions []models.InferenceSession, start, end time.Time, idleGap time.Duration, bounded bool) (complete []models.InferenceSession, next time.Time, ok bool) {
+	next = end.Add(-idleGap)
+	for _, session := range sessions {
+		switch {
+		case inferenceWindowComplete(session.Ts, session.EndTs, start, end, idleGap, bounded):
+			complete = append(complete, session)
+		case end.Sub(session.EndTs) < idleGap && session.Ts.Before(next):
+			// 仍在进行的会话
+			next = session.Ts
+		}
+		// 其余是开头被窗口截断的会话，已经在之前的运行中写入或无法完整重建
+	}
+	// 起点不能落在其他会话中间，否则下一次只能看到这些会话的后半段
+	for moved := true; moved; {
+		moved = false
+		for _, session := range sessions {
+			if session.Ts.Before(next) && session.EndTs.After(next) {
+				next = session.Ts
+				moved = true
+			}
+		}
+	}
+	if !bounded && next.Sub(start) < idleGap {
+		return complete, time.Time{}, false
+	}
+	if next.Before(start) {
+		next = start
+	}
+	return complete, next, true
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// inferenceSegment 是同一进程中属于一次推理请求的连续 ggml_graph_compute 事件
+type inferenceSegment struct {
+	start    time.Time // 会话开始时间 (可能被日志标记提前)
+	computes []models.GGMLEvent
+}
+
+// end 返回最后一次计算的返回时间
+func (seg inferenceSegment) end() time.Time {
+	return seg.computes[len(seg.computes)-1].Ts
+}
+
+// inferenceMarkers 按 pid 收集匹配 inferenceMarkerRegex 的 llamaLog 时间
+func inferenceMarkers(logs []models.AppLogEvent) map[int32][]time.Time {
+	markers := make(map[int32][]time.Time)
+	for _, e := range logs {
+		if inferenceMarkerRegex.MatchString(e.LogText) {
+			markers[e.PID] = append(markers[e.PID], e.Ts)
+		}
+	}
+	return markers
+}
+
+// segmentGraphComputes 把一个进程按时间升序排列的 ggml_graph_compute 事件切分为推理请求。
+//
+// ggml_graph_compute 在返回时上报，其执行区间为 [ts - ggml_cost_ns, ts]。相邻两次计算间隔超过
+// idleGap，或中间出现了 llamaLog 请求标记时，开始一个新会话。会话开始前 idleGap 内且在上一个
+// 会话结束之后的标记会把会话开始时间提前到标记处，以覆盖 tokenize 等准备阶段。
+func segmentGraphComputes(markers []time.Time, computes []models.GGMLEvent, idleGap time.Duration) []inferenceSegment {
+	// markerBetween 判断 (from, to] 内是否有请求标记
+	markerBetween := func(from, to time.Time) bool {
+		i := sort.Search(len(markers), func(i int) bool { return markers[i].After(from) })
+		return i < len(markers) && !markers[i].After(to)
+	}
+
+	var segments []inferenceSegment
+	var lastEnd time.Time // 上一个会话的结束时间，新会话不会向前延伸到它之前
+	for _, e := range computes {
+		begin := e.Ts.Add(-time.Duration(e.GGMLCostNs))
+		if n := len(segments); n > 0 {
+			lastEnd = segments[n-1].end()
+			if begin.Sub(lastEnd) <= idleGap && !markerBetween(lastEnd, begin) {
+				segments[n-1].computes = append(segments[n-1].computes, e)
+				continue
+			}
+		}
+
+		start := begin
+		from := begin.Add(-idleGap)
+		if from.Before(lastEnd) {
+			from = lastEnd
+		}
+		i := sort.Search(len(markers), func(i int) bool { return markers[i].After(from) })
+		if i < len(markers) && markers[i].Before(begin) {
+			start = markers[i]
+		}
+		segments = append(segments, inferenceSegment{start: start, computes: []models.GGMLEvent{e}})
+	}
+	return segments
+}
+
+// splitGGMLEvents 按 pid 分出 ggml_graph_compute 与 ggml_cuda 事件
+func splitGGMLEvents(ggml []models.GGMLEvent) (computes, kernels map[int32][]models.GGMLEvent) {
+	computes = make(map[int32][]models.GGMLEvent)
+	kernels = make(map[int32][]models.GGMLEvent)
+	for _, e := range ggml {
+		switch e.EventSubtype {
+		case models.GGMLCpuTopic:
+			computes[e.PID] = append(computes[e.PID], e)
+		case models.GGMLCudaTopic:
+			kernels[e.PID] = append(kernels[e.PID], e)
+		}
+	}
+	return computes, kernels
+}
+
+// reconstructInferenceSessions 按 pid 把进程时间线切分为推理请求 (见 segmentGraphComputes)，
+// 并把会话时间范围内的 ggml_cuda、cudaMemcpy 和 cudaDeviceSynchronize 事件计入该会话。
+// 所有事件需按时间升序排列。
+func reconstructInferenceSessions(machineID string, logs []models.AppLogEvent, ggml []models.GGMLEvent, cuda []models.CudaEvent, idleGap time.Duration) []models.InferenceSession {
+	if idleGap <= 0 {
+		idleGap = defaultInferenceIdleGap
+	}
+
+	markers := inferenceMarkers(logs)
+	computes, kernels := splitGGMLEvents(ggml)
+	cudaByPID := make(map[int32][]models.CudaEvent)
+	for _, e := range cuda {
+		cudaByPID[e.PID] = append(cudaByPID[e.PID], e)
+	}
+
+	var sessions []models.InferenceSession
+	for pid, events := range computes {
+		for _, seg := range segmentGraphComputes(markers[pid], events, idleGap) {
+			first := seg.computes[0]
+			session := models.InferenceSession{
+				Ts:            seg.start,
+				EndTs:         seg.end(),
+				MachineID:     machineID,
+				PID:           pid,
+				Comm:          first.Comm,
+				Cmdline:       first.Cmdline,
+				GraphComputes: int32(len(seg.computes)),
+			}
+			session.DurationNs = session.EndTs.Sub(session.Ts).Nanoseconds()
+			for _, e := range seg.computes {
+				session.CpuGraphNs += e.GGMLCostNs
+			}
+			attributeInferenceSession(&session, markers[pid], kernels[pid], cudaByPID[pid])
+			sessions = append(sessions, session)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].Ts.Equal(sessions[j].Ts) {
+			return sessions[i].Ts.Before(sessions[j].Ts)
+		}
+		return sessions[i].PID < sessions[j].PID
+	})
+	return sessions
+}
+
+// attributeInferenceSession 把 [session.Ts, session.EndTs] 内的 GPU 和 CUDA 事件累加到会话
+func attributeInferenceSession(session *models.InferenceSession, markers []time.Time, kernels []models.GGMLEvent, cuda []models.CudaEvent) {
+	inside := func(ts time.Time) bool { return !ts.Before(session.Ts) && !ts.After(session.EndTs) }
+
+	for i := sort.Search(len(markers), func(i int) bool { return !markers[i].Before(session.Ts) }); i < len(markers) && inside(markers[i]); i++ {
+		session.LogMarkers++
+	}
+	for i := sort.Search(len(kernels), func(i int) bool { return !kernels[i].Ts.Before(session.Ts) }); i < len(kernels) && inside(kernels[i].Ts); i++ {
+		session.GpuMatmulNs += kernels[i].GGMLCudaDurationNs
+		session.GpuMatmulCalls++
+	}
+	for i := sort.Search(len(cuda), func(i int) bool { return !cuda[i].Ts.Before(session.Ts) }); i < len(cuda) && inside(cuda[i].Ts); i++ {
+		switch cuda[i].EventSubtype {
+		case models.CudaMemcpyTopic:
+			session.MemcpyBytes += cuda[i].CudaSize
+			session.MemcpyCount++
+		case models.CudaSyncTopic:
+			session.SyncWaitNs += cuda[i].CudaSyncDurationNs
+			session.SyncCount++
+		}
+	}
+}
+
+// InferenceSessionBuilder 周期性重建推理会话，写入 inference_sessions 和 llm_token_metrics
+func InferenceSessionBuilder(ctx context.Context, wg *sync.WaitGroup, handler *Handler, interval, lookback, idleGap time.Duration) {
+	defer wg.Done()
+	service := handler.inferenceHandler.inferenceService
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := service.RunSessionBuild(ctx, lookback, idleGap); err != nil {
+				log.Printf("Error building inference sessions: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"scope/internal/models"
+)
+
+func TestReconstructInferenceSessions(t *testing.T) {
+	compute := func(d time.Duration, cost time.Duration) models.GGMLEvent {
+		return models.GGMLEvent{Ts: at(d), EventSubtype: models.GGMLCpuTopic, PID: 9, Comm: "llama-server", GGMLCostNs: cost.Nanoseconds()}
+	}
+
+	logs := []models.AppLogEvent{
+		{Ts: at(900 * time.Millisecond), PID: 9, LogText: "slot launch_slot_: id 0 | task 0 | processing task"},
+		{Ts: at(1500 * time.Millisecond), PID: 9, LogText: "unrelated log line"},
+		// 第二个请求紧跟第一个请求，间隔小于 idleGap，只能靠日志标记切分
+		{Ts: at(2200 * time.Millisecond), PID: 9, LogText: "slot launch_slot_: id 0 | task 1 | processing task"},
+	}
+	ggml := []models.GGMLEvent{
+		compute(1100*time.Millisecond, 100*time.Millisecond),
+		{Ts: at(1150 * time.Millisecond), EventSubtype: models.GGMLCudaTopic, PID: 9, GGMLCudaDurationNs: 40},
+		compute(1200*time.Millisecond, 50*time.Millisecond),
+		compute(1300*time.Millisecond, 50*time.Millisecond),
+		compute(2400*time.Millisecond, 100*time.Millisecond),
+		// 之后空闲 10s，开始第三个没有日志标记的请求
+		compute(12500*time.Millisecond, 100*time.Millisecond),
+	}
+	cuda := []models.CudaEvent{
+		{Ts: at(1050 * time.Millisecond), EventSubtype: models.CudaMemcpyTopic, PID: 9, CudaSize: 4096},
+		{Ts: at(1250 * time.Millisecond), EventSubtype: models.CudaSyncTopic, PID: 9, CudaSyncDurationNs: 700},
+		{Ts: at(5 * time.Second), EventSubtype: models.CudaMemcpyTopic, PID: 9, CudaSize: 1},
+	}
+
+	sessions := reconstructInferenceSessions("m1", logs, ggml, cuda, 2*time.Second)
+	if len(sessions) != 3 {
+		t.Fatalf("got %d sessions, want 3: %+v", len(sessions), sessions)
+	}
+
+	first := sessions[0]
+	if !first.Ts.Equal(at(900*time.Millisecond)) || !first.EndTs.Equal(at(1300*time.Millisecond)) {
+		t.Errorf("first session spans [%v, %v], want [900ms, 1300ms]", first.Ts.Sub(testBase), first.EndTs.Sub(testBase))
+	}
+	if first.GraphComputes != 3 || first.CpuGraphNs != (200*time.Millisecond).Nanoseconds() {
+		t.Errorf("first session computes = %d cpu = %d", first.GraphComputes, first.CpuGraphNs)
+	}
+	if first.GpuMatmulNs != 40 || first.GpuMatmulCalls != 1 {
+		t.Errorf("first session gpu = %d ns over %d calls, want 40/1", first.GpuMatmulNs, first.GpuMatmulCalls)
+	}
+	if first.MemcpyBytes != 4096 || first.SyncWaitNs != 700 || first.SyncCount != 1 {
+		t.Errorf("first session memcpy = %d sync = %d/%d", first.MemcpyBytes, first.SyncWaitNs, first.SyncCount)
+	}
+	if first.LogMarkers != 1 {
+		t.Errorf("first session markers = %d, want 1", first.LogMarkers)
+	}
+
+	if !sessions[1].Ts.Equal(at(2200 * time.Millisecond)) {
+		t.Errorf("second session should start at its log marker, got %v", sessions[1].Ts.Sub(testBase))
+	}
+	if sessions[2].LogMarkers != 0 || sessions[2].MemcpyBytes != 0 {
+		t.Errorf("third session should not include earlier events: %+v", sessions[2])
+	}
+}
+
+func TestCompleteInferenceSessionsAcrossRuns(t *testing.T) {
+	lookback, idleGap := 10*time.Minute, 2*time.Second
+	var ggml []models.GGMLEvent
+	compute := func(d time.Duration) {
+		ggml = append(ggml, models.GGMLEvent{Ts: at(d), EventSubtype: models.GGMLCpuTopic, PID: 9, GGMLCostNs: int64(time.Millisecond)})
+	}
+	// 一个短会话，之后是持续 15 分钟、比 lookback 更长的会话
+	for d := time.Duration(0); d <= 5*time.Second; d += time.Second {
+		compute(d)
+	}
+	for d := time.Minute; d <= 16*time.Minute; d += 500 * time.Millisecond {
+		compute(d)
+	}
+
+	// 每分钟运行一次周期重建
+	written := map[time.Time]models.InferenceSession{}
+	var cursor time.Time
+	bounded := false
+	for now := at(30 * time.Second); now.Before(at(20 * time.Minute)); now = now.Add(time.Minute) {
+		start := now.Add(-lookback)
+		if bounded {
+			start = cursor
+		}
+		var window []models.GGMLEvent
+		for _, e := range ggml {
+			if !e.Ts.Before(start) && e.Ts.Before(now) {
+				window = append(window, e)
+			}
+		}
+		sessions, next, ok := completeInferenceSessions(reconstructInferenceSessions("m1", nil, window, nil, idleGap), start, now, idleGap, bounded)
+		for _, s := range sessions {
+			written[s.Ts] = s
+		}
+		cursor, bounded = next, ok
+	}
+
+	if len(written) != 2 {
+		t.Fatalf("got %d sessions, want 2: %+v", len(written), written)
+	}
+	// 会话从第一次图计算开始执行时算起
+	long, ok := written[at(time.Minute-time.Millisecond)]
+	if !ok || !long.EndTs.Equal(at(16*time.Minute)) || long.GraphComputes != 1801 {
+		t.Errorf("the long session should be written once from 1m to 16m, got %+v", written)
+	}
+}
+
+func TestCompleteInferenceSessionsTruncated(t *testing.T) {
+	start, end := testBase, at(10*time.Minute)
+	sessions := []models.InferenceSession{
+		// 在窗口开始前就已开始且仍在进行
+		{Ts: at(100 * time.Millisecond), EndTs: at(10*time.Minute - time.Second)},
+	}
+	if complete, _, ok := completeInferenceSessions(sessions, start, end, 2*time.Second, false); len(complete) != 0 || ok {
+		t.Errorf("a session truncated by the first window must not be written or used as the next start: %+v, %v", complete, ok)
+	}
+	// 有上次留下的起点时，从起点开始的会话是完整的
+	if _, next, ok := completeInferenceSessions(sessions, start, end, 2*time.Second, true); !ok || !next.Equal(sessions[0].Ts) {
+		t.Errorf("next = %v, %v, want the start of the running session", next, ok)
+	}
+}
@@ -0,0 +1,162 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"scope/internal/models"
+)
+
+// NodeInventoryItem 是清单接口返回的一个节点，不包含 token 和心跳
+type NodeInventoryItem struct {
+	ID        string                `json:"id"`
+	Status    string                `json:"status"`
+	Labels    map[string]string     `json:"labels,omitempty"`
+	LastSeen  time.Time             `json:"last_seen"`
+	Inventory *models.NodeInventory `json:"inventory"`
+}
+
+// InventoryFilter 是节点清单的过滤条件，零值的字段不参与过滤。
+// 设置了任何清单相关条件时，尚未上报清单的节点不匹配。
+type InventoryFilter struct {
+	Labels   map[string]string // 标签必须全部相等
+	Status   string            // online 或 offline
+	Kernel   string            // 内核版本前缀，如 "6.8"
+	GPUModel string            // GPU 型号子串，不区分大小写
+	HasGPU   *bool
+	BTF      *bool
+	CUDA     *bool  // 是否找到 CUDA 运行时
+	Binary   string // 推理程序名，如 ollama、llama-server
+	Probe    string // 正在运行的探针名
+}
+
+// ParseInventoryFilter 解析查询参数: label=key=value (可重复)、status、kernel、gpu、has_gpu、btf、cuda、binary、probe
+func ParseInventoryFilter(q url.Values) (InventoryFilter, error) {
+	f := InventoryFilter{
+		Status:   q.Get("status"),
+		Kernel:   q.Get("kernel"),
+		GPUModel: q.Get("gpu"),
+		Binary:   q.Get("binary"),
+		Probe:    q.Get("probe"),
+	}
+	if f.Status != "" && f.Status != NodeStatusOnline && f.Status != NodeStatusOffline {
+		return f, fmt.Errorf("无效的节点状态: %s", f.Status)
+	}
+	for _, label := range q["label"] {
+		key, value, ok := strings.Cut(label, "=")
+		if !ok || key == "" {
+			return f, fmt.Errorf("标签条件必须是 key=value: %s", label)
+		}
+		if f.Labels == nil {
+			f.Labels = make(map[string]string)
+		}
+		f.Labels[key] = value
+	}
+	for name, dst := range map[string]**bool{"has_gpu": &f.HasGPU, "btf": &f.BTF, "cuda": &f.CUDA} {
+		raw := q.Get(name)
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return f, fmt.Errorf("%s 必须是布尔值: %s", name, raw)
+		}
+		*dst = &v
+	}
+	return f, nil
+}
+
+// needsInventory 判断是否设置了清单相关的条件
+func (f InventoryFilter) needsInventory() bool {
+	return f.Kernel != "" || f.GPUModel != "" || f.HasGPU != nil || f.BTF != nil || f.CUDA != nil || f.Binary != "" || f.Probe != ""
+}
+
+// Match 判断节点是否满足所有条件，node.Status 需要已经由 deriveNodeStatus 得出
+func (f InventoryFilter) Match(node models.NodeInfo) bool {
+	if f.Status != "" && node.Status != f.Status {
+		return false
+	}
+	for key, value := range f.Labels {
+		if v, ok := node.Labels[key]; !ok || v != value {
+			return false
+		}
+	}
+	inv := node.Inventory
+	if inv == nil {
+		return !f.needsInventory()
+	}
+	if f.Kernel != "" && !strings.HasPrefix(inv.KernelVersion, f.Kernel) {
+		return false
+	}
+	if f.HasGPU != nil && (len(inv.GPUs) > 0) != *f.HasGPU {
+		return false
+	}
+	if f.BTF != nil && inv.BTF != *f.BTF {
+		return false
+	}
+	if f.CUDA != nil && (len(inv.CUDARuntimes) > 0) != *f.CUDA {
+		return false
+	}
+	if f.GPUModel != "" && !matchAny(len(inv.GPUs), func(i int) bool {
+		return strings.Contains(strings.ToLower(inv.GPUs[i].Model), strings.ToLower(f.GPUModel))
+	}) {
+		return false
+	}
+	if f.Binary != "" && !matchAny(len(inv.LLMBinaries), func(i int) bool { return inv.LLMBinaries[i].Name == f.Binary }) {
+		return false
+	}
+	if f.Probe != "" && !matchAny(len(inv.Probes), func(i int) bool { return inv.Probes[i].Name == f.Probe && inv.Probes[i].Running }) {
+		return false
+	}
+	return true
+}
+
+func matchAny(n int, match func(i int) bool) bool {
+	for i := 0; i < n; i++ {
+		if match(i) {
+			return true
+		}
+	}
+	return false
+}
+
+func inventoryItem(node models.NodeInfo) NodeInventoryItem {
+	return NodeInventoryItem{
+		ID:        node.ID,
+		Status:    node.Status,
+		Labels:    node.Labels,
+		LastSeen:  node.LastSeen,
+		Inventory: node.Inventory,
+	}
+}
+
+// ListInventory 返回满足 filter 的节点清单，按节点 ID 排序
+func (s *NodeService) ListInventory(ctx context.Context, filter InventoryFilter) ([]NodeInventoryItem, error) {
+	nodes, err := s.ListNodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]NodeInventoryItem, 0, len(nodes))
+	for _, node := range nodes {
+		if filter.Match(node) {
+			items = append(items, inventoryItem(node))
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+	return items, nil
+}
+
+// GetInventory 返回单个节点的清单
+func (s *NodeService) GetInventory(ctx context.Context, id string) (NodeInventoryItem, error) {
+	node, err := s.nodeStore.GetNode(ctx, id)
+	if err != nil {
+		return NodeInventoryItem{}, err
+	}
+	node.Status = deriveNodeStatus(node, time.Now(), s.grace)
+	return inventoryItem(node), nil
+}
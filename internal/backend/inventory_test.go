@@ -0,0 +1,80 @@
+package backend
+
+import (
+	"net/url"
+	"testing"
+
+	"scope/internal/models"
+)
+
+func TestParseInventoryFilter(t *testing.T) {
+	q, _ := url.ParseQuery("label=zone=a&label=pool=gpu&status=online&gpu=4090&has_gpu=true&cuda=0")
+	f, err := ParseInventoryFilter(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Labels["zone"] != "a" || f.Labels["pool"] != "gpu" || f.Status != NodeStatusOnline || f.GPUModel != "4090" {
+		t.Errorf("got %+v", f)
+	}
+	if f.HasGPU == nil || !*f.HasGPU || f.CUDA == nil || *f.CUDA || f.BTF != nil {
+		t.Errorf("bool filters: has_gpu=%v cuda=%v btf=%v", f.HasGPU, f.CUDA, f.BTF)
+	}
+
+	// 无效的参数
+	for _, raw := range []string{"label=zone", "label==a", "btf=maybe", "status=busy"} {
+		q, _ := url.ParseQuery(raw)
+		if _, err := ParseInventoryFilter(q); err == nil {
+			t.Errorf("%s: expected error", raw)
+		}
+	}
+}
+
+func TestInventoryFilterMatch(t *testing.T) {
+	gpuNode := models.NodeInfo{
+		ID:     "gpu-01",
+		Status: NodeStatusOnline,
+		Labels: map[string]string{"zone": "a"},
+		Inventory: &models.NodeInventory{
+			KernelVersion: "6.8.0-45-generic",
+			BTF:           true,
+			GPUs:          []models.GPUInfo{{Model: "NVIDIA GeForce RTX 4090"}},
+			CUDARuntimes:  []string{"/usr/local/cuda/lib64/libcudart.so.12"},
+			LLMBinaries:   []models.BinaryInfo{{Name: "ollama", Path: "/usr/local/bin/ollama"}},
+			Probes:        []models.ProbeStatus{{Name: "cuda", Running: true}, {Name: "sched", Running: false}},
+		},
+	}
+	cpuNode := models.NodeInfo{
+		ID:        "cpu-01",
+		Status:    NodeStatusOffline,
+		Inventory: &models.NodeInventory{KernelVersion: "5.15.0-1-generic"},
+	}
+	// 尚未上报清单的节点
+	bareNode := models.NodeInfo{ID: "new-01", Status: NodeStatusOnline}
+
+	yes, no := true, false
+	tests := []struct {
+		name   string
+		filter InventoryFilter
+		want   []bool // gpuNode, cpuNode, bareNode
+	}{
+		{"no filter", InventoryFilter{}, []bool{true, true, true}},
+		{"status", InventoryFilter{Status: NodeStatusOnline}, []bool{true, false, true}},
+		{"label", InventoryFilter{Labels: map[string]string{"zone": "a"}}, []bool{true, false, false}},
+		{"kernel prefix", InventoryFilter{Kernel: "6."}, []bool{true, false, false}},
+		{"gpu model", InventoryFilter{GPUModel: "rtx 4090"}, []bool{true, false, false}},
+		{"has gpu", InventoryFilter{HasGPU: &yes}, []bool{true, false, false}},
+		{"no gpu", InventoryFilter{HasGPU: &no}, []bool{false, true, false}},
+		{"btf", InventoryFilter{BTF: &yes}, []bool{true, false, false}},
+		{"cuda", InventoryFilter{CUDA: &yes}, []bool{true, false, false}},
+		{"binary", InventoryFilter{Binary: "ollama"}, []bool{true, false, false}},
+		{"running probe", InventoryFilter{Probe: "cuda"}, []bool{true, false, false}},
+		{"stopped probe", InventoryFilter{Probe: "sched"}, []bool{false, false, false}},
+	}
+	for _, tt := range tests {
+		for i, node := range []models.NodeInfo{gpuNode, cpuNode, bareNode} {
+			if got := tt.filter.Match(node); got != tt.want[i] {
+				t.Errorf("%s: Match(%s) = %v, want %v", tt.name, node.ID, got, tt.want[i])
+			}
+		}
+	}
+}
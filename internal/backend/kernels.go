@@ -0,0 +1,218 @@
+package backend
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"scope/database/postgres"
+	"scope/internal/models"
+)
+
+// KernelProfileEntry 是一个进程中某个 CUDA kernel 的启动统计
+type KernelProfileEntry struct {
+	PID        int32   `json:"pid"`
+	Comm       string  `json:"comm"`
+	SymbolName string  `json:"symbol_name"`
+	SymbolFile string  `json:"symbol_file"`
+	Launches   int64   `json:"launches"`
+	Share      float64 `json:"share"`        // 占该进程全部 kernel 启动的比例
+	RatePerSec float64 `json:"rate_per_sec"` // 窗口内平均每秒启动次数
+}
+
+// KernelProfile 是一个时间窗口内的 kernel 热点分布
+type KernelProfile struct {
+	MachineID string                    `json:"machine_id"`
+	Start     time.Time                 `json:"start"`
+	End       time.Time                 `json:"end"`
+	Total     int64                     `json:"total"`
+	Kernels   []KernelProfileEntry      `json:"kernels"`
+	Timeline  []models.CudaKernelSample `json:"timeline,omitempty"`
+}
+
+// KernelDiffEntry 比较同一 kernel 在两个窗口中的启动占比
+type KernelDiffEntry struct {
+	SymbolName     string  `json:"symbol_name"`
+	SymbolFile     string  `json:"symbol_file"` // 仅保留文件名，库路径随版本变化时仍能对齐
+	BaseLaunches   int64   `json:"base_launches"`
+	TargetLaunches int64   `json:"target_launches"`
+	BaseShare      float64 `json:"base_share"`
+	TargetShare    float64 `json:"target_share"`
+	ShareDelta     float64 `json:"share_delta"`
+	BaseRate       float64 `json:"base_rate_per_sec"`
+	TargetRate     float64 `json:"target_rate_per_sec"`
+	Status         string  `json:"status"` // added, removed, changed
+}
+
+// KernelDiff 是两个窗口的 kernel 分布差异，按占比变化绝对值降序排列
+type KernelDiff struct {
+	Base    KernelWindow      `json:"base"`
+	Target  KernelWindow      `json:"target"`
+	Kernels []KernelDiffEntry `json:"kernels"`
+}
+
+// KernelWindow 描述参与比较的一个窗口
+type KernelWindow struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Total int64     `json:"total"`
+}
+
+const (
+	KernelDiffAdded   = "added"
+	KernelDiffRemoved = "removed"
+	KernelDiffChanged = "changed"
+)
+
+// KernelService 基于 cudaLaunchKernel 事件生成 kernel 热点分析
+type KernelService struct {
+	eventStore *postgres.EventStore
+	symbols    *SymbolStore // 为 agent 未能解析的 kernel 离线解析名字，可以为 nil
+}
+
+// Profile 统计窗口内每个进程各 kernel 的启动次数和占比；bucket > 0 时同时返回启动次数时间线
+func (s *KernelService) Profile(ctx context.Context, filter postgres.EventFilter, bucket time.Duration) (*KernelProfile, error) {
+	stats, err := s.eventStore.CudaKernelStats(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	resolver := s.symbols.resolver()
+	profile := buildKernelProfile(filter.MachineID, resolver.resolveKernelStats(stats), filter.Start, filter.End)
+	if bucket > 0 {
+		timeline, err := s.eventStore.CudaKernelTimeline(ctx, filter, bucket)
+		if err != nil {
+			return nil, err
+		}
+		profile.Timeline = resolver.resolveKernelSamples(timeline)
+	}
+	return profile, nil
+}
+
+// Diff 比较 base 与 target 两个窗口的 kernel 分布，两个窗口使用相同的 machine_id 和 pid 过滤
+func (s *KernelService) Diff(ctx context.Context, base, target postgres.EventFilter) (*KernelDiff, error) {
+	baseStats, err := s.eventStore.CudaKernelStats(ctx, base)
+	if err != nil {
+		return nil, err
+	}
+	targetStats, err := s.eventStore.CudaKernelStats(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	resolver := s.symbols.resolver()
+	baseStats = resolver.resolveKernelStats(baseStats)
+	targetStats = resolver.resolveKernelStats(targetStats)
+	return diffKernelStats(baseStats, base.Start, base.End, targetStats, target.Start, target.End), nil
+}
+
+func buildKernelProfile(machineID string, stats []models.CudaKernelStat, start, end time.Time) *KernelProfile {
+	profile := &KernelProfile{MachineID: machineID, Start: start, End: end}
+	seconds := end.Sub(start).Seconds()
+
+	perPID := make(map[int32]int64)
+	for _, st := range stats {
+		perPID[st.PID] += st.Launches
+		profile.Total += st.Launches
+	}
+	for _, st := range stats {
+		entry := KernelProfileEntry{
+			PID:        st.PID,
+			Comm:       st.Comm,
+			SymbolName: st.SymbolName,
+			SymbolFile: st.SymbolFile,
+			Launches:   st.Launches,
+			Share:      float64(st.Launches) / float64(perPID[st.PID]),
+		}
+		if seconds > 0 {
+			entry.RatePerSec = float64(st.Launches) / seconds
+		}
+		profile.Kernels = append(profile.Kernels, entry)
+	}
+	sort.Slice(profile.Kernels, func(i, j int) bool {
+		a, b := profile.Kernels[i], profile.Kernels[j]
+		if a.PID != b.PID {
+			return perPID[a.PID] > perPID[b.PID]
+		}
+		return a.Launches > b.Launches
+	})
+	return profile
+}
+
+// diffKernelStats 以 (kernel 名, 库文件名) 为键合并各进程的统计后比较两个窗口。
+// 两个窗口长度可以不同，因此主要按占比比较，同时给出每秒启动次数。
+func diffKernelStats(baseStats []models.CudaKernelStat, baseStart, baseEnd time.Time, targetStats []models.CudaKernelStat, targetStart, targetEnd time.Time) *KernelDiff {
+	type kernelKey struct{ name, file string }
+	merge := func(stats []models.CudaKernelStat) (map[kernelKey]int64, int64) {
+		counts := make(map[kernelKey]int64)
+		var total int64
+		for _, st := range stats {
+			counts[kernelKey{st.SymbolName, filepath.Base(st.SymbolFile)}] += st.Launches
+			total += st.Launches
+		}
+		return counts, total
+	}
+	ratio := func(n, d int64) float64 {
+		if d == 0 {
+			return 0
+		}
+		return float64(n) / float64(d)
+	}
+	rate := func(n int64, start, end time.Time) float64 {
+		if seconds := end.Sub(start).Seconds(); seconds > 0 {
+			return float64(n) / seconds
+		}
+		return 0
+	}
+
+	baseCounts, baseTotal := merge(baseStats)
+	targetCounts, targetTotal := merge(targetStats)
+	diff := &KernelDiff{
+		Base:   KernelWindow{Start: baseStart, End: baseEnd, Total: baseTotal},
+		Target: KernelWindow{Start: targetStart, End: targetEnd, Total: targetTotal},
+	}
+
+	keys := make(map[kernelKey]struct{})
+	for k := range baseCounts {
+		keys[k] = struct{}{}
+	}
+	for k := range targetCounts {
+		keys[k] = struct{}{}
+	}
+	for k := range keys {
+		entry := KernelDiffEntry{
+			SymbolName:     k.name,
+			SymbolFile:     k.file,
+			BaseLaunches:   baseCounts[k],
+			TargetLaunches: targetCounts[k],
+			BaseShare:      ratio(baseCounts[k], baseTotal),
+			TargetShare:    ratio(targetCounts[k], targetTotal),
+			BaseRate:       rate(baseCounts[k], baseStart, baseEnd),
+			TargetRate:     rate(targetCounts[k], targetStart, targetEnd),
+		}
+		entry.ShareDelta = entry.TargetShare - entry.BaseShare
+		switch {
+		case entry.BaseLaunches == 0:
+			entry.Status = KernelDiffAdded
+		case entry.TargetLaunches == 0:
+			entry.Status = KernelDiffRemoved
+		default:
+			entry.Status = KernelDiffChanged
+		}
+		diff.Kernels = append(diff.Kernels, entry)
+	}
+
+	abs := func(f float64) float64 {
+		if f < 0 {
+			return -f
+		}
+		return f
+	}
+	sort.Slice(diff.Kernels, func(i, j int) bool {
+		a, b := diff.Kernels[i], diff.Kernels[j]
+		if abs(a.ShareDelta) != abs(b.ShareDelta) {
+			return abs(a.ShareDelta) > abs(b.ShareDelta)
+		}
+		return a.SymbolName < b.SymbolName
+	})
+	return diff
+}
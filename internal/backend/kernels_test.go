@@ -0,0 +1,58 @@
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"scope/internal/models"
+)
+
+func TestDiffKernelStats(t *testing.T) {
+	target := at(24 * time.Hour)
+
+	baseStats := []models.CudaKernelStat{
+		{PID: 1, SymbolName: "mul_mat_q4_0", SymbolFile: "/usr/lib/ollama/v1/libggml-cuda.so", Launches: 60},
+		{PID: 1, SymbolName: "rms_norm_f32", SymbolFile: "/usr/lib/ollama/v1/libggml-cuda.so", Launches: 40},
+	}
+	targetStats := []models.CudaKernelStat{
+		// 升级后 pid 和库路径都变了
+		{PID: 2, SymbolName: "mul_mat_q4_0", SymbolFile: "/usr/lib/ollama/v2/libggml-cuda.so", Launches: 30},
+		{PID: 2, SymbolName: "rms_norm_f32", SymbolFile: "/usr/lib/ollama/v2/libggml-cuda.so", Launches: 40},
+		{PID: 2, SymbolName: "flash_attn_ext_f16", SymbolFile: "/usr/lib/ollama/v2/libggml-cuda.so", Launches: 30},
+	}
+
+	diff := diffKernelStats(baseStats, testBase, at(10*time.Second), targetStats, target, target.Add(20*time.Second))
+	if len(diff.Kernels) != 3 {
+		t.Fatalf("got %d kernels, want 3: %+v", len(diff.Kernels), diff.Kernels)
+	}
+
+	byName := map[string]KernelDiffEntry{}
+	for _, k := range diff.Kernels {
+		byName[k.SymbolName] = k
+	}
+	if k := byName["flash_attn_ext_f16"]; k.Status != KernelDiffAdded || k.TargetShare != 0.3 {
+		t.Errorf("flash_attn = %+v, want added with share 0.3", k)
+	}
+	if k := byName["mul_mat_q4_0"]; k.Status != KernelDiffChanged || k.BaseRate != 6 || k.TargetRate != 1.5 {
+		t.Errorf("mul_mat = %+v, want changed with rates 6 -> 1.5", k)
+	}
+	if diff.Kernels[2].SymbolName != "rms_norm_f32" {
+		t.Errorf("kernel with the smallest share change should sort last, got %q", diff.Kernels[2].SymbolName)
+	}
+}
+
+func TestBuildKernelProfile(t *testing.T) {
+	stats := []models.CudaKernelStat{
+		{PID: 1, SymbolName: "a", Launches: 10},
+		{PID: 2, SymbolName: "b", Launches: 30},
+		{PID: 2, SymbolName: "c", Launches: 10},
+	}
+	profile := buildKernelProfile("m1", stats, testBase, at(10*time.Second))
+	if profile.Total != 50 {
+		t.Errorf("total = %d, want 50", profile.Total)
+	}
+	first := profile.Kernels[0]
+	if first.PID != 2 || first.SymbolName != "b" || first.Share != 0.75 || first.RatePerSec != 3 {
+		t.Errorf("first entry = %+v, want pid 2 kernel b share 0.75 rate 3", first)
+	}
+}
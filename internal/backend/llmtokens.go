@@ -0,0 +1,119 @@
+package backend
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"scope/database/postgres"
+	"scope/internal/models"
+)
+
+// prefillCostRatio 请求开头耗时超过 decode 中位耗时该倍数的计算被视为 prefill (一次处理一批 prompt token)
+const prefillCostRatio = 2
+
+// ListTokenMetrics 查询请求级 token 指标
+func (s *InferenceService) ListTokenMetrics(ctx context.Context, filter postgres.EventFilter) ([]models.LLMTokenMetrics, error) {
+	return s.analysisStore.ListLLMTokenMetrics(ctx, filter)
+}
+
+// TokenMetricsSeries 按进程和时间桶汇总 token 指标
+func (s *InferenceService) TokenMetricsSeries(ctx context.Context, filter postgres.EventFilter, bucket time.Duration) ([]models.LLMTokenMetricsBucket, error) {
+	return s.analysisStore.LLMTokenMetricsSeries(ctx, filter, bucket)
+}
+
+// deriveLLMTokenMetrics 按推理请求 (见 segmentGraphComputes) 计算 prefill/decode 阶段和 token 吞吐。
+//
+// llama.cpp 每个 decode step 调用一次 ggml_graph_compute。请求的第一次计算总是 prefill；
+// 紧随其后、耗时明显高于 decode 中位耗时或图节点数与 decode 图不同的计算是分批 (ubatch) 的 prefill。
+// 最后一次 prefill 返回时产生第一个 token，之后每次 decode 计算返回时产生一个 token。
+func deriveLLMTokenMetrics(machineID string, logs []models.AppLogEvent, ggml []models.GGMLEvent, idleGap time.Duration) []models.LLMTokenMetrics {
+	if idleGap <= 0 {
+		idleGap = defaultInferenceIdleGap
+	}
+	markers := inferenceMarkers(logs)
+	computes, _ := splitGGMLEvents(ggml)
+
+	var metrics []models.LLMTokenMetrics
+	for pid, events := range computes {
+		for _, seg := range segmentGraphComputes(markers[pid], events, idleGap) {
+			m := tokenMetricsForSegment(seg)
+			m.MachineID = machineID
+			m.PID = pid
+			metrics = append(metrics, m)
+		}
+	}
+	sort.Slice(metrics, func(i, j int) bool {
+		if !metrics[i].Ts.Equal(metrics[j].Ts) {
+			return metrics[i].Ts.Before(metrics[j].Ts)
+		}
+		return metrics[i].PID < metrics[j].PID
+	})
+	return metrics
+}
+
+func tokenMetricsForSegment(seg inferenceSegment) models.LLMTokenMetrics {
+	computes := seg.computes
+	m := models.LLMTokenMetrics{
+		Ts:      seg.start,
+		EndTs:   seg.end(),
+		Comm:    computes[0].Comm,
+		Cmdline: computes[0].Cmdline,
+	}
+
+	// decode 参考值取第一次计算之后的耗时中位数和最常见的图节点数
+	prefill := 1
+	if rest := computes[1:]; len(rest) > 0 {
+		costs := make([]int64, len(rest))
+		nodes := make(map[int32]int)
+		for i, e := range rest {
+			costs[i] = e.GGMLCostNs
+			nodes[e.GGMLGraphNodes]++
+		}
+		sort.Slice(costs, func(i, j int) bool { return costs[i] < costs[j] })
+		medianCost := costs[len(costs)/2]
+		var decodeNodes int32
+		for n, count := range nodes {
+			if count > nodes[decodeNodes] || (count == nodes[decodeNodes] && n < decodeNodes) {
+				decodeNodes = n
+			}
+		}
+		for prefill < len(computes)-1 {
+			e := computes[prefill]
+			if e.GGMLCostNs <= prefillCostRatio*medianCost && e.GGMLGraphNodes == decodeNodes {
+				break
+			}
+			prefill++
+		}
+	}
+
+	for _, e := range computes[:prefill] {
+		m.PrefillNs += e.GGMLCostNs
+	}
+	m.PrefillSteps = int32(prefill)
+	firstToken := computes[prefill-1].Ts
+	m.TTFTNs = firstToken.Sub(seg.start).Nanoseconds()
+
+	decode := computes[prefill:]
+	if len(decode) == 0 {
+		return m
+	}
+	itls := make([]int64, len(decode))
+	prev := firstToken
+	for i, e := range decode {
+		itls[i] = e.Ts.Sub(prev).Nanoseconds()
+		prev = e.Ts
+	}
+	m.DecodeTokens = int32(len(decode))
+	m.DecodeNs = prev.Sub(firstToken).Nanoseconds()
+	if m.DecodeNs > 0 {
+		m.TokensPerSec = float64(m.DecodeTokens) * 1e9 / float64(m.DecodeNs)
+	}
+	m.ITLAvgNs = m.DecodeNs / int64(m.DecodeTokens)
+
+	sort.Slice(itls, func(i, j int) bool { return itls[i] < itls[j] })
+	m.ITLP50Ns = itls[(len(itls)-1)*50/100]
+	m.ITLP95Ns = itls[(len(itls)-1)*95/100]
+	m.ITLMaxNs = itls[len(itls)-1]
+	return m
+}
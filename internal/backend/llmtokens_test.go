@@ -0,0 +1,46 @@
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"scope/internal/models"
+)
+
+func TestDeriveLLMTokenMetrics(t *testing.T) {
+	compute := func(d, cost time.Duration, nodes int32) models.GGMLEvent {
+		return models.GGMLEvent{Ts: at(d), EventSubtype: models.GGMLCpuTopic, PID: 3, GGMLCostNs: cost.Nanoseconds(), GGMLGraphNodes: nodes}
+	}
+
+	logs := []models.AppLogEvent{{Ts: at(0), PID: 3, LogText: "slot launch_slot_: id 0 | task 5 | processing task"}}
+	ggml := []models.GGMLEvent{
+		// 两个 ubatch 的 prefill, 第二个图节点数不同 (只输出最后一个 token 的 logits)
+		compute(300*time.Millisecond, 200*time.Millisecond, 1000),
+		compute(400*time.Millisecond, 30*time.Millisecond, 1002),
+		// decode, 间隔 20ms, 20ms, 40ms
+		compute(420*time.Millisecond, 15*time.Millisecond, 1000),
+		compute(440*time.Millisecond, 15*time.Millisecond, 1000),
+		compute(480*time.Millisecond, 15*time.Millisecond, 1000),
+	}
+
+	metrics := deriveLLMTokenMetrics("m1", logs, ggml, time.Second)
+	if len(metrics) != 1 {
+		t.Fatalf("got %d requests, want 1", len(metrics))
+	}
+	m := metrics[0]
+	if m.PrefillSteps != 2 {
+		t.Errorf("prefill steps = %d, want 2", m.PrefillSteps)
+	}
+	if m.TTFTNs != (400 * time.Millisecond).Nanoseconds() {
+		t.Errorf("ttft = %v, want 400ms", time.Duration(m.TTFTNs))
+	}
+	if m.DecodeTokens != 3 || m.DecodeNs != (80*time.Millisecond).Nanoseconds() {
+		t.Errorf("decode = %d tokens over %v, want 3 over 80ms", m.DecodeTokens, time.Duration(m.DecodeNs))
+	}
+	if m.TokensPerSec != 37.5 {
+		t.Errorf("tokens/sec = %v, want 37.5", m.TokensPerSec)
+	}
+	if m.ITLP50Ns != (20*time.Millisecond).Nanoseconds() || m.ITLMaxNs != (40*time.Millisecond).Nanoseconds() {
+		t.Errorf("itl p50 = %v max = %v, want 20ms/40ms", time.Duration(m.ITLP50Ns), time.Duration(m.ITLMaxNs))
+	}
+}
@@ -0,0 +1,181 @@
+package backend
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"scope/database/postgres"
+	"scope/internal/models"
+)
+
+// MemcpyDirectionStats 是一个进程在一个拷贝方向上的统计
+type MemcpyDirectionStats struct {
+	Direction      string `json:"direction"` // host_to_device, device_to_host, ...
+	Transfers      int64  `json:"transfers"`
+	Bytes          int64  `json:"bytes"`
+	TimedTransfers int64  `json:"timed_transfers"` // 带耗时的拷贝数 (旧版本探针不上报耗时)
+	TimedBytes     int64  `json:"timed_bytes"`
+	DurationNs     int64  `json:"duration_ns"`
+	// 有效带宽 = TimedBytes / DurationNs，包含 cudaMemcpy 的调用开销
+	BandwidthBytesPerSec float64 `json:"bandwidth_bytes_per_sec"`
+	SmallTransfers       int64   `json:"small_transfers"`
+	SmallDurationNs      int64   `json:"small_duration_ns"`
+	PeakSmallRatePerSec  float64 `json:"peak_small_rate_per_sec"` // 单个时间桶内小拷贝频率的最大值
+	// 小拷贝频率超过阈值: 大量小块拷贝的调用开销远大于传输本身，应合并或改用异步/pinned 内存
+	SmallTransferStorm bool `json:"small_transfer_storm"`
+}
+
+// MemcpySample 是一个时间桶内的拷贝量，只包含有拷贝的桶
+type MemcpySample struct {
+	Ts          time.Time `json:"ts"` // 桶开始时间
+	Transfers   int64     `json:"transfers"`
+	Bytes       int64     `json:"bytes"`
+	BytesPerSec float64   `json:"bytes_per_sec"`
+}
+
+// MemcpyProcessReport 是单个进程的拷贝分析结果
+type MemcpyProcessReport struct {
+	PID        int32                  `json:"pid"`
+	Comm       string                 `json:"comm"`
+	Cmdline    string                 `json:"cmdline"`
+	Directions []MemcpyDirectionStats `json:"directions"`
+	Timeline   []MemcpySample         `json:"timeline"`
+}
+
+// MemcpyReport 是一台机器在一个时间窗口内的 cudaMemcpy 分析结果
+type MemcpyReport struct {
+	MachineID          string                `json:"machine_id"`
+	Start              time.Time             `json:"start"`
+	End                time.Time             `json:"end"`
+	SmallTransferBytes int64                 `json:"small_transfer_bytes"`
+	StormRatePerSec    float64               `json:"storm_rate_per_sec"`
+	Processes          []MemcpyProcessReport `json:"processes"`
+}
+
+// MemcpyOptions 控制拷贝分析的参数
+type MemcpyOptions struct {
+	Bucket             time.Duration // 时间线桶大小
+	SmallTransferBytes int64         // 小于该大小的拷贝视为小拷贝
+	StormRatePerSec    float64       // 小拷贝频率达到该值时标记
+}
+
+type MemcpyService struct {
+	eventStore *postgres.EventStore
+}
+
+// Analyze 统计窗口内每个进程各方向的 cudaMemcpy 带宽、小拷贝频率和字节速率时间线
+func (s *MemcpyService) Analyze(ctx context.Context, filter postgres.EventFilter, opts MemcpyOptions) (*MemcpyReport, error) {
+	filter.Subtypes = []string{models.CudaMemcpyTopic}
+	events, err := s.eventStore.ListCudaEvents(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	return analyzeMemcpy(filter.MachineID, events, filter.Start, filter.End, opts), nil
+}
+
+// analyzeMemcpy 按进程和方向聚合 cudaMemcpy 事件。events 需按时间升序排列。
+func analyzeMemcpy(machineID string, events []models.CudaEvent, start, end time.Time, opts MemcpyOptions) *MemcpyReport {
+	if opts.Bucket <= 0 {
+		opts.Bucket = time.Second
+	}
+	type directionState struct {
+		stats       *MemcpyDirectionStats
+		bucketStart time.Time
+		bucketSmall int64
+	}
+	type procState struct {
+		report     *MemcpyProcessReport
+		directions map[string]*directionState
+	}
+
+	bucketSeconds := opts.Bucket.Seconds()
+	bucketOf := func(ts time.Time) time.Time {
+		return start.Add(ts.Sub(start) / opts.Bucket * opts.Bucket)
+	}
+	closeSmallBucket := func(d *directionState) {
+		if rate := float64(d.bucketSmall) / bucketSeconds; rate > d.stats.PeakSmallRatePerSec {
+			d.stats.PeakSmallRatePerSec = rate
+		}
+		d.bucketSmall = 0
+	}
+
+	procs := make(map[int32]*procState)
+	for _, e := range events {
+		p, ok := procs[e.PID]
+		if !ok {
+			p = &procState{
+				report:     &MemcpyProcessReport{PID: e.PID, Comm: e.Comm, Cmdline: e.Cmdline},
+				directions: make(map[string]*directionState),
+			}
+			procs[e.PID] = p
+		}
+
+		direction := e.CudaMemcpyType
+		if direction == "" {
+			direction = "unknown"
+		}
+		d, ok := p.directions[direction]
+		if !ok {
+			d = &directionState{stats: &MemcpyDirectionStats{Direction: direction}}
+			p.directions[direction] = d
+		}
+
+		bucket := bucketOf(e.Ts)
+		st := d.stats
+		st.Transfers++
+		st.Bytes += e.CudaSize
+		if e.CudaMemcpyDurationNs > 0 {
+			st.TimedTransfers++
+			st.TimedBytes += e.CudaSize
+			st.DurationNs += e.CudaMemcpyDurationNs
+		}
+		if e.CudaSize < opts.SmallTransferBytes {
+			if !bucket.Equal(d.bucketStart) {
+				closeSmallBucket(d)
+				d.bucketStart = bucket
+			}
+			st.SmallTransfers++
+			st.SmallDurationNs += e.CudaMemcpyDurationNs
+			d.bucketSmall++
+		}
+
+		timeline := p.report.Timeline
+		if n := len(timeline); n == 0 || !timeline[n-1].Ts.Equal(bucket) {
+			p.report.Timeline = append(p.report.Timeline, MemcpySample{Ts: bucket})
+		}
+		sample := &p.report.Timeline[len(p.report.Timeline)-1]
+		sample.Transfers++
+		sample.Bytes += e.CudaSize
+	}
+
+	report := &MemcpyReport{
+		MachineID:          machineID,
+		Start:              start,
+		End:                end,
+		SmallTransferBytes: opts.SmallTransferBytes,
+		StormRatePerSec:    opts.StormRatePerSec,
+	}
+	for _, p := range procs {
+		for i := range p.report.Timeline {
+			p.report.Timeline[i].BytesPerSec = float64(p.report.Timeline[i].Bytes) / bucketSeconds
+		}
+		for _, d := range p.directions {
+			closeSmallBucket(d)
+			st := d.stats
+			if st.DurationNs > 0 {
+				st.BandwidthBytesPerSec = float64(st.TimedBytes) * 1e9 / float64(st.DurationNs)
+			}
+			st.SmallTransferStorm = opts.StormRatePerSec > 0 && st.PeakSmallRatePerSec >= opts.StormRatePerSec
+			p.report.Directions = append(p.report.Directions, *st)
+		}
+		sort.Slice(p.report.Directions, func(i, j int) bool {
+			return p.report.Directions[i].Bytes > p.report.Directions[j].Bytes
+		})
+		report.Processes = append(report.Processes, *p.report)
+	}
+	sort.Slice(report.Processes, func(i, j int) bool {
+		return report.Processes[i].PID < report.Processes[j].PID
+	})
+	return report
+}
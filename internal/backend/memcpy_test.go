@@ -0,0 +1,47 @@
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"scope/internal/models"
+)
+
+func TestAnalyzeMemcpy(t *testing.T) {
+	var events []models.CudaEvent
+	// 一次 1GiB 的 H2D 拷贝耗时 100ms
+	events = append(events, models.CudaEvent{Ts: at(100 * time.Millisecond), EventSubtype: models.CudaMemcpyTopic, PID: 5,
+		CudaSize: 1 << 30, CudaMemcpyType: "host_to_device", CudaMemcpyDurationNs: (100 * time.Millisecond).Nanoseconds()})
+	// 第 2 秒内 200 次 4KiB 的 D2H 拷贝
+	for i := 0; i < 200; i++ {
+		events = append(events, models.CudaEvent{Ts: at(2*time.Second + time.Duration(i)*time.Millisecond), EventSubtype: models.CudaMemcpyTopic, PID: 5,
+			CudaSize: 4096, CudaMemcpyType: "device_to_host", CudaMemcpyDurationNs: 10000})
+	}
+
+	report := analyzeMemcpy("m1", events, testBase, at(time.Minute), MemcpyOptions{Bucket: time.Second, SmallTransferBytes: 64 * 1024, StormRatePerSec: 100})
+	if len(report.Processes) != 1 {
+		t.Fatalf("got %d processes, want 1", len(report.Processes))
+	}
+	p := report.Processes[0]
+	if len(p.Directions) != 2 {
+		t.Fatalf("got %d directions, want 2", len(p.Directions))
+	}
+
+	h2d, d2h := p.Directions[0], p.Directions[1]
+	if h2d.Direction != "host_to_device" || h2d.BandwidthBytesPerSec != float64(1<<30)*10 {
+		t.Errorf("h2d = %+v, want 10 GiB/s", h2d)
+	}
+	if h2d.SmallTransferStorm {
+		t.Errorf("a single large transfer must not be flagged")
+	}
+	if d2h.SmallTransfers != 200 || d2h.PeakSmallRatePerSec != 200 || !d2h.SmallTransferStorm {
+		t.Errorf("d2h = %+v, want 200 small transfers flagged at 200/s", d2h)
+	}
+
+	if len(p.Timeline) != 2 {
+		t.Fatalf("got %d timeline samples, want 2", len(p.Timeline))
+	}
+	if p.Timeline[1].Bytes != 200*4096 || p.Timeline[1].BytesPerSec != 200*4096 {
+		t.Errorf("second sample = %+v", p.Timeline[1])
+	}
+}
@@ -3,71 +3,95 @@ package backend
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
+
+	"scope/internal/models"
 )
 
-func NodePingChecker(wg *sync.WaitGroup, handler *Handler) {
+// maxConcurrentPings 是轮询时同时 ping 的节点数
+const maxConcurrentPings = 16
+
+// NodePingChecker 是可选的轮询模式：每隔 interval 并发 ping 所有节点的 agent，成功时刷新最后在线时间和延迟。
+// 节点状态由最后在线时间得出 (见 deriveNodeStatus)，ping 失败不会直接把推送心跳的节点标记为离线。
+// 节点没有上报端口时使用 defaultPort，每个地址的请求最多等待 timeout。
+func NodePingChecker(wg *sync.WaitGroup, handler *Handler, interval time.Duration, defaultPort int, timeout time.Duration) {
 	defer wg.Done()
-	nodestore := handler.nodeHandler.nodeService.nodeStore
-	timeticker := time.NewTicker(10 * time.Second)
-	for {
-		select {
-		case <-timeticker.C:
-			nodes, err := nodestore.ListNodes(context.Background())
-			if err != nil {
-				log.Println("Error listing nodes:", err)
-				continue
-			}
-			for _, node := range nodes {
-				// Ping node
-				success := false
-				for _, ip := range node.IPs {
-					if success {
-						break
-					}
-					url := "http://" + ip + ":18090" + "/ping"
-					// Send ping request
-					ts := time.Now()
-					resp, err := http.Get(url)
-					if err != nil {
-						// log.Println("Error pinging node:", err)
-						success = false
-						continue
-					}
-					data := map[string]string{}
-					if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-						log.Println("Error decoding response:", err)
-						success = false
-						continue
-					}
-					resp.Body.Close()
-					if data["timestamp"] == "" {
-						log.Println("Invalid response from node:", resp.Status)
-						success = false
-						continue
-					}
-					success = true
-					// Update last seen time
-					node.LastSeen = time.Now()
-					node.Status = "online"
-					node.Latency = time.Since(ts)
-					err = nodestore.UpdateNode(context.Background(), node)
-					if err != nil {
-						log.Println("Error updating node:", err)
-						continue
-					}
-				}
-				if !success {
-					node.Status = "offline"
-					nodestore.UpdateNode(context.Background(), node)
-				}
-			}
-		default:
-			time.Sleep(5 * time.Second)
+	nodeService := handler.nodeHandler.nodeService
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		nodes, err := nodeService.nodeStore.ListNodes(context.Background())
+		if err != nil {
+			log.Println("Error listing nodes:", err)
+			continue
+		}
+		sem := make(chan struct{}, maxConcurrentPings)
+		var pings sync.WaitGroup
+		for _, node := range nodes {
+			sem <- struct{}{}
+			pings.Add(1)
+			go func(node models.NodeInfo) {
+				defer pings.Done()
+				defer func() { <-sem }()
+				nodeService.pingNode(node, defaultPort, timeout)
+			}(node)
+		}
+		pings.Wait()
+	}
+}
+
+// pingNode 依次尝试节点的每个地址，第一个成功的地址刷新节点的最后在线时间和延迟
+func (s *NodeService) pingNode(node models.NodeInfo, defaultPort int, timeout time.Duration) {
+	port := node.Port
+	if port == 0 {
+		port = defaultPort
+	}
+	for _, ip := range node.IPs {
+		ts := time.Now()
+		if err := s.ping(node, net.JoinHostPort(ip, strconv.Itoa(port)), timeout); err != nil {
 			continue
 		}
+		latency := time.Since(ts)
+		// 重新读取节点，避免覆盖轮询期间收到的心跳
+		current, err := s.nodeStore.GetNode(context.Background(), node.ID)
+		if err != nil {
+			log.Println("Error getting node:", err)
+			return
+		}
+		current.LastSeen = time.Now()
+		current.Status = NodeStatusOnline
+		current.Latency = latency
+		if err := s.nodeStore.UpdateNode(context.Background(), current); err != nil {
+			log.Println("Error updating node:", err)
+		}
+		return
+	}
+}
+
+// ping 请求 agent 的 /ping，响应中必须带有时间戳
+func (s *NodeService) ping(node models.NodeInfo, host string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	resp, err := s.agentClient.Do(ctx, node, host, http.MethodGet, "/ping", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("agent returned %s", resp.Status)
+	}
+	data := map[string]string{}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return err
+	}
+	if data["timestamp"] == "" {
+		return fmt.Errorf("invalid response from node %s", node.ID)
 	}
+	return nil
 }
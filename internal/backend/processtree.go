@@ -0,0 +1,309 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"scope/database/postgres"
+	"scope/internal/models"
+)
+
+const (
+	processTreeRetention = 7 * 24 * time.Hour // 超过该时间未再出现的进程节点会被清理
+	processTreeMaxDepth  = 128                // 祖先链的最大深度，防止异常数据导致死循环
+)
+
+// ProcessNode 是一次 execv 产生的进程节点。同一个 pid 可能因 pid 复用或多次 exec 对应多个节点，
+// 以 StartTs 区分。只作为父进程出现过的 pid 会生成一个 Placeholder 节点 (StartTs 为零值)。
+type ProcessNode struct {
+	PID         int32     `json:"pid"`
+	PPID        int32     `json:"ppid"`
+	Comm        string    `json:"comm"`
+	Cmdline     string    `json:"cmdline"`
+	Filename    string    `json:"filename,omitempty"`
+	Args        string    `json:"args,omitempty"`
+	StartTs     time.Time `json:"start_ts"`
+	Placeholder bool      `json:"placeholder,omitempty"`
+
+	lastSeen time.Time // 墙上时间，用于清理
+}
+
+// ProcessTreeNode 是后代查询结果中的一个节点
+type ProcessTreeNode struct {
+	ProcessNode
+	Children []*ProcessTreeNode `json:"children,omitempty"`
+}
+
+type machineProcessTree struct {
+	procs    map[int32][]*ProcessNode // pid -> 按 StartTs 升序的节点
+	children map[int32][]*ProcessNode // ppid -> 子进程节点
+}
+
+// ProcessTree 根据 execv 事件维护每台机器的进程父子关系。
+// 它实现 EventObserver，由 Receive 在消费 Redis Stream 时调用，启动时可通过 Bootstrap 从 events_os 恢复。
+type ProcessTree struct {
+	mu        sync.RWMutex
+	machines  map[string]*machineProcessTree
+	lastPrune time.Time
+}
+
+func NewProcessTree() *ProcessTree {
+	return &ProcessTree{
+		machines:  make(map[string]*machineProcessTree),
+		lastPrune: time.Now(),
+	}
+}
+
+// ObserveEvent 处理一条来自 agent 的事件
+func (t *ProcessTree) ObserveEvent(topic string, eventData map[string]interface{}) {
+	if topic != models.ExecvTopic {
+		return
+	}
+	machineID, _ := eventData["machineid"].(string)
+	timestamp, _ := eventData["timestamp"].(float64)
+	pid, _ := eventData["pid"].(float64)
+	ppid, _ := eventData["ppid"].(float64)
+	comm, _ := eventData["pid_comm"].(string)
+	cmdline, _ := eventData["pid_cmdline"].(string)
+	ppidComm, _ := eventData["ppid_comm"].(string)
+	ppidCmdline, _ := eventData["ppid_cmdline"].(string)
+	filename, _ := eventData["filename"].(string)
+	args, _ := eventData["args"].(string)
+
+	t.observe(machineID, ProcessNode{
+		PID:      int32(pid),
+		PPID:     int32(ppid),
+		Comm:     comm,
+		Cmdline:  cmdline,
+		Filename: filename,
+		Args:     args,
+		StartTs:  time.Unix(0, int64(timestamp)).UTC(),
+	}, ppidComm, ppidCmdline)
+}
+
+// Bootstrap 从 events_os 中读取最近 lookback 时间的 execv 事件重建进程树
+func (t *ProcessTree) Bootstrap(ctx context.Context, eventStore *postgres.EventStore, analysisStore *postgres.AnalysisStore, lookback time.Duration) error {
+	now := time.Now().UTC()
+	window := postgres.EventFilter{Start: now.Add(-lookback), End: now, Subtypes: []string{models.ExecvTopic}}
+	machineIDs, err := analysisStore.ListMachineIDs(ctx, "events_os", window)
+	if err != nil {
+		return err
+	}
+	for _, machineID := range machineIDs {
+		filter := window
+		filter.MachineID = machineID
+		// 事件超过单次查询上限时按时间分页
+		for {
+			events, err := eventStore.ListOSEvents(ctx, filter)
+			truncated := errors.Is(err, postgres.ErrTooManyEvents)
+			if err != nil && !truncated {
+				return err
+			}
+			if truncated {
+				var pageEnd time.Time
+				events, pageEnd = truncateAtLastTs(events, func(e models.OSEvent) time.Time { return e.Ts })
+				if !pageEnd.After(filter.Start) {
+					return fmt.Errorf("机器 %s 在 %v 的 execv 事件超过单次查询上限: %w", machineID, filter.Start, err)
+				}
+				filter.Start = pageEnd
+			}
+			for _, e := range events {
+				t.observe(machineID, ProcessNode{
+					PID:      e.PID,
+					PPID:     e.Ppid,
+					Comm:     e.Comm,
+					Cmdline:  e.Cmdline,
+					Filename: e.ExecFilename,
+					Args:     e.ExecArgs,
+					StartTs:  e.Ts,
+				}, e.PpidComm, e.PpidCmdline)
+			}
+			if !truncated {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (t *ProcessTree) observe(machineID string, node ProcessNode, ppidComm, ppidCmdline string) {
+	if node.Comm == "" && node.Filename != "" {
+		node.Comm = filepath.Base(node.Filename)
+	}
+	node.lastSeen = time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	m, ok := t.machines[machineID]
+	if !ok {
+		m = &machineProcessTree{
+			procs:    make(map[int32][]*ProcessNode),
+			children: make(map[int32][]*ProcessNode),
+		}
+		t.machines[machineID] = m
+	}
+
+	nodes := m.procs[node.PID]
+	i := sort.Search(len(nodes), func(i int) bool { return !nodes[i].StartTs.Before(node.StartTs) })
+	if i < len(nodes) && nodes[i].StartTs.Equal(node.StartTs) {
+		// 重复的事件 (例如 Bootstrap 与实时事件重叠)
+		nodes[i].lastSeen = node.lastSeen
+		return
+	}
+	n := &node
+	nodes = append(nodes, nil)
+	copy(nodes[i+1:], nodes[i:])
+	nodes[i] = n
+	m.procs[node.PID] = nodes
+	m.children[node.PPID] = append(m.children[node.PPID], n)
+
+	// 父进程在 agent 启动前就已存在时没有 execv 事件，用 Processor 补充的 ppid 信息生成占位节点
+	if node.PPID > 0 && len(m.procs[node.PPID]) == 0 {
+		m.procs[node.PPID] = []*ProcessNode{{
+			PID:         node.PPID,
+			Comm:        ppidComm,
+			Cmdline:     ppidCmdline,
+			Placeholder: true,
+			lastSeen:    node.lastSeen,
+		}}
+	} else if parent := m.lookup(node.PPID, node.StartTs); parent != nil {
+		parent.lastSeen = node.lastSeen
+	}
+
+	if time.Since(t.lastPrune) > time.Minute {
+		t.pruneLocked()
+	}
+}
+
+// pruneLocked 清理超过 processTreeRetention 未再出现的节点
+func (t *ProcessTree) pruneLocked() {
+	t.lastPrune = time.Now()
+	expired := func(n *ProcessNode) bool { return time.Since(n.lastSeen) > processTreeRetention }
+	for machineID, m := range t.machines {
+		for pid, nodes := range m.procs {
+			if kept := filterNodes(nodes, expired); len(kept) > 0 {
+				m.procs[pid] = kept
+			} else {
+				delete(m.procs, pid)
+			}
+		}
+		for ppid, nodes := range m.children {
+			if kept := filterNodes(nodes, expired); len(kept) > 0 {
+				m.children[ppid] = kept
+			} else {
+				delete(m.children, ppid)
+			}
+		}
+		if len(m.procs) == 0 {
+			delete(t.machines, machineID)
+		}
+	}
+}
+
+func filterNodes(nodes []*ProcessNode, drop func(*ProcessNode) bool) []*ProcessNode {
+	kept := nodes[:0]
+	for _, n := range nodes {
+		if !drop(n) {
+			kept = append(kept, n)
+		}
+	}
+	return kept
+}
+
+// lookup 返回 at 时刻 pid 对应的节点: StartTs 不晚于 at 的最后一个节点
+func (m *machineProcessTree) lookup(pid int32, at time.Time) *ProcessNode {
+	nodes := m.procs[pid]
+	i := sort.Search(len(nodes), func(i int) bool { return nodes[i].StartTs.After(at) })
+	if i == 0 {
+		return nil
+	}
+	return nodes[i-1]
+}
+
+// nextStart 返回同一 pid 下一个节点的开始时间，没有时返回零值
+func (m *machineProcessTree) nextStart(n *ProcessNode) time.Time {
+	nodes := m.procs[n.PID]
+	i := sort.Search(len(nodes), func(i int) bool { return nodes[i].StartTs.After(n.StartTs) })
+	if i < len(nodes) {
+		return nodes[i].StartTs
+	}
+	return time.Time{}
+}
+
+// Ancestry 返回 at 时刻 pid 的祖先链，第一个元素为 pid 本身，最后一个为已知的最上层祖先
+func (t *ProcessTree) Ancestry(machineID string, pid int32, at time.Time) []ProcessNode {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	m, ok := t.machines[machineID]
+	if !ok {
+		return nil
+	}
+	var chain []ProcessNode
+	visited := make(map[*ProcessNode]bool)
+	for cur := m.lookup(pid, at); cur != nil && !visited[cur] && len(chain) < processTreeMaxDepth; {
+		visited[cur] = true
+		chain = append(chain, *cur)
+		if cur.PPID <= 0 || cur.PPID == cur.PID {
+			break
+		}
+		// 父进程必须在子进程启动时已存在
+		parentAt := at
+		if !cur.StartTs.IsZero() {
+			parentAt = cur.StartTs
+		}
+		cur = m.lookup(cur.PPID, parentAt)
+	}
+	return chain
+}
+
+// Descendants 返回 pid (在 end 时刻对应的节点) 在 [start, end) 内启动的全部后代，
+// 以及连接这些后代所需的中间节点
+func (t *ProcessTree) Descendants(machineID string, pid int32, start, end time.Time) *ProcessTreeNode {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	m, ok := t.machines[machineID]
+	if !ok {
+		return nil
+	}
+	rootNode := m.lookup(pid, end)
+	if rootNode == nil {
+		return nil
+	}
+
+	visited := make(map[*ProcessNode]bool)
+	var build func(n *ProcessNode, depth int) *ProcessTreeNode
+	build = func(n *ProcessNode, depth int) *ProcessTreeNode {
+		visited[n] = true
+		tn := &ProcessTreeNode{ProcessNode: *n}
+		if depth >= processTreeMaxDepth {
+			return tn
+		}
+		// 只取属于这一次进程实例的子进程: 启动于该节点之后、同一 pid 的下一个节点之前
+		next := m.nextStart(n)
+		for _, child := range m.children[n.PID] {
+			if visited[child] || child.StartTs.Before(n.StartTs) || (!next.IsZero() && !child.StartTs.Before(next)) {
+				continue
+			}
+			if !child.StartTs.Before(end) {
+				continue
+			}
+			// 早于 start 启动的子进程只在其后代中有范围内启动的进程时保留，作为路径上的中间节点
+			ctn := build(child, depth+1)
+			if child.StartTs.Before(start) && len(ctn.Children) == 0 {
+				continue
+			}
+			tn.Children = append(tn.Children, ctn)
+		}
+		sort.Slice(tn.Children, func(i, j int) bool { return tn.Children[i].StartTs.Before(tn.Children[j].StartTs) })
+		return tn
+	}
+	return build(rootNode, 0)
+}
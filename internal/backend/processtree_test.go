@@ -0,0 +1,64 @@
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"scope/internal/models"
+)
+
+func TestProcessTree(t *testing.T) {
+	exec := func(d time.Duration, pid, ppid int32, filename string) map[string]interface{} {
+		return map[string]interface{}{
+			"machineid":    "m1",
+			"timestamp":    float64(at(d).UnixNano()),
+			"pid":          float64(pid),
+			"ppid":         float64(ppid),
+			"filename":     filename,
+			"ppid_comm":    "sshd",
+			"ppid_cmdline": "sshd: user",
+		}
+	}
+
+	tree := NewProcessTree()
+	tree.ObserveEvent(models.ExecvTopic, exec(0, 100, 50, "/bin/bash"))
+	tree.ObserveEvent(models.ExecvTopic, exec(time.Second, 200, 100, "/usr/bin/ollama"))
+	tree.ObserveEvent(models.ExecvTopic, exec(2*time.Second, 300, 200, "/usr/lib/ollama/runner"))
+	// pid 200 退出后被复用
+	tree.ObserveEvent(models.ExecvTopic, exec(time.Hour, 200, 100, "/usr/bin/python3"))
+	tree.ObserveEvent(models.SchedTopic, exec(time.Hour, 999, 1, "ignored"))
+
+	chain := tree.Ancestry("m1", 300, at(time.Minute))
+	if len(chain) != 4 {
+		t.Fatalf("got ancestry of %d nodes, want 4: %+v", len(chain), chain)
+	}
+	if chain[1].Comm != "ollama" || chain[2].Comm != "bash" {
+		t.Errorf("ancestry = %s <- %s <- %s", chain[0].Comm, chain[1].Comm, chain[2].Comm)
+	}
+	if !chain[3].Placeholder || chain[3].PID != 50 || chain[3].Comm != "sshd" {
+		t.Errorf("top of chain should be a placeholder for sshd: %+v", chain[3])
+	}
+
+	if chain := tree.Ancestry("m1", 200, at(2*time.Hour)); chain[0].Comm != "python3" {
+		t.Errorf("reused pid 200 should resolve to python3, got %q", chain[0].Comm)
+	}
+
+	root := tree.Descendants("m1", 100, testBase, at(2*time.Hour))
+	if root == nil || len(root.Children) != 2 {
+		t.Fatalf("bash should have 2 children, got %+v", root)
+	}
+	if ollama := root.Children[0]; len(ollama.Children) != 1 || ollama.Children[0].PID != 300 {
+		t.Errorf("ollama should have the runner as its only child: %+v", ollama)
+	}
+	if python := root.Children[1]; len(python.Children) != 0 {
+		t.Errorf("the runner belongs to the earlier pid 200, not python: %+v", python.Children)
+	}
+
+	if root := tree.Descendants("m1", 100, at(30*time.Minute), at(2*time.Hour)); len(root.Children) != 1 {
+		t.Errorf("time range should keep only the python child, got %d", len(root.Children))
+	}
+	// runner 在范围内启动，其父进程 ollama 早于范围但作为中间节点保留
+	if root := tree.Descendants("m1", 100, at(1500*time.Millisecond), at(time.Minute)); len(root.Children) != 1 || len(root.Children[0].Children) != 1 {
+		t.Errorf("ollama should be kept as the path to the runner: %+v", root)
+	}
+}
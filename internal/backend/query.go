@@ -0,0 +1,159 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"scope/database/postgres"
+)
+
+// maxQueryRange 单次分析查询允许的最大时间跨度
+const maxQueryRange = 24 * time.Hour
+
+// tooManyEvents 在窗口内的事件数超过单次查询上限时返回 422 并提示缩小范围，
+// 不把被截断的结果当作完整结果返回
+func tooManyEvents(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, postgres.ErrTooManyEvents) {
+		return false
+	}
+	http.Error(w, postgres.ErrTooManyEvents.Error(), http.StatusUnprocessableEntity)
+	return true
+}
+
+// truncateAtLastTs 处理被 postgres.ErrTooManyEvents 截断的按时间升序的结果: 同一时间戳的事件可能只读到了一部分，
+// 去掉最后一个时间戳上的事件，返回剩余的事件和该时间戳，调用方分析到该时间戳 (不含) 为止，之后从该时间戳继续读取
+func truncateAtLastTs[T any](events []T, ts func(T) time.Time) ([]T, time.Time) {
+	if len(events) == 0 {
+		return events, time.Time{}
+	}
+	last := ts(events[len(events)-1])
+	return eventsBefore(events, last, ts), last
+}
+
+// eventsBefore 返回按时间升序的 events 中时间早于 t 的部分
+func eventsBefore[T any](events []T, t time.Time, ts func(T) time.Time) []T {
+	i := sort.Search(len(events), func(i int) bool { return !ts(events[i]).Before(t) })
+	return events[:i]
+}
+
+// parseTimeParam 解析时间参数，支持 RFC3339 字符串或 Unix 纳秒时间戳
+func parseTimeParam(value string) (time.Time, error) {
+	if ns, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(0, ns).UTC(), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("无效的时间格式 %q (需要 RFC3339 或 Unix 纳秒)", value)
+	}
+	return t.UTC(), nil
+}
+
+// parseDurationParam 解析 Go duration 格式的参数 (如 "30s", "5m")，为空时返回默认值
+func parseDurationParam(value string, defaultValue time.Duration) (time.Duration, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("无效的时长 %q", value)
+	}
+	return d, nil
+}
+
+// parsePIDsParam 解析以逗号分隔的 pid 列表，例如 "123,456"
+func parsePIDsParam(value string) ([]int32, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var pids []int32
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		pid, err := strconv.ParseInt(part, 10, 32)
+		if err != nil || pid <= 0 {
+			return nil, fmt.Errorf("无效的 pid %q", part)
+		}
+		pids = append(pids, int32(pid))
+	}
+	return pids, nil
+}
+
+// containerIDRegex 匹配完整的容器 ID 或其前缀
+var containerIDRegex = regexp.MustCompile(`^[0-9a-f]{1,64}$`)
+
+// parseContainerIDsParam 解析以逗号分隔的容器 ID 列表，允许使用短 ID (前缀)
+func parseContainerIDsParam(value string) ([]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var ids []string
+	for _, part := range strings.Split(value, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if part == "" {
+			continue
+		}
+		if !containerIDRegex.MatchString(part) {
+			return nil, fmt.Errorf("无效的 container_id %q", part)
+		}
+		ids = append(ids, part)
+	}
+	return ids, nil
+}
+
+// parseEventFilter 从查询参数 machine_id, pids, start, end 以及可选的 container_id, cgroup, pod_uid 构造事件过滤条件
+func parseEventFilter(r *http.Request) (postgres.EventFilter, error) {
+	q := r.URL.Query()
+	filter := postgres.EventFilter{
+		MachineID: q.Get("machine_id"),
+	}
+	if filter.MachineID == "" {
+		return filter, errors.New("缺少 machine_id 参数")
+	}
+
+	pids, err := parsePIDsParam(q.Get("pids"))
+	if err != nil {
+		return filter, err
+	}
+	filter.PIDs = pids
+
+	if filter.ContainerIDs, err = parseContainerIDsParam(q.Get("container_id")); err != nil {
+		return filter, err
+	}
+	filter.Cgroup = q.Get("cgroup")
+	filter.PodUID = q.Get("pod_uid")
+
+	if q.Get("start") == "" || q.Get("end") == "" {
+		return filter, errors.New("缺少 start 或 end 参数")
+	}
+	if filter.Start, err = parseTimeParam(q.Get("start")); err != nil {
+		return filter, err
+	}
+	if filter.End, err = parseTimeParam(q.Get("end")); err != nil {
+		return filter, err
+	}
+	if !filter.End.After(filter.Start) {
+		return filter, errors.New("end 必须晚于 start")
+	}
+	if filter.End.Sub(filter.Start) > maxQueryRange {
+		return filter, fmt.Errorf("时间范围不能超过 %s", maxQueryRange)
+	}
+	return filter, nil
+}
+
+// parseEventFilterWithoutContainer 用于查询分析结果表的接口。这些表由后端从事件计算得到，没有容器字段，
+// 设置了容器过滤条件时返回错误
+func parseEventFilterWithoutContainer(r *http.Request) (postgres.EventFilter, error) {
+	filter, err := parseEventFilter(r)
+	if err == nil && filter.HasContainerFilter() {
+		err = errors.New("该接口不支持 container_id / cgroup / pod_uid 过滤")
+	}
+	return filter, err
+}
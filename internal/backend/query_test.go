@@ -0,0 +1,34 @@
+package backend
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTruncateAtLastTs(t *testing.T) {
+	tests := []struct {
+		name      string
+		events    []time.Duration
+		wantLen   int
+		wantLast  time.Duration
+		wantEmpty bool
+	}{
+		{"empty", nil, 0, 0, true},
+		// 最后一个时间戳上的事件可能只读到了一部分，全部留给下一页
+		{"drops the last timestamp", []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second}, 2, 3 * time.Second, false},
+		{"single timestamp", []time.Duration{time.Second, time.Second}, 0, time.Second, false},
+	}
+	for _, tt := range tests {
+		events, last := truncateAtLastTs(tt.events, at)
+		if len(events) != tt.wantLen {
+			t.Errorf("%s: kept %d events, want %d", tt.name, len(events), tt.wantLen)
+		}
+		if tt.wantEmpty {
+			if !last.IsZero() {
+				t.Errorf("%s: last = %v, want zero", tt.name, last)
+			}
+		} else if !last.Equal(at(tt.wantLast)) {
+			t.Errorf("%s: last = %v, want %v", tt.name, last.Sub(testBase), tt.wantLast)
+		}
+	}
+}
@@ -11,7 +11,7 @@ import (
 	"time"
 
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"                  // Ensure pq driver is registered
+	"github.com/lib/pq"                    // Ensure pq driver is registered
 	goredis "github.com/redis/go-redis/v9" // Import pq for potential error checking if needed, though not strictly required by the rewrite logic itself
 )
 
@@ -32,8 +32,15 @@ var (
 	ackedMessageIDsLock sync.Mutex
 )
 
+// EventObserver receives every decoded event in addition to it being inserted into TimescaleDB.
+// Used by in-memory analyzers that need to follow events as they arrive.
+// ObserveEvent is called concurrently from all consumers and must not block.
+type EventObserver interface {
+	ObserveEvent(topic string, eventData map[string]interface{})
+}
+
 // Receive reads messages from Redis Stream and inserts them into TimescaleDB.
-func Receive(ctx context.Context, wg *sync.WaitGroup, tsdb *sqlx.DB, redisClient *goredis.Client, verbose bool, consumerID int) {
+func Receive(ctx context.Context, wg *sync.WaitGroup, tsdb *sqlx.DB, redisClient *goredis.Client, verbose bool, consumerID int, observers ...EventObserver) {
 	defer wg.Done()
 
 	ackedMessageIDsLock.Lock()
@@ -91,7 +98,7 @@ func Receive(ctx context.Context, wg *sync.WaitGroup, tsdb *sqlx.DB, redisClient
 						log.Printf("Consumer %s received %d messages from stream %s", consumerName, len(stream.Messages), stream.Stream)
 					}
 					// Process the batch and get IDs that were successfully processed (or attempted)
-					processMessages(ctx, tsdb, stream.Messages, verbose)
+					processMessages(ctx, tsdb, stream.Messages, verbose, observers)
 
 					// Acknowledge successfully processed messages
 					ackedMessageIDsLock.Lock()
@@ -107,7 +114,7 @@ func Receive(ctx context.Context, wg *sync.WaitGroup, tsdb *sqlx.DB, redisClient
 
 // processMessages processes a batch of messages from Redis Stream and inserts them into TimescaleDB.
 // It returns a slice of message IDs that were processed (successfully or unsuccessfully attempted within the transaction).
-func processMessages(ctx context.Context, tsdb *sqlx.DB, messages []goredis.XMessage, verbose bool) {
+func processMessages(ctx context.Context, tsdb *sqlx.DB, messages []goredis.XMessage, verbose bool, observers []EventObserver) {
 	var tx *sqlx.Tx
 	var err error // Declare err outside loop for deferred rollback check
 
@@ -197,6 +204,21 @@ func processMessages(ctx context.Context, tsdb *sqlx.DB, messages []goredis.XMes
 		return sql.NullInt32{Valid: false}
 	}
 
+	// Helper function to get the symbolized user stack as a TEXT[] value (NULL when absent)
+	getStack := func(data map[string]interface{}) pq.StringArray {
+		frames, ok := data["stack"].([]interface{})
+		if !ok || len(frames) == 0 {
+			return nil
+		}
+		stack := make(pq.StringArray, 0, len(frames))
+		for _, frame := range frames {
+			if name, ok := frame.(string); ok {
+				stack = append(stack, name)
+			}
+		}
+		return stack
+	}
+
 	// Begin transaction
 	tx, err = tsdb.BeginTxx(ctx, nil)
 	if err != nil {
@@ -235,10 +257,12 @@ func processMessages(ctx context.Context, tsdb *sqlx.DB, messages []goredis.XMes
 	// Prepare events_os statement
 	osStmt, err := tx.PreparexContext(ctx, `
 		INSERT INTO events_os (
-			ts, machine_id, event_subtype, pid, comm, cmdline, vfs_filename,
-			syscall_name, cpu, sched_type, ppid, ppid_comm, ppid_cmdline,
+			ts, machine_id, event_subtype, pid, comm, cmdline, proc_uid, container_id, cgroup, pod_uid,
+			uid, euid, gid, username, mnt_ns, pid_ns, exe_path, exe_inode, exe_build_id, exe_deleted, vfs_filename,
+			syscall_name, cpu, sched_type, tgid, ppid, ppid_comm, ppid_cmdline,
 			exec_filename, exec_args
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`)
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20,
+			$21, $22, $23, $24, $25, $26, $27, $28, $29, $30)`)
 	if err != nil {
 		log.Printf("Error preparing OS statement: %v", err)
 		return // Cannot proceed
@@ -248,12 +272,14 @@ func processMessages(ctx context.Context, tsdb *sqlx.DB, messages []goredis.XMes
 	// Prepare events_cuda statement
 	cudaStmt, err := tx.PreparexContext(ctx, `
 		INSERT INTO events_cuda (
-			ts, machine_id, event_subtype, pid, comm, cmdline, operation,
+			ts, machine_id, event_subtype, pid, comm, cmdline, proc_uid, container_id, cgroup, pod_uid,
+			uid, euid, gid, username, mnt_ns, pid_ns, exe_path, exe_inode, exe_build_id, exe_deleted, operation,
 			cuda_ptr, cuda_size, cuda_retval, cuda_func_ptr, cuda_symbol_name,
-			cuda_symbol_file, cuda_symbol_offset, cuda_symbol_sourcefile,
+			cuda_symbol_file, cuda_symbol_offset, cuda_symbol_sourcefile, cuda_symbol_build_id, cuda_symbol_addr,
 			cuda_memcpy_src, cuda_memcpy_dst, cuda_memcpy_kind, cuda_memcpy_type,
-			cuda_sync_duration_ns
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)`)
+			cuda_memcpy_duration_ns, cuda_sync_duration_ns, stack
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25,
+			$26, $27, $28, $29, $30, $31, $32, $33, $34, $35, $36, $37, $38)`)
 	if err != nil {
 		log.Printf("Error preparing CUDA statement: %v", err)
 		return // Cannot proceed
@@ -263,11 +289,13 @@ func processMessages(ctx context.Context, tsdb *sqlx.DB, messages []goredis.XMes
 	// Prepare events_ggml statement
 	ggmlStmt, err := tx.PreparexContext(ctx, `
 		INSERT INTO events_ggml (
-			ts, machine_id, event_subtype, pid, comm, cmdline, operation,
+			ts, machine_id, event_subtype, pid, comm, cmdline, proc_uid, container_id, cgroup, pod_uid,
+			uid, euid, gid, username, mnt_ns, pid_ns, exe_path, exe_inode, exe_build_id, exe_deleted, operation,
 			ggml_cuda_func_name, ggml_cuda_duration_ns, ggml_graph_size,
 			ggml_graph_nodes, ggml_graph_leafs, ggml_graph_order, ggml_cost_ns,
-			ggml_mem_size, ggml_mem_ptr
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)`)
+			ggml_mem_size, ggml_mem_ptr, stack
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20,
+			$21, $22, $23, $24, $25, $26, $27, $28, $29, $30, $31)`)
 	if err != nil {
 		log.Printf("Error preparing GGML statement: %v", err)
 		return // Cannot proceed
@@ -277,14 +305,37 @@ func processMessages(ctx context.Context, tsdb *sqlx.DB, messages []goredis.XMes
 	// Prepare events_app_log statement
 	appLogStmt, err := tx.PreparexContext(ctx, `
 		INSERT INTO events_app_log (
-			ts, machine_id, event_subtype, pid, comm, cmdline, log_text
-		) VALUES ($1, $2, $3, $4, $5, $6, $7)`)
+			ts, machine_id, event_subtype, pid, comm, cmdline, proc_uid, container_id, cgroup, pod_uid,
+			uid, euid, gid, username, mnt_ns, pid_ns, exe_path, exe_inode, exe_build_id, exe_deleted, log_text
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)`)
 	if err != nil {
 		log.Printf("Error preparing AppLog statement: %v", err)
 		return // Cannot proceed
 	}
 	defer appLogStmt.Close()
 
+	// Prepare syscall_rollups statement
+	syscallRollupStmt, err := tx.PreparexContext(ctx, `
+		INSERT INTO syscall_rollups (
+			ts, machine_id, pid, comm, cmdline, proc_uid, container_id, cgroup, pod_uid, syscall_name, interval_ns, count
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`)
+	if err != nil {
+		log.Printf("Error preparing syscall rollup statement: %v", err)
+		return // Cannot proceed
+	}
+	defer syscallRollupStmt.Close()
+
+	// Prepare event_rollups statement
+	eventRollupStmt, err := tx.PreparexContext(ctx, `
+		INSERT INTO event_rollups (
+			ts, machine_id, rule_name, event_topic, pid, comm, proc_uid, container_id, cgroup, pod_uid, group_values, interval_ns, count
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`)
+	if err != nil {
+		log.Printf("Error preparing event rollup statement: %v", err)
+		return // Cannot proceed
+	}
+	defer eventRollupStmt.Close()
+
 	// --- Process each message in the batch ---
 	for _, msg := range messages {
 		// Add message ID to processed list early, even if insertion fails,
@@ -310,6 +361,22 @@ func processMessages(ctx context.Context, tsdb *sqlx.DB, messages []goredis.XMes
 		pid, pidOk := getInt32(eventData, "pid") // Use getInt32
 		comm := getNullString(eventData, "comm")
 		cmdline := getNullString(eventData, "cmdline")
+		procUID := getNullString(eventData, "proc_uid") // 进程已退出时 agent 无法读取启动时间，为 NULL
+		containerID := getNullString(eventData, "container_id")
+		cgroup := getNullString(eventData, "cgroup")
+		podUID := getNullString(eventData, "pod_uid")
+		// 进程身份，agent 无法读取 /proc 时为 NULL；只写入事件表，汇总表不需要
+		uid := getNullInt32(eventData, "uid")
+		euid := getNullInt32(eventData, "euid")
+		gid := getNullInt32(eventData, "gid")
+		username := getNullString(eventData, "username")
+		mntNS := getNullInt64(eventData, "mnt_ns")
+		pidNS := getNullInt64(eventData, "pid_ns")
+		exePath := getNullString(eventData, "exe")
+		exeInode := getNullInt64(eventData, "exe_inode")
+		exeBuildID := getNullString(eventData, "exe_build_id")
+		exeDeleted, _ := eventData["exe_deleted"].(bool)
+		exeDeletedValue := sql.NullBool{Bool: exeDeleted, Valid: exePath.Valid} // agent 只在为 true 时上报
 
 		// Basic validation: topic, timestamp, machineID, pid are usually essential
 		if !topicOk || !tsOk || !machineIDOk || !pidOk {
@@ -320,6 +387,10 @@ func processMessages(ctx context.Context, tsdb *sqlx.DB, messages []goredis.XMes
 		// Convert timestamp to time.Time (UTC)
 		ts := time.Unix(0, timestampNs).UTC()
 
+		for _, observer := range observers {
+			observer.ObserveEvent(topic, eventData)
+		}
+
 		// --- Insert into appropriate table based on topic ---
 		switch topic {
 		// OS events
@@ -328,6 +399,7 @@ func processMessages(ctx context.Context, tsdb *sqlx.DB, messages []goredis.XMes
 			syscallName := getNullString(eventData, "syscall")      // Used by syscalls
 			cpu := getNullInt32(eventData, "cpu")                   // Used by sched
 			schedType := getNullString(eventData, "type")           // Used by sched (processor already converts to string)
+			tgid := getNullInt32(eventData, "tgid")                 // Used by sched (pid is a thread id there)
 			ppid := getNullInt32(eventData, "ppid")                 // Used by execv
 			ppidComm := getNullString(eventData, "ppid_comm")       // Used by execv
 			ppidCmdline := getNullString(eventData, "ppid_cmdline") // Used by execv
@@ -337,15 +409,23 @@ func processMessages(ctx context.Context, tsdb *sqlx.DB, messages []goredis.XMes
 			if topic == "execv" {
 				execFilename = getNullString(eventData, "filename")
 				execArgs = getNullString(eventData, "args")
+				// Processor reports the new process as pid_comm / pid_cmdline
+				if !comm.Valid {
+					comm = getNullString(eventData, "pid_comm")
+				}
+				if !cmdline.Valid {
+					cmdline = getNullString(eventData, "pid_cmdline")
+				}
 				// Clear vfsFilename if it's an execv event to avoid confusion
 				vfsFilename = sql.NullString{Valid: false}
 			}
 
 			_, err = osStmt.ExecContext(ctx,
-				ts, machineID, topic, int(pid), comm, cmdline, // Common fields first
-				vfsFilename,    // vfs_open specific
-				syscallName,    // syscalls specific
-				cpu, schedType, // sched specific
+				ts, machineID, topic, int(pid), comm, cmdline, procUID, containerID, cgroup, podUID, // Common fields first
+				uid, euid, gid, username, mntNS, pidNS, exePath, exeInode, exeBuildID, exeDeletedValue, // Identity
+				vfsFilename,          // vfs_open specific
+				syscallName,          // syscalls specific
+				cpu, schedType, tgid, // sched specific
 				ppid, ppidComm, ppidCmdline, // execv specific (ppid info)
 				execFilename, execArgs, // execv specific (exec info)
 			)
@@ -373,6 +453,8 @@ func processMessages(ctx context.Context, tsdb *sqlx.DB, messages []goredis.XMes
 			cudaSymbolFile := getNullString(eventData, "symbol_file")
 			cudaSymbolOffset := getNullInt64(eventData, "symbol_offset")
 			cudaSymbolSourcefile := getNullString(eventData, "symbol_sourcefile")
+			cudaSymbolBuildID := getNullString(eventData, "symbol_build_id")
+			cudaSymbolAddr := getNullInt64(eventData, "symbol_addr")
 
 			// Memcpy specific
 			cudaMemcpySrc := getNullInt64(eventData, "src")
@@ -380,15 +462,23 @@ func processMessages(ctx context.Context, tsdb *sqlx.DB, messages []goredis.XMes
 			cudaMemcpyKind := getNullInt32(eventData, "kind")  // Processor maps to int32, schema is INT
 			cudaMemcpyType := getNullString(eventData, "type") // Processor adds this string type
 
-			// Sync specific
-			cudaSyncDurationNs := getNullInt64(eventData, "duration_ns")
+			// Memcpy and Sync both report "duration_ns"; store it in the column of the topic
+			var cudaMemcpyDurationNs, cudaSyncDurationNs sql.NullInt64
+			if topic == "cudaMemcpy" {
+				cudaMemcpyDurationNs = getNullInt64(eventData, "duration_ns")
+			} else {
+				cudaSyncDurationNs = getNullInt64(eventData, "duration_ns")
+			}
 
 			_, err = cudaStmt.ExecContext(ctx,
-				ts, machineID, topic, int(pid), comm, cmdline, operation, // Common + operation
+				ts, machineID, topic, int(pid), comm, cmdline, procUID, containerID, cgroup, podUID, // Common fields
+				uid, euid, gid, username, mntNS, pidNS, exePath, exeInode, exeBuildID, exeDeletedValue, // Identity
+				operation,
 				cudaPtr, cudaSize, cudaRetval, cudaFuncPtr, // Malloc, Free, LaunchKernel specifics
-				cudaSymbolName, cudaSymbolFile, cudaSymbolOffset, cudaSymbolSourcefile, // LaunchKernel specifics
-				cudaMemcpySrc, cudaMemcpyDst, cudaMemcpyKind, cudaMemcpyType, // Memcpy specifics
+				cudaSymbolName, cudaSymbolFile, cudaSymbolOffset, cudaSymbolSourcefile, cudaSymbolBuildID, cudaSymbolAddr, // LaunchKernel specifics
+				cudaMemcpySrc, cudaMemcpyDst, cudaMemcpyKind, cudaMemcpyType, cudaMemcpyDurationNs, // Memcpy specifics
 				cudaSyncDurationNs, // Sync specific
+				getStack(eventData),
 			)
 			if err != nil {
 				log.Printf("Error inserting CUDA event (topic: %s, msgID: %s): %v", topic, msg.ID, err)
@@ -414,10 +504,13 @@ func processMessages(ctx context.Context, tsdb *sqlx.DB, messages []goredis.XMes
 			ggmlMemPtr := getNullInt64(eventData, "ptr")   // Map eventData["ptr"] to ggml_mem_ptr
 
 			_, err = ggmlStmt.ExecContext(ctx,
-				ts, machineID, topic, int(pid), comm, cmdline, operation, // Common + operation
+				ts, machineID, topic, int(pid), comm, cmdline, procUID, containerID, cgroup, podUID, // Common fields
+				uid, euid, gid, username, mntNS, pidNS, exePath, exeInode, exeBuildID, exeDeletedValue, // Identity
+				operation,
 				ggmlCudaFuncName, ggmlCudaDurationNs, // ggml_cuda specific
 				ggmlGraphSize, ggmlGraphNodes, ggmlGraphLeafs, ggmlGraphOrder, ggmlCostNs, // ggml_graph_compute specific
 				ggmlMemSize, ggmlMemPtr, // ggml_base specific
+				getStack(eventData),
 			)
 			if err != nil {
 				log.Printf("Error inserting GGML event (topic: %s, msgID: %s): %v", topic, msg.ID, err)
@@ -428,13 +521,49 @@ func processMessages(ctx context.Context, tsdb *sqlx.DB, messages []goredis.XMes
 			logText := getNullString(eventData, "text")
 
 			_, err = appLogStmt.ExecContext(ctx,
-				ts, machineID, topic, int(pid), comm, cmdline, // Common fields
+				ts, machineID, topic, int(pid), comm, cmdline, procUID, containerID, cgroup, podUID, // Common fields
+				uid, euid, gid, username, mntNS, pidNS, exePath, exeInode, exeBuildID, exeDeletedValue, // Identity
 				logText, // AppLog specific
 			)
 			if err != nil {
 				log.Printf("Error inserting App Log event (topic: %s, msgID: %s): %v", topic, msg.ID, err)
 			}
 
+		// Syscall rollups produced by the agent
+		case "syscalls_agg":
+			syscallName := getNullString(eventData, "syscall")
+			intervalNs := getNullInt64(eventData, "interval_ns")
+			count, _ := getInt64(eventData, "count")
+
+			_, err = syscallRollupStmt.ExecContext(ctx,
+				ts, machineID, int(pid), comm, cmdline, procUID, containerID, cgroup, podUID, // Common fields
+				syscallName, intervalNs, count, // Rollup specific
+			)
+			if err != nil {
+				log.Printf("Error inserting syscall rollup (msgID: %s): %v", msg.ID, err)
+			}
+
+		// Rollups produced by the agent's aggregate rules
+		case "rule_agg":
+			ruleName, _ := getString(eventData, "rule")
+			eventTopic, _ := getString(eventData, "event_topic")
+			intervalNs := getNullInt64(eventData, "interval_ns")
+			count, _ := getInt64(eventData, "count")
+			groupValues := sql.NullString{}
+			if group, ok := eventData["group"]; ok {
+				if groupJSON, jsonErr := json.Marshal(group); jsonErr == nil {
+					groupValues = sql.NullString{String: string(groupJSON), Valid: true}
+				}
+			}
+
+			_, err = eventRollupStmt.ExecContext(ctx,
+				ts, machineID, ruleName, eventTopic, int(pid), comm, procUID, containerID, cgroup, podUID,
+				groupValues, intervalNs, count,
+			)
+			if err != nil {
+				log.Printf("Error inserting event rollup (msgID: %s): %v", msg.ID, err)
+			}
+
 		default:
 			if verbose {
 				log.Printf("Unknown event topic '%s' encountered in message ID: %s, skipping insertion.", topic, msg.ID)
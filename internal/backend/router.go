@@ -11,12 +11,17 @@ import (
 	authMiddleware "scope/internal/middleware"
 )
 
+// corsAllowedHeaders 是跨域请求允许携带的请求头
+var corsAllowedHeaders = []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", authMiddleware.AdminTokenHeader}
+
 // SetupRouter 配置认证API的路由
-func SetupRouter(handler *Handler, authMiddleware *authMiddleware.AuthMiddleware) *chi.Mux {
+// 签发加入令牌和删除节点除了用户登录外还要求管理员密钥 (见 adminMiddleware)。
+func SetupRouter(handler *Handler, authMiddleware *authMiddleware.AuthMiddleware, adminMiddleware *authMiddleware.AdminMiddleware) *chi.Mux {
 	r := chi.NewRouter()
 
 	// 全局中间件
 	r.Use(middleware.RequestID)
+	r.Use(PeerAddr) // 必须在 RealIP 之前
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
@@ -29,7 +34,7 @@ func SetupRouter(handler *Handler, authMiddleware *authMiddleware.AuthMiddleware
 		AllowedOrigins: []string{"https://*", "http://*"},
 		// AllowOriginFunc:  func(r *http.Request, origin string) bool { return true },
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		AllowedHeaders:   corsAllowedHeaders,
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: false,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
@@ -55,15 +60,68 @@ func SetupRouter(handler *Handler, authMiddleware *authMiddleware.AuthMiddleware
 	})
 
 	r.Route("/api/v1/node", func(r chi.Router) {
+		r.Post("/enroll", handler.nodeHandler.NodeEnroll)
 		r.Post("/up", handler.nodeHandler.NodeUp)
 		r.Post("/down", handler.nodeHandler.NodeDown)
+		r.Post("/heartbeat", handler.nodeHandler.NodeHeartbeat)
 
 		r.Group(func(r chi.Router) {
 			r.Use(authMiddleware.Authenticate)
 			r.Get("/list", handler.nodeHandler.NodeList)
+			r.Get("/inventory", handler.nodeHandler.NodeInventoryList)
+			r.Get("/{id}/inventory", handler.nodeHandler.NodeInventory)
+
+			// 删除节点会吊销其凭据，持有加入令牌可以注册任意节点 ID，只允许管理员操作
+			r.Group(func(r chi.Router) {
+				r.Use(adminMiddleware.RequireAdmin)
+				r.Delete("/{id}", handler.nodeHandler.DeleteNode)
+				r.Post("/join-tokens", handler.nodeHandler.CreateJoinToken)
+				r.Get("/join-tokens", handler.nodeHandler.ListJoinTokens)
+				r.Delete("/join-tokens/{id}", handler.nodeHandler.DeleteJoinToken)
+			})
 		})
 	})
 
+	r.Route("/api/v1/trace", func(r chi.Router) {
+		r.Use(authMiddleware.Authenticate)
+		r.Get("/chrome", handler.traceHandler.ExportChromeTrace)
+	})
+
+	r.Route("/api/v1/analysis", func(r chi.Router) {
+		r.Use(authMiddleware.Authenticate)
+		r.Get("/cuda/memory", handler.cudaMemHandler.AnalyzeCudaMemory)
+		r.Get("/cuda/memory/findings", handler.cudaMemHandler.ListCudaMemFindings)
+		r.Get("/cuda/kernels", handler.kernelHandler.GetCudaKernelProfile)
+		r.Get("/cuda/kernels/diff", handler.kernelHandler.DiffCudaKernelProfiles)
+		r.Get("/cuda/memcpy", handler.memcpyHandler.AnalyzeCudaMemcpy)
+		r.Get("/processes/ancestry", handler.processHandler.GetProcessAncestry)
+		r.Get("/processes/descendants", handler.processHandler.GetProcessDescendants)
+		r.Get("/sched", handler.schedHandler.GetSchedReport)
+		r.Get("/sched/timeline", handler.schedHandler.GetSchedTimeline)
+		r.Get("/syscalls", handler.syscallHandler.GetSyscallProfile)
+		r.Get("/syscalls/anomalies", handler.syscallHandler.GetSyscallAnomalies)
+		r.Get("/files", handler.fileHandler.GetFileAccess)
+		r.Get("/files/openers", handler.fileHandler.GetFileOpeners)
+		r.Get("/flamegraph", handler.flameHandler.GetFlameGraph)
+		r.Get("/ggml/heap", handler.ggmlHeapHandler.GetGGMLHeap)
+		r.Get("/ggml/heap/stream", handler.ggmlHeapHandler.StreamGGMLHeap)
+		r.Get("/inference/sessions", handler.inferenceHandler.ListInferenceSessions)
+		r.Post("/inference/sessions/rebuild", handler.inferenceHandler.RebuildInferenceSessions)
+	})
+
+	r.Route("/api/v1/symbols", func(r chi.Router) {
+		r.Use(authMiddleware.Authenticate)
+		r.Get("/", handler.symbolHandler.ListSymbolFiles)
+		r.Post("/", handler.symbolHandler.UploadSymbolFile)
+		r.Get("/lookup", handler.symbolHandler.LookupSymbol)
+	})
+
+	r.Route("/api/v1/metrics", func(r chi.Router) {
+		r.Use(authMiddleware.Authenticate)
+		r.Get("/llm/requests", handler.metricsHandler.ListLLMRequestMetrics)
+		r.Get("/llm/series", handler.metricsHandler.GetLLMMetricsSeries)
+	})
+
 	// 新增的/apis路由，返回所有路由信息
 	r.Get("/apis", func(w http.ResponseWriter, req *http.Request) {
 		type RouteInfo struct {
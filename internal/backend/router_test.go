@@ -0,0 +1,83 @@
+package backend
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	authMiddleware "scope/internal/middleware"
+)
+
+func TestNodeAdminRoutes(t *testing.T) {
+	tokenService := authMiddleware.NewTokenService(authMiddleware.TokenConfig{
+		AccessTokenSecret: "access",
+		AccessTokenExpiry: time.Minute,
+	})
+	userToken, _, err := tokenService.GenerateAccessToken("u1", "user@example.com")
+	if err != nil {
+		t.Fatalf("GenerateAccessToken: %v", err)
+	}
+	router := SetupRouter(&Handler{}, authMiddleware.NewAuthMiddleware(tokenService), authMiddleware.NewAdminMiddleware("admin-secret"))
+
+	routes := []struct{ method, path string }{
+		{http.MethodDelete, "/api/v1/node/n1"},
+		{http.MethodPost, "/api/v1/node/join-tokens"},
+		{http.MethodGet, "/api/v1/node/join-tokens"},
+		{http.MethodDelete, "/api/v1/node/join-tokens/t1"},
+	}
+	for _, route := range routes {
+		tests := []struct {
+			name       string
+			auth       string
+			adminToken string
+			want       int
+		}{
+			{"anonymous", "", "", http.StatusUnauthorized},
+			// 自行注册的普通用户不能签发加入令牌或删除节点
+			{"normal user", "Bearer " + userToken, "", http.StatusForbidden},
+			{"wrong admin token", "Bearer " + userToken, "guess", http.StatusForbidden},
+		}
+		for _, tt := range tests {
+			r := httptest.NewRequest(route.method, route.path, nil)
+			if tt.auth != "" {
+				r.Header.Set("Authorization", tt.auth)
+			}
+			if tt.adminToken != "" {
+				r.Header.Set(authMiddleware.AdminTokenHeader, tt.adminToken)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("%s %s as %s: got %d, want %d", route.method, route.path, tt.name, w.Code, tt.want)
+			}
+		}
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	tests := []struct {
+		name       string
+		secret     string
+		adminToken string
+		want       int
+	}{
+		{"admin", "admin-secret", "admin-secret", http.StatusNoContent},
+		{"missing header", "admin-secret", "", http.StatusForbidden},
+		{"wrong token", "admin-secret", "admin-secreT", http.StatusForbidden},
+		// 没有配置 ADMIN_TOKEN 时管理接口不可用，空请求头也不能通过
+		{"not configured", "", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/node/join-tokens", nil)
+		if tt.adminToken != "" {
+			r.Header.Set(authMiddleware.AdminTokenHeader, tt.adminToken)
+		}
+		w := httptest.NewRecorder()
+		authMiddleware.NewAdminMiddleware(tt.secret).RequireAdmin(next).ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package backend
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"scope/database/postgres"
+	"scope/internal/models"
+)
+
+// schedSyncOffCPURatio cudaDeviceSynchronize 等待期间调用线程离开 CPU 的时间达到等待时长的该比例时，
+// 认为该次同步被调度出去 (阻塞式同步或 CPU 争用)，而不是在 CPU 上自旋等待
+const schedSyncOffCPURatio = 0.1
+
+// SchedSlice 是一个线程的一段在 CPU 上运行的区间 (switch_in 到 switch_out)
+type SchedSlice struct {
+	TID   int32     `json:"tid"`
+	CPU   int32     `json:"cpu"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// SchedSyncWait 是一次 cudaDeviceSynchronize 等待期间调用线程的调度情况
+type SchedSyncWait struct {
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	TID         int32     `json:"tid"` // 推断的调用线程，0 表示等待开始时没有该进程的线程在 CPU 上，无法判断
+	OffCPUNs    int64     `json:"off_cpu_ns"`
+	Descheduled bool      `json:"descheduled"`
+}
+
+// SchedProcessStats 是一个进程 (所有线程合计) 在窗口内的调度统计
+type SchedProcessStats struct {
+	PID        int32   `json:"pid"`
+	Comm       string  `json:"comm"`
+	Threads    int     `json:"threads"`
+	CPUTimeNs  int64   `json:"cpu_time_ns"`
+	CPUUsage   float64 `json:"cpu_usage"` // CPUTimeNs / 窗口长度，多线程时可以大于 1
+	Slices     int64   `json:"slices"`
+	Migrations int64   `json:"migrations"` // 线程相邻两次运行位于不同 CPU 的次数
+	SyncWaits  int64   `json:"sync_waits"`
+	SyncWaitNs int64   `json:"sync_wait_ns"`
+	// 同步等待期间调用线程不在 CPU 上的时间，以及被调度出去的同步次数
+	SyncOffCPUNs          int64 `json:"sync_off_cpu_ns"`
+	SyncDescheduled       int64 `json:"sync_descheduled"`
+	DescheduledDuringSync bool  `json:"descheduled_during_sync"`
+}
+
+// SchedCPUStats 是一个 CPU 在窗口内被已采集进程占用的情况
+type SchedCPUStats struct {
+	CPU         int32   `json:"cpu"`
+	BusyNs      int64   `json:"busy_ns"`
+	Utilization float64 `json:"utilization"`
+	Slices      int64   `json:"slices"`
+	Processes   int     `json:"processes"`
+}
+
+// SchedReport 是一台机器在一个时间窗口内的调度分析结果
+type SchedReport struct {
+	MachineID string              `json:"machine_id"`
+	Start     time.Time           `json:"start"`
+	End       time.Time           `json:"end"`
+	Unpaired  int64               `json:"unpaired"` // 无法配对的 switch 事件数 (事件丢失)
+	CPUs      []SchedCPUStats     `json:"cpus"`
+	Processes []SchedProcessStats `json:"processes"`
+}
+
+// SchedTimeline 是单个进程的运行区间和同步等待时间线
+type SchedTimeline struct {
+	MachineID string          `json:"machine_id"`
+	PID       int32           `json:"pid"`
+	Comm      string          `json:"comm"`
+	Start     time.Time       `json:"start"`
+	End       time.Time       `json:"end"`
+	Slices    []SchedSlice    `json:"slices"`
+	SyncWaits []SchedSyncWait `json:"sync_waits"`
+}
+
+// SchedService 基于 sched_switch 事件生成 CPU 调度分析
+type SchedService struct {
+	eventStore *postgres.EventStore
+}
+
+// loadEvents 读取窗口内的 sched 事件和 cudaDeviceSynchronize 事件
+func (s *SchedService) loadEvents(ctx context.Context, filter postgres.EventFilter) ([]models.OSEvent, []models.CudaEvent, error) {
+	sched, err := s.eventStore.ListSchedEvents(ctx, filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	syncFilter := filter
+	syncFilter.Subtypes = []string{models.CudaSyncTopic}
+	syncs, err := s.eventStore.ListCudaEvents(ctx, syncFilter)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sched, syncs, nil
+}
+
+// Analyze 统计窗口内每个进程的 CPU 时间、迁移次数和同步等待期间的调度情况，以及每个 CPU 的占用率。
+// 指定 pids 时 CPU 占用率只包含这些进程。
+func (s *SchedService) Analyze(ctx context.Context, filter postgres.EventFilter) (*SchedReport, error) {
+	sched, syncs, err := s.loadEvents(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	return analyzeSched(filter.MachineID, sched, syncs, filter.Start, filter.End), nil
+}
+
+// Timeline 返回单个进程的运行区间和同步等待，没有该进程的 sched 事件时返回 nil
+func (s *SchedService) Timeline(ctx context.Context, filter postgres.EventFilter, pid int32) (*SchedTimeline, error) {
+	filter.PIDs = []int32{pid}
+	sched, syncs, err := s.loadEvents(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	procs, _ := pairSchedEvents(sched, filter.Start, filter.End)
+	p, ok := procs[pid]
+	if !ok {
+		return nil, nil
+	}
+	timeline := &SchedTimeline{
+		MachineID: filter.MachineID,
+		PID:       pid,
+		Comm:      p.comm,
+		Start:     filter.Start,
+		End:       filter.End,
+		SyncWaits: p.syncWaits(syncs),
+	}
+	for _, slices := range p.threads {
+		timeline.Slices = append(timeline.Slices, slices...)
+	}
+	sort.Slice(timeline.Slices, func(i, j int) bool {
+		a, b := timeline.Slices[i], timeline.Slices[j]
+		if !a.Start.Equal(b.Start) {
+			return a.Start.Before(b.Start)
+		}
+		return a.TID < b.TID
+	})
+	return timeline, nil
+}
+
+// schedProcess 是一个进程按线程分组的运行区间
+type schedProcess struct {
+	pid     int32
+	comm    string
+	threads map[int32][]SchedSlice // tid -> 按时间升序的运行区间
+	comms   map[int32]string       // tid -> 线程名
+}
+
+// pairSchedEvents 把按时间升序排列的 switch_in/switch_out 事件按线程配对为运行区间，并按所属进程分组。
+//
+// 窗口开始前已在运行的线程，其第一个事件为 switch_out，区间从 start 开始；窗口结束时仍在运行的线程，
+// 区间截止到 end。连续两次 switch_in、或 CPU 不一致的 switch_out 说明中间有事件丢失，计入 unpaired。
+func pairSchedEvents(events []models.OSEvent, start, end time.Time) (map[int32]*schedProcess, int64) {
+	type threadState struct {
+		seen    bool
+		running bool
+		cpu     int32
+		since   time.Time
+		process *schedProcess
+	}
+
+	procs := make(map[int32]*schedProcess)
+	threads := make(map[int32]*threadState)
+	var unpaired int64
+
+	emit := func(t *threadState, tid, cpu int32, from, to time.Time) {
+		if to.After(from) {
+			t.process.threads[tid] = append(t.process.threads[tid], SchedSlice{TID: tid, CPU: cpu, Start: from, End: to})
+		}
+	}
+
+	for _, e := range events {
+		pid := e.Tgid
+		if pid == 0 {
+			pid = e.PID
+		}
+		p, ok := procs[pid]
+		if !ok {
+			p = &schedProcess{pid: pid, comm: e.Comm, threads: make(map[int32][]SchedSlice), comms: make(map[int32]string)}
+			procs[pid] = p
+		}
+		if e.PID == pid {
+			// 主线程的 comm 即进程名
+			p.comm = e.Comm
+		}
+		p.comms[e.PID] = e.Comm
+		t, ok := threads[e.PID]
+		if !ok {
+			t = &threadState{process: p}
+			threads[e.PID] = t
+		}
+
+		switch e.SchedType {
+		case "switch_in":
+			if t.running {
+				unpaired++
+			}
+			t.running, t.cpu, t.since = true, e.Cpu, e.Ts
+		case "switch_out":
+			switch {
+			case t.running && t.cpu == e.Cpu:
+				emit(t, e.PID, e.Cpu, t.since, e.Ts)
+			case !t.seen:
+				emit(t, e.PID, e.Cpu, start, e.Ts)
+			default:
+				unpaired++
+			}
+			t.running = false
+		default:
+			continue
+		}
+		t.seen = true
+	}
+
+	for tid, t := range threads {
+		if t.running {
+			emit(t, tid, t.cpu, t.since, end)
+		}
+	}
+	return procs, unpaired
+}
+
+// onCPUWithin 返回 slices 在 [from, to] 内的运行时间。slices 需按时间升序排列且互不重叠。
+func onCPUWithin(slices []SchedSlice, from, to time.Time) time.Duration {
+	var total time.Duration
+	for i := sort.Search(len(slices), func(i int) bool { return slices[i].End.After(from) }); i < len(slices) && slices[i].Start.Before(to); i++ {
+		s, e := slices[i].Start, slices[i].End
+		if s.Before(from) {
+			s = from
+		}
+		if e.After(to) {
+			e = to
+		}
+		total += e.Sub(s)
+	}
+	return total
+}
+
+// syncWaits 计算进程每次 cudaDeviceSynchronize 等待期间调用线程的离开 CPU 时间。
+//
+// CUDA 事件只记录进程 ID，调用线程取等待开始时正在 CPU 上运行的线程 (有同名线程时只考虑同名线程)；
+// 有多个候选时取等待期间运行时间最长的一个，避免把其他线程的正常调度误判为同步被调度出去。
+func (p *schedProcess) syncWaits(syncs []models.CudaEvent) []SchedSyncWait {
+	var waits []SchedSyncWait
+	for _, e := range syncs {
+		if e.PID != p.pid || e.CudaSyncDurationNs <= 0 {
+			continue
+		}
+		wait := SchedSyncWait{Start: e.Ts.Add(-time.Duration(e.CudaSyncDurationNs)), End: e.Ts}
+
+		var candidates, sameComm []int32
+		for tid, slices := range p.threads {
+			if onCPUWithin(slices, wait.Start, wait.Start.Add(time.Nanosecond)) > 0 {
+				candidates = append(candidates, tid)
+				if e.Comm != "" && p.comms[tid] == e.Comm {
+					sameComm = append(sameComm, tid)
+				}
+			}
+		}
+		if len(sameComm) > 0 {
+			candidates = sameComm
+		}
+		sort.Slice(candidates, func(i, j int) bool { return candidates[i] < candidates[j] })
+
+		var best time.Duration = -1
+		for _, tid := range candidates {
+			if on := onCPUWithin(p.threads[tid], wait.Start, wait.End); on > best {
+				best = on
+				wait.TID = tid
+			}
+		}
+		if wait.TID != 0 {
+			wait.OffCPUNs = e.CudaSyncDurationNs - best.Nanoseconds()
+			wait.Descheduled = float64(wait.OffCPUNs) >= schedSyncOffCPURatio*float64(e.CudaSyncDurationNs)
+		}
+		waits = append(waits, wait)
+	}
+	return waits
+}
+
+// analyzeSched 汇总每个进程和每个 CPU 的调度统计。sched 和 syncs 需按时间升序排列。
+func analyzeSched(machineID string, sched []models.OSEvent, syncs []models.CudaEvent, start, end time.Time) *SchedReport {
+	procs, unpaired := pairSchedEvents(sched, start, end)
+	report := &SchedReport{MachineID: machineID, Start: start, End: end, Unpaired: unpaired}
+	window := end.Sub(start).Nanoseconds()
+	ratio := func(ns int64) float64 {
+		if window <= 0 {
+			return 0
+		}
+		return float64(ns) / float64(window)
+	}
+
+	cpus := make(map[int32]*SchedCPUStats)
+	cpuProcs := make(map[int32]map[int32]bool)
+	for pid, p := range procs {
+		stats := SchedProcessStats{PID: pid, Comm: p.comm, Threads: len(p.threads)}
+		for _, slices := range p.threads {
+			for i, sl := range slices {
+				ns := sl.End.Sub(sl.Start).Nanoseconds()
+				stats.CPUTimeNs += ns
+				stats.Slices++
+				if i > 0 && slices[i-1].CPU != sl.CPU {
+					stats.Migrations++
+				}
+
+				c, ok := cpus[sl.CPU]
+				if !ok {
+					c = &SchedCPUStats{CPU: sl.CPU}
+					cpus[sl.CPU] = c
+					cpuProcs[sl.CPU] = make(map[int32]bool)
+				}
+				c.BusyNs += ns
+				c.Slices++
+				cpuProcs[sl.CPU][pid] = true
+			}
+		}
+		stats.CPUUsage = ratio(stats.CPUTimeNs)
+
+		for _, w := range p.syncWaits(syncs) {
+			stats.SyncWaits++
+			stats.SyncWaitNs += w.End.Sub(w.Start).Nanoseconds()
+			stats.SyncOffCPUNs += w.OffCPUNs
+			if w.Descheduled {
+				stats.SyncDescheduled++
+			}
+		}
+		stats.DescheduledDuringSync = stats.SyncDescheduled > 0
+		report.Processes = append(report.Processes, stats)
+	}
+
+	for cpu, c := range cpus {
+		c.Utilization = ratio(c.BusyNs)
+		c.Processes = len(cpuProcs[cpu])
+		report.CPUs = append(report.CPUs, *c)
+	}
+	sort.Slice(report.CPUs, func(i, j int) bool { return report.CPUs[i].CPU < report.CPUs[j].CPU })
+	sort.Slice(report.Processes, func(i, j int) bool {
+		a, b := report.Processes[i], report.Processes[j]
+		if a.CPUTimeNs != b.CPUTimeNs {
+			return a.CPUTimeNs > b.CPUTimeNs
+		}
+		return a.PID < b.PID
+	})
+	return report
+}
@@ -0,0 +1,66 @@
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"scope/internal/models"
+)
+
+func TestAnalyzeSched(t *testing.T) {
+	sw := func(ms int, tid, tgid, cpu int32, typ string) models.OSEvent {
+		return models.OSEvent{Ts: at(time.Duration(ms) * time.Millisecond), EventSubtype: models.SchedTopic, PID: tid, Tgid: tgid, Comm: "worker", Cpu: cpu, SchedType: typ}
+	}
+	sched := []models.OSEvent{
+		sw(1000, 100, 100, 0, "switch_out"), // 窗口开始前已在运行
+		sw(1000, 101, 100, 0, "switch_in"),
+		sw(1500, 101, 100, 0, "switch_out"),
+		sw(2000, 100, 100, 1, "switch_in"), // 迁移到 cpu1
+		sw(3000, 100, 100, 1, "switch_out"),
+		sw(4000, 101, 100, 0, "switch_in"), // 运行到窗口结束
+		sw(5000, 200, 200, 1, "switch_in"),
+		sw(5200, 200, 200, 1, "switch_out"),
+		sw(7000, 100, 100, 0, "switch_in"),
+		sw(8000, 100, 100, 0, "switch_in"), // 丢失了一次 switch_out
+	}
+	syncs := []models.CudaEvent{
+		// 线程 101 在等待期间一直在 CPU 上自旋
+		{Ts: at(5 * time.Second), EventSubtype: models.CudaSyncTopic, PID: 100, CudaSyncDurationNs: (500 * time.Millisecond).Nanoseconds()},
+		// 进程 200 在等待开始后 100ms 被调度出去
+		{Ts: at(6 * time.Second), EventSubtype: models.CudaSyncTopic, PID: 200, CudaSyncDurationNs: (900 * time.Millisecond).Nanoseconds()},
+	}
+
+	report := analyzeSched("m1", sched, syncs, testBase, at(10*time.Second))
+	if report.Unpaired != 1 {
+		t.Errorf("unpaired = %d, want 1", report.Unpaired)
+	}
+	if len(report.Processes) != 2 {
+		t.Fatalf("got %d processes, want 2", len(report.Processes))
+	}
+
+	p := report.Processes[0]
+	if p.PID != 100 || p.Threads != 2 || p.CPUTimeNs != (10500*time.Millisecond).Nanoseconds() || p.Slices != 5 || p.Migrations != 2 {
+		t.Errorf("process 100 = %+v", p)
+	}
+	if p.SyncWaits != 1 || p.SyncOffCPUNs != 0 || p.DescheduledDuringSync {
+		t.Errorf("spinning sync of process 100 must not be flagged: %+v", p)
+	}
+
+	p = report.Processes[1]
+	if p.PID != 200 || p.CPUTimeNs != (200*time.Millisecond).Nanoseconds() {
+		t.Errorf("process 200 = %+v", p)
+	}
+	if p.SyncOffCPUNs != (800*time.Millisecond).Nanoseconds() || p.SyncDescheduled != 1 || !p.DescheduledDuringSync {
+		t.Errorf("process 200 should be flagged as descheduled during sync: %+v", p)
+	}
+
+	if len(report.CPUs) != 2 {
+		t.Fatalf("got %d cpus, want 2", len(report.CPUs))
+	}
+	if c := report.CPUs[0]; c.CPU != 0 || c.BusyNs != (9500*time.Millisecond).Nanoseconds() || c.Utilization != 0.95 || c.Processes != 1 {
+		t.Errorf("cpu0 = %+v", c)
+	}
+	if c := report.CPUs[1]; c.CPU != 1 || c.BusyNs != (1200*time.Millisecond).Nanoseconds() || c.Processes != 2 {
+		t.Errorf("cpu1 = %+v", c)
+	}
+}
@@ -3,6 +3,7 @@ package backend
 import (
 	"context"
 	"errors"
+	"net"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -183,10 +184,17 @@ func (s *AuthService) LogoutUser(refreshToken string) error {
 }
 
 type NodeService struct {
-	nodeStore *redis.NodeStore
+	nodeStore      *redis.NodeStore
+	agentClient    *AgentClient      // 调用 agent API，请求用节点 token 签名
+	credentialKey  string            // 加密节点凭据的 AES-256 密钥 (hex)
+	nonces         *utils.NonceCache // 节点签名请求的 nonce，防重放
+	grace          time.Duration     // 超过该时间没有心跳的节点视为离线
+	allowInsecure  bool              // 允许非本机的节点通过明文 HTTP 注册
+	trustedProxies []*net.IPNet      // 采信其 X-Forwarded-Proto 的反向代理
 }
 
-func (s *NodeService) NodeUp(ctx context.Context, node models.NodeInfo) (string, error) {
+// issueToken 为节点签发新的会话 token 并保存节点信息，token 同时是 center 调用 agent API 的签名密钥
+func (s *NodeService) issueToken(ctx context.Context, node models.NodeInfo) (string, error) {
 	random32, err := utils.GenerateRandomString(32)
 	if err != nil {
 		return "", err
@@ -195,10 +203,22 @@ func (s *NodeService) NodeUp(ctx context.Context, node models.NodeInfo) (string,
 	return random32, s.nodeStore.UpdateNode(ctx, node)
 }
 
-func (s *NodeService) NodeDown(ctx context.Context, node models.NodeInfo) error {
-	if node.Status != "offline" {
-		node.Status = "offline"
+// NodeUp 在节点证明持有凭据之后调用 (见 VerifyNodeRequest)，标签和注册时间沿用已保存的值，
+// 节点没有上报主机清单时沿用之前的清单
+func (s *NodeService) NodeUp(ctx context.Context, node models.NodeInfo) (string, error) {
+	node.Labels = nil
+	node.EnrolledAt = time.Time{}
+	if stored, err := s.nodeStore.GetNode(ctx, node.ID); err == nil {
+		node.Labels = stored.Labels
+		node.EnrolledAt = stored.EnrolledAt
+		if node.Inventory == nil {
+			node.Inventory = stored.Inventory
+		}
 	}
+	return s.issueToken(ctx, node)
+}
+
+func (s *NodeService) NodeDown(ctx context.Context, node models.NodeInfo) error {
 	nodeinredis, err := s.GetNode(ctx, node.ID)
 	if err != nil {
 		return err
@@ -206,11 +226,21 @@ func (s *NodeService) NodeDown(ctx context.Context, node models.NodeInfo) error
 	if nodeinredis.Token != node.Token {
 		return errors.New("token mismatch")
 	}
-	return s.nodeStore.UpdateNode(ctx, node)
+	nodeinredis.Status = NodeStatusOffline
+	return s.nodeStore.UpdateNode(ctx, nodeinredis)
 }
 
+// ListNodes 返回所有节点，状态由最近一次心跳的时间得出
 func (s *NodeService) ListNodes(ctx context.Context) ([]models.NodeInfo, error) {
-	return s.nodeStore.ListNodes(ctx)
+	nodes, err := s.nodeStore.ListNodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for i := range nodes {
+		nodes[i].Status = deriveNodeStatus(nodes[i], now, s.grace)
+	}
+	return nodes, nil
 }
 
 func (s *NodeService) GetNode(ctx context.Context, id string) (models.NodeInfo, error) {
@@ -0,0 +1,289 @@
+package backend
+
+import (
+	"debug/elf"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"scope/internal/models"
+	"scope/internal/platform"
+)
+
+// 调试文件的种类，与 debuginfod 的 URL 和缓存目录布局一致
+const (
+	SymbolKindDebuginfo  = "debuginfo"  // 带 DWARF 的文件 (分离的 .debug 或未 strip 的二进制)
+	SymbolKindExecutable = "executable" // 只有符号表的二进制
+)
+
+// ErrSymbolFileNotFound 表示符号仓库中没有该 build-id 的文件
+var ErrSymbolFileNotFound = errors.New("符号文件不存在")
+
+// SymbolFile 描述符号仓库中的一个文件
+type SymbolFile struct {
+	BuildID string    `json:"build_id"`
+	Kind    string    `json:"kind"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// SymbolStore 按 GNU build-id 保存调试文件，目录布局与 debuginfod 的缓存一致：<dir>/<build-id>/debuginfo (或 executable)。
+// agent 只记录 (build-id, ELF 地址)，kernel 名和源码位置在查询时从这里解析，不依赖目标进程仍然存在。
+type SymbolStore struct {
+	dir string // 上传的文件写入这里
+	// 只读查找的目录，支持 debuginfod 缓存布局和 /usr/lib/debug 的 .build-id/xx/yyyy.debug 布局
+	searchDirs []string
+	cache      *platform.LRUCache[string, *platform.ELFSymbols] // build-id -> 符号表，cost 为估算的字节数
+}
+
+// NewSymbolStore 创建符号仓库，maxBytes 限制缓存在内存中的符号表和 DWARF 大小
+func NewSymbolStore(dir string, searchDirs []string, maxBytes int64) *SymbolStore {
+	return &SymbolStore{
+		dir:        dir,
+		searchDirs: searchDirs,
+		cache:      platform.NewLRUCache[string, *platform.ELFSymbols](maxBytes),
+	}
+}
+
+// validBuildID 检查 build-id 是小写十六进制，避免拼接路径时越出仓库目录
+func validBuildID(buildID string) bool {
+	if len(buildID) < 2 || len(buildID)%2 != 0 || len(buildID) > 128 {
+		return false
+	}
+	_, err := hex.DecodeString(buildID)
+	return err == nil && strings.ToLower(buildID) == buildID
+}
+
+// find 返回 build-id 对应的文件路径，带 DWARF 的优先
+func (s *SymbolStore) find(buildID string) (string, bool) {
+	var candidates []string
+	for _, dir := range append([]string{s.dir}, s.searchDirs...) {
+		if dir == "" {
+			continue
+		}
+		candidates = append(candidates,
+			filepath.Join(dir, buildID, SymbolKindDebuginfo),
+			filepath.Join(dir, ".build-id", buildID[:2], buildID[2:]+".debug"),
+		)
+	}
+	for _, dir := range append([]string{s.dir}, s.searchDirs...) {
+		if dir != "" {
+			candidates = append(candidates, filepath.Join(dir, buildID, SymbolKindExecutable))
+		}
+	}
+	for _, path := range candidates {
+		if fi, err := os.Stat(path); err == nil && fi.Mode().IsRegular() {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// symbols 返回 build-id 对应的符号表，加载后缓存
+func (s *SymbolStore) symbols(buildID string) (*platform.ELFSymbols, error) {
+	if !validBuildID(buildID) {
+		return nil, fmt.Errorf("无效的 build-id: %q", buildID)
+	}
+	if es, ok := s.cache.Get(buildID); ok {
+		return es, nil
+	}
+	path, ok := s.find(buildID)
+	if !ok {
+		return nil, ErrSymbolFileNotFound
+	}
+	es, err := platform.LoadELFSymbols(path)
+	if err != nil {
+		return nil, fmt.Errorf("加载符号文件 %s 失败: %w", path, err)
+	}
+	s.cache.Add(buildID, es, es.Size())
+	return es, nil
+}
+
+// Lookup 解析 build-id 对应文件中的 ELF 虚拟地址
+func (s *SymbolStore) Lookup(buildID string, addr uint64) (platform.SymbolInfo, error) {
+	es, err := s.symbols(buildID)
+	if err != nil {
+		return platform.SymbolInfo{}, err
+	}
+	return es.Symbolize(addr), nil
+}
+
+// Upload 保存一个 ELF 文件，按其中的 build-id 存放，已有同 build-id 同种类的文件时覆盖
+func (s *SymbolStore) Upload(r io.Reader) (*SymbolFile, error) {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建符号仓库目录失败: %w", err)
+	}
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		return nil, fmt.Errorf("写入上传文件失败: %w", err)
+	}
+	buildID, err := platform.ReadELFBuildID(tmp)
+	if err != nil {
+		return nil, fmt.Errorf("上传的文件不是带 GNU build-id 的 ELF: %w", err)
+	}
+	kind := SymbolKindExecutable
+	if ef, err := elf.NewFile(tmp); err == nil {
+		if ef.Section(".debug_info") != nil || ef.Section(".zdebug_info") != nil {
+			kind = SymbolKindDebuginfo
+		}
+		ef.Close()
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("写入上传文件失败: %w", err)
+	}
+
+	dir := filepath.Join(s.dir, buildID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建目录 %s 失败: %w", dir, err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, kind)); err != nil {
+		return nil, fmt.Errorf("保存符号文件失败: %w", err)
+	}
+	s.cache.Remove(buildID)
+	return &SymbolFile{BuildID: buildID, Kind: kind, Size: size, ModTime: time.Now()}, nil
+}
+
+// List 列出上传到仓库的文件 (不包含只读查找目录)，按 build-id 排序
+func (s *SymbolStore) List() ([]SymbolFile, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []SymbolFile{}, nil
+		}
+		return nil, fmt.Errorf("读取符号仓库目录失败: %w", err)
+	}
+	files := []SymbolFile{}
+	for _, entry := range entries {
+		if !entry.IsDir() || !validBuildID(entry.Name()) {
+			continue
+		}
+		for _, kind := range []string{SymbolKindDebuginfo, SymbolKindExecutable} {
+			fi, err := os.Stat(filepath.Join(s.dir, entry.Name(), kind))
+			if err != nil || !fi.Mode().IsRegular() {
+				continue
+			}
+			files = append(files, SymbolFile{BuildID: entry.Name(), Kind: kind, Size: fi.Size(), ModTime: fi.ModTime()})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].BuildID != files[j].BuildID {
+			return files[i].BuildID < files[j].BuildID
+		}
+		return files[i].Kind < files[j].Kind
+	})
+	return files, nil
+}
+
+// Stats 返回符号表缓存的统计
+func (s *SymbolStore) Stats() platform.CacheStats {
+	return s.cache.Stats()
+}
+
+// symbolResolver 在一次查询中解析事件里的 (build-id, 地址)，记住找不到文件的 build-id 以免逐行重复查找。
+// store 为 nil 时不做任何解析。
+type symbolResolver struct {
+	store   *SymbolStore
+	missing map[string]bool
+}
+
+// resolver 创建一次查询使用的解析器，s 为 nil 时 (未配置符号仓库) 不做解析
+func (s *SymbolStore) resolver() *symbolResolver {
+	return &symbolResolver{store: s, missing: make(map[string]bool)}
+}
+
+func (r *symbolResolver) resolve(buildID string, addr int64) (platform.SymbolInfo, bool) {
+	if r.store == nil || buildID == "" || addr == 0 || r.missing[buildID] {
+		return platform.SymbolInfo{}, false
+	}
+	info, err := r.store.Lookup(buildID, uint64(addr))
+	if err != nil {
+		r.missing[buildID] = true
+		return platform.SymbolInfo{}, false
+	}
+	return info, info.Resolved
+}
+
+// isUnresolvedKernelName 判断 kernel 名是否为 agent 未能解析时使用的函数地址 (见 cudaKernelNameSQL)
+func isUnresolvedKernelName(name string) bool {
+	return strings.HasPrefix(name, "0x")
+}
+
+// resolveCudaEvents 为 agent 未能解析的 cudaLaunchKernel 事件填充符号名和源码位置
+func (r *symbolResolver) resolveCudaEvents(events []models.CudaEvent) {
+	for i := range events {
+		e := &events[i]
+		if e.EventSubtype != models.CudaLaunchKernelTopic || e.CudaSymbolName != "" {
+			continue
+		}
+		if info, ok := r.resolve(e.CudaSymbolBuildID, e.CudaSymbolAddr); ok {
+			e.CudaSymbolName = info.SymbolName
+			if info.SourceLine != 0 {
+				e.CudaSymbolSourcefile = fmt.Sprintf("%s:%d", info.SourceFile, info.SourceLine)
+			}
+		}
+	}
+}
+
+// resolveKernelStats 解析名字为函数地址的 kernel，并合并解析后重复的 (pid, kernel, 库) 统计
+func (r *symbolResolver) resolveKernelStats(stats []models.CudaKernelStat) []models.CudaKernelStat {
+	type statKey struct {
+		pid        int32
+		name, file string
+	}
+	merged := make([]models.CudaKernelStat, 0, len(stats))
+	index := make(map[statKey]int, len(stats))
+	for _, st := range stats {
+		if isUnresolvedKernelName(st.SymbolName) {
+			if info, ok := r.resolve(st.BuildID, st.SymbolAddr); ok {
+				st.SymbolName = info.SymbolName
+			}
+		}
+		key := statKey{st.PID, st.SymbolName, st.SymbolFile}
+		if i, ok := index[key]; ok {
+			merged[i].Launches += st.Launches
+			continue
+		}
+		index[key] = len(merged)
+		merged = append(merged, st)
+	}
+	return merged
+}
+
+// resolveKernelSamples 与 resolveKernelStats 相同，作用于时间线
+func (r *symbolResolver) resolveKernelSamples(samples []models.CudaKernelSample) []models.CudaKernelSample {
+	type sampleKey struct {
+		ts   time.Time
+		pid  int32
+		name string
+	}
+	merged := make([]models.CudaKernelSample, 0, len(samples))
+	index := make(map[sampleKey]int, len(samples))
+	for _, sm := range samples {
+		if isUnresolvedKernelName(sm.SymbolName) {
+			if info, ok := r.resolve(sm.BuildID, sm.SymbolAddr); ok {
+				sm.SymbolName = info.SymbolName
+			}
+		}
+		key := sampleKey{sm.Ts, sm.PID, sm.SymbolName}
+		if i, ok := index[key]; ok {
+			merged[i].Launches += sm.Launches
+			continue
+		}
+		index[key] = len(merged)
+		merged = append(merged, sm)
+	}
+	return merged
+}
@@ -0,0 +1,144 @@
+package backend
+
+import (
+	"bytes"
+	"debug/elf"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"scope/internal/models"
+)
+
+// buildELFWithBuildID 编译一个带调试信息和 GNU build-id 的测试程序，返回路径和 kernel 函数的地址
+func buildELFWithBuildID(t *testing.T) (string, uint64) {
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("C compiler not available")
+	}
+	dir := t.TempDir()
+	src := filepath.Join(dir, "prog.c")
+	code := "__attribute__((noinline)) int rms_norm_f32(int x) {\n\treturn x * 3;\n}\n\nint main(int argc, char **argv) {\n\t(void)argv;\n\treturn rms_norm_f32(argc);\n}\n"
+	if err := os.WriteFile(src, []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+	bin := filepath.Join(dir, "prog")
+	if out, err := exec.Command(cc, "-g", "-O0", "-Wl,--build-id", "-o", bin, src).CombinedOutput(); err != nil {
+		t.Skipf("failed to compile test program: %v: %s", err, out)
+	}
+	ef, err := elf.Open(bin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ef.Close()
+	syms, _ := ef.Symbols()
+	for _, sym := range syms {
+		if sym.Name == "rms_norm_f32" {
+			return bin, sym.Value
+		}
+	}
+	t.Fatal("rms_norm_f32 not found in symbol table")
+	return "", 0
+}
+
+func TestSymbolStore(t *testing.T) {
+	bin, addr := buildELFWithBuildID(t)
+	store := NewSymbolStore(filepath.Join(t.TempDir(), "symbols"), nil, 64<<20)
+
+	if _, err := store.Upload(bytes.NewReader([]byte("not an elf"))); err == nil {
+		t.Error("Upload should reject a non-ELF file")
+	}
+
+	f, err := os.Open(bin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	file, err := store.Upload(f)
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	if file.Kind != SymbolKindDebuginfo {
+		t.Errorf("Kind = %q, want %q", file.Kind, SymbolKindDebuginfo)
+	}
+	files, err := store.List()
+	if err != nil || len(files) != 1 || files[0].BuildID != file.BuildID {
+		t.Fatalf("List = %+v, %v", files, err)
+	}
+
+	info, err := store.Lookup(file.BuildID, addr)
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if !info.Resolved || info.SymbolName != "rms_norm_f32" || filepath.Base(info.SourceFile) != "prog.c" {
+		t.Errorf("Lookup = %+v, want rms_norm_f32 in prog.c", info)
+	}
+	if _, err := store.Lookup("00ff", addr); err != ErrSymbolFileNotFound {
+		t.Errorf("Lookup unknown build-id err = %v, want ErrSymbolFileNotFound", err)
+	}
+
+	// 同一 kernel 一部分事件由 agent 解析、一部分只带 (build-id, 地址)，解析后合并为一行
+	stats := []models.CudaKernelStat{
+		{PID: 1, SymbolName: "rms_norm_f32", SymbolFile: "/opt/libk.so", BuildID: file.BuildID, SymbolAddr: int64(addr), Launches: 5},
+		{PID: 1, SymbolName: "0x7f0000001000", SymbolFile: "/opt/libk.so", BuildID: file.BuildID, SymbolAddr: int64(addr), Launches: 3},
+		{PID: 1, SymbolName: "0x7f0000002000", SymbolFile: "/opt/libk.so", BuildID: "00ff", SymbolAddr: 0x2000, Launches: 1},
+	}
+	merged := store.resolver().resolveKernelStats(stats)
+	if len(merged) != 2 || merged[0].SymbolName != "rms_norm_f32" || merged[0].Launches != 8 || merged[1].SymbolName != "0x7f0000002000" {
+		t.Errorf("resolveKernelStats = %+v", merged)
+	}
+
+	// 未配置符号仓库时保持原样
+	var none *SymbolStore
+	if got := none.resolver().resolveKernelStats(stats); len(got) != 3 {
+		t.Errorf("resolveKernelStats without store = %+v", got)
+	}
+
+	events := []models.CudaEvent{{EventSubtype: models.CudaLaunchKernelTopic, CudaSymbolBuildID: file.BuildID, CudaSymbolAddr: int64(addr)}}
+	store.resolver().resolveCudaEvents(events)
+	if events[0].CudaSymbolName != "rms_norm_f32" || events[0].CudaSymbolSourcefile == "" {
+		t.Errorf("resolveCudaEvents = %+v", events[0])
+	}
+}
+
+func TestSymbolStoreSearchDirs(t *testing.T) {
+	bin, addr := buildELFWithBuildID(t)
+	f, err := os.Open(bin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// 先上传到一个仓库拿到 build-id，再按 /usr/lib/debug 的布局放进只读目录
+	file, err := NewSymbolStore(t.TempDir(), nil, 64<<20).Upload(f)
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	debugDir := t.TempDir()
+	debugPath := filepath.Join(debugDir, ".build-id", file.BuildID[:2], file.BuildID[2:]+".debug")
+	if err := os.MkdirAll(filepath.Dir(debugPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(bin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(debugPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewSymbolStore(filepath.Join(t.TempDir(), "empty"), []string{debugDir}, 64<<20)
+	info, err := store.Lookup(file.BuildID, addr)
+	if err != nil || info.SymbolName != "rms_norm_f32" {
+		t.Errorf("Lookup = %+v, %v", info, err)
+	}
+	if files, err := store.List(); err != nil || len(files) != 0 {
+		t.Errorf("List = %+v, %v, want only uploaded files", files, err)
+	}
+	for _, id := range []string{"../etc", "ABCD", "abc", ""} {
+		if validBuildID(id) {
+			t.Errorf("validBuildID(%q) = true", id)
+		}
+	}
+}
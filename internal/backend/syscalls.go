@@ -0,0 +1,272 @@
+package backend
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"scope/database/postgres"
+	"scope/internal/models"
+)
+
+// syscallTopChanges 异常报告中列出的占比变化最大的系统调用数
+const syscallTopChanges = 5
+
+// SyscallShare 是一个系统调用的次数及其占进程全部系统调用的比例
+type SyscallShare struct {
+	SyscallName string  `json:"syscall_name"`
+	Count       int64   `json:"count"`
+	Share       float64 `json:"share"`
+}
+
+// SyscallProcessProfile 是一个进程在窗口内的系统调用分布
+type SyscallProcessProfile struct {
+	PID        int32          `json:"pid"`
+	Comm       string         `json:"comm"`
+	Total      int64          `json:"total"`
+	RatePerSec float64        `json:"rate_per_sec"`
+	Syscalls   []SyscallShare `json:"syscalls"`
+}
+
+// SyscallProfile 是一台机器在一个时间窗口内的系统调用分布
+type SyscallProfile struct {
+	MachineID string                  `json:"machine_id"`
+	Start     time.Time               `json:"start"`
+	End       time.Time               `json:"end"`
+	Processes []SyscallProcessProfile `json:"processes"`
+	Timeline  []models.SyscallSample  `json:"timeline,omitempty"`
+}
+
+// SyscallDeviation 是一个系统调用在当前窗口与基线中的占比差异
+type SyscallDeviation struct {
+	SyscallName   string  `json:"syscall_name"`
+	BaselineShare float64 `json:"baseline_share"`
+	CurrentShare  float64 `json:"current_share"`
+	Delta         float64 `json:"delta"`
+}
+
+// SyscallAnomaly 比较一个进程当前的系统调用分布与同名进程的历史分布
+type SyscallAnomaly struct {
+	PID           int32  `json:"pid"`
+	Comm          string `json:"comm"`
+	Total         int64  `json:"total"`
+	BaselineTotal int64  `json:"baseline_total"`
+	// Distance 为两个分布的总变差距离 (0.5 * Σ|p - q|)，0 表示完全相同，1 表示没有共同的系统调用
+	Distance     float64            `json:"distance"`
+	Anomalous    bool               `json:"anomalous"`
+	Insufficient bool               `json:"insufficient,omitempty"` // 当前或基线调用次数不足 MinCalls，不做判断
+	NewSyscalls  []string           `json:"new_syscalls,omitempty"` // 基线中从未出现的系统调用
+	TopChanges   []SyscallDeviation `json:"top_changes"`
+}
+
+// SyscallAnomalyReport 是一个窗口相对历史基线的系统调用异常检测结果
+type SyscallAnomalyReport struct {
+	MachineID     string           `json:"machine_id"`
+	Start         time.Time        `json:"start"`
+	End           time.Time        `json:"end"`
+	BaselineStart time.Time        `json:"baseline_start"`
+	BaselineEnd   time.Time        `json:"baseline_end"`
+	Threshold     float64          `json:"threshold"`
+	MinCalls      int64            `json:"min_calls"`
+	Processes     []SyscallAnomaly `json:"processes"`
+}
+
+// SyscallAnomalyOptions 控制异常检测的参数
+type SyscallAnomalyOptions struct {
+	Baseline  time.Duration // 基线窗口为 [start - Baseline, start)
+	Threshold float64       // 分布距离达到该值时标记
+	MinCalls  int64         // 当前窗口或基线调用次数少于该值时不做判断
+}
+
+// SyscallService 基于 agent 汇总的 syscall_rollups 生成系统调用分析
+type SyscallService struct {
+	eventStore *postgres.EventStore
+}
+
+// Profile 统计窗口内每个进程的系统调用分布；bucket > 0 时同时返回次数时间线
+func (s *SyscallService) Profile(ctx context.Context, filter postgres.EventFilter, bucket time.Duration) (*SyscallProfile, error) {
+	counts, err := s.eventStore.SyscallCounts(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	profile := buildSyscallProfile(filter.MachineID, counts, filter.Start, filter.End)
+	if bucket > 0 {
+		if profile.Timeline, err = s.eventStore.SyscallTimeline(ctx, filter, bucket); err != nil {
+			return nil, err
+		}
+	}
+	return profile, nil
+}
+
+// Anomalies 把窗口内每个进程的系统调用分布与基线窗口内同名进程的分布比较。
+// pid 会随进程重启变化，因此基线按进程名而不是 pid 汇总。
+func (s *SyscallService) Anomalies(ctx context.Context, filter postgres.EventFilter, opts SyscallAnomalyOptions) (*SyscallAnomalyReport, error) {
+	current, err := s.eventStore.SyscallCounts(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	commSet := make(map[string]bool)
+	for _, c := range current {
+		commSet[c.Comm] = true
+	}
+	comms := make([]string, 0, len(commSet))
+	for comm := range commSet {
+		comms = append(comms, comm)
+	}
+
+	report := &SyscallAnomalyReport{
+		MachineID:     filter.MachineID,
+		Start:         filter.Start,
+		End:           filter.End,
+		BaselineStart: filter.Start.Add(-opts.Baseline),
+		BaselineEnd:   filter.Start,
+		Threshold:     opts.Threshold,
+		MinCalls:      opts.MinCalls,
+	}
+	var baseline []models.SyscallCount
+	if len(comms) > 0 {
+		baselineFilter := filter
+		baselineFilter.Start, baselineFilter.End = report.BaselineStart, report.BaselineEnd
+		if baseline, err = s.eventStore.SyscallCountsByComm(ctx, baselineFilter, comms); err != nil {
+			return nil, err
+		}
+	}
+	report.Processes = detectSyscallAnomalies(current, baseline, opts)
+	return report, nil
+}
+
+func buildSyscallProfile(machineID string, counts []models.SyscallCount, start, end time.Time) *SyscallProfile {
+	profile := &SyscallProfile{MachineID: machineID, Start: start, End: end}
+	seconds := end.Sub(start).Seconds()
+
+	procs := make(map[int32]*SyscallProcessProfile)
+	for _, c := range counts {
+		p, ok := procs[c.PID]
+		if !ok {
+			p = &SyscallProcessProfile{PID: c.PID, Comm: c.Comm}
+			procs[c.PID] = p
+		}
+		p.Total += c.Count
+		p.Syscalls = append(p.Syscalls, SyscallShare{SyscallName: c.SyscallName, Count: c.Count})
+	}
+	for _, p := range procs {
+		for i := range p.Syscalls {
+			p.Syscalls[i].Share = float64(p.Syscalls[i].Count) / float64(p.Total)
+		}
+		sort.Slice(p.Syscalls, func(i, j int) bool {
+			if p.Syscalls[i].Count != p.Syscalls[j].Count {
+				return p.Syscalls[i].Count > p.Syscalls[j].Count
+			}
+			return p.Syscalls[i].SyscallName < p.Syscalls[j].SyscallName
+		})
+		if seconds > 0 {
+			p.RatePerSec = float64(p.Total) / seconds
+		}
+		profile.Processes = append(profile.Processes, *p)
+	}
+	sort.Slice(profile.Processes, func(i, j int) bool {
+		a, b := profile.Processes[i], profile.Processes[j]
+		if a.Total != b.Total {
+			return a.Total > b.Total
+		}
+		return a.PID < b.PID
+	})
+	return profile
+}
+
+// detectSyscallAnomalies 计算每个进程 (current，按 pid 汇总) 与同名进程基线 (baseline，按 comm 汇总)
+// 的系统调用分布距离，结果按距离降序排列
+func detectSyscallAnomalies(current, baseline []models.SyscallCount, opts SyscallAnomalyOptions) []SyscallAnomaly {
+	type distribution struct {
+		comm   string
+		total  int64
+		counts map[string]int64
+	}
+	add := func(d *distribution, c models.SyscallCount) *distribution {
+		if d == nil {
+			d = &distribution{comm: c.Comm, counts: make(map[string]int64)}
+		}
+		d.total += c.Count
+		d.counts[c.SyscallName] += c.Count
+		return d
+	}
+
+	procs := make(map[int32]*distribution)
+	for _, c := range current {
+		procs[c.PID] = add(procs[c.PID], c)
+	}
+	baselines := make(map[string]*distribution)
+	for _, c := range baseline {
+		baselines[c.Comm] = add(baselines[c.Comm], c)
+	}
+
+	var anomalies []SyscallAnomaly
+	for pid, cur := range procs {
+		a := SyscallAnomaly{PID: pid, Comm: cur.comm, Total: cur.total}
+		base, ok := baselines[cur.comm]
+		if ok {
+			a.BaselineTotal = base.total
+		}
+		if !ok || base.total < opts.MinCalls || cur.total < opts.MinCalls {
+			a.Insufficient = true
+			anomalies = append(anomalies, a)
+			continue
+		}
+
+		names := make(map[string]struct{})
+		for name := range cur.counts {
+			names[name] = struct{}{}
+			if base.counts[name] == 0 {
+				a.NewSyscalls = append(a.NewSyscalls, name)
+			}
+		}
+		for name := range base.counts {
+			names[name] = struct{}{}
+		}
+		var distance float64
+		for name := range names {
+			d := SyscallDeviation{
+				SyscallName:   name,
+				BaselineShare: float64(base.counts[name]) / float64(base.total),
+				CurrentShare:  float64(cur.counts[name]) / float64(cur.total),
+			}
+			d.Delta = d.CurrentShare - d.BaselineShare
+			if d.Delta < 0 {
+				distance -= d.Delta
+			} else {
+				distance += d.Delta
+			}
+			a.TopChanges = append(a.TopChanges, d)
+		}
+		a.Distance = distance / 2
+		a.Anomalous = a.Distance >= opts.Threshold
+
+		abs := func(f float64) float64 {
+			if f < 0 {
+				return -f
+			}
+			return f
+		}
+		sort.Slice(a.TopChanges, func(i, j int) bool {
+			x, y := a.TopChanges[i], a.TopChanges[j]
+			if abs(x.Delta) != abs(y.Delta) {
+				return abs(x.Delta) > abs(y.Delta)
+			}
+			return x.SyscallName < y.SyscallName
+		})
+		if len(a.TopChanges) > syscallTopChanges {
+			a.TopChanges = a.TopChanges[:syscallTopChanges]
+		}
+		sort.Strings(a.NewSyscalls)
+		anomalies = append(anomalies, a)
+	}
+
+	sort.Slice(anomalies, func(i, j int) bool {
+		if anomalies[i].Distance != anomalies[j].Distance {
+			return anomalies[i].Distance > anomalies[j].Distance
+		}
+		return anomalies[i].PID < anomalies[j].PID
+	})
+	return anomalies
+}
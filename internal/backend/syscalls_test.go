@@ -0,0 +1,70 @@
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"scope/internal/models"
+)
+
+func TestBuildSyscallProfile(t *testing.T) {
+	counts := []models.SyscallCount{
+		{PID: 1, Comm: "ollama", SyscallName: "read", Count: 300},
+		{PID: 1, Comm: "ollama", SyscallName: "futex", Count: 100},
+		{PID: 2, Comm: "bash", SyscallName: "read", Count: 10},
+	}
+	profile := buildSyscallProfile("m1", counts, testBase, at(10*time.Second))
+	if len(profile.Processes) != 2 || profile.Processes[0].PID != 1 {
+		t.Fatalf("unexpected processes: %+v", profile.Processes)
+	}
+	p := profile.Processes[0]
+	if p.Total != 400 || p.RatePerSec != 40 || p.Syscalls[0].SyscallName != "read" || p.Syscalls[0].Share != 0.75 {
+		t.Errorf("process 1 = %+v", p)
+	}
+}
+
+func TestDetectSyscallAnomalies(t *testing.T) {
+	baseline := []models.SyscallCount{
+		{Comm: "ollama", SyscallName: "read", Count: 500},
+		{Comm: "ollama", SyscallName: "futex", Count: 500},
+		{Comm: "bash", SyscallName: "read", Count: 1000},
+	}
+	current := []models.SyscallCount{
+		// 与基线相同的分布
+		{PID: 10, Comm: "ollama", SyscallName: "read", Count: 100},
+		{PID: 10, Comm: "ollama", SyscallName: "futex", Count: 100},
+		// 突然大量 connect
+		{PID: 20, Comm: "bash", SyscallName: "read", Count: 100},
+		{PID: 20, Comm: "bash", SyscallName: "connect", Count: 300},
+		// 没有历史
+		{PID: 30, Comm: "new", SyscallName: "read", Count: 1000},
+	}
+
+	anomalies := detectSyscallAnomalies(current, baseline, SyscallAnomalyOptions{Threshold: 0.3, MinCalls: 100})
+	if len(anomalies) != 3 {
+		t.Fatalf("got %d results, want 3", len(anomalies))
+	}
+
+	a := anomalies[0]
+	if a.PID != 20 || !a.Anomalous || a.Distance != 0.75 {
+		t.Errorf("bash should be flagged with distance 0.75: %+v", a)
+	}
+	if len(a.NewSyscalls) != 1 || a.NewSyscalls[0] != "connect" || a.TopChanges[0].SyscallName != "connect" {
+		t.Errorf("connect should be reported as new and the top change: %+v", a)
+	}
+
+	for _, a := range anomalies[1:] {
+		switch a.PID {
+		case 10:
+			if a.Anomalous || a.Distance != 0 {
+				t.Errorf("unchanged mix must not be flagged: %+v", a)
+			}
+		case 30:
+			if !a.Insufficient || a.Anomalous {
+				t.Errorf("process without history must be skipped: %+v", a)
+			}
+		default:
+			t.Errorf("unexpected pid %d", a.PID)
+		}
+	}
+}
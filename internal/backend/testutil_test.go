@@ -0,0 +1,9 @@
+package backend
+
+import "time"
+
+// testBase 是测试事件的时间基准
+var testBase = time.Unix(1700000000, 0).UTC()
+
+// at 返回 testBase 之后 d 的时间
+func at(d time.Duration) time.Time { return testBase.Add(d) }
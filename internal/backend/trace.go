@@ -0,0 +1,299 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"scope/database/postgres"
+	"scope/internal/models"
+)
+
+// cpuTrackPID 是 Chrome trace 中承载 CPU 调度轨道的虚拟进程号，
+// 每个 CPU 对应其下的一个线程 (tid = cpu)。
+const cpuTrackPID = 0
+
+// TraceEvent 是 Chrome Trace Event Format 中的单个事件，
+// ui.perfetto.dev 与 chrome://tracing 均可直接打开。
+// 参见 https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU
+type TraceEvent struct {
+	Name  string                 `json:"name"`
+	Cat   string                 `json:"cat,omitempty"`
+	Ph    string                 `json:"ph"`
+	Ts    float64                `json:"ts"`            // 微秒
+	Dur   float64                `json:"dur,omitempty"` // 微秒, 仅 ph=X
+	Pid   int32                  `json:"pid"`
+	Tid   int32                  `json:"tid"`
+	Scope string                 `json:"s,omitempty"` // 仅 ph=i
+	Args  map[string]interface{} `json:"args,omitempty"`
+}
+
+// ChromeTrace 是导出的完整 trace 文件
+type ChromeTrace struct {
+	TraceEvents     []TraceEvent      `json:"traceEvents"`
+	DisplayTimeUnit string            `json:"displayTimeUnit"`
+	Metadata        map[string]string `json:"metadata,omitempty"`
+}
+
+type TraceService struct {
+	eventStore *postgres.EventStore
+	symbols    *SymbolStore
+}
+
+// BuildChromeTrace 查询给定机器、进程集合与时间范围内的事件并转换为 Chrome trace
+func (s *TraceService) BuildChromeTrace(ctx context.Context, filter postgres.EventFilter) (*ChromeTrace, error) {
+	// sched 事件的 pid 是线程 ID，ListSchedEvents 按所属进程 (tgid) 过滤，否则 pids 过滤会丢掉工作线程
+	schedEvents, err := s.eventStore.ListSchedEvents(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	execFilter := filter
+	execFilter.Subtypes = []string{models.ExecvTopic}
+	execEvents, err := s.eventStore.ListOSEvents(ctx, execFilter)
+	if err != nil {
+		return nil, err
+	}
+	osEvents := append(schedEvents, execEvents...)
+	sort.SliceStable(osEvents, func(i, j int) bool { return osEvents[i].Ts.Before(osEvents[j].Ts) })
+
+	cudaFilter := filter
+	cudaFilter.Subtypes = []string{models.CudaMemcpyTopic, models.CudaLaunchKernelTopic}
+	cudaEvents, err := s.eventStore.ListCudaEvents(ctx, cudaFilter)
+	if err != nil {
+		return nil, err
+	}
+	s.symbols.resolver().resolveCudaEvents(cudaEvents)
+
+	ggmlFilter := filter
+	ggmlFilter.Subtypes = []string{models.GGMLCudaTopic, models.GGMLCpuTopic}
+	ggmlEvents, err := s.eventStore.ListGGMLEvents(ctx, ggmlFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	trace := buildChromeTrace(filter.End, osEvents, cudaEvents, ggmlEvents)
+	trace.Metadata = map[string]string{
+		"machine_id": filter.MachineID,
+		"start":      filter.Start.Format(time.RFC3339Nano),
+		"end":        filter.End.Format(time.RFC3339Nano),
+	}
+	return trace, nil
+}
+
+// toTraceTs 将时间转换为 trace 使用的微秒时间戳
+func toTraceTs(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e3
+}
+
+// buildChromeTrace 将三类事件转换为 Chrome trace 事件。
+//
+//   - sched switch_in/switch_out 按线程配对为 CPU 轨道上的切片，未配对的 switch_in 延续到 end，
+//     切片参数与进程名归属于线程所在的进程 (tgid)
+//   - ggml_cuda / ggml_graph_compute 成为进程轨道上的持续切片
+//   - cudaMemcpy / cudaLaunchKernel 成为带参数的瞬时事件，带耗时的 cudaMemcpy 成为切片
+//   - execv 成为进程元数据 (进程名与启动参数)
+//
+// ggml 探针在函数返回时记录时间戳，因此切片起点为 ts - duration。
+func buildChromeTrace(end time.Time, osEvents []models.OSEvent, cudaEvents []models.CudaEvent, ggmlEvents []models.GGMLEvent) *ChromeTrace {
+	var events []TraceEvent
+	processNames := make(map[int32]string)
+	cpus := make(map[int32]bool)
+
+	type runningSlice struct {
+		start time.Time
+		cpu   int32
+		pid   int32 // 所属进程 (tgid)
+		comm  string
+	}
+	running := make(map[int32]runningSlice) // 线程 ID -> 正在运行的切片
+	closeSlice := func(tid int32, rs runningSlice, stop time.Time) {
+		events = append(events, TraceEvent{
+			Name: fmt.Sprintf("%s (%d)", rs.comm, rs.pid),
+			Cat:  models.SchedTopic,
+			Ph:   "X",
+			Ts:   toTraceTs(rs.start),
+			Dur:  float64(stop.Sub(rs.start).Nanoseconds()) / 1e3,
+			Pid:  cpuTrackPID,
+			Tid:  rs.cpu,
+			Args: map[string]interface{}{"pid": rs.pid, "tid": tid, "comm": rs.comm},
+		})
+	}
+
+	for _, e := range osEvents {
+		switch e.EventSubtype {
+		case models.SchedTopic:
+			if e.Cpu < 0 {
+				continue
+			}
+			cpus[e.Cpu] = true
+			// sched 的 pid 是线程 ID，切片按线程配对，进程轨道使用所属进程 (tgid)
+			pid := e.Tgid
+			if pid == 0 {
+				pid = e.PID
+			}
+			switch e.SchedType {
+			case "switch_in":
+				if rs, ok := running[e.PID]; ok {
+					// 缺失 switch_out，以新的 switch_in 作为结束
+					closeSlice(e.PID, rs, e.Ts)
+				}
+				running[e.PID] = runningSlice{start: e.Ts, cpu: e.Cpu, pid: pid, comm: e.Comm}
+			case "switch_out":
+				if rs, ok := running[e.PID]; ok {
+					closeSlice(e.PID, rs, e.Ts)
+					delete(running, e.PID)
+				}
+			}
+			// 主线程的 comm 即进程名，工作线程的 comm 可能是线程名
+			if _, ok := processNames[pid]; (!ok || e.PID == pid) && e.Comm != "" {
+				processNames[pid] = e.Comm
+			}
+		case models.ExecvTopic:
+			name := filepath.Base(e.ExecFilename)
+			if name == "." || name == "/" {
+				name = e.Comm
+			}
+			processNames[e.PID] = name
+			events = append(events, TraceEvent{
+				Name: "process_labels",
+				Ph:   "M",
+				Pid:  e.PID,
+				Args: map[string]interface{}{"labels": fmt.Sprintf("ppid=%d %s", e.Ppid, e.ExecArgs)},
+			})
+		}
+	}
+	for tid, rs := range running {
+		closeSlice(tid, rs, end)
+	}
+
+	for _, e := range ggmlEvents {
+		var name string
+		var dur int64
+		args := map[string]interface{}{}
+		switch e.EventSubtype {
+		case models.GGMLCudaTopic:
+			name = e.GGMLCudaFuncName
+			dur = e.GGMLCudaDurationNs
+		case models.GGMLCpuTopic:
+			name = models.GGMLCpuTopic
+			dur = e.GGMLCostNs
+			args["graph_size"] = e.GGMLGraphSize
+			args["graph_nodes"] = e.GGMLGraphNodes
+			args["graph_leafs"] = e.GGMLGraphLeafs
+			args["graph_order"] = e.GGMLGraphOrder
+		default:
+			continue
+		}
+		events = append(events, TraceEvent{
+			Name: name,
+			Cat:  e.EventSubtype,
+			Ph:   "X",
+			Ts:   toTraceTs(e.Ts.Add(-time.Duration(dur))),
+			Dur:  float64(dur) / 1e3,
+			Pid:  e.PID,
+			Tid:  e.PID,
+			Args: args,
+		})
+		if _, ok := processNames[e.PID]; !ok && e.Comm != "" {
+			processNames[e.PID] = e.Comm
+		}
+	}
+
+	for _, e := range cudaEvents {
+		var name string
+		args := map[string]interface{}{}
+		switch e.EventSubtype {
+		case models.CudaMemcpyTopic:
+			name = models.CudaMemcpyTopic
+			args["size"] = e.CudaSize
+			args["type"] = e.CudaMemcpyType
+			args["src"] = fmt.Sprintf("0x%x", uint64(e.CudaMemcpySrc))
+			args["dst"] = fmt.Sprintf("0x%x", uint64(e.CudaMemcpyDst))
+		case models.CudaLaunchKernelTopic:
+			name = e.CudaSymbolName
+			if name == "" {
+				name = models.CudaLaunchKernelTopic
+			}
+			args["func_ptr"] = fmt.Sprintf("0x%x", uint64(e.CudaFuncPtr))
+			args["symbol_file"] = e.CudaSymbolFile
+			if e.CudaSymbolSourcefile != "" {
+				args["source"] = e.CudaSymbolSourcefile
+			}
+		default:
+			continue
+		}
+		if e.EventSubtype == models.CudaMemcpyTopic && e.CudaMemcpyDurationNs > 0 {
+			// 带耗时的 cudaMemcpy 在返回时上报，画成切片
+			events = append(events, TraceEvent{
+				Name: name,
+				Cat:  e.EventSubtype,
+				Ph:   "X",
+				Ts:   toTraceTs(e.Ts.Add(-time.Duration(e.CudaMemcpyDurationNs))),
+				Dur:  float64(e.CudaMemcpyDurationNs) / 1e3,
+				Pid:  e.PID,
+				Tid:  e.PID,
+				Args: args,
+			})
+		} else {
+			events = append(events, TraceEvent{
+				Name:  name,
+				Cat:   e.EventSubtype,
+				Ph:    "i",
+				Ts:    toTraceTs(e.Ts),
+				Pid:   e.PID,
+				Tid:   e.PID,
+				Scope: "t",
+				Args:  args,
+			})
+		}
+		if _, ok := processNames[e.PID]; !ok && e.Comm != "" {
+			processNames[e.PID] = e.Comm
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Ts < events[j].Ts
+	})
+
+	// 元数据事件放在最前面
+	meta := []TraceEvent{{
+		Name: "process_name",
+		Ph:   "M",
+		Pid:  cpuTrackPID,
+		Args: map[string]interface{}{"name": "CPU scheduling"},
+	}}
+	cpuList := make([]int32, 0, len(cpus))
+	for cpu := range cpus {
+		cpuList = append(cpuList, cpu)
+	}
+	sort.Slice(cpuList, func(i, j int) bool { return cpuList[i] < cpuList[j] })
+	for _, cpu := range cpuList {
+		meta = append(meta, TraceEvent{
+			Name: "thread_name",
+			Ph:   "M",
+			Pid:  cpuTrackPID,
+			Tid:  cpu,
+			Args: map[string]interface{}{"name": fmt.Sprintf("CPU %d", cpu)},
+		})
+	}
+	pidList := make([]int32, 0, len(processNames))
+	for pid := range processNames {
+		pidList = append(pidList, pid)
+	}
+	sort.Slice(pidList, func(i, j int) bool { return pidList[i] < pidList[j] })
+	for _, pid := range pidList {
+		meta = append(meta, TraceEvent{
+			Name: "process_name",
+			Ph:   "M",
+			Pid:  pid,
+			Args: map[string]interface{}{"name": fmt.Sprintf("%s (%d)", processNames[pid], pid)},
+		})
+	}
+
+	return &ChromeTrace{
+		TraceEvents:     append(meta, events...),
+		DisplayTimeUnit: "ns",
+	}
+}
@@ -0,0 +1,108 @@
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"scope/internal/models"
+)
+
+func TestBuildChromeTrace(t *testing.T) {
+	end := at(10 * time.Millisecond)
+
+	osEvents := []models.OSEvent{
+		{Ts: testBase, EventSubtype: models.ExecvTopic, PID: 42, Ppid: 1, ExecFilename: "/usr/bin/ollama", ExecArgs: "serve"},
+		{Ts: at(1 * time.Millisecond), EventSubtype: models.SchedTopic, PID: 42, Comm: "ollama", Cpu: 3, SchedType: "switch_in"},
+		{Ts: at(3 * time.Millisecond), EventSubtype: models.SchedTopic, PID: 42, Comm: "ollama", Cpu: 3, SchedType: "switch_out"},
+		{Ts: at(5 * time.Millisecond), EventSubtype: models.SchedTopic, PID: 42, Comm: "ollama", Cpu: 1, SchedType: "switch_in"},
+	}
+	ggmlEvents := []models.GGMLEvent{
+		{Ts: at(4 * time.Millisecond), EventSubtype: models.GGMLCudaTopic, PID: 42, GGMLCudaFuncName: "ggml_cuda_op_mul_mat_q", GGMLCudaDurationNs: 1000000},
+	}
+	cudaEvents := []models.CudaEvent{
+		{Ts: at(2 * time.Millisecond), EventSubtype: models.CudaMemcpyTopic, PID: 42, CudaSize: 4096, CudaMemcpyType: "host_to_device"},
+	}
+
+	trace := buildChromeTrace(end, osEvents, cudaEvents, ggmlEvents)
+
+	var slices, instants, cudaSlices int
+	var processName string
+	for _, e := range trace.TraceEvents {
+		switch {
+		case e.Ph == "X" && e.Pid == cpuTrackPID:
+			slices++
+			if e.Tid == 3 && e.Dur != 2000 {
+				t.Errorf("sched slice on cpu 3: dur = %v us, want 2000", e.Dur)
+			}
+			if e.Tid == 1 && e.Dur != 5000 {
+				t.Errorf("open sched slice on cpu 1 should extend to end: dur = %v us, want 5000", e.Dur)
+			}
+		case e.Ph == "X" && e.Pid == 42:
+			cudaSlices++
+			if want := toTraceTs(at(3 * time.Millisecond)); e.Ts != want {
+				t.Errorf("ggml_cuda slice starts at %v, want %v", e.Ts, want)
+			}
+		case e.Ph == "i":
+			instants++
+		case e.Ph == "M" && e.Name == "process_name" && e.Pid == 42:
+			processName, _ = e.Args["name"].(string)
+		}
+	}
+
+	if slices != 2 {
+		t.Errorf("got %d sched slices, want 2", slices)
+	}
+	if cudaSlices != 1 {
+		t.Errorf("got %d ggml slices, want 1", cudaSlices)
+	}
+	if instants != 1 {
+		t.Errorf("got %d instant events, want 1", instants)
+	}
+	if processName != "ollama (42)" {
+		t.Errorf("process name = %q, want %q", processName, "ollama (42)")
+	}
+}
+
+func TestBuildChromeTraceWorkerThreads(t *testing.T) {
+	end := at(10 * time.Millisecond)
+
+	// sched 事件的 pid 是线程 ID，工作线程 43 属于进程 42
+	osEvents := []models.OSEvent{
+		{Ts: at(1 * time.Millisecond), EventSubtype: models.SchedTopic, PID: 43, Tgid: 42, Comm: "llama-worker", Cpu: 2, SchedType: "switch_in"},
+		{Ts: at(2 * time.Millisecond), EventSubtype: models.SchedTopic, PID: 42, Tgid: 42, Comm: "ollama", Cpu: 3, SchedType: "switch_in"},
+		{Ts: at(4 * time.Millisecond), EventSubtype: models.SchedTopic, PID: 43, Tgid: 42, Comm: "llama-worker", Cpu: 2, SchedType: "switch_out"},
+		{Ts: at(6 * time.Millisecond), EventSubtype: models.SchedTopic, PID: 42, Tgid: 42, Comm: "ollama", Cpu: 3, SchedType: "switch_out"},
+	}
+
+	trace := buildChromeTrace(end, osEvents, nil, nil)
+
+	var processName string
+	slices := map[int32]TraceEvent{}
+	for _, e := range trace.TraceEvents {
+		switch {
+		case e.Ph == "X" && e.Pid == cpuTrackPID:
+			slices[e.Tid] = e
+		case e.Ph == "M" && e.Name == "process_name" && e.Pid == 43:
+			t.Errorf("worker thread got its own process track: %+v", e)
+		case e.Ph == "M" && e.Name == "process_name" && e.Pid == 42:
+			processName, _ = e.Args["name"].(string)
+		}
+	}
+
+	worker, ok := slices[2]
+	if !ok {
+		t.Fatalf("missing sched slice for the worker thread on cpu 2")
+	}
+	if worker.Dur != 3000 {
+		t.Errorf("worker slice dur = %v us, want 3000", worker.Dur)
+	}
+	if worker.Args["pid"] != int32(42) || worker.Args["tid"] != int32(43) {
+		t.Errorf("worker slice args = %v, want pid 42 and tid 43", worker.Args)
+	}
+	if main, ok := slices[3]; !ok || main.Dur != 4000 {
+		t.Errorf("main thread slice on cpu 3 = %+v, want dur 4000", main)
+	}
+	if processName != "ollama (42)" {
+		t.Errorf("process name = %q, want %q", processName, "ollama (42)")
+	}
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// AdminTokenHeader 是管理接口要求的管理员密钥请求头
+const AdminTokenHeader = "X-Admin-Token"
+
+// AdminMiddleware 保护管理接口 (签发加入令牌、删除节点等)。
+// 用户可以自行注册，JWT 只能证明是某个用户，管理接口还要求请求携带部署时配置的管理员密钥。
+type AdminMiddleware struct {
+	secret []byte
+}
+
+// NewAdminMiddleware 创建管理员校验中间件，secret 为空时拒绝所有管理请求
+func NewAdminMiddleware(secret string) *AdminMiddleware {
+	return &AdminMiddleware{
+		secret: []byte(secret),
+	}
+}
+
+// RequireAdmin 拒绝没有携带正确管理员密钥的请求，需要放在 Authenticate 之后
+func (m *AdminMiddleware) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(m.secret) == 0 {
+			http.Error(w, "管理接口未启用，请配置 ADMIN_TOKEN", http.StatusForbidden)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(AdminTokenHeader)), m.secret) != 1 {
+			http.Error(w, "需要管理员权限", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
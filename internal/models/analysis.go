@@ -0,0 +1,140 @@
+package models
+
+import (
+	"time"
+)
+
+// CUDA 显存分析发现的问题类型
+const (
+	CudaMemFindingLongLived   = "long_lived"   // 超过阈值仍未释放的分配
+	CudaMemFindingDoubleFree  = "double_free"  // 对已释放指针再次 cudaFree
+	CudaMemFindingUnknownFree = "unknown_free" // cudaFree 的指针从未被 cudaMalloc 分配过
+)
+
+// CudaMemFinding 对应 cuda_mem_findings 表中的一行
+type CudaMemFinding struct {
+	Ts          time.Time `json:"ts" db:"ts"` // long_lived 为分配时间，其余为 cudaFree 时间
+	MachineID   string    `json:"machine_id" db:"machine_id"`
+	PID         int32     `json:"pid" db:"pid"`
+	Comm        string    `json:"comm" db:"comm"`
+	Cmdline     string    `json:"cmdline" db:"cmdline"`
+	FindingType string    `json:"finding_type" db:"finding_type"`
+	CudaPtr     int64     `json:"cuda_ptr" db:"cuda_ptr"`
+	CudaSize    int64     `json:"cuda_size" db:"cuda_size"`
+	AgeNs       int64     `json:"age_ns" db:"age_ns"`
+	DetectedAt  time.Time `json:"detected_at" db:"detected_at"`
+}
+
+// InferenceSession 对应 inference_sessions 表中的一行，表示一次推理请求
+type InferenceSession struct {
+	Ts             time.Time `json:"ts" db:"ts"` // 会话开始时间
+	EndTs          time.Time `json:"end_ts" db:"end_ts"`
+	MachineID      string    `json:"machine_id" db:"machine_id"`
+	PID            int32     `json:"pid" db:"pid"`
+	Comm           string    `json:"comm" db:"comm"`
+	Cmdline        string    `json:"cmdline" db:"cmdline"`
+	DurationNs     int64     `json:"duration_ns" db:"duration_ns"`
+	GraphComputes  int32     `json:"graph_computes" db:"graph_computes"`
+	CpuGraphNs     int64     `json:"cpu_graph_ns" db:"cpu_graph_ns"`         // ggml_cost_ns 之和
+	GpuMatmulNs    int64     `json:"gpu_matmul_ns" db:"gpu_matmul_ns"`       // ggml_cuda_duration_ns 之和
+	GpuMatmulCalls int32     `json:"gpu_matmul_calls" db:"gpu_matmul_calls"` // ggml_cuda 事件数
+	MemcpyBytes    int64     `json:"memcpy_bytes" db:"memcpy_bytes"`
+	MemcpyCount    int32     `json:"memcpy_count" db:"memcpy_count"`
+	SyncWaitNs     int64     `json:"sync_wait_ns" db:"sync_wait_ns"` // cudaDeviceSynchronize 耗时之和
+	SyncCount      int32     `json:"sync_count" db:"sync_count"`
+	LogMarkers     int32     `json:"log_markers" db:"log_markers"` // 会话内匹配到的 llamaLog 标记数
+}
+
+// LLMTokenMetrics 对应 llm_token_metrics 表中的一行，是一次推理请求的 token 吞吐指标
+//
+// 第一个 token 由最后一次 prefill 计算产生，其后的每次 decode 计算产生一个 token，
+// 因此输出 token 数为 DecodeTokens + 1。
+type LLMTokenMetrics struct {
+	Ts           time.Time `json:"ts" db:"ts"` // 请求开始时间，与 inference_sessions.ts 一致
+	EndTs        time.Time `json:"end_ts" db:"end_ts"`
+	MachineID    string    `json:"machine_id" db:"machine_id"`
+	PID          int32     `json:"pid" db:"pid"`
+	Comm         string    `json:"comm" db:"comm"`
+	Cmdline      string    `json:"cmdline" db:"cmdline"`
+	PrefillSteps int32     `json:"prefill_steps" db:"prefill_steps"`
+	PrefillNs    int64     `json:"prefill_ns" db:"prefill_ns"` // prefill 计算的 ggml_cost_ns 之和
+	TTFTNs       int64     `json:"ttft_ns" db:"ttft_ns"`       // 请求开始到第一个 token
+	DecodeTokens int32     `json:"decode_tokens" db:"decode_tokens"`
+	DecodeNs     int64     `json:"decode_ns" db:"decode_ns"` // 第一个 token 到最后一个 token
+	TokensPerSec float64   `json:"tokens_per_sec" db:"tokens_per_sec"`
+	ITLAvgNs     int64     `json:"itl_avg_ns" db:"itl_avg_ns"`
+	ITLP50Ns     int64     `json:"itl_p50_ns" db:"itl_p50_ns"`
+	ITLP95Ns     int64     `json:"itl_p95_ns" db:"itl_p95_ns"`
+	ITLMaxNs     int64     `json:"itl_max_ns" db:"itl_max_ns"`
+}
+
+// LLMTokenMetricsBucket 是一个进程在一个时间桶内开始的请求的汇总指标
+type LLMTokenMetricsBucket struct {
+	Ts           time.Time `json:"ts" db:"ts"`
+	PID          int32     `json:"pid" db:"pid"`
+	Comm         string    `json:"comm" db:"comm"`
+	Requests     int32     `json:"requests" db:"requests"`
+	DecodeTokens int64     `json:"decode_tokens" db:"decode_tokens"`
+	TokensPerSec float64   `json:"tokens_per_sec" db:"tokens_per_sec"` // 总 decode token 数 / 总 decode 时间
+	TTFTAvgNs    int64     `json:"ttft_avg_ns" db:"ttft_avg_ns"`
+	TTFTMaxNs    int64     `json:"ttft_max_ns" db:"ttft_max_ns"`
+	ITLAvgNs     int64     `json:"itl_avg_ns" db:"itl_avg_ns"`
+	ITLP95MaxNs  int64     `json:"itl_p95_max_ns" db:"itl_p95_max_ns"` // 桶内各请求 ITL p95 的最大值
+}
+
+// CudaKernelStat 是一个进程在时间窗口内某个 CUDA kernel 的启动次数
+type CudaKernelStat struct {
+	PID        int32  `json:"pid" db:"pid"`
+	Comm       string `json:"comm" db:"comm"`
+	SymbolName string `json:"symbol_name" db:"symbol_name"` // 无法解析符号时为 kernel 函数地址 (0x...)
+	SymbolFile string `json:"symbol_file" db:"symbol_file"` // kernel 所在的库，例如 libggml-cuda.so
+	BuildID    string `json:"build_id,omitempty" db:"build_id"`
+	SymbolAddr int64  `json:"symbol_addr,omitempty" db:"symbol_addr"` // kernel 在 ELF 中的虚拟地址，与 BuildID 一起用于离线解析
+	Launches   int64  `json:"launches" db:"launches"`
+}
+
+// CudaKernelSample 是某个 kernel 在一个时间桶内的启动次数
+type CudaKernelSample struct {
+	Ts         time.Time `json:"ts" db:"ts"`
+	PID        int32     `json:"pid" db:"pid"`
+	SymbolName string    `json:"symbol_name" db:"symbol_name"`
+	BuildID    string    `json:"-" db:"build_id"`
+	SymbolAddr int64     `json:"-" db:"symbol_addr"`
+	Launches   int64     `json:"launches" db:"launches"`
+}
+
+// StackCount 是一个进程中某条用户态调用栈在时间窗口内的事件数和分配字节数
+type StackCount struct {
+	PID   int32    `json:"pid"`
+	Comm  string   `json:"comm"`
+	Stack []string `json:"stack"` // 从栈顶到栈底
+	Count int64    `json:"count"`
+	Bytes int64    `json:"bytes"` // 仅分配类操作有意义
+}
+
+// SyscallCount 是一个进程 (或同名进程合计，此时 PID 为 0) 在时间窗口内某个系统调用的次数，来自 syscall_rollups
+type SyscallCount struct {
+	PID         int32  `json:"pid" db:"pid"`
+	Comm        string `json:"comm" db:"comm"`
+	SyscallName string `json:"syscall_name" db:"syscall_name"`
+	Count       int64  `json:"count" db:"count"`
+}
+
+// SyscallSample 是一个进程某个系统调用在一个时间桶内的次数
+type SyscallSample struct {
+	Ts          time.Time `json:"ts" db:"ts"`
+	PID         int32     `json:"pid" db:"pid"`
+	SyscallName string    `json:"syscall_name" db:"syscall_name"`
+	Count       int64     `json:"count" db:"count"`
+}
+
+// FileAccessStat 是一个进程在时间窗口内打开某个文件的次数，来自 vfs_open 事件
+type FileAccessStat struct {
+	PID     int32     `json:"pid" db:"pid"`
+	Comm    string    `json:"comm" db:"comm"`
+	Cmdline string    `json:"cmdline" db:"cmdline"`
+	Path    string    `json:"path" db:"path"`
+	Opens   int64     `json:"opens" db:"opens"`
+	FirstTs time.Time `json:"first_ts" db:"first_ts"`
+	LastTs  time.Time `json:"last_ts" db:"last_ts"`
+}
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"time"
+)
+
+// OSEvent 对应 events_os 表中的一行 (vfs_open, syscalls, sched, execv)
+type OSEvent struct {
+	Ts           time.Time `json:"ts" db:"ts"`
+	MachineID    string    `json:"machine_id" db:"machine_id"`
+	EventSubtype string    `json:"event_subtype" db:"event_subtype"`
+	PID          int32     `json:"pid" db:"pid"`
+	Comm         string    `json:"comm" db:"comm"`
+	Cmdline      string    `json:"cmdline" db:"cmdline"`
+	ProcUID      string    `json:"proc_uid,omitempty" db:"proc_uid"`
+	ContainerID  string    `json:"container_id,omitempty" db:"container_id"`
+	Cgroup       string    `json:"cgroup,omitempty" db:"cgroup"`
+	PodUID       string    `json:"pod_uid,omitempty" db:"pod_uid"`
+	UID          int32     `json:"uid" db:"uid"`
+	EUID         int32     `json:"euid" db:"euid"`
+	GID          int32     `json:"gid" db:"gid"`
+	Username     string    `json:"username,omitempty" db:"username"`
+	MntNS        int64     `json:"mnt_ns,omitempty" db:"mnt_ns"`
+	PidNS        int64     `json:"pid_ns,omitempty" db:"pid_ns"`
+	ExePath      string    `json:"exe_path,omitempty" db:"exe_path"`
+	ExeInode     int64     `json:"exe_inode,omitempty" db:"exe_inode"`
+	ExeBuildID   string    `json:"exe_build_id,omitempty" db:"exe_build_id"`
+	ExeDeleted   bool      `json:"exe_deleted,omitempty" db:"exe_deleted"`
+	VfsFilename  string    `json:"vfs_filename,omitempty" db:"vfs_filename"`
+	SyscallName  string    `json:"syscall_name,omitempty" db:"syscall_name"`
+	Cpu          int32     `json:"cpu" db:"cpu"`
+	SchedType    string    `json:"sched_type,omitempty" db:"sched_type"`
+	Tgid         int32     `json:"tgid,omitempty" db:"tgid"` // sched 事件的所属进程 ID，旧数据等于 pid
+	Ppid         int32     `json:"ppid,omitempty" db:"ppid"`
+	PpidComm     string    `json:"ppid_comm,omitempty" db:"ppid_comm"`
+	PpidCmdline  string    `json:"ppid_cmdline,omitempty" db:"ppid_cmdline"`
+	ExecFilename string    `json:"exec_filename,omitempty" db:"exec_filename"`
+	ExecArgs     string    `json:"exec_args,omitempty" db:"exec_args"`
+}
+
+// CudaEvent 对应 events_cuda 表中的一行
+type CudaEvent struct {
+	Ts                   time.Time `json:"ts" db:"ts"`
+	MachineID            string    `json:"machine_id" db:"machine_id"`
+	EventSubtype         string    `json:"event_subtype" db:"event_subtype"`
+	PID                  int32     `json:"pid" db:"pid"`
+	Comm                 string    `json:"comm" db:"comm"`
+	Cmdline              string    `json:"cmdline" db:"cmdline"`
+	ProcUID              string    `json:"proc_uid,omitempty" db:"proc_uid"`
+	ContainerID          string    `json:"container_id,omitempty" db:"container_id"`
+	Cgroup               string    `json:"cgroup,omitempty" db:"cgroup"`
+	PodUID               string    `json:"pod_uid,omitempty" db:"pod_uid"`
+	UID                  int32     `json:"uid" db:"uid"`
+	EUID                 int32     `json:"euid" db:"euid"`
+	GID                  int32     `json:"gid" db:"gid"`
+	Username             string    `json:"username,omitempty" db:"username"`
+	MntNS                int64     `json:"mnt_ns,omitempty" db:"mnt_ns"`
+	PidNS                int64     `json:"pid_ns,omitempty" db:"pid_ns"`
+	ExePath              string    `json:"exe_path,omitempty" db:"exe_path"`
+	ExeInode             int64     `json:"exe_inode,omitempty" db:"exe_inode"`
+	ExeBuildID           string    `json:"exe_build_id,omitempty" db:"exe_build_id"`
+	ExeDeleted           bool      `json:"exe_deleted,omitempty" db:"exe_deleted"`
+	Operation            string    `json:"operation" db:"operation"`
+	CudaPtr              int64     `json:"cuda_ptr,omitempty" db:"cuda_ptr"`
+	CudaSize             int64     `json:"cuda_size,omitempty" db:"cuda_size"`
+	CudaRetval           int32     `json:"cuda_retval,omitempty" db:"cuda_retval"`
+	CudaFuncPtr          int64     `json:"cuda_func_ptr,omitempty" db:"cuda_func_ptr"`
+	CudaSymbolName       string    `json:"cuda_symbol_name,omitempty" db:"cuda_symbol_name"`
+	CudaSymbolFile       string    `json:"cuda_symbol_file,omitempty" db:"cuda_symbol_file"`
+	CudaSymbolOffset     int64     `json:"cuda_symbol_offset,omitempty" db:"cuda_symbol_offset"`
+	CudaSymbolSourcefile string    `json:"cuda_symbol_sourcefile,omitempty" db:"cuda_symbol_sourcefile"`
+	CudaSymbolBuildID    string    `json:"cuda_symbol_build_id,omitempty" db:"cuda_symbol_build_id"`
+	CudaSymbolAddr       int64     `json:"cuda_symbol_addr,omitempty" db:"cuda_symbol_addr"` // 符号在 ELF 中的虚拟地址
+	CudaMemcpySrc        int64     `json:"cuda_memcpy_src,omitempty" db:"cuda_memcpy_src"`
+	CudaMemcpyDst        int64     `json:"cuda_memcpy_dst,omitempty" db:"cuda_memcpy_dst"`
+	CudaMemcpyKind       int32     `json:"cuda_memcpy_kind,omitempty" db:"cuda_memcpy_kind"`
+	CudaMemcpyType       string    `json:"cuda_memcpy_type,omitempty" db:"cuda_memcpy_type"`
+	CudaMemcpyDurationNs int64     `json:"cuda_memcpy_duration_ns,omitempty" db:"cuda_memcpy_duration_ns"`
+	CudaSyncDurationNs   int64     `json:"cuda_sync_duration_ns,omitempty" db:"cuda_sync_duration_ns"`
+}
+
+// GGMLEvent 对应 events_ggml 表中的一行
+type GGMLEvent struct {
+	Ts                 time.Time `json:"ts" db:"ts"`
+	MachineID          string    `json:"machine_id" db:"machine_id"`
+	EventSubtype       string    `json:"event_subtype" db:"event_subtype"`
+	PID                int32     `json:"pid" db:"pid"`
+	Comm               string    `json:"comm" db:"comm"`
+	Cmdline            string    `json:"cmdline" db:"cmdline"`
+	ProcUID            string    `json:"proc_uid,omitempty" db:"proc_uid"`
+	ContainerID        string    `json:"container_id,omitempty" db:"container_id"`
+	Cgroup             string    `json:"cgroup,omitempty" db:"cgroup"`
+	PodUID             string    `json:"pod_uid,omitempty" db:"pod_uid"`
+	UID                int32     `json:"uid" db:"uid"`
+	EUID               int32     `json:"euid" db:"euid"`
+	GID                int32     `json:"gid" db:"gid"`
+	Username           string    `json:"username,omitempty" db:"username"`
+	MntNS              int64     `json:"mnt_ns,omitempty" db:"mnt_ns"`
+	PidNS              int64     `json:"pid_ns,omitempty" db:"pid_ns"`
+	ExePath            string    `json:"exe_path,omitempty" db:"exe_path"`
+	ExeInode           int64     `json:"exe_inode,omitempty" db:"exe_inode"`
+	ExeBuildID         string    `json:"exe_build_id,omitempty" db:"exe_build_id"`
+	ExeDeleted         bool      `json:"exe_deleted,omitempty" db:"exe_deleted"`
+	Operation          string    `json:"operation" db:"operation"`
+	GGMLCudaFuncName   string    `json:"ggml_cuda_func_name,omitempty" db:"ggml_cuda_func_name"`
+	GGMLCudaDurationNs int64     `json:"ggml_cuda_duration_ns,omitempty" db:"ggml_cuda_duration_ns"`
+	GGMLGraphSize      int32     `json:"ggml_graph_size,omitempty" db:"ggml_graph_size"`
+	GGMLGraphNodes     int32     `json:"ggml_graph_nodes,omitempty" db:"ggml_graph_nodes"`
+	GGMLGraphLeafs     int32     `json:"ggml_graph_leafs,omitempty" db:"ggml_graph_leafs"`
+	GGMLGraphOrder     string    `json:"ggml_graph_order,omitempty" db:"ggml_graph_order"`
+	GGMLCostNs         int64     `json:"ggml_cost_ns,omitempty" db:"ggml_cost_ns"`
+	GGMLMemSize        int64     `json:"ggml_mem_size,omitempty" db:"ggml_mem_size"`
+	GGMLMemPtr         int64     `json:"ggml_mem_ptr,omitempty" db:"ggml_mem_ptr"`
+}
+
+// AppLogEvent 对应 events_app_log 表中的一行 (llamaLog)
+type AppLogEvent struct {
+	Ts           time.Time `json:"ts" db:"ts"`
+	MachineID    string    `json:"machine_id" db:"machine_id"`
+	EventSubtype string    `json:"event_subtype" db:"event_subtype"`
+	PID          int32     `json:"pid" db:"pid"`
+	Comm         string    `json:"comm" db:"comm"`
+	Cmdline      string    `json:"cmdline" db:"cmdline"`
+	ProcUID      string    `json:"proc_uid,omitempty" db:"proc_uid"`
+	ContainerID  string    `json:"container_id,omitempty" db:"container_id"`
+	Cgroup       string    `json:"cgroup,omitempty" db:"cgroup"`
+	PodUID       string    `json:"pod_uid,omitempty" db:"pod_uid"`
+	UID          int32     `json:"uid" db:"uid"`
+	EUID         int32     `json:"euid" db:"euid"`
+	GID          int32     `json:"gid" db:"gid"`
+	Username     string    `json:"username,omitempty" db:"username"`
+	MntNS        int64     `json:"mnt_ns,omitempty" db:"mnt_ns"`
+	PidNS        int64     `json:"pid_ns,omitempty" db:"pid_ns"`
+	ExePath      string    `json:"exe_path,omitempty" db:"exe_path"`
+	ExeInode     int64     `json:"exe_inode,omitempty" db:"exe_inode"`
+	ExeBuildID   string    `json:"exe_build_id,omitempty" db:"exe_build_id"`
+	ExeDeleted   bool      `json:"exe_deleted,omitempty" db:"exe_deleted"`
+	LogText      string    `json:"log_text" db:"log_text"`
+}
@@ -27,6 +27,12 @@ type SyscallsEvent struct {
 	SyscallName string
 }
 
+// SyscallsAggTopic 不来自探针: agent 按 (pid, syscall) 汇总 syscalls 事件后以该 topic 写入 Redis Stream
+const SyscallsAggTopic = "syscalls_agg"
+
+// RuleAggTopic 是 agent 规则引擎 aggregate 动作周期写入的汇总事件
+const RuleAggTopic = "rule_agg"
+
 //! [syscalls] END
 
 //! [sched]
@@ -90,6 +96,7 @@ type GGMLBaseEvent struct {
 	Type        int32
 	Size        uint64
 	Ptr         uint64
+	Stack       []uint64 // 用户态调用栈，从栈顶开始；探针未开启 -s 或 free 事件时为空
 }
 
 //! [execv]
@@ -115,6 +122,7 @@ type CudaMallocEvent struct {
 	AllocatedPtr uint64
 	Size         uint64
 	Retval       int
+	Stack        []uint64 // 用户态调用栈，从栈顶开始；探针未开启 -s 时为空
 }
 
 const CudaFreeTopic = "cudaFree"
@@ -133,6 +141,7 @@ type CudaLaunchKernelEvent struct {
 	PID         int32
 	Comm        string
 	FuncPtr     uint64
+	Stack       []uint64 // 用户态调用栈，从栈顶开始；探针未开启 -s 时为空
 }
 
 const CudaMemcpyTopic = "cudaMemcpy"
@@ -145,6 +154,7 @@ type CudaMemcpyEvent struct {
 	Dst         uint64
 	Size        uint64
 	Kind        int
+	DurationNs  uint64 // cudaMemcpy 执行耗时
 }
 
 const CudaSyncTopic = "cudaDeviceSynchronize"
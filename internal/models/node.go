@@ -12,4 +12,100 @@ type NodeInfo struct {
 	Status   string            `json:"status" validate:"required"` // Status of the agent (online, offline)
 	Token    string            `json:"token,omitempty"`            // Authentication token
 	Latency  time.Duration     `json:"latency,omitempty"`          // Latency of the agent
+
+	Labels     map[string]string `json:"labels,omitempty"`      // 注册时使用的加入令牌上的标签
+	EnrolledAt time.Time         `json:"enrolled_at,omitempty"` // 首次注册 (enroll) 的时间
+
+	Port      int            `json:"port,omitempty"`      // agent API 的端口，轮询模式使用
+	Heartbeat *NodeHeartbeat `json:"heartbeat,omitempty"` // 最近一次心跳
+	Inventory *NodeInventory `json:"inventory,omitempty"` // 最近一次上报的软硬件信息
+}
+
+// GPUInfo 是节点上的一块 NVIDIA GPU
+type GPUInfo struct {
+	Model    string `json:"model,omitempty"` // 只有 /proc/driver/nvidia 中有型号名
+	UUID     string `json:"uuid,omitempty"`
+	BusID    string `json:"bus_id"`    // PCI 地址，例如 0000:01:00.0
+	DeviceID string `json:"device_id"` // PCI device id，例如 0x2684
+	Source   string `json:"source"`    // procfs 或 sysfs
+}
+
+// BinaryInfo 是在节点上发现的推理程序或库
+type BinaryInfo struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// NodeInventory 是 agent 采集的节点软硬件信息，在注册时上报，之后随心跳定期刷新
+type NodeInventory struct {
+	CollectedAt   time.Time     `json:"collected_at"`
+	Hostname      string        `json:"hostname"`
+	OS            string        `json:"os"` // /etc/os-release 的 PRETTY_NAME
+	Arch          string        `json:"arch"`
+	KernelVersion string        `json:"kernel_version"`
+	BTF           bool          `json:"btf"` // /sys/kernel/btf/vmlinux 存在，CO-RE 探针可以运行
+	CPUModel      string        `json:"cpu_model"`
+	CPUCores      int           `json:"cpu_cores"`
+	MemoryBytes   uint64        `json:"memory_bytes"`
+	NvidiaDriver  string        `json:"nvidia_driver,omitempty"`
+	GPUs          []GPUInfo     `json:"gpus,omitempty"`
+	CUDARuntimes  []string      `json:"cuda_runtimes,omitempty"` // 找到的 libcudart.so 路径
+	LLMBinaries   []BinaryInfo  `json:"llm_binaries,omitempty"`  // ollama、llama.cpp 等
+	AgentVersion  string        `json:"agent_version"`
+	Probes        []ProbeStatus `json:"probes,omitempty"`
+}
+
+// 节点的健康状态，由 agent 在心跳中上报
+const (
+	NodeHealthOK       = "ok"
+	NodeHealthDegraded = "degraded" // 有探针未运行或消息积压
+)
+
+// ProbeStatus 是 agent 启动的一个探针的状态
+type ProbeStatus struct {
+	Name    string `json:"name"`
+	Runtime string `json:"runtime"`       // go (进程内) 或 c (C 加载程序)
+	PID     int    `json:"pid,omitempty"` // C 加载程序的 pid
+	Running bool   `json:"running"`
+	Version string `json:"version,omitempty"` // 探针对象或 C 加载程序的 SHA-256 前缀
+}
+
+// NodeHeartbeat 是 agent 周期性推送给 center 的心跳，请求用节点凭据签名
+type NodeHeartbeat struct {
+	Timestamp     time.Time      `json:"timestamp"`
+	Version       string         `json:"version"`
+	UptimeSec     int64          `json:"uptime_sec"`
+	Health        string         `json:"health"`
+	Problems      []string       `json:"problems,omitempty"` // Health 为 degraded 的原因
+	Probes        []ProbeStatus  `json:"probes"`
+	SpoolDepth    int            `json:"spool_depth"`         // 等待处理的事件数
+	SpoolCapacity int            `json:"spool_capacity"`      // 事件缓冲区的容量
+	IPCRejected   uint64         `json:"ipc_rejected"`        // 被拒绝的 IPC 消息数
+	Inventory     *NodeInventory `json:"inventory,omitempty"` // 定期附带最新的软硬件信息
+}
+
+// JoinToken 是管理员创建的节点加入令牌。agent 首次启动时出示令牌完成注册，换取长期有效的节点凭据。
+// 令牌本身 ("<id>.<secret>") 只在创建时返回一次，服务端只保存 secret 的 SHA-256。
+type JoinToken struct {
+	ID          string            `json:"id"`
+	Description string            `json:"description,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`     // 使用该令牌注册的节点获得的标签
+	SingleUse   bool              `json:"single_use"`           // 只能注册一个节点
+	ExpiresAt   time.Time         `json:"expires_at,omitempty"` // 零值表示不过期
+	CreatedAt   time.Time         `json:"created_at"`
+	CreatedBy   string            `json:"created_by,omitempty"` // 创建者的用户 ID
+	Uses        int64             `json:"uses"`                 // 已注册的节点数
+}
+
+// NodeEnrollRequest 是 agent 首次注册的请求
+type NodeEnrollRequest struct {
+	Node      NodeInfo `json:"node"`
+	JoinToken string   `json:"join_token"`
+}
+
+// NodeEnrollResponse 返回长期有效的节点凭据和本次会话的 token。
+// 之后的注册 (/api/v1/node/up) 用凭据对请求做 HMAC 签名以证明持有凭据。
+type NodeEnrollResponse struct {
+	Credential string `json:"credential"`
+	Token      string `json:"token"`
 }
@@ -0,0 +1,122 @@
+// cgroup.go
+package platform
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ContainerInfo 描述进程所在的 cgroup 以及从 cgroup 路径中识别出的容器信息。
+// 不在容器中的进程只有 CgroupPath。
+type ContainerInfo struct {
+	CgroupPath  string // 例如 /system.slice/docker-<id>.scope
+	ContainerID string // 64 位十六进制容器 ID
+	Runtime     string // docker, containerd, cri-o, podman；kubelet cgroupfs 布局下无法区分时为空
+	PodUID      string // Kubernetes pod UID，仅在 kubelet 的 cgroup 布局中可识别
+}
+
+var (
+	containerCache     map[int]ContainerInfo
+	containerCacheLock sync.Mutex
+
+	containerIDRegex = regexp.MustCompile(`^(?:(docker|cri-containerd|crio|libpod)-)?([0-9a-f]{64})(?:\.scope)?$`)
+	// cgroupfs: /kubepods/burstable/pod<uid>/...，systemd: /kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod<uid>.slice/...
+	// systemd 驱动把 uid 中的 '-' 替换为 '_'
+	podUIDRegex = regexp.MustCompile(`pod([0-9a-f]{8}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{12})`)
+
+	containerRuntimes = map[string]string{
+		"docker":         "docker",
+		"cri-containerd": "containerd",
+		"crio":           "cri-o",
+		"libpod":         "podman",
+	}
+)
+
+// ParseCgroupPath 从 /proc/[pid]/cgroup 的内容中取出进程的 cgroup 路径。
+// 优先使用 cgroup v2 的统一层级 (0::/path)，v1 下依次尝试 name=systemd、pids、memory、cpu 控制器。
+func ParseCgroupPath(content string) string {
+	paths := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(content), "\n") {
+		// hierarchy-ID:controller-list:cgroup-path，路径中可能包含 ':'
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[1] == "" {
+			paths[""] = parts[2]
+			continue
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			paths[controller] = parts[2]
+		}
+	}
+	// 混合模式下 v1 控制器仍在使用时 0::/ 只是占位，继续查找 v1 的路径
+	if p, ok := paths[""]; ok && p != "/" {
+		return p
+	}
+	for _, controller := range []string{"name=systemd", "pids", "memory", "cpu"} {
+		if p, ok := paths[controller]; ok {
+			return p
+		}
+	}
+	return paths[""]
+}
+
+// ParseContainerInfo 识别 cgroup 路径中的容器 ID、容器运行时和 pod UID。
+// 容器 ID 取自最后一个形如容器 ID 的路径组件，以兼容 systemd 和 cgroupfs 两种驱动。
+func ParseContainerInfo(cgroupPath string) ContainerInfo {
+	info := ContainerInfo{CgroupPath: cgroupPath}
+	parts := strings.Split(cgroupPath, "/")
+	for i := len(parts) - 1; i >= 0; i-- {
+		m := containerIDRegex.FindStringSubmatch(parts[i])
+		if m == nil {
+			continue
+		}
+		info.ContainerID = m[2]
+		info.Runtime = containerRuntimes[m[1]]
+		// cgroupfs 驱动下 docker 的路径为 /docker/<id>
+		if info.Runtime == "" && i > 0 && parts[i-1] == "docker" {
+			info.Runtime = "docker"
+		}
+		break
+	}
+	if m := podUIDRegex.FindStringSubmatch(cgroupPath); m != nil {
+		info.PodUID = strings.ReplaceAll(m[1], "_", "-")
+	}
+	return info
+}
+
+// GetContainerInfo 返回进程的 cgroup 和容器信息。进程不会在运行中换到另一个容器，
+// 因此结果缓存到 InvalidatePid 或 ReapExitedPids 清除为止。
+func GetContainerInfo(pid int) (ContainerInfo, error) {
+	if pid <= 0 {
+		return ContainerInfo{}, fmt.Errorf("invalid pid: %d", pid)
+	}
+
+	containerCacheLock.Lock()
+	if containerCache == nil {
+		containerCache = make(map[int]ContainerInfo)
+	}
+	cachedValue, found := containerCache[pid]
+	containerCacheLock.Unlock()
+	if found {
+		return cachedValue, nil
+	}
+
+	GetStartTime(pid)
+	path := fmt.Sprintf("/proc/%d/cgroup", pid)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ContainerInfo{}, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	info := ParseContainerInfo(ParseCgroupPath(string(content)))
+
+	containerCacheLock.Lock()
+	containerCache[pid] = info
+	containerCacheLock.Unlock()
+
+	return info, nil
+}
@@ -0,0 +1,67 @@
+// cgroup_test.go
+package platform
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseCgroupPath(t *testing.T) {
+	cases := []struct {
+		name, content, want string
+	}{
+		{"v2", "0::/system.slice/docker-abc.scope\n", "/system.slice/docker-abc.scope"},
+		{"v1", "12:pids:/docker/abc\n11:cpu,cpuacct:/docker/abc\n1:name=systemd:/docker/abc\n0::/\n", "/docker/abc"},
+		{"root", "0::/\n", "/"},
+		{"colon in path", "0::/user.slice/a:b\n", "/user.slice/a:b"},
+	}
+	for _, c := range cases {
+		if got := ParseCgroupPath(c.content); got != c.want {
+			t.Errorf("%s: ParseCgroupPath = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestParseContainerInfo(t *testing.T) {
+	id := "3f4e5d6c7b8a99887766554433221100ffeeddccbbaa00998877665544332211"
+	cases := []struct {
+		path string
+		want ContainerInfo
+	}{
+		{"/system.slice/docker-" + id + ".scope", ContainerInfo{ContainerID: id, Runtime: "docker"}},
+		{"/docker/" + id, ContainerInfo{ContainerID: id, Runtime: "docker"}},
+		{
+			"/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1a2b3c4d_0000_1111_2222_333344445555.slice/cri-containerd-" + id + ".scope",
+			ContainerInfo{ContainerID: id, Runtime: "containerd", PodUID: "1a2b3c4d-0000-1111-2222-333344445555"},
+		},
+		{
+			"/kubepods/besteffort/pod1a2b3c4d-0000-1111-2222-333344445555/" + id,
+			ContainerInfo{ContainerID: id, PodUID: "1a2b3c4d-0000-1111-2222-333344445555"},
+		},
+		{"/user.slice/user-1000.slice/session-2.scope", ContainerInfo{}},
+	}
+	for _, c := range cases {
+		c.want.CgroupPath = c.path
+		if got := ParseContainerInfo(c.path); got != c.want {
+			t.Errorf("ParseContainerInfo(%q) = %+v, want %+v", c.path, got, c.want)
+		}
+	}
+}
+
+func TestGetContainerInfo(t *testing.T) {
+	if _, err := os.Stat("/proc/self/cgroup"); err != nil {
+		t.Skip("/proc/self/cgroup not available")
+	}
+	pid := os.Getpid()
+	info, err := GetContainerInfo(pid)
+	if err != nil {
+		t.Fatalf("GetContainerInfo(%d): %v", pid, err)
+	}
+	if info.CgroupPath == "" {
+		t.Errorf("expected a cgroup path for pid %d", pid)
+	}
+	InvalidatePid(pid)
+	if _, found := containerCache[pid]; found {
+		t.Errorf("InvalidatePid should clear the container cache")
+	}
+}
@@ -0,0 +1,239 @@
+// identity.go
+package platform
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// ProcessIdentity 描述进程的用户、命名空间和可执行文件，用于区分同名进程和发现从已删除文件运行的程序
+type ProcessIdentity struct {
+	UID        int
+	EUID       int
+	GID        int
+	Username   string // 按主机的用户数据库解析 UID，容器内的用户可能无法解析，此时为空
+	MntNS      uint64 // mount 命名空间 inode
+	PidNS      uint64 // pid 命名空间 inode
+	ExePath    string // /proc/[pid]/exe 指向的路径，已去掉 " (deleted)" 后缀
+	ExeDeleted bool   // 可执行文件在进程启动后被删除或替换
+	ExeInode   uint64
+	BuildID    string // ELF 的 GNU build-id (十六进制)，没有时为空
+}
+
+const deletedSuffix = " (deleted)"
+
+type buildIDKey struct {
+	dev, ino uint64
+	mtimeNs  int64
+}
+
+var (
+	identityCache     map[int]ProcessIdentity
+	identityCacheLock sync.Mutex
+
+	usernameCache     = make(map[int]string)
+	usernameCacheLock sync.Mutex
+
+	// 同一个可执行文件通常对应多个进程，build-id 按文件缓存
+	buildIDCache     = make(map[buildIDKey]string)
+	buildIDCacheLock sync.Mutex
+)
+
+// ParseStatusIDs 从 /proc/[pid]/status 的内容中解析真实 UID、有效 UID 和真实 GID
+func ParseStatusIDs(status string) (uid, euid, gid int, err error) {
+	var foundUID, foundGID bool
+	for _, line := range strings.Split(status, "\n") {
+		if rest, ok := strings.CutPrefix(line, "Uid:"); ok {
+			// Uid: real effective saved filesystem
+			fields := strings.Fields(rest)
+			if len(fields) < 2 {
+				return 0, 0, 0, fmt.Errorf("malformed Uid line: %q", line)
+			}
+			if uid, err = strconv.Atoi(fields[0]); err != nil {
+				return 0, 0, 0, err
+			}
+			if euid, err = strconv.Atoi(fields[1]); err != nil {
+				return 0, 0, 0, err
+			}
+			foundUID = true
+		} else if rest, ok := strings.CutPrefix(line, "Gid:"); ok {
+			fields := strings.Fields(rest)
+			if len(fields) < 1 {
+				return 0, 0, 0, fmt.Errorf("malformed Gid line: %q", line)
+			}
+			if gid, err = strconv.Atoi(fields[0]); err != nil {
+				return 0, 0, 0, err
+			}
+			foundGID = true
+		}
+	}
+	if !foundUID || !foundGID {
+		return 0, 0, 0, fmt.Errorf("Uid or Gid not found in status")
+	}
+	return uid, euid, gid, nil
+}
+
+// ParseNamespaceLink 解析 /proc/[pid]/ns/* 符号链接的目标 (例如 "mnt:[4026531841]")，返回命名空间 inode
+func ParseNamespaceLink(link string) (uint64, error) {
+	start := strings.IndexByte(link, '[')
+	if start < 0 || !strings.HasSuffix(link, "]") {
+		return 0, fmt.Errorf("malformed namespace link: %q", link)
+	}
+	return strconv.ParseUint(link[start+1:len(link)-1], 10, 64)
+}
+
+// ReadELFBuildID 从 ELF 文件的 PT_NOTE 段 (或 .note.gnu.build-id 节) 中读取 GNU build-id
+func ReadELFBuildID(r io.ReaderAt) (string, error) {
+	f, err := elf.NewFile(r)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_NOTE {
+			continue
+		}
+		data, err := io.ReadAll(prog.Open())
+		if err != nil {
+			continue
+		}
+		if id, ok := findGNUBuildID(data, f.ByteOrder); ok {
+			return id, nil
+		}
+	}
+	// 没有程序头的文件 (如被 strip 的 .debug 文件) 只有节
+	if sec := f.Section(".note.gnu.build-id"); sec != nil {
+		if data, err := sec.Data(); err == nil {
+			if id, ok := findGNUBuildID(data, f.ByteOrder); ok {
+				return id, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no GNU build-id note")
+}
+
+// findGNUBuildID 遍历 ELF note 列表，查找 name 为 "GNU"、type 为 NT_GNU_BUILD_ID 的 note
+func findGNUBuildID(data []byte, order binary.ByteOrder) (string, bool) {
+	const ntGNUBuildID = 3
+	align := func(n uint32) uint32 { return (n + 3) &^ 3 }
+	for len(data) >= 12 {
+		namesz := order.Uint32(data[0:4])
+		descsz := order.Uint32(data[4:8])
+		typ := order.Uint32(data[8:12])
+		data = data[12:]
+		if uint64(align(namesz))+uint64(align(descsz)) > uint64(len(data)) {
+			return "", false
+		}
+		name := data[:namesz]
+		desc := data[align(namesz) : align(namesz)+descsz]
+		data = data[align(namesz)+align(descsz):]
+		if typ == ntGNUBuildID && bytes.Equal(bytes.TrimRight(name, "\x00"), []byte("GNU")) {
+			return hex.EncodeToString(desc), true
+		}
+	}
+	return "", false
+}
+
+// lookupUsername 返回 uid 对应的用户名，无法解析时返回空字符串
+func lookupUsername(uid int) string {
+	usernameCacheLock.Lock()
+	name, found := usernameCache[uid]
+	usernameCacheLock.Unlock()
+	if found {
+		return name
+	}
+	if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+		name = u.Username
+	}
+	usernameCacheLock.Lock()
+	usernameCache[uid] = name
+	usernameCacheLock.Unlock()
+	return name
+}
+
+// exeBuildID 返回进程可执行文件的 build-id。通过 /proc/[pid]/exe 打开，文件已被删除时仍然可读。
+func exeBuildID(pid int, fi os.FileInfo, st *syscall.Stat_t) string {
+	key := buildIDKey{dev: uint64(st.Dev), ino: st.Ino, mtimeNs: fi.ModTime().UnixNano()}
+	buildIDCacheLock.Lock()
+	id, found := buildIDCache[key]
+	buildIDCacheLock.Unlock()
+	if found {
+		return id
+	}
+
+	if f, err := os.Open(fmt.Sprintf("/proc/%d/exe", pid)); err == nil {
+		id, _ = ReadELFBuildID(f)
+		f.Close()
+	}
+	buildIDCacheLock.Lock()
+	buildIDCache[key] = id
+	buildIDCacheLock.Unlock()
+	return id
+}
+
+// GetProcessIdentity 返回进程的用户、命名空间和可执行文件信息。这些信息只会因 exec 改变，
+// 因此结果缓存到 InvalidatePid (execv 事件) 或 ReapExitedPids 清除为止。
+// 内核线程没有可执行文件，此时 Exe 相关字段为空；没有权限读取的字段同样为空。
+func GetProcessIdentity(pid int) (ProcessIdentity, error) {
+	if pid <= 0 {
+		return ProcessIdentity{}, fmt.Errorf("invalid pid: %d", pid)
+	}
+
+	identityCacheLock.Lock()
+	if identityCache == nil {
+		identityCache = make(map[int]ProcessIdentity)
+	}
+	cachedValue, found := identityCache[pid]
+	identityCacheLock.Unlock()
+	if found {
+		return cachedValue, nil
+	}
+
+	GetStartTime(pid)
+	path := fmt.Sprintf("/proc/%d/status", pid)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ProcessIdentity{}, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	var id ProcessIdentity
+	if id.UID, id.EUID, id.GID, err = ParseStatusIDs(string(content)); err != nil {
+		return ProcessIdentity{}, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	id.Username = lookupUsername(id.UID)
+
+	if link, err := os.Readlink(fmt.Sprintf("/proc/%d/ns/mnt", pid)); err == nil {
+		id.MntNS, _ = ParseNamespaceLink(link)
+	}
+	if link, err := os.Readlink(fmt.Sprintf("/proc/%d/ns/pid", pid)); err == nil {
+		id.PidNS, _ = ParseNamespaceLink(link)
+	}
+
+	exeLink := fmt.Sprintf("/proc/%d/exe", pid)
+	if target, err := os.Readlink(exeLink); err == nil {
+		id.ExePath, id.ExeDeleted = strings.CutSuffix(target, deletedSuffix)
+		// Stat 跟随 /proc/[pid]/exe 指向进程实际映射的文件，即使它已被删除
+		if fi, err := os.Stat(exeLink); err == nil {
+			if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+				id.ExeInode = st.Ino
+				id.BuildID = exeBuildID(pid, fi, st)
+			}
+		}
+	}
+
+	identityCacheLock.Lock()
+	identityCache[pid] = id
+	identityCacheLock.Unlock()
+
+	return id, nil
+}
@@ -0,0 +1,58 @@
+// identity_test.go
+package platform
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseStatusIDs(t *testing.T) {
+	status := "Name:\tpython3\nUmask:\t0022\nUid:\t1000\t0\t0\t0\nGid:\t100\t100\t100\t100\n"
+	uid, euid, gid, err := ParseStatusIDs(status)
+	if err != nil {
+		t.Fatalf("ParseStatusIDs: %v", err)
+	}
+	if uid != 1000 || euid != 0 || gid != 100 {
+		t.Errorf("got uid=%d euid=%d gid=%d, want 1000 0 100", uid, euid, gid)
+	}
+	if _, _, _, err := ParseStatusIDs("Name:\tx\n"); err == nil {
+		t.Error("expected an error without Uid/Gid lines")
+	}
+}
+
+func TestParseNamespaceLink(t *testing.T) {
+	ino, err := ParseNamespaceLink("mnt:[4026531841]")
+	if err != nil || ino != 4026531841 {
+		t.Errorf("ParseNamespaceLink = %d, %v", ino, err)
+	}
+	if _, err := ParseNamespaceLink("mnt:4026531841"); err == nil {
+		t.Error("expected an error for a malformed link")
+	}
+}
+
+func TestGetProcessIdentity(t *testing.T) {
+	if _, err := os.Stat("/proc/self/exe"); err != nil {
+		t.Skip("/proc not available")
+	}
+	pid := os.Getpid()
+	id, err := GetProcessIdentity(pid)
+	if err != nil {
+		t.Fatalf("GetProcessIdentity(%d): %v", pid, err)
+	}
+	if id.UID != os.Getuid() || id.GID != os.Getgid() {
+		t.Errorf("uid/gid = %d/%d, want %d/%d", id.UID, id.GID, os.Getuid(), os.Getgid())
+	}
+	exe, _ := os.Executable()
+	if id.ExePath != exe || id.ExeDeleted || id.ExeInode == 0 {
+		t.Errorf("exe = %+v, want path %s", id, exe)
+	}
+	// go test 构建的测试二进制带有 Go build-id note，不一定有 GNU build-id，只检查读取不会失败
+	f, err := os.Open(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if buildID, err := ReadELFBuildID(f); err == nil && buildID != id.BuildID {
+		t.Errorf("build-id = %q, want %q", id.BuildID, buildID)
+	}
+}
@@ -0,0 +1,278 @@
+// inventory.go
+package platform
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"scope/internal/models"
+)
+
+// nvidiaVendorID 是 NVIDIA 的 PCI vendor id
+const nvidiaVendorID = "0x10de"
+
+// CUDARuntimeDirs 是查找 libcudart.so 的默认目录，与 cuda 探针的默认目标和常见的安装位置一致
+var CUDARuntimeDirs = []string{
+	"/opt/cuda/targets/x86_64-linux/lib",
+	"/usr/local/cuda/lib64",
+	"/usr/local/cuda/targets/x86_64-linux/lib",
+	"/usr/lib/x86_64-linux-gnu",
+	"/usr/lib64",
+	"/usr/lib/ollama/cuda_v12",
+	"/usr/lib/ollama/cuda_v11",
+}
+
+// LLMBinaryNames 是在 PATH 和 LLMBinaryDirs 中查找的推理程序
+var LLMBinaryNames = []string{"ollama", "llama-server", "llama-cli", "llama-bench"}
+
+// LLMBinaryDirs 是 PATH 之外查找推理程序的目录
+var LLMBinaryDirs = []string{"/usr/bin", "/usr/local/bin", "/opt/llama.cpp/build/bin"}
+
+// CollectHostInventory 采集主机的内核、CPU、内存、GPU 和推理软件信息。
+// root 为文件系统的根 (测试时指向构造的目录)，为空时为 "/"。读取失败的项留空。
+func CollectHostInventory(root string) models.NodeInventory {
+	if root == "" {
+		root = "/"
+	}
+	read := func(path string) []byte {
+		data, _ := os.ReadFile(filepath.Join(root, path))
+		return data
+	}
+	inv := models.NodeInventory{
+		CollectedAt:   time.Now(),
+		Arch:          runtime.GOARCH,
+		KernelVersion: strings.TrimSpace(string(read("proc/sys/kernel/osrelease"))),
+		OS:            ParseOSRelease(read("etc/os-release")),
+		NvidiaDriver:  ParseNvidiaDriverVersion(read("proc/driver/nvidia/version")),
+	}
+	inv.Hostname = strings.TrimSpace(string(read("proc/sys/kernel/hostname")))
+	if _, err := os.Stat(filepath.Join(root, "sys/kernel/btf/vmlinux")); err == nil {
+		inv.BTF = true
+	}
+	inv.CPUModel, inv.CPUCores = ParseCPUInfo(read("proc/cpuinfo"))
+	inv.MemoryBytes = ParseMemTotal(read("proc/meminfo"))
+	inv.GPUs = nvidiaGPUs(root)
+
+	for _, dir := range CUDARuntimeDirs {
+		matches, _ := filepath.Glob(filepath.Join(root, dir, "libcudart.so*"))
+		for _, m := range matches {
+			inv.CUDARuntimes = append(inv.CUDARuntimes, hostPath(root, m))
+		}
+	}
+	inv.CUDARuntimes = uniqueSorted(inv.CUDARuntimes)
+	inv.LLMBinaries = findLLMBinaries(root)
+	return inv
+}
+
+// ParseCPUInfo 返回 /proc/cpuinfo 中的 CPU 型号和逻辑核数。
+// x86 使用 "model name"，部分 ARM 内核只有 "Hardware" 或 "Processor"。
+func ParseCPUInfo(data []byte) (model string, cores int) {
+	var fallback string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		key, value, ok := strings.Cut(sc.Text(), ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch key {
+		case "processor":
+			if _, err := strconv.Atoi(value); err == nil {
+				cores++
+			} else if fallback == "" {
+				fallback = value
+			}
+		case "model name":
+			if model == "" {
+				model = value
+			}
+		case "Processor", "Hardware":
+			if fallback == "" {
+				fallback = value
+			}
+		}
+	}
+	if model == "" {
+		model = fallback
+	}
+	return model, cores
+}
+
+// ParseMemTotal 返回 /proc/meminfo 中的 MemTotal，单位为字节
+func ParseMemTotal(data []byte) uint64 {
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return 0
+			}
+			return kb << 10
+		}
+	}
+	return 0
+}
+
+// ParseOSRelease 返回 /etc/os-release 的 PRETTY_NAME
+func ParseOSRelease(data []byte) string {
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		if value, ok := strings.CutPrefix(sc.Text(), "PRETTY_NAME="); ok {
+			return strings.Trim(value, `"'`)
+		}
+	}
+	return ""
+}
+
+// ParseNvidiaDriverVersion 从 /proc/driver/nvidia/version 的 "NVRM version: ... Kernel Module  550.54.14  ..." 中取出驱动版本。
+// 开源内核模块的格式为 "... Open Kernel Module for x86_64  555.42.02  ..."，因此取第一个形如版本号的字段。
+func ParseNvidiaDriverVersion(data []byte) string {
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line, ok := strings.CutPrefix(sc.Text(), "NVRM version:")
+		if !ok {
+			continue
+		}
+		for _, f := range strings.Fields(line) {
+			if isVersion(f) {
+				return f
+			}
+		}
+	}
+	return ""
+}
+
+// isVersion 判断 s 是否为 "550.54.14" 这样由点分隔的数字
+func isVersion(s string) bool {
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 {
+		return false
+	}
+	for _, p := range parts {
+		if _, err := strconv.Atoi(p); err != nil || p == "" || p[0] == '-' || p[0] == '+' {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseNvidiaGPUInformation 解析 /proc/driver/nvidia/gpus/<bus>/information
+func ParseNvidiaGPUInformation(data []byte) models.GPUInfo {
+	gpu := models.GPUInfo{Source: "procfs"}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		key, value, ok := strings.Cut(sc.Text(), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "Model":
+			gpu.Model = value
+		case "GPU UUID":
+			gpu.UUID = value
+		case "Bus Location":
+			gpu.BusID = value
+		}
+	}
+	return gpu
+}
+
+// nvidiaGPUs 优先读取驱动的 /proc/driver/nvidia/gpus，驱动未加载时从 sysfs 按 PCI vendor 和 class 查找
+func nvidiaGPUs(root string) []models.GPUInfo {
+	sysfs := make(map[string]string) // PCI 地址 -> device id
+	devices, _ := filepath.Glob(filepath.Join(root, "sys/bus/pci/devices/*"))
+	for _, dev := range devices {
+		vendor, _ := os.ReadFile(filepath.Join(dev, "vendor"))
+		class, _ := os.ReadFile(filepath.Join(dev, "class"))
+		// 0x0300xx VGA 控制器，0x0302xx 3D 控制器 (数据中心 GPU)
+		c := strings.TrimSpace(string(class))
+		if strings.TrimSpace(string(vendor)) != nvidiaVendorID || !(strings.HasPrefix(c, "0x0300") || strings.HasPrefix(c, "0x0302")) {
+			continue
+		}
+		device, _ := os.ReadFile(filepath.Join(dev, "device"))
+		sysfs[strings.ToLower(filepath.Base(dev))] = strings.TrimSpace(string(device))
+	}
+
+	var gpus []models.GPUInfo
+	infos, _ := filepath.Glob(filepath.Join(root, "proc/driver/nvidia/gpus/*/information"))
+	for _, info := range infos {
+		data, err := os.ReadFile(info)
+		if err != nil {
+			continue
+		}
+		gpu := ParseNvidiaGPUInformation(data)
+		if gpu.BusID == "" {
+			gpu.BusID = filepath.Base(filepath.Dir(info))
+		}
+		bus := strings.ToLower(gpu.BusID)
+		gpu.DeviceID = sysfs[bus]
+		delete(sysfs, bus)
+		gpus = append(gpus, gpu)
+	}
+	for bus, device := range sysfs {
+		gpus = append(gpus, models.GPUInfo{BusID: bus, DeviceID: device, Source: "sysfs"})
+	}
+	sort.Slice(gpus, func(i, j int) bool { return gpus[i].BusID < gpus[j].BusID })
+	return gpus
+}
+
+// findLLMBinaries 在 PATH (仅 root 为 "/" 时) 和 LLMBinaryDirs 中查找推理程序
+func findLLMBinaries(root string) []models.BinaryInfo {
+	seen := make(map[string]bool)
+	var found []models.BinaryInfo
+	add := func(name, path string) {
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			path = resolved
+		}
+		if !seen[path] {
+			seen[path] = true
+			found = append(found, models.BinaryInfo{Name: name, Path: hostPath(root, path)})
+		}
+	}
+	for _, name := range LLMBinaryNames {
+		if root == "/" {
+			if path, err := exec.LookPath(name); err == nil {
+				add(name, path)
+			}
+		}
+		for _, dir := range LLMBinaryDirs {
+			path := filepath.Join(root, dir, name)
+			if fi, err := os.Stat(path); err == nil && fi.Mode().IsRegular() && fi.Mode()&0111 != 0 {
+				add(name, path)
+			}
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].Name != found[j].Name {
+			return found[i].Name < found[j].Name
+		}
+		return found[i].Path < found[j].Path
+	})
+	return found
+}
+
+// hostPath 把 root 下的路径转换为主机上的绝对路径
+func hostPath(root, path string) string {
+	return "/" + strings.TrimPrefix(strings.TrimPrefix(path, root), "/")
+}
+
+func uniqueSorted(s []string) []string {
+	sort.Strings(s)
+	out := s[:0]
+	for i, v := range s {
+		if i == 0 || v != s[i-1] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
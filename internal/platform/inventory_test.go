@@ -0,0 +1,103 @@
+// inventory_test.go
+package platform
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"scope/internal/models"
+)
+
+func TestParseCPUInfo(t *testing.T) {
+	x86 := "processor\t: 0\nvendor_id\t: GenuineIntel\nmodel name\t: 12th Gen Intel(R) Core(TM) i7-12700H\n\n" +
+		"processor\t: 1\nmodel name\t: 12th Gen Intel(R) Core(TM) i7-12700H\n"
+	if model, cores := ParseCPUInfo([]byte(x86)); model != "12th Gen Intel(R) Core(TM) i7-12700H" || cores != 2 {
+		t.Errorf("x86: got %q, %d", model, cores)
+	}
+	arm := "Processor\t: AArch64 Processor rev 4 (aarch64)\nprocessor\t: 0\nprocessor\t: 1\nprocessor\t: 2\nHardware\t: Qualcomm\n"
+	if model, cores := ParseCPUInfo([]byte(arm)); model != "AArch64 Processor rev 4 (aarch64)" || cores != 3 {
+		t.Errorf("arm: got %q, %d", model, cores)
+	}
+}
+
+func TestParseMemTotal(t *testing.T) {
+	if got := ParseMemTotal([]byte("MemTotal:       32657612 kB\nMemFree:         1000 kB\n")); got != 32657612<<10 {
+		t.Errorf("got %d", got)
+	}
+	if got := ParseMemTotal(nil); got != 0 {
+		t.Errorf("empty meminfo: got %d", got)
+	}
+}
+
+func TestParseNvidiaDriverVersion(t *testing.T) {
+	data := "NVRM version: NVIDIA UNIX x86_64 Kernel Module  550.54.14  Thu Feb 22 01:44:30 UTC 2024\nGCC version:  gcc version 13.2.1\n"
+	if got := ParseNvidiaDriverVersion([]byte(data)); got != "550.54.14" {
+		t.Errorf("got %q", got)
+	}
+	// 开源内核模块
+	open := "NVRM version: NVIDIA UNIX Open Kernel Module for x86_64  555.42.02  Release Build  (dvs-builder@U16-I3-B03-4-3)\n"
+	if got := ParseNvidiaDriverVersion([]byte(open)); got != "555.42.02" {
+		t.Errorf("open kernel module: got %q", got)
+	}
+	if got := ParseNvidiaDriverVersion(nil); got != "" {
+		t.Errorf("no driver: got %q", got)
+	}
+}
+
+func writeFile(t *testing.T, root, path, content string) {
+	t.Helper()
+	full := filepath.Join(root, path)
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(full, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectHostInventory(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "proc/sys/kernel/osrelease", "6.8.0-45-generic\n")
+	writeFile(t, root, "proc/sys/kernel/hostname", "gpu-01\n")
+	writeFile(t, root, "etc/os-release", "NAME=\"Ubuntu\"\nPRETTY_NAME=\"Ubuntu 24.04.1 LTS\"\n")
+	writeFile(t, root, "sys/kernel/btf/vmlinux", "")
+	writeFile(t, root, "proc/cpuinfo", "processor\t: 0\nmodel name\t: AMD EPYC 7763\n")
+	writeFile(t, root, "proc/meminfo", "MemTotal:       1024 kB\n")
+	writeFile(t, root, "proc/driver/nvidia/version", "NVRM version: NVIDIA UNIX x86_64 Kernel Module  550.54.14  Thu Feb 22 2024\n")
+	writeFile(t, root, "proc/driver/nvidia/gpus/0000:01:00.0/information",
+		"Model: \t\t NVIDIA GeForce RTX 4090\nIRQ:   \t\t 185\nGPU UUID: \t GPU-8a1f\nBus Location: \t 0000:01:00.0\n")
+	// 驱动已识别的 GPU 和只在 sysfs 中出现的 GPU，以及一块非 NVIDIA 的显卡
+	writeFile(t, root, "sys/bus/pci/devices/0000:01:00.0/vendor", "0x10de\n")
+	writeFile(t, root, "sys/bus/pci/devices/0000:01:00.0/class", "0x030000\n")
+	writeFile(t, root, "sys/bus/pci/devices/0000:01:00.0/device", "0x2684\n")
+	writeFile(t, root, "sys/bus/pci/devices/0000:41:00.0/vendor", "0x10de\n")
+	writeFile(t, root, "sys/bus/pci/devices/0000:41:00.0/class", "0x030200\n")
+	writeFile(t, root, "sys/bus/pci/devices/0000:41:00.0/device", "0x20b5\n")
+	writeFile(t, root, "sys/bus/pci/devices/0000:00:02.0/vendor", "0x8086\n")
+	writeFile(t, root, "sys/bus/pci/devices/0000:00:02.0/class", "0x030000\n")
+	writeFile(t, root, "usr/local/cuda/lib64/libcudart.so.12", "")
+	writeFile(t, root, "usr/local/bin/ollama", "#!/bin/sh\n")
+
+	inv := CollectHostInventory(root)
+	if inv.KernelVersion != "6.8.0-45-generic" || inv.Hostname != "gpu-01" || inv.OS != "Ubuntu 24.04.1 LTS" || !inv.BTF {
+		t.Errorf("host facts: %+v", inv)
+	}
+	if inv.CPUModel != "AMD EPYC 7763" || inv.CPUCores != 1 || inv.MemoryBytes != 1<<20 || inv.NvidiaDriver != "550.54.14" {
+		t.Errorf("cpu/memory/driver: %+v", inv)
+	}
+	wantGPUs := []models.GPUInfo{
+		{Model: "NVIDIA GeForce RTX 4090", UUID: "GPU-8a1f", BusID: "0000:01:00.0", DeviceID: "0x2684", Source: "procfs"},
+		{BusID: "0000:41:00.0", DeviceID: "0x20b5", Source: "sysfs"},
+	}
+	if !reflect.DeepEqual(inv.GPUs, wantGPUs) {
+		t.Errorf("GPUs = %+v, want %+v", inv.GPUs, wantGPUs)
+	}
+	if !reflect.DeepEqual(inv.CUDARuntimes, []string{"/usr/local/cuda/lib64/libcudart.so.12"}) {
+		t.Errorf("CUDARuntimes = %v", inv.CUDARuntimes)
+	}
+	if !reflect.DeepEqual(inv.LLMBinaries, []models.BinaryInfo{{Name: "ollama", Path: "/usr/local/bin/ollama"}}) {
+		t.Errorf("LLMBinaries = %+v", inv.LLMBinaries)
+	}
+}
@@ -0,0 +1,126 @@
+// lru.go
+package platform
+
+import (
+	"container/list"
+	"sync"
+)
+
+// CacheStats 是一个有界缓存的容量和命中统计
+type CacheStats struct {
+	Entries   int    `json:"entries"`
+	Cost      int64  `json:"cost"`     // 当前占用，单位由缓存决定 (条目数或估算的字节数)
+	MaxCost   int64  `json:"max_cost"` // 占用上限，超过时淘汰最久未使用的条目
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+}
+
+type lruEntry[K comparable, V any] struct {
+	key   K
+	value V
+	cost  int64
+}
+
+// LRUCache 是按 cost 总和限制容量的 LRU 缓存，可并发使用
+type LRUCache[K comparable, V any] struct {
+	mu        sync.Mutex
+	maxCost   int64
+	cost      int64
+	ll        *list.List // 最近使用的在前
+	items     map[K]*list.Element
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+// NewLRUCache 创建一个总 cost 不超过 maxCost 的缓存
+func NewLRUCache[K comparable, V any](maxCost int64) *LRUCache[K, V] {
+	return &LRUCache[K, V]{
+		maxCost: maxCost,
+		ll:      list.New(),
+		items:   make(map[K]*list.Element),
+	}
+}
+
+// Get 返回缓存的值并把它标记为最近使用
+func (c *LRUCache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.items[key]; ok {
+		c.ll.MoveToFront(elem)
+		c.hits++
+		return elem.Value.(*lruEntry[K, V]).value, true
+	}
+	c.misses++
+	var zero V
+	return zero, false
+}
+
+// Add 加入或替换一个条目，然后淘汰最久未使用的条目直到总 cost 不超过上限。
+// 刚加入的条目总会保留，即使它自身的 cost 已超过上限。
+func (c *LRUCache[K, V]) Add(key K, value V, cost int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.items[key]; ok {
+		c.removeElement(elem)
+	}
+	c.items[key] = c.ll.PushFront(&lruEntry[K, V]{key: key, value: value, cost: cost})
+	c.cost += cost
+	c.evict()
+}
+
+// Remove 删除一个条目，不计入淘汰次数
+func (c *LRUCache[K, V]) Remove(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.items[key]; ok {
+		c.removeElement(elem)
+	}
+}
+
+// Keys 返回当前所有的 key
+func (c *LRUCache[K, V]) Keys() []K {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := make([]K, 0, len(c.items))
+	for key := range c.items {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// SetMaxCost 修改容量上限，立即淘汰超出的条目
+func (c *LRUCache[K, V]) SetMaxCost(maxCost int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxCost = maxCost
+	c.evict()
+}
+
+// Stats 返回容量和命中统计
+func (c *LRUCache[K, V]) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{
+		Entries:   len(c.items),
+		Cost:      c.cost,
+		MaxCost:   c.maxCost,
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+	}
+}
+
+func (c *LRUCache[K, V]) evict() {
+	for c.cost > c.maxCost && c.ll.Len() > 1 {
+		c.removeElement(c.ll.Back())
+		c.evictions++
+	}
+}
+
+func (c *LRUCache[K, V]) removeElement(elem *list.Element) {
+	entry := c.ll.Remove(elem).(*lruEntry[K, V])
+	delete(c.items, entry.key)
+	c.cost -= entry.cost
+}
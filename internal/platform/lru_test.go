@@ -0,0 +1,38 @@
+// lru_test.go
+package platform
+
+import "testing"
+
+func TestLRUCache(t *testing.T) {
+	c := NewLRUCache[string, int](10)
+	c.Add("a", 1, 4)
+	c.Add("b", 2, 4)
+	if _, ok := c.Get("a"); !ok { // a 变为最近使用
+		t.Fatal("a should be cached")
+	}
+	c.Add("c", 3, 4) // 总 cost 12 > 10，淘汰最久未使用的 b
+	if _, ok := c.Get("b"); ok {
+		t.Error("b should have been evicted")
+	}
+	if v, ok := c.Get("c"); !ok || v != 3 {
+		t.Errorf("Get(c) = %d, %v", v, ok)
+	}
+
+	c.Add("a", 5, 2) // 替换不计入淘汰
+	c.Remove("c")
+	stats := c.Stats()
+	want := CacheStats{Entries: 1, Cost: 2, MaxCost: 10, Hits: 2, Misses: 1, Evictions: 1}
+	if stats != want {
+		t.Errorf("Stats() = %+v, want %+v", stats, want)
+	}
+
+	// 超过上限的单个条目仍然保留
+	c.Add("big", 0, 100)
+	if _, ok := c.Get("big"); !ok || c.Stats().Entries != 1 {
+		t.Errorf("oversized entry should replace everything else, stats %+v", c.Stats())
+	}
+	c.SetMaxCost(50)
+	if c.Stats().Entries != 1 {
+		t.Error("SetMaxCost must keep the most recent entry")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -71,6 +72,8 @@ func GetCmdline(pid int) (string, error) {
 	}
 
 	// --- 2. 缓存未命中，从 /proc 读取 ---
+	// 同时记录启动时间，ReapExitedPids 据此发现 pid 复用
+	GetStartTime(pid)
 	path := fmt.Sprintf("/proc/%d/cmdline", pid)
 	content, err := os.ReadFile(path)
 	if err != nil {
@@ -110,6 +113,7 @@ func GetComm(pid int) (string, error) {
 	}
 
 	// --- 2. 缓存未命中，从 /proc 读取 ---
+	GetStartTime(pid)
 	path := fmt.Sprintf("/proc/%d/comm", pid)
 	content, err := os.ReadFile(path)
 	if err != nil {
@@ -128,3 +132,249 @@ func GetComm(pid int) (string, error) {
 
 	return commStr, nil
 }
+
+// clockTicksPerSec 是 /proc/[pid]/stat 中时间字段的单位 (USER_HZ)，Linux 上对用户态固定为 100
+const clockTicksPerSec = 100
+
+var (
+	startTimeCache     map[int]uint64
+	startTimeCacheLock sync.Mutex
+
+	tgidCache     map[int]int
+	tgidCacheLock sync.Mutex
+
+	bootTimeOnce sync.Once
+	bootTimeNs   int64
+	bootTimeErr  error
+)
+
+// ParseStatStartTime 从 /proc/[pid]/stat 的内容中解析进程启动时间 (第 22 个字段，自开机以来的 clock tick)。
+// comm 字段可能包含空格和括号，因此从最后一个 ')' 之后开始按空格切分。
+func ParseStatStartTime(stat string) (uint64, error) {
+	i := strings.LastIndexByte(stat, ')')
+	if i < 0 {
+		return 0, fmt.Errorf("malformed stat: %q", stat)
+	}
+	// ')' 之后的第一个字段是第 3 个字段 state
+	fields := strings.Fields(stat[i+1:])
+	if len(fields) < 20 {
+		return 0, fmt.Errorf("malformed stat: only %d fields after comm", len(fields))
+	}
+	return strconv.ParseUint(fields[19], 10, 64)
+}
+
+func readStartTime(pid int) (uint64, error) {
+	path := fmt.Sprintf("/proc/%d/stat", pid)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return ParseStatStartTime(string(content))
+}
+
+// GetStartTime 返回进程的启动时间 (自开机以来的 clock tick)。结果会被缓存，
+// 直到 InvalidatePid 或 ReapExitedPids 发现该 pid 已退出或被复用。
+func GetStartTime(pid int) (uint64, error) {
+	if pid <= 0 {
+		return 0, fmt.Errorf("invalid pid: %d", pid)
+	}
+
+	startTimeCacheLock.Lock()
+	if startTimeCache == nil {
+		startTimeCache = make(map[int]uint64)
+	}
+	cachedValue, found := startTimeCache[pid]
+	startTimeCacheLock.Unlock()
+	if found {
+		return cachedValue, nil
+	}
+
+	startTime, err := readStartTime(pid)
+	if err != nil {
+		return 0, err
+	}
+
+	startTimeCacheLock.Lock()
+	startTimeCache[pid] = startTime
+	startTimeCacheLock.Unlock()
+
+	return startTime, nil
+}
+
+// ParseStatusTgid 从 /proc/[pid]/status 的内容中解析线程组 ID (Tgid)
+func ParseStatusTgid(status string) (int, error) {
+	for _, line := range strings.Split(status, "\n") {
+		if rest, ok := strings.CutPrefix(line, "Tgid:"); ok {
+			return strconv.Atoi(strings.TrimSpace(rest))
+		}
+	}
+	return 0, fmt.Errorf("Tgid not found in status")
+}
+
+// GetTgid 返回线程所属进程的 pid (线程组 ID)。sched_switch 等按线程上报的事件需要它归并到进程。
+// 线程 ID 不出现在 /proc 目录列表中，但 /proc/[tid]/status 可以直接读取。
+func GetTgid(pid int) (int, error) {
+	if pid <= 0 {
+		return 0, fmt.Errorf("invalid pid: %d", pid)
+	}
+
+	tgidCacheLock.Lock()
+	if tgidCache == nil {
+		tgidCache = make(map[int]int)
+	}
+	cachedValue, found := tgidCache[pid]
+	tgidCacheLock.Unlock()
+	if found {
+		return cachedValue, nil
+	}
+
+	GetStartTime(pid)
+	path := fmt.Sprintf("/proc/%d/status", pid)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	tgid, err := ParseStatusTgid(string(content))
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	tgidCacheLock.Lock()
+	tgidCache[pid] = tgid
+	tgidCacheLock.Unlock()
+
+	return tgid, nil
+}
+
+// getBootTimeNs 读取 /proc/stat 中的 btime (开机时间，秒)。btime 由当前时间减去 uptime 计算，
+// 可能随时钟调整轻微漂移，因此只在进程内读取一次，保证同一进程的 proc_uid 不变。
+func getBootTimeNs() (int64, error) {
+	bootTimeOnce.Do(func() {
+		content, err := os.ReadFile("/proc/stat")
+		if err != nil {
+			bootTimeErr = fmt.Errorf("failed to read /proc/stat: %w", err)
+			return
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			if rest, ok := strings.CutPrefix(line, "btime "); ok {
+				sec, err := strconv.ParseInt(strings.TrimSpace(rest), 10, 64)
+				if err != nil {
+					bootTimeErr = fmt.Errorf("invalid btime %q: %w", rest, err)
+					return
+				}
+				bootTimeNs = sec * int64(time.Second)
+				return
+			}
+		}
+		bootTimeErr = fmt.Errorf("btime not found in /proc/stat")
+	})
+	return bootTimeNs, bootTimeErr
+}
+
+// GetProcessStartTime 返回进程启动的墙上时间，精度为一个 clock tick (10ms)
+func GetProcessStartTime(pid int) (time.Time, error) {
+	ticks, err := GetStartTime(pid)
+	if err != nil {
+		return time.Time{}, err
+	}
+	boot, err := getBootTimeNs()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, boot+int64(ticks)*int64(time.Second)/clockTicksPerSec), nil
+}
+
+// FormatProcUID 由 (machine_id, pid, 启动时间) 生成稳定的进程标识，pid 被复用后得到不同的值
+func FormatProcUID(machineID string, pid int, startTime time.Time) string {
+	return fmt.Sprintf("%s:%d:%d", machineID, pid, startTime.UnixNano())
+}
+
+// GetProcUID 返回进程的 proc_uid，见 FormatProcUID
+func GetProcUID(machineID string, pid int) (string, error) {
+	startTime, err := GetProcessStartTime(pid)
+	if err != nil {
+		return "", err
+	}
+	return FormatProcUID(machineID, pid, startTime), nil
+}
+
+// InvalidatePid 清除一个 pid 的 cmdline、comm、tgid、容器信息、身份信息、内存映射和启动时间缓存。
+// 进程 exec 后 comm/cmdline 会变化，退出后 pid 可能被复用，两种情况都需要调用。
+func InvalidatePid(pid int) {
+	cmdlineCacheLock.Lock()
+	delete(cmdlineCache, pid)
+	cmdlineCacheLock.Unlock()
+
+	commCacheLock.Lock()
+	delete(commCache, pid)
+	commCacheLock.Unlock()
+
+	tgidCacheLock.Lock()
+	delete(tgidCache, pid)
+	tgidCacheLock.Unlock()
+
+	containerCacheLock.Lock()
+	delete(containerCache, pid)
+	containerCacheLock.Unlock()
+
+	identityCacheLock.Lock()
+	delete(identityCache, pid)
+	identityCacheLock.Unlock()
+
+	processMapsCache.Remove(pid)
+
+	startTimeCacheLock.Lock()
+	delete(startTimeCache, pid)
+	startTimeCacheLock.Unlock()
+}
+
+// ReapExitedPids 检查所有被缓存的 pid，清除已退出或启动时间已变化 (pid 被复用) 的进程的缓存。
+// 返回被清除的 pid 数量。
+func ReapExitedPids() int {
+	pids := make(map[int]struct{})
+	cmdlineCacheLock.Lock()
+	for pid := range cmdlineCache {
+		pids[pid] = struct{}{}
+	}
+	cmdlineCacheLock.Unlock()
+	commCacheLock.Lock()
+	for pid := range commCache {
+		pids[pid] = struct{}{}
+	}
+	commCacheLock.Unlock()
+	tgidCacheLock.Lock()
+	for pid := range tgidCache {
+		pids[pid] = struct{}{}
+	}
+	tgidCacheLock.Unlock()
+	containerCacheLock.Lock()
+	for pid := range containerCache {
+		pids[pid] = struct{}{}
+	}
+	containerCacheLock.Unlock()
+	identityCacheLock.Lock()
+	for pid := range identityCache {
+		pids[pid] = struct{}{}
+	}
+	identityCacheLock.Unlock()
+	for _, pid := range processMapsCache.Keys() {
+		pids[pid] = struct{}{}
+	}
+	startTimeCacheLock.Lock()
+	cachedStart := make(map[int]uint64, len(startTimeCache))
+	for pid, start := range startTimeCache {
+		pids[pid] = struct{}{}
+		cachedStart[pid] = start
+	}
+	startTimeCacheLock.Unlock()
+
+	reaped := 0
+	for pid := range pids {
+		start, err := readStartTime(pid)
+		if prev, ok := cachedStart[pid]; err != nil || (ok && prev != start) {
+			InvalidatePid(pid)
+			reaped++
+		}
+	}
+	return reaped
+}
@@ -3,9 +3,11 @@ package platform
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 // TestGetCmdline tests the GetCmdline function and its caching mechanism.
@@ -150,3 +152,107 @@ func TestGetCmdline(t *testing.T) {
 		t.Logf("CacheClear test passed for PID %d.", selfPid)
 	})
 }
+
+func TestParseStatStartTime(t *testing.T) {
+	// comm 中包含空格和括号
+	stat := "4242 (evil) (proc x) S 1 4242 4242 0 -1 4194560 1034 0 0 0 3 1 0 0 20 0 1 0 987654 12345678 900 18446744073709551615 1 1 0 0 0 0 0 0 0 0 0 0 17 2 0 0 0 0 0"
+	start, err := ParseStatStartTime(stat)
+	if err != nil {
+		t.Fatalf("ParseStatStartTime failed: %v", err)
+	}
+	if start != 987654 {
+		t.Errorf("expected start time 987654, got %d", start)
+	}
+
+	if _, err := ParseStatStartTime("4242 (truncated) S 1 2"); err == nil {
+		t.Errorf("expected error for truncated stat")
+	}
+	if _, err := ParseStatStartTime("garbage"); err == nil {
+		t.Errorf("expected error for stat without comm")
+	}
+}
+
+func TestProcUID(t *testing.T) {
+	selfPid := os.Getpid()
+	uid1, err := GetProcUID("machine", selfPid)
+	if err != nil {
+		t.Fatalf("GetProcUID(%d) failed: %v", selfPid, err)
+	}
+	InvalidatePid(selfPid)
+	uid2, err := GetProcUID("machine", selfPid)
+	if err != nil {
+		t.Fatalf("GetProcUID(%d) failed after invalidation: %v", selfPid, err)
+	}
+	if uid1 != uid2 {
+		t.Errorf("proc_uid of a running process changed: %s -> %s", uid1, uid2)
+	}
+	if !strings.HasPrefix(uid1, fmt.Sprintf("machine:%d:", selfPid)) {
+		t.Errorf("unexpected proc_uid format: %s", uid1)
+	}
+
+	startTime, _ := GetProcessStartTime(selfPid)
+	if d := time.Since(startTime); d < 0 || d > 24*time.Hour {
+		t.Errorf("implausible start time %v for the test process", startTime)
+	}
+}
+
+func TestReapExitedPids(t *testing.T) {
+	selfPid := os.Getpid()
+	if _, err := GetCmdline(selfPid); err != nil {
+		t.Fatalf("GetCmdline(%d) failed: %v", selfPid, err)
+	}
+
+	// 伪造一个已退出进程和一个 pid 被复用的进程的缓存
+	exited := 999999
+	cmdlineCacheLock.Lock()
+	cmdlineCache[exited] = "stale"
+	cmdlineCacheLock.Unlock()
+	startTimeCacheLock.Lock()
+	realStart := startTimeCache[selfPid]
+	startTimeCacheLock.Unlock()
+
+	if n := ReapExitedPids(); n < 1 {
+		t.Errorf("expected the exited pid to be reaped, reaped %d", n)
+	}
+	cmdlineCacheLock.Lock()
+	_, stale := cmdlineCache[exited]
+	_, self := cmdlineCache[selfPid]
+	cmdlineCacheLock.Unlock()
+	if stale {
+		t.Errorf("cache entry of exited pid %d was not reaped", exited)
+	}
+	if !self {
+		t.Errorf("cache entry of running pid %d was reaped", selfPid)
+	}
+
+	startTimeCacheLock.Lock()
+	startTimeCache[selfPid] = realStart + 1
+	startTimeCacheLock.Unlock()
+	ReapExitedPids()
+	cmdlineCacheLock.Lock()
+	_, self = cmdlineCache[selfPid]
+	cmdlineCacheLock.Unlock()
+	if self {
+		t.Errorf("cache entry of reused pid %d was not reaped", selfPid)
+	}
+}
+
+func TestGetTgid(t *testing.T) {
+	status := "Name:\tollama\nUmask:\t0022\nState:\tS (sleeping)\nTgid:\t1234\nNgid:\t0\nPid:\t1240\n"
+	tgid, err := ParseStatusTgid(status)
+	if err != nil || tgid != 1234 {
+		t.Errorf("ParseStatusTgid = %d, %v; want 1234", tgid, err)
+	}
+	if _, err := ParseStatusTgid("Name:\tx\n"); err == nil {
+		t.Errorf("expected error for status without Tgid")
+	}
+
+	selfPid := os.Getpid()
+	tgid, err = GetTgid(selfPid)
+	if err != nil {
+		t.Fatalf("GetTgid(%d) failed: %v", selfPid, err)
+	}
+	if tgid != selfPid {
+		t.Errorf("GetTgid(%d) = %d, want the pid itself for the main thread", selfPid, tgid)
+	}
+}
@@ -2,27 +2,30 @@ package platform
 
 import (
 	"bufio"
-	"bytes"
+	"debug/elf"
 	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
-	"time"
 )
 
 // SymbolInfo 存储解析出的符号信息
 type SymbolInfo struct {
-	SymbolName  string  // 函数名或符号名
-	FilePath    string  // 包含该符号的可执行文件或库路径
-	Offset      uintptr // 传入地址相对于文件加载基址的偏移量
-	BaseAddress uintptr // 文件在内存中的加载基址
-	SourceFile  string  // 源代码文件名 (如果可用)
-	SourceLine  int     // 源代码行号 (如果可用)
+	SymbolName  string        `json:"symbol_name"`            // 函数名或符号名
+	FilePath    string        `json:"file_path,omitempty"`    // 包含该符号的可执行文件或库路径
+	Offset      uintptr       `json:"offset,omitempty"`       // 传入地址相对于文件加载基址的偏移量
+	BaseAddress uintptr       `json:"base_address,omitempty"` // 文件在内存中的加载基址
+	SourceFile  string        `json:"source_file,omitempty"`  // 源代码文件名 (如果可用)
+	SourceLine  int           `json:"source_line,omitempty"`  // 源代码行号 (如果可用)
+	Inlined     []InlineFrame `json:"inlined,omitempty"`      // SymbolName 被内联时的外层调用者，从内到外 (需要 DWARF)
+	Resolved    bool          `json:"resolved"`               // 符号表或 DWARF 中找到了覆盖该地址的函数，否则 SymbolName 只是占位
+	BuildID     string        `json:"build_id,omitempty"`     // 文件的 GNU build-id，与 Address 一起可在进程退出后离线解析
+	Address     uint64        `json:"address,omitempty"`      // 地址在 ELF 中对应的虚拟地址 (符号表和 DWARF 使用的地址)
 }
 
 // mapEntry 表示 /proc/<pid>/maps 中的一行内部结构
@@ -42,23 +45,6 @@ type mapEntry struct {
 //	address           perms offset   dev    inode      pathname
 var mapLineRegex = regexp.MustCompile(`^([0-9a-f]+)-([0-9a-f]+)\s+([rwxp\-s]+)\s+([0-9a-f]+)\s+([0-9a-f]+:[0-9a-f]+)\s+([0-9]+)\s*(.*)$`)
 
-// Cache for addr2line path to avoid repeated lookups
-var (
-	addr2linePath     string
-	addr2linePathErr  error
-	addr2linePathOnce sync.Once
-)
-
-func findAddr2line() (string, error) {
-	addr2linePathOnce.Do(func() {
-		addr2linePath, addr2linePathErr = exec.LookPath("addr2line")
-		if addr2linePathErr != nil {
-			addr2linePathErr = errors.New("addr2line command not found in PATH. Please install binutils (or equivalent)")
-		}
-	})
-	return addr2linePath, addr2linePathErr
-}
-
 // parseMapLine 解析 maps 文件中的单行
 func parseMapLine(line string) (*mapEntry, error) {
 	matches := mapLineRegex.FindStringSubmatch(line)
@@ -103,31 +89,99 @@ func parseMapLine(line string) (*mapEntry, error) {
 	}, nil
 }
 
+// 符号缓存分两级：进程级缓存解析后的 /proc/<pid>/maps，exec (InvalidatePid) 或退出 (ReapExitedPids) 时清除；
+// 模块级缓存 ELF 文件的符号表和 DWARF，按 build-id (没有时按设备号和 inode) 在进程间共享。两级都按 LRU 淘汰。
+const (
+	maxCachedMapEntries      = 256 * 1024        // 进程级缓存中 maps 行数的上限
+	defaultModuleCacheBytes  = 256 * 1024 * 1024 // 模块级缓存估算内存的默认上限
+	symbolResultCacheEntries = 4096              // 每个模块缓存的已解析地址数
+)
+
 var (
-	symbolCache        map[string]SymbolInfo
-	symbolCacheLock    sync.Mutex
-	lastClearCacheTime time.Time
+	processMapsCache = NewLRUCache[int, *processMaps](maxCachedMapEntries)
+	moduleCache      = NewLRUCache[string, *elfSymbolizer](defaultModuleCacheBytes)
 )
 
-// FindSymbolFromPidPtr 根据 PID 和内存地址查找符号信息
-// pid: 目标进程的 ID
-// ptr: 目标进程内的内存地址
-// 返回: 符号信息指针和错误 (如果发生)
-func findSymbolFromPidPtrImpl(pid int, ptr uintptr) (*SymbolInfo, error) {
-	if pid <= 0 {
-		return nil, errors.New("invalid PID provided (must be > 0)")
+// SymbolCacheStats 是两级符号缓存的统计
+type SymbolCacheStats struct {
+	Processes CacheStats `json:"processes"` // cost 为缓存的 maps 行数
+	Modules   CacheStats `json:"modules"`   // cost 为估算的字节数
+}
+
+// GetSymbolCacheStats 返回两级符号缓存的容量和命中统计
+func GetSymbolCacheStats() SymbolCacheStats {
+	return SymbolCacheStats{
+		Processes: processMapsCache.Stats(),
+		Modules:   moduleCache.Stats(),
 	}
-	if ptr == 0 {
-		// Technically a valid address, but unlikely to hold a meaningful user symbol.
-		// Can be adjusted if resolving symbols at address 0 is required.
-		return nil, errors.New("invalid pointer (0x0) provided, usually not a user symbol location")
+}
+
+// SetSymbolCacheLimit 设置模块级缓存的内存上限 (字节)
+func SetSymbolCacheLimit(maxBytes int64) {
+	moduleCache.SetMaxCost(maxBytes)
+}
+
+// processMaps 是一个进程解析后的 /proc/<pid>/maps
+type processMaps struct {
+	entries []*mapEntry // 按地址升序
+	// 存储每个映射文件实例（路径+inode）对应的最低加载地址（文件偏移为0的段的起始地址）
+	baseAddresses map[string]uintptr
+	// 存储路径对应的第一个遇到的inode，用于备选查找
+	filePathToInode map[string]uint64
+
+	mu      sync.Mutex
+	modules map[string]*mappedModule // 路径+inode -> 映射的模块，避免每次查找都读取 build-id 和程序头
+}
+
+// mappedModule 是进程映射的一个 ELF 文件中换算地址需要的信息，符号表按 key 放在模块级缓存中
+type mappedModule struct {
+	key     string
+	buildID string
+	loads   []elfLoad
+}
+
+// fileOffsetToAddr 把文件偏移换算为 ELF 中的虚拟地址 (符号表和 DWARF 使用的地址)
+func (mod *mappedModule) fileOffsetToAddr(off uint64) (uint64, bool) {
+	for _, load := range mod.loads {
+		if off >= load.off && off < load.off+load.filesz {
+			return off - load.off + load.vaddr, true
+		}
 	}
+	return 0, false
+}
 
-	addr2line, err := findAddr2line()
+// readMappedModule 读取 build-id 和 PT_LOAD 段
+func readMappedModule(f *os.File, entry *mapEntry) (*mappedModule, error) {
+	ef, err := elf.NewFile(f)
 	if err != nil {
-		return nil, err // Return error if addr2line is not found
+		return nil, err
+	}
+	mod := &mappedModule{}
+	for _, prog := range ef.Progs {
+		if prog.Type == elf.PT_LOAD {
+			mod.loads = append(mod.loads, elfLoad{off: prog.Off, vaddr: prog.Vaddr, filesz: prog.Filesz})
+		}
 	}
+	mod.buildID, _ = ReadELFBuildID(f)
+	if mod.buildID != "" {
+		mod.key = "build-id:" + mod.buildID
+	} else {
+		mod.key = fmt.Sprintf("inode:%s:%d", entry.Dev, entry.Inode)
+	}
+	return mod, nil
+}
 
+// find 二分查找包含 ptr 的映射
+func (m *processMaps) find(ptr uintptr) *mapEntry {
+	i := sort.Search(len(m.entries), func(i int) bool { return m.entries[i].EndAddr > ptr })
+	if i < len(m.entries) && ptr >= m.entries[i].StartAddr {
+		return m.entries[i]
+	}
+	return nil
+}
+
+// readProcessMaps 读取并解析 /proc/<pid>/maps
+func readProcessMaps(pid int) (*processMaps, error) {
 	mapsPath := fmt.Sprintf("/proc/%d/maps", pid)
 	mapsFile, err := os.Open(mapsPath)
 	if err != nil {
@@ -141,11 +195,11 @@ func findSymbolFromPidPtrImpl(pid int, ptr uintptr) (*SymbolInfo, error) {
 	}
 	defer mapsFile.Close()
 
-	var targetEntry *mapEntry = nil
-	// 存储每个映射文件实例（路径+inode）对应的最低加载地址（文件偏移为0的段的起始地址）
-	baseAddresses := make(map[string]uintptr)
-	// 存储路径对应的第一个遇到的inode，用于备选查找
-	filePathToInode := make(map[string]uint64)
+	m := &processMaps{
+		baseAddresses:   make(map[string]uintptr),
+		filePathToInode: make(map[string]uint64),
+		modules:         make(map[string]*mappedModule),
+	}
 
 	scanner := bufio.NewScanner(mapsFile)
 	for scanner.Scan() {
@@ -156,12 +210,7 @@ func findSymbolFromPidPtrImpl(pid int, ptr uintptr) (*SymbolInfo, error) {
 			// fmt.Fprintf(os.Stderr, "Warning: skipping unparsable map line in PID %d: %v\n", pid, err)
 			continue
 		}
-
-		// 检查 ptr 是否在此映射范围内
-		if targetEntry == nil && ptr >= entry.StartAddr && ptr < entry.EndAddr {
-			targetEntry = entry
-			// Continue scanning to collect all base addresses
-		}
+		m.entries = append(m.entries, entry)
 
 		// 记录文件的基地址（第一个映射段，文件偏移为0）
 		// 使用 Inode 来区分不同的文件，即使路径相同（例如被删除后重新创建的文件）
@@ -169,16 +218,13 @@ func findSymbolFromPidPtrImpl(pid int, ptr uintptr) (*SymbolInfo, error) {
 			uniqueFileID := fmt.Sprintf("%s:%d", entry.Path, entry.Inode)
 
 			// Record the first inode seen for a given path
-			if _, exists := filePathToInode[entry.Path]; !exists {
-				// Check if the file path actually points to a regular file,
-				// to avoid recording base addresses for special fs entries if needed.
-				// This check adds overhead, maybe optional? For now, keep it simple.
-				filePathToInode[entry.Path] = entry.Inode
+			if _, exists := m.filePathToInode[entry.Path]; !exists {
+				m.filePathToInode[entry.Path] = entry.Inode
 			}
 
 			// Store the base address, taking the minimum if multiple offset 0 segments exist (unlikely but possible)
-			if currentBase, exists := baseAddresses[uniqueFileID]; !exists || entry.StartAddr < currentBase {
-				baseAddresses[uniqueFileID] = entry.StartAddr
+			if currentBase, exists := m.baseAddresses[uniqueFileID]; !exists || entry.StartAddr < currentBase {
+				m.baseAddresses[uniqueFileID] = entry.StartAddr
 			}
 		}
 	}
@@ -186,7 +232,93 @@ func findSymbolFromPidPtrImpl(pid int, ptr uintptr) (*SymbolInfo, error) {
 	if err := scanner.Err(); err != nil {
 		return nil, fmt.Errorf("error reading maps file %s: %w", mapsPath, err)
 	}
+	// 内核按地址顺序输出，这里保证二分查找的前提
+	sort.Slice(m.entries, func(i, j int) bool { return m.entries[i].StartAddr < m.entries[j].StartAddr })
+	return m, nil
+}
+
+// loadProcessMaps 读取进程的 maps 并放入进程级缓存
+func loadProcessMaps(pid int) (*processMaps, error) {
+	m, err := readProcessMaps(pid)
+	if err != nil {
+		return nil, err
+	}
+	// 记录启动时间，ReapExitedPids 据此发现进程退出或 pid 复用
+	GetStartTime(pid)
+	processMapsCache.Add(pid, m, int64(len(m.entries)))
+	return m, nil
+}
 
+// module 返回映射对应的模块和它的符号表。符号表加载失败时仍返回已读取的模块 (如果有)，
+// 调用方可以据此记录 build-id 和 ELF 地址。
+func (m *processMaps) module(pid int, entry *mapEntry, path string) (*mappedModule, *elfSymbolizer, error) {
+	fileID := fmt.Sprintf("%s:%d", path, entry.Inode)
+	m.mu.Lock()
+	mod := m.modules[fileID]
+	m.mu.Unlock()
+	if mod != nil {
+		if s, ok := moduleCache.Get(mod.key); ok {
+			return mod, s, nil
+		}
+	}
+
+	f, err := openMappedFile(pid, entry, path)
+	if err != nil {
+		return mod, nil, fmt.Errorf("failed to open mapped file '%s' for PID %d: %w", path, pid, err)
+	}
+	defer f.Close()
+
+	if mod == nil {
+		if mod, err = readMappedModule(f, entry); err != nil {
+			return nil, nil, fmt.Errorf("failed to load symbols from '%s': %w", path, err)
+		}
+		m.mu.Lock()
+		m.modules[fileID] = mod
+		m.mu.Unlock()
+		// 其他进程可能已经加载过同一个模块
+		if s, ok := moduleCache.Get(mod.key); ok {
+			return mod, s, nil
+		}
+	}
+
+	s, err := loadSymbolizer(f, mod.buildID)
+	if err != nil {
+		return mod, nil, fmt.Errorf("failed to load symbols from '%s': %w", path, err)
+	}
+	moduleCache.Add(mod.key, s, s.size)
+	return mod, s, nil
+}
+
+// FindSymbolFromPidPtr 根据 PID 和内存地址查找符号信息
+// pid: 目标进程的 ID
+// ptr: 目标进程内的内存地址
+// 返回: 符号信息指针和错误 (如果发生)
+func FindSymbolFromPidPtr(pid int, ptr uintptr) (*SymbolInfo, error) {
+	if pid <= 0 {
+		return nil, errors.New("invalid PID provided (must be > 0)")
+	}
+	if ptr == 0 {
+		// Technically a valid address, but unlikely to hold a meaningful user symbol.
+		// Can be adjusted if resolving symbols at address 0 is required.
+		return nil, errors.New("invalid pointer (0x0) provided, usually not a user symbol location")
+	}
+
+	maps, cached := processMapsCache.Get(pid)
+	if !cached {
+		var err error
+		if maps, err = loadProcessMaps(pid); err != nil {
+			return nil, err
+		}
+	}
+	targetEntry := maps.find(ptr)
+	if targetEntry == nil && cached {
+		// 缓存之后进程可能又 dlopen 了新的库，重新读取一次 maps
+		var err error
+		if maps, err = loadProcessMaps(pid); err != nil {
+			return nil, err
+		}
+		targetEntry = maps.find(ptr)
+	}
 	if targetEntry == nil {
 		return nil, fmt.Errorf("pointer 0x%x not found in any mapped region for PID %d", ptr, pid)
 	}
@@ -206,7 +338,7 @@ func findSymbolFromPidPtrImpl(pid int, ptr uintptr) (*SymbolInfo, error) {
 		}, nil
 	}
 
-	// --- It's a file-backed mapping, find its base address and use addr2line ---
+	// --- It's a file-backed mapping, find its base address and resolve the symbol from the ELF file ---
 
 	// Clean up path (remove "(deleted)")
 	targetPath := targetEntry.Path
@@ -216,21 +348,15 @@ func findSymbolFromPidPtrImpl(pid int, ptr uintptr) (*SymbolInfo, error) {
 		isDeleted = true
 	}
 
-	// Check if path is absolute (it usually is in /proc/pid/maps)
-	if !filepath.IsAbs(targetPath) {
-		// This is unlikely but good to handle. We might need PWD of the process for accuracy.
-		fmt.Fprintf(os.Stderr, "Warning: Path '%s' from maps for PID %d is relative. addr2line might fail if not run from the correct directory.\n", targetPath, pid)
-	}
-
 	// Find the base address for this specific file instance (path + inode)
 	uniqueFileID := fmt.Sprintf("%s:%d", targetPath, targetEntry.Inode) // Use cleaned path
-	baseAddr, found := baseAddresses[uniqueFileID]
+	baseAddr, found := maps.baseAddresses[uniqueFileID]
 
 	if !found {
 		// Fallback: Try finding the base address using the path and the *first* inode we saw for it.
-		if firstInode, inodeFound := filePathToInode[targetPath]; inodeFound {
+		if firstInode, inodeFound := maps.filePathToInode[targetPath]; inodeFound {
 			fallbackUniqueID := fmt.Sprintf("%s:%d", targetPath, firstInode)
-			baseAddr, found = baseAddresses[fallbackUniqueID]
+			baseAddr, found = maps.baseAddresses[fallbackUniqueID]
 			if found {
 				fmt.Fprintf(os.Stderr, "Warning: Using base address associated with first encountered inode (%d) for path '%s' as specific inode (%d) wasn't found in offset 0 maps.\n", firstInode, targetPath, targetEntry.Inode)
 			}
@@ -249,7 +375,7 @@ func findSymbolFromPidPtrImpl(pid int, ptr uintptr) (*SymbolInfo, error) {
 	// Calculate ptr offset relative to the file's determined load base address
 	offset := ptr - baseAddr
 
-	// Prepare result struct even before calling addr2line
+	// Prepare result struct even before reading the ELF file
 	result := &SymbolInfo{
 		SymbolName:  fmt.Sprintf("symbol at offset 0x%x", offset), // Default name
 		FilePath:    targetPath,                                   // Use potentially cleaned path
@@ -262,122 +388,50 @@ func findSymbolFromPidPtrImpl(pid int, ptr uintptr) (*SymbolInfo, error) {
 		result.FilePath += " (deleted)" // Add back for clarity in output
 	}
 
-	// Execute addr2line
-	// -e: Specify executable/library
-	// -f: Output function names
-	// -C: Demangle C++ symbols
-	// -i: Resolve inlined functions (provides more detail)
-	// -p: Pretty-print address (makes parsing easier)
-	cmd := exec.Command(addr2line, "-e", targetPath, "-fCi", "-p", fmt.Sprintf("0x%x", offset))
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	cmd.Env = append(os.Environ(), "LC_ALL=C")
-
-	err = cmd.Run()
-	if err != nil {
-		// addr2line failed (e.g., file not found, no debug info, invalid offset)
-		errMsg := fmt.Sprintf("addr2line execution failed for path '%s' offset 0x%x: %v", targetPath, offset, err)
-		stderrMsg := strings.TrimSpace(stderr.String())
-		if stderrMsg != "" {
-			errMsg += fmt.Sprintf(" | addr2line stderr: %s", stderrMsg)
-		}
+	mod, symbolizer, err := maps.module(pid, targetEntry, targetPath)
+	if mod == nil {
 		// Return the partially filled result struct along with the error
-		return result, errors.New(errMsg)
+		return result, err
 	}
 
-	// Parse addr2line output (last line is usually most specific with -i)
-	outputLines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
-	if len(outputLines) == 0 {
-		// Empty output from addr2line? Unexpected.
-		return result, errors.New("addr2line produced empty output")
+	// Symbol tables and DWARF use virtual addresses, not offsets from the load base (they differ for non-PIE executables)
+	pc, ok := mod.fileOffsetToAddr(uint64(ptr - targetEntry.StartAddr + targetEntry.FileOffset))
+	if !ok {
+		return result, fmt.Errorf("pointer 0x%x is outside the loadable segments of '%s'", ptr, targetPath)
 	}
-
-	// fmt.Fprintf(os.Stderr, "Warning: addr2line output: %s\n", stdout.String())
-
-	lastLine := outputLines[len(outputLines)-1]
-
-	// Expected format with -p: "0xOFFSET: FUNCTION at FILE:LINE"
-	addrPrefix := fmt.Sprintf("0x%x: ", offset) // Note the space after colon
-	if strings.HasPrefix(lastLine, addrPrefix) {
-		relevantPart := strings.TrimPrefix(lastLine, addrPrefix)
-		parts := strings.SplitN(relevantPart, " at ", 2)
-		symbolName := strings.TrimSpace(parts[0])
-		if symbolName != "??" && symbolName != "" { // Update symbol name if found
-			result.SymbolName = symbolName
-		} else {
-			result.SymbolName = fmt.Sprintf("Symbol at offset 0x%x (no name)", offset) // More specific default
-		}
-
-		if len(parts) == 2 {
-			fileLinePart := strings.TrimSpace(parts[1])
-			// Find the last colon for line number, robust against colons in filenames
-			if locIdx := strings.LastIndex(fileLinePart, ":"); locIdx != -1 {
-				filePart := fileLinePart[:locIdx]
-				linePart := fileLinePart[locIdx+1:]
-
-				// Clean up line number part from extras like (discriminator N) or (inlined by...)
-				if parenIdx := strings.Index(linePart, " ("); parenIdx != -1 {
-					linePart = linePart[:parenIdx]
-				}
-				if discIdx := strings.Index(linePart, " discriminator "); discIdx != -1 {
-					linePart = linePart[:discIdx]
-				}
-				linePart = strings.TrimSpace(linePart) // Trim potential spaces
-
-				if lineInt, err := strconv.Atoi(linePart); err == nil {
-					result.SourceFile = filePart
-					result.SourceLine = lineInt
-				} else {
-					// Could not parse line number part, treat whole thing as file path
-					result.SourceFile = fileLinePart
-					result.SourceLine = 0 // Reset line number
-				}
-			} else {
-				// No colon found, treat whole part as file path
-				result.SourceFile = fileLinePart
-				result.SourceLine = 0
-			}
-		}
-	} else {
-		// Fallback or unexpected format
-		// vectorAdd(float const*, float const*, float*, int) at ??:?
-
-		result.SymbolName = strings.Split(lastLine, " at ")[0]
+	result.BuildID = mod.buildID
+	result.Address = pc
+	if err != nil {
+		return result, err
 	}
 
+	symbolizer.symbolize(pc, result) // Keeps the default name if neither the symbol table nor DWARF covers pc
+
 	return result, nil // Success
 }
 
-func FindSymbolFromPidPtr(pid int, ptr uintptr) (*SymbolInfo, error) {
-	if time.Since(lastClearCacheTime) > 10*time.Minute {
-		symbolCacheLock.Lock()
-		if symbolCache == nil {
-			symbolCache = make(map[string]SymbolInfo)
+// SymbolizeStack 解析用户态调用栈 (bpf_get_stack 采集的地址，从栈顶开始)，返回从栈顶到栈底的帧名。
+// 被内联的函数展开为单独的帧；无法解析的帧记为 "文件名+0x偏移"，不在任何映射中的记为 "0x地址"。
+func SymbolizeStack(pid int, stack []uint64) []string {
+	frames := make([]string, 0, len(stack))
+	for i, addr := range stack {
+		pc := addr
+		if i > 0 && pc > 0 {
+			// 除栈顶外都是返回地址，指向 call 的下一条指令，减一才落在调用所在的函数和源码行
+			pc--
+		}
+		info, err := FindSymbolFromPidPtr(pid, uintptr(pc))
+		switch {
+		case err == nil && info.Resolved:
+			frames = append(frames, info.SymbolName)
+			for _, inl := range info.Inlined {
+				frames = append(frames, inl.Function)
+			}
+		case info != nil && info.FilePath != "" && !strings.HasPrefix(info.FilePath, "["):
+			frames = append(frames, fmt.Sprintf("%s+0x%x", filepath.Base(strings.TrimSuffix(info.FilePath, " (deleted)")), info.Offset))
+		default:
+			frames = append(frames, fmt.Sprintf("0x%x", addr))
 		}
-		clear(symbolCache)
-		lastClearCacheTime = time.Now()
-		symbolCacheLock.Unlock()
-	}
-
-	// Check cache first
-	symbolCacheLock.Lock()
-	cached, ok := symbolCache[fmt.Sprintf("%d_%x", pid, ptr)]
-	symbolCacheLock.Unlock()
-	if ok {
-		return &cached, nil
-	}
-
-	res, err := findSymbolFromPidPtrImpl(pid, ptr)
-	if err != nil {
-		return nil, err
 	}
-
-	// Store in cache
-	symbolCacheLock.Lock()
-	symbolCache[fmt.Sprintf("%d_%x", pid, ptr)] = *res
-	symbolCacheLock.Unlock()
-
-	return res, nil
+	return frames
 }
@@ -37,13 +37,13 @@ func TestFindSymbolFromPidPtr_SpecificExample(t *testing.T) {
 			// Consider skipping instead if preferred: t.Skipf(...)
 			return
 		}
-		// Check if the error is due to addr2line failing (e.g., binary stripped, path incorrect)
-		// This is an expected outcome if the 'cudademo' binary lacks debug symbols or isn't at the path found in maps.
-		if strings.Contains(err.Error(), "addr2line execution failed") {
-			t.Logf("Test Info: addr2line failed as expected if symbols/path are missing: %v", err)
-			// Even if addr2line failed, we might have partial info. Check if info is non-nil.
+		// Check if the error is due to the ELF file being unreadable (e.g., path incorrect, not an ELF file)
+		// This is an expected outcome if the 'cudademo' binary isn't at the path found in maps.
+		if strings.Contains(err.Error(), "failed to open mapped file") || strings.Contains(err.Error(), "failed to load symbols") {
+			t.Logf("Test Info: reading the ELF file failed as expected if the path is missing: %v", err)
+			// Even if symbolization failed, we might have partial info. Check if info is non-nil.
 			if info == nil {
-				t.Errorf("Expected non-nil partial SymbolInfo even when addr2line failed, but got nil")
+				t.Errorf("Expected non-nil partial SymbolInfo even when symbolization failed, but got nil")
 			} else {
 				// Check if the partial path info is reasonable
 				if !strings.Contains(info.FilePath, expectedExeNamePart) {
@@ -51,7 +51,7 @@ func TestFindSymbolFromPidPtr_SpecificExample(t *testing.T) {
 				}
 				t.Logf("Partial Info: FilePath='%s', Offset=0x%x, Base=0x%x", info.FilePath, info.Offset, info.BaseAddress)
 			}
-			// Don't proceed to check symbol name if addr2line failed.
+			// Don't proceed to check symbol name if symbolization failed.
 			return
 		}
 
@@ -0,0 +1,405 @@
+// symbolizer.go
+package platform
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/ianlancetaylor/demangle"
+)
+
+// InlineFrame 是一层内联调用：Function 在 SourceFile:SourceLine 处内联了内层函数
+type InlineFrame struct {
+	Function   string `json:"function"`
+	SourceFile string `json:"source_file"`
+	SourceLine int    `json:"source_line"`
+}
+
+// elfSymbol 是符号表中的一个函数
+type elfSymbol struct {
+	addr uint64
+	size uint64
+	name string
+}
+
+// elfLoad 是一个 PT_LOAD 段，用于把文件偏移换算为虚拟地址
+type elfLoad struct {
+	off    uint64
+	vaddr  uint64
+	filesz uint64
+}
+
+// cuRange 是一个编译单元覆盖的地址范围
+type cuRange struct {
+	low, high uint64
+	offset    dwarf.Offset
+}
+
+// symbolResult 是一个地址的解析结果，在使用同一模块的进程间共享
+type symbolResult struct {
+	name       string
+	sourceFile string
+	sourceLine int
+	inlined    []InlineFrame
+}
+
+// elfSymbolizer 保存一个 ELF 文件解析后的符号表和 DWARF 调试信息，可并发使用
+type elfSymbolizer struct {
+	symbols []elfSymbol // 按地址排序
+	dwarf   *dwarf.Data // 没有调试信息时为 nil
+	cus     []cuRange   // 按 low 排序
+	size    int64       // 估算的内存占用，作为模块级缓存的 cost
+
+	// 遍历 DWARF 的开销较大，缓存已解析的地址 (同一个 kernel 会被反复启动)
+	results *LRUCache[uint64, symbolResult]
+}
+
+// attrMIPSLinkageName 是旧版 GCC 使用的 DW_AT_MIPS_linkage_name
+const attrMIPSLinkageName dwarf.Attr = 0x2007
+
+// debugFileDir 是按 build-id 存放分离调试信息的目录 (.build-id/xx/yyyy.debug)
+const debugFileDir = "/usr/lib/debug"
+
+// openMappedFile 打开进程映射的文件。优先使用 /proc/<pid>/map_files (需要 CAP_SYS_ADMIN)，
+// 文件已被删除或位于容器的 mount 命名空间中时仍指向进程实际映射的文件；其次通过进程的根目录和原路径打开。
+// 返回 inode 与 maps 中一致的文件，都不一致时返回第一个能打开的文件。
+func openMappedFile(pid int, entry *mapEntry, path string) (*os.File, error) {
+	candidates := []string{
+		fmt.Sprintf("/proc/%d/map_files/%x-%x", pid, entry.StartAddr, entry.EndAddr),
+		fmt.Sprintf("/proc/%d/root%s", pid, path),
+		path,
+	}
+	var fallback *os.File
+	var firstErr error
+	for _, candidate := range candidates {
+		f, err := os.Open(candidate)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if fileInode(f) == entry.Inode {
+			if fallback != nil {
+				fallback.Close()
+			}
+			return f, nil
+		}
+		if fallback == nil {
+			fallback = f
+		} else {
+			f.Close()
+		}
+	}
+	if fallback != nil {
+		return fallback, nil
+	}
+	return nil, firstErr
+}
+
+func fileInode(f *os.File) uint64 {
+	fi, err := f.Stat()
+	if err != nil {
+		return 0
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return st.Ino
+	}
+	return 0
+}
+
+// loadSymbolizer 解析 ELF 的 .symtab / .dynsym 中的函数符号和 DWARF。
+// 文件本身没有 DWARF 时尝试 /usr/lib/debug/.build-id 下的分离调试信息。
+func loadSymbolizer(f *os.File, buildID string) (*elfSymbolizer, error) {
+	ef, err := elf.NewFile(f)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &elfSymbolizer{results: NewLRUCache[uint64, symbolResult](symbolResultCacheEntries)}
+
+	// .symtab 在前，同一地址有多个符号时保留 .symtab 中的 (dynsym 是它的子集)
+	syms, _ := ef.Symbols()
+	dynSyms, _ := ef.DynamicSymbols()
+	for _, sym := range append(syms, dynSyms...) {
+		typ := elf.ST_TYPE(sym.Info)
+		if (typ != elf.STT_FUNC && typ != elf.STT_GNU_IFUNC) || sym.Value == 0 || sym.Section == elf.SHN_UNDEF {
+			continue
+		}
+		s.symbols = append(s.symbols, elfSymbol{addr: sym.Value, size: sym.Size, name: sym.Name})
+	}
+	sort.SliceStable(s.symbols, func(i, j int) bool { return s.symbols[i].addr < s.symbols[j].addr })
+	deduped := s.symbols[:0]
+	for i, sym := range s.symbols {
+		if i > 0 && sym.addr == s.symbols[i-1].addr {
+			continue
+		}
+		deduped = append(deduped, sym)
+	}
+	s.symbols = deduped
+	// 符号名和切片元素，以及地址缓存按每条约 256 字节估算
+	s.size = int64(symbolResultCacheEntries) * 256
+	for _, sym := range s.symbols {
+		s.size += int64(len(sym.name)) + 40
+	}
+
+	var debugSize int64
+	s.dwarf, debugSize = loadDWARF(ef)
+	if s.dwarf == nil && len(buildID) > 2 {
+		debugPath := fmt.Sprintf("%s/.build-id/%s/%s.debug", debugFileDir, buildID[:2], buildID[2:])
+		if df, err := elf.Open(debugPath); err == nil {
+			s.dwarf, debugSize = loadDWARF(df)
+			df.Close()
+		}
+	}
+	if s.dwarf != nil {
+		s.cus = indexCompileUnits(s.dwarf)
+		s.size += debugSize + int64(len(s.cus))*24
+	}
+	return s, nil
+}
+
+// loadDWARF 读取调试信息并返回调试节解压后的总大小 (dwarf.Data 会把它们全部读入内存)，
+// 没有 .debug_info 或解析失败时返回 nil
+func loadDWARF(ef *elf.File) (*dwarf.Data, int64) {
+	if ef.Section(".debug_info") == nil && ef.Section(".zdebug_info") == nil {
+		return nil, 0
+	}
+	d, err := ef.DWARF()
+	if err != nil {
+		return nil, 0
+	}
+	var size int64
+	for _, sec := range ef.Sections {
+		if strings.HasPrefix(sec.Name, ".debug_") || strings.HasPrefix(sec.Name, ".zdebug_") {
+			size += int64(sec.Size)
+		}
+	}
+	return d, size
+}
+
+func indexCompileUnits(d *dwarf.Data) []cuRange {
+	var cus []cuRange
+	r := d.Reader()
+	for {
+		e, err := r.Next()
+		if err != nil || e == nil {
+			break
+		}
+		if e.Tag == dwarf.TagCompileUnit {
+			if ranges, err := d.Ranges(e); err == nil {
+				for _, rg := range ranges {
+					cus = append(cus, cuRange{low: rg[0], high: rg[1], offset: e.Offset})
+				}
+			}
+		}
+		r.SkipChildren()
+	}
+	sort.Slice(cus, func(i, j int) bool { return cus[i].low < cus[j].low })
+	return cus
+}
+
+// lookupSymbol 二分查找包含 pc 的函数符号。size 为 0 的符号视为延伸到下一个符号。
+func (s *elfSymbolizer) lookupSymbol(pc uint64) (elfSymbol, bool) {
+	i := sort.Search(len(s.symbols), func(i int) bool { return s.symbols[i].addr > pc }) - 1
+	if i < 0 {
+		return elfSymbol{}, false
+	}
+	sym := s.symbols[i]
+	if sym.size != 0 && pc >= sym.addr+sym.size {
+		return elfSymbol{}, false
+	}
+	return sym, true
+}
+
+// symbolize 解析 pc 的函数名、源码位置和内联调用链，写入 info 中能解析出的字段。
+// 与 addr2line -fCi 一致：SymbolName 为最内层 (可能是被内联的) 函数，SourceFile:SourceLine 为 pc 所在的源码行，
+// Inlined 依次为外层调用者及其调用位置。
+func (s *elfSymbolizer) symbolize(pc uint64, info *SymbolInfo) {
+	res, ok := s.results.Get(pc)
+	if !ok {
+		res = s.resolve(pc)
+		s.results.Add(pc, res, 1)
+	}
+	if res.name != "" {
+		info.SymbolName = res.name
+		info.Resolved = true
+	}
+	if res.sourceFile != "" {
+		info.SourceFile = res.sourceFile
+		info.SourceLine = res.sourceLine
+	}
+	info.Inlined = res.inlined
+}
+
+func (s *elfSymbolizer) resolve(pc uint64) symbolResult {
+	var res symbolResult
+	if sym, ok := s.lookupSymbol(pc); ok {
+		res.name = demangle.Filter(sym.name)
+	}
+	if s.dwarf == nil {
+		return res
+	}
+
+	i := sort.Search(len(s.cus), func(i int) bool { return s.cus[i].low > pc }) - 1
+	if i < 0 || pc >= s.cus[i].high {
+		return res
+	}
+	r := s.dwarf.Reader()
+	r.Seek(s.cus[i].offset)
+	cu, err := r.Next()
+	if err != nil || cu == nil {
+		return res
+	}
+
+	lr, _ := s.dwarf.LineReader(cu)
+	var files []*dwarf.LineFile
+	if lr != nil {
+		var le dwarf.LineEntry
+		if lr.SeekPC(pc, &le) == nil && le.File != nil {
+			res.sourceFile = le.File.Name
+			res.sourceLine = le.Line
+		}
+		files = lr.Files()
+	}
+
+	chain := s.scopesContaining(r, pc)
+	if len(chain) == 0 {
+		return res
+	}
+	if name := dwarfFuncName(s.dwarf, chain[len(chain)-1]); name != "" {
+		res.name = name
+	}
+	for j := len(chain) - 1; j > 0; j-- {
+		frame := InlineFrame{Function: dwarfFuncName(s.dwarf, chain[j-1])}
+		if idx, ok := chain[j].Val(dwarf.AttrCallFile).(int64); ok && idx >= 0 && int(idx) < len(files) && files[idx] != nil {
+			frame.SourceFile = files[idx].Name
+		}
+		if line, ok := chain[j].Val(dwarf.AttrCallLine).(int64); ok {
+			frame.SourceLine = int(line)
+		}
+		res.inlined = append(res.inlined, frame)
+	}
+	return res
+}
+
+// scopesContaining 从编译单元的第一个子节点开始遍历，返回包含 pc 的函数及内联函数，从外到内排列
+func (s *elfSymbolizer) scopesContaining(r *dwarf.Reader, pc uint64) []*dwarf.Entry {
+	var chain []*dwarf.Entry
+	depth := 0
+	for {
+		e, err := r.Next()
+		if err != nil || e == nil {
+			break
+		}
+		if e.Tag == 0 {
+			depth--
+			// 离开了编译单元，或者已经找到函数并回到编译单元顶层
+			if depth < 0 || (depth == 0 && len(chain) > 0) {
+				break
+			}
+			continue
+		}
+		if !e.Children {
+			if (e.Tag == dwarf.TagSubprogram || e.Tag == dwarf.TagInlinedSubroutine) && s.containsPC(e, pc) {
+				// 没有子节点，不会再有更内层的内联函数
+				return append(chain, e)
+			}
+			continue
+		}
+		switch e.Tag {
+		case dwarf.TagSubprogram, dwarf.TagInlinedSubroutine:
+			if !s.containsPC(e, pc) {
+				r.SkipChildren()
+				continue
+			}
+			chain = append(chain, e)
+		case dwarf.TagLexDwarfBlock, dwarf.TagNamespace:
+			// 内联函数可能位于词法块中，C++ 的函数可能位于 namespace 中
+		default:
+			r.SkipChildren()
+			continue
+		}
+		depth++
+	}
+	return chain
+}
+
+func (s *elfSymbolizer) containsPC(e *dwarf.Entry, pc uint64) bool {
+	ranges, err := s.dwarf.Ranges(e)
+	if err != nil {
+		return false
+	}
+	for _, rg := range ranges {
+		if pc >= rg[0] && pc < rg[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// dwarfFuncName 返回函数的名字，沿 DW_AT_abstract_origin / DW_AT_specification 查找声明。
+// 有 linkage name 时返回 demangle 后的完整签名，与 addr2line -C 一致。
+func dwarfFuncName(d *dwarf.Data, e *dwarf.Entry) string {
+	var name string
+	for i := 0; i < 4 && e != nil; i++ {
+		for _, attr := range []dwarf.Attr{dwarf.AttrLinkageName, attrMIPSLinkageName} {
+			if linkage, ok := e.Val(attr).(string); ok && linkage != "" {
+				return demangle.Filter(linkage)
+			}
+		}
+		if n, ok := e.Val(dwarf.AttrName).(string); ok && name == "" {
+			name = n
+		}
+		ref, ok := e.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset)
+		if !ok {
+			if ref, ok = e.Val(dwarf.AttrSpecification).(dwarf.Offset); !ok {
+				break
+			}
+		}
+		r := d.Reader()
+		r.Seek(ref)
+		if e, _ = r.Next(); e == nil {
+			break
+		}
+	}
+	return name
+}
+
+// ELFSymbols 是从调试文件加载的符号表和 DWARF，用于在目标进程已经不存在时按 (build-id, 地址) 离线解析
+type ELFSymbols struct {
+	BuildID string
+	s       *elfSymbolizer
+}
+
+// LoadELFSymbols 加载 path 指向的 ELF 文件 (可执行文件、共享库或分离的 .debug 文件)
+func LoadELFSymbols(path string) (*ELFSymbols, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	buildID, _ := ReadELFBuildID(f)
+	s, err := loadSymbolizer(f, "")
+	if err != nil {
+		return nil, err
+	}
+	return &ELFSymbols{BuildID: buildID, s: s}, nil
+}
+
+// Symbolize 解析 ELF 虚拟地址 addr (即 SymbolInfo.Address)，没有符号覆盖时 Resolved 为 false
+func (e *ELFSymbols) Symbolize(addr uint64) SymbolInfo {
+	info := SymbolInfo{BuildID: e.BuildID, Address: addr}
+	e.s.symbolize(addr, &info)
+	return info
+}
+
+// Size 返回估算的内存占用 (字节)
+func (e *ELFSymbols) Size() int64 {
+	return e.s.size
+}
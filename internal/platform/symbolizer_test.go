@@ -0,0 +1,210 @@
+// symbolizer_test.go
+package platform
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// go test 链接的测试二进制默认不带符号表和 DWARF，这里用 C 编译器构建带调试信息的测试程序
+const symbolizerTestSource = `static inline __attribute__((always_inline)) int inner(int x) {
+	return x * 7 + 1;
+}
+
+__attribute__((noinline)) int outer(int x) {
+	return inner(x) + 2;
+}
+
+int main(int argc, char **argv) {
+	(void)argv;
+	return outer(argc);
+}
+`
+
+func buildSymbolizerTestProgram(t *testing.T) string {
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("C compiler not available")
+	}
+	dir := t.TempDir()
+	src := filepath.Join(dir, "prog.c")
+	if err := os.WriteFile(src, []byte(symbolizerTestSource), 0644); err != nil {
+		t.Fatal(err)
+	}
+	bin := filepath.Join(dir, "prog")
+	if out, err := exec.Command(cc, "-g", "-O0", "-o", bin, src).CombinedOutput(); err != nil {
+		t.Skipf("failed to compile test program: %v: %s", err, out)
+	}
+	return bin
+}
+
+func TestElfSymbolizer(t *testing.T) {
+	bin := buildSymbolizerTestProgram(t)
+	f, err := os.Open(bin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	s, err := loadSymbolizer(f, "")
+	if err != nil {
+		t.Fatalf("loadSymbolizer: %v", err)
+	}
+	if s.dwarf == nil {
+		t.Fatal("expected DWARF in a binary built with -g")
+	}
+
+	var outer elfSymbol
+	for _, sym := range s.symbols {
+		if sym.name == "outer" {
+			outer = sym
+		}
+	}
+	if outer.addr == 0 || outer.size == 0 {
+		t.Fatalf("outer not found in symbol table")
+	}
+
+	var entry SymbolInfo
+	s.symbolize(outer.addr, &entry)
+	if entry.SymbolName != "outer" || filepath.Base(entry.SourceFile) != "prog.c" || entry.SourceLine != 5 {
+		t.Errorf("symbolize(outer) = %s at %s:%d, want outer at prog.c:5", entry.SymbolName, entry.SourceFile, entry.SourceLine)
+	}
+
+	// outer 中至少有一条指令属于被内联的 inner
+	for pc := outer.addr; pc < outer.addr+outer.size; pc++ {
+		var info SymbolInfo
+		s.symbolize(pc, &info)
+		if info.SymbolName != "inner" {
+			continue
+		}
+		if info.SourceLine != 2 {
+			t.Errorf("inlined inner at line %d, want 2", info.SourceLine)
+		}
+		if len(info.Inlined) != 1 || info.Inlined[0].Function != "outer" || info.Inlined[0].SourceLine != 6 ||
+			filepath.Base(info.Inlined[0].SourceFile) != "prog.c" {
+			t.Errorf("Inlined = %+v, want [outer at prog.c:6]", info.Inlined)
+		}
+		return
+	}
+	t.Error("no instruction of outer resolved to the inlined inner")
+}
+
+func TestLoadELFSymbols(t *testing.T) {
+	bin := buildSymbolizerTestProgram(t)
+	es, err := LoadELFSymbols(bin)
+	if err != nil {
+		t.Fatalf("LoadELFSymbols: %v", err)
+	}
+	f, err := os.Open(bin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if id, _ := ReadELFBuildID(f); es.BuildID != id {
+		t.Errorf("BuildID = %q, want %q", es.BuildID, id)
+	}
+
+	var outer elfSymbol
+	for _, sym := range es.s.symbols {
+		if sym.name == "outer" {
+			outer = sym
+		}
+	}
+	info := es.Symbolize(outer.addr)
+	if !info.Resolved || info.SymbolName != "outer" || info.SourceLine != 5 || info.Address != outer.addr {
+		t.Errorf("Symbolize(outer) = %+v, want outer at line 5", info)
+	}
+	if info := es.Symbolize(1); info.Resolved {
+		t.Errorf("Symbolize(1) = %+v, want unresolved", info)
+	}
+}
+
+func TestFindSymbolFromPidPtr_Self(t *testing.T) {
+	if _, err := os.Stat("/proc/self/maps"); err != nil {
+		t.Skip("/proc not available")
+	}
+	ptr := reflect.ValueOf(TestFindSymbolFromPidPtr_Self).Pointer()
+	info, err := FindSymbolFromPidPtr(os.Getpid(), ptr)
+	if err != nil {
+		t.Fatalf("FindSymbolFromPidPtr: %v", err)
+	}
+	exe, _ := os.Executable()
+	if info.FilePath != exe {
+		t.Errorf("FilePath = %q, want %q", info.FilePath, exe)
+	}
+	if info.Address == 0 {
+		t.Error("Address should be set for a file-backed mapping")
+	}
+
+	// 第二次查找命中进程级和模块级缓存
+	before := GetSymbolCacheStats()
+	if _, err := FindSymbolFromPidPtr(os.Getpid(), ptr); err != nil {
+		t.Fatalf("FindSymbolFromPidPtr: %v", err)
+	}
+	after := GetSymbolCacheStats()
+	if after.Processes.Hits != before.Processes.Hits+1 || after.Modules.Hits != before.Modules.Hits+1 {
+		t.Errorf("stats before %+v after %+v, want one hit on each level", before, after)
+	}
+
+	InvalidatePid(os.Getpid())
+	if _, ok := processMapsCache.Get(os.Getpid()); ok {
+		t.Error("InvalidatePid should drop the cached maps")
+	}
+}
+
+func TestSymbolizeStack(t *testing.T) {
+	if _, err := os.Stat("/proc/self/maps"); err != nil {
+		t.Skip("/proc not available")
+	}
+	ptr := reflect.ValueOf(TestSymbolizeStack).Pointer()
+	frames := SymbolizeStack(os.Getpid(), []uint64{uint64(ptr), 0})
+	if len(frames) != 2 {
+		t.Fatalf("frames = %q, want 2", frames)
+	}
+	// go test 的二进制没有符号表时按 "文件名+偏移" 记录
+	exe, _ := os.Executable()
+	if frames[0] != "TestSymbolizeStack" && !strings.HasPrefix(frames[0], filepath.Base(exe)+"+0x") {
+		t.Errorf("frames[0] = %q", frames[0])
+	}
+	if frames[1] != "0x0" {
+		t.Errorf("frames[1] = %q, want 0x0", frames[1])
+	}
+}
+
+func TestElfSymbolizerLookup(t *testing.T) {
+	mod := &mappedModule{loads: []elfLoad{{off: 0x1000, vaddr: 0x401000, filesz: 0x2000}}}
+	s := &elfSymbolizer{
+		results: NewLRUCache[uint64, symbolResult](symbolResultCacheEntries),
+		symbols: []elfSymbol{
+			{addr: 0x401000, size: 0x10, name: "_Z9vectorAddPKfS0_Pfi"},
+			{addr: 0x401100, size: 0, name: "main"},
+		},
+	}
+	pc, ok := mod.fileOffsetToAddr(0x1008)
+	if !ok || pc != 0x401008 {
+		t.Fatalf("fileOffsetToAddr(0x1008) = %#x, %v", pc, ok)
+	}
+	if _, ok := mod.fileOffsetToAddr(0x4000); ok {
+		t.Error("fileOffsetToAddr outside PT_LOAD should fail")
+	}
+
+	cases := []struct {
+		pc   uint64
+		want string
+	}{
+		{0x401008, "vectorAdd(float const*, float const*, float*, int)"},
+		{0x401050, ""}, // 在 vectorAdd 之后、main 之前的空隙
+		{0x401200, "main"},
+		{0x400000, ""},
+	}
+	for _, c := range cases {
+		var info SymbolInfo
+		s.symbolize(c.pc, &info)
+		if info.SymbolName != c.want {
+			t.Errorf("symbolize(%#x) = %q, want %q", c.pc, info.SymbolName, c.want)
+		}
+	}
+}
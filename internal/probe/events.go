@@ -0,0 +1,253 @@
+// events.go
+package probe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"scope/internal/models"
+)
+
+const (
+	taskCommLen   = 16
+	maxStackDepth = 32 // 与 bpf/*/*.h 中的 MAX_STACK_DEPTH 一致
+	maxArgsToRead = 8  // execv.h 中的 MAX_ARGS_TO_READ，每个参数占 16 字节
+)
+
+// 以下结构体与各探针 .h 中 struct event 的内存布局一致 (LP64)，C 编译器插入的对齐填充用 _ 字段显式写出
+
+type vfsOpenRecord struct {
+	PID      int32
+	Comm     [taskCommLen]byte
+	Filename [256]byte
+}
+
+type syscallsRecord struct {
+	PID       int32
+	SyscallID int32
+	Comm      [taskCommLen]byte
+}
+
+type schedRecord struct {
+	Type int32 // enum event_type { SWITCH_IN, SWITCH_OUT }
+	Cpu  int32
+	PID  int32
+	Comm [taskCommLen]byte
+}
+
+type execvRecord struct {
+	PID      int32
+	PPID     int32
+	Filename [64]byte
+	Args     [maxArgsToRead * 16]byte
+}
+
+type llamaLogRecord struct {
+	PID  int32
+	Comm [taskCommLen]byte
+	Text [256]byte
+}
+
+type ggmlCpuRecord struct {
+	PID        int32
+	Comm       [taskCommLen]byte
+	GraphSize  int32
+	GraphNodes int32
+	GraphLeafs int32
+	GraphOrder int32
+	_          [4]byte
+	CostNs     uint64
+}
+
+type ggmlCudaRecord struct {
+	Type       int32
+	PID        int32
+	Comm       [taskCommLen]byte
+	FuncName   [32]byte // union func_duration
+	DurationNs uint64
+}
+
+type ggmlBaseRecord struct {
+	Type       int32 // EVENT_MALLOC = 0, EVENT_FREE = 1
+	PID        int32
+	Comm       [taskCommLen]byte
+	Size       uint64
+	Ptr        uint64
+	StackDepth int32
+	_          [4]byte
+	Stack      [maxStackDepth]uint64
+}
+
+// cuda.h 中 enum event_type
+const (
+	cudaEventMalloc = iota
+	cudaEventFree
+	cudaEventLaunchKernel
+	cudaEventMemcpy
+	cudaEventSync
+)
+
+type cudaRecord struct {
+	Type       int32
+	PID        int32
+	Comm       [taskCommLen]byte
+	StackDepth int32
+	_          [4]byte
+	Stack      [maxStackDepth]uint64
+	Union      [40]byte // 按 Type 解释，最大的成员是 memcpy
+}
+
+// readRecord 按 C 结构体布局解码 ring buffer 中的一条记录
+func readRecord(raw []byte, rec interface{}) error {
+	if size := binary.Size(rec); len(raw) < size {
+		return fmt.Errorf("record too short: %d bytes, want %d", len(raw), size)
+	}
+	return binary.Read(bytes.NewReader(raw), binary.NativeEndian, rec)
+}
+
+// cString 返回以 NUL 结尾的 C 字符串
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// copyStack 复制探针采集的调用栈，未采集时返回 nil
+func copyStack(stack []uint64, depth int32) []uint64 {
+	if depth <= 0 {
+		return nil
+	}
+	if int(depth) > len(stack) {
+		depth = int32(len(stack))
+	}
+	return append([]uint64(nil), stack[:depth]...)
+}
+
+func decodeVfsOpen(raw []byte, ts int64) (Event, error) {
+	var r vfsOpenRecord
+	if err := readRecord(raw, &r); err != nil {
+		return Event{}, err
+	}
+	return Event{Topic: models.VfsOpenTopic, PID: r.PID, Data: models.VfsOpenEvent{
+		TimestampNs: ts, PID: r.PID, Comm: cString(r.Comm[:]), Filename: cString(r.Filename[:]),
+	}}, nil
+}
+
+func decodeSyscalls(raw []byte, ts int64) (Event, error) {
+	var r syscallsRecord
+	if err := readRecord(raw, &r); err != nil {
+		return Event{}, err
+	}
+	return Event{Topic: models.SyscallsTopic, PID: r.PID, Data: models.SyscallsEvent{
+		TimestampNs: ts, PID: r.PID, Comm: cString(r.Comm[:]), SyscallName: SyscallName(r.SyscallID),
+	}}, nil
+}
+
+func decodeSched(raw []byte, ts int64) (Event, error) {
+	var r schedRecord
+	if err := readRecord(raw, &r); err != nil {
+		return Event{}, err
+	}
+	return Event{Topic: models.SchedTopic, PID: r.PID, Data: models.SchedEvent{
+		TimestampNs: ts, PID: r.PID, Comm: cString(r.Comm[:]), Cpu: r.Cpu, Type: r.Type,
+	}}, nil
+}
+
+// decodeExecv 把每 16 字节一个的参数以空格连接
+func decodeExecv(raw []byte, ts int64) (Event, error) {
+	var r execvRecord
+	if err := readRecord(raw, &r); err != nil {
+		return Event{}, err
+	}
+	var args []string
+	for i := 0; i < maxArgsToRead; i++ {
+		if arg := cString(r.Args[i*16 : (i+1)*16]); arg != "" {
+			args = append(args, arg)
+		}
+	}
+	return Event{Topic: models.ExecvTopic, PID: r.PID, Data: models.ExecvEvent{
+		TimestampNs: ts, PID: r.PID, Ppid: r.PPID, Filename: cString(r.Filename[:]), Args: strings.Join(args, " "),
+	}}, nil
+}
+
+func decodeLlamaLog(raw []byte, ts int64) (Event, error) {
+	var r llamaLogRecord
+	if err := readRecord(raw, &r); err != nil {
+		return Event{}, err
+	}
+	return Event{Topic: models.OllamabinTopic, PID: r.PID, Data: models.LlamaLogEvent{
+		TimestampNs: ts, PID: r.PID, Comm: cString(r.Comm[:]), Text: cString(r.Text[:]),
+	}}, nil
+}
+
+func decodeGGMLCpu(raw []byte, ts int64) (Event, error) {
+	var r ggmlCpuRecord
+	if err := readRecord(raw, &r); err != nil {
+		return Event{}, err
+	}
+	return Event{Topic: models.GGMLCpuTopic, PID: r.PID, Data: models.GGMLCpuEvent{
+		TimestampNs: ts, PID: r.PID, Comm: cString(r.Comm[:]),
+		GraphSize: r.GraphSize, GraphNodes: r.GraphNodes, GraphLeafs: r.GraphLeafs, GraphOrder: r.GraphOrder,
+		CostNs: int64(r.CostNs),
+	}}, nil
+}
+
+func decodeGGMLCuda(raw []byte, ts int64) (Event, error) {
+	var r ggmlCudaRecord
+	if err := readRecord(raw, &r); err != nil {
+		return Event{}, err
+	}
+	return Event{Topic: models.GGMLCudaTopic, PID: r.PID, Data: models.GGMLCudaEvent{
+		TimestampNs: ts, PID: r.PID, Comm: cString(r.Comm[:]), FuncName: cString(r.FuncName[:]), DurationNs: int64(r.DurationNs),
+	}}, nil
+}
+
+func decodeGGMLBase(raw []byte, ts int64) (Event, error) {
+	var r ggmlBaseRecord
+	if err := readRecord(raw, &r); err != nil {
+		return Event{}, err
+	}
+	return Event{Topic: models.GGMLBaseTopic, PID: r.PID, Data: models.GGMLBaseEvent{
+		TimestampNs: ts, PID: r.PID, Comm: cString(r.Comm[:]), Type: r.Type, Size: r.Size, Ptr: r.Ptr,
+		Stack: copyStack(r.Stack[:], r.StackDepth),
+	}}, nil
+}
+
+// decodeCuda 按事件类型解释 union，一个探针产生五种 topic
+func decodeCuda(raw []byte, ts int64) (Event, error) {
+	var r cudaRecord
+	if err := readRecord(raw, &r); err != nil {
+		return Event{}, err
+	}
+	comm := cString(r.Comm[:])
+	u64 := func(off int) uint64 { return binary.NativeEndian.Uint64(r.Union[off:]) }
+	i32 := func(off int) int { return int(int32(binary.NativeEndian.Uint32(r.Union[off:]))) }
+
+	e := Event{PID: r.PID}
+	switch r.Type {
+	case cudaEventMalloc:
+		e.Topic = models.CudaMallocTopic
+		e.Data = models.CudaMallocEvent{TimestampNs: ts, PID: r.PID, Comm: comm,
+			AllocatedPtr: u64(0), Size: u64(8), Retval: i32(16), Stack: copyStack(r.Stack[:], r.StackDepth)}
+	case cudaEventFree:
+		e.Topic = models.CudaFreeTopic
+		e.Data = models.CudaFreeEvent{TimestampNs: ts, PID: r.PID, Comm: comm, DevPtr: u64(0)}
+	case cudaEventLaunchKernel:
+		e.Topic = models.CudaLaunchKernelTopic
+		e.Data = models.CudaLaunchKernelEvent{TimestampNs: ts, PID: r.PID, Comm: comm,
+			FuncPtr: u64(0), Stack: copyStack(r.Stack[:], r.StackDepth)}
+	case cudaEventMemcpy:
+		e.Topic = models.CudaMemcpyTopic
+		e.Data = models.CudaMemcpyEvent{TimestampNs: ts, PID: r.PID, Comm: comm,
+			Src: u64(0), Dst: u64(8), Size: u64(16), Kind: i32(24), DurationNs: u64(32)}
+	case cudaEventSync:
+		e.Topic = models.CudaSyncTopic
+		e.Data = models.CudaSyncEvent{TimestampNs: ts, PID: r.PID, Comm: comm, DurationNs: u64(0)}
+	default:
+		return Event{}, fmt.Errorf("unknown cuda event type %d", r.Type)
+	}
+	return e, nil
+}
@@ -0,0 +1,106 @@
+// events_test.go
+package probe
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"scope/internal/models"
+)
+
+// 记录大小必须与 C 编译器 (LP64) 给出的 sizeof(struct event) 一致
+func TestRecordSizes(t *testing.T) {
+	cases := []struct {
+		rec  interface{}
+		want int
+	}{
+		{vfsOpenRecord{}, 276},
+		{syscallsRecord{}, 24},
+		{schedRecord{}, 28},
+		{execvRecord{}, 200},
+		{llamaLogRecord{}, 276},
+		{ggmlCpuRecord{}, 48},
+		{ggmlCudaRecord{}, 64},
+		{ggmlBaseRecord{}, 304},
+		{cudaRecord{}, 328},
+	}
+	for _, c := range cases {
+		if got := binary.Size(c.rec); got != c.want {
+			t.Errorf("sizeof(%T) = %d, want %d", c.rec, got, c.want)
+		}
+	}
+}
+
+func TestDecodeCuda(t *testing.T) {
+	// 按 cuda.h 的偏移手工构造 cudaMemcpy 记录: type、pid、comm、stack_depth、stack，union 从 288 开始
+	raw := make([]byte, 328)
+	ne := binary.NativeEndian
+	ne.PutUint32(raw[0:], cudaEventMemcpy)
+	ne.PutUint32(raw[4:], 42)
+	copy(raw[8:], "ollama")
+	ne.PutUint64(raw[288:], 0x1000)  // src
+	ne.PutUint64(raw[296:], 0x2000)  // dst
+	ne.PutUint64(raw[304:], 4096)    // size
+	ne.PutUint32(raw[312:], 1)       // kind
+	ne.PutUint64(raw[320:], 123_456) // duration_ns
+
+	e, err := decodeCuda(raw, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := models.CudaMemcpyEvent{TimestampNs: 7, PID: 42, Comm: "ollama", Src: 0x1000, Dst: 0x2000, Size: 4096, Kind: 1, DurationNs: 123_456}
+	if e.Topic != models.CudaMemcpyTopic || e.PID != 42 || !reflect.DeepEqual(e.Data, want) {
+		t.Errorf("decodeCuda = %+v, want %+v", e, want)
+	}
+
+	// cudaMalloc 带调用栈
+	raw = make([]byte, 328)
+	ne.PutUint32(raw[0:], cudaEventMalloc)
+	ne.PutUint32(raw[4:], 42)
+	ne.PutUint32(raw[24:], 2) // stack_depth
+	ne.PutUint64(raw[32:], 0xaaaa)
+	ne.PutUint64(raw[40:], 0xbbbb)
+	ne.PutUint64(raw[288:], 0x7f00) // allocated_ptr
+	ne.PutUint64(raw[296:], 1<<20)  // size
+	e, err = decodeCuda(raw, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	malloc, ok := e.Data.(models.CudaMallocEvent)
+	if !ok || malloc.AllocatedPtr != 0x7f00 || malloc.Size != 1<<20 || !reflect.DeepEqual(malloc.Stack, []uint64{0xaaaa, 0xbbbb}) {
+		t.Errorf("decodeCuda(malloc) = %+v", e.Data)
+	}
+
+	if _, err := decodeCuda(raw[:100], 7); err == nil {
+		t.Error("decodeCuda should reject a truncated record")
+	}
+}
+
+func TestDecodeExecv(t *testing.T) {
+	raw := make([]byte, 200)
+	ne := binary.NativeEndian
+	ne.PutUint32(raw[0:], 100)
+	ne.PutUint32(raw[4:], 1)
+	copy(raw[8:], "/usr/bin/ollama")
+	copy(raw[72:], "ollama")
+	copy(raw[72+16:], "serve")
+	e, err := decodeExecv(raw, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev := e.Data.(models.ExecvEvent)
+	if ev.PID != 100 || ev.Ppid != 1 || ev.Filename != "/usr/bin/ollama" || ev.Args != "ollama serve" {
+		t.Errorf("decodeExecv = %+v", ev)
+	}
+}
+
+func TestParseAusyscallDump(t *testing.T) {
+	names := parseAusyscallDump([]byte("Using x86_64 syscall table:\n0\tread\n1\twrite\n257\topenat\n"))
+	if len(names) != 3 || names[257] != "openat" {
+		t.Errorf("parseAusyscallDump = %v", names)
+	}
+	if got := SyscallName(-1); got != "[unknown: 4294967295]" {
+		t.Errorf("SyscallName(-1) = %q", got)
+	}
+}
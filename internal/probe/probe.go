@@ -0,0 +1,253 @@
+// probe.go
+// Package probe 在 agent 进程内加载 bpf/build/<name>.bpf.o，直接读取 ring buffer 并把事件解码为 models 中的结构体，
+// 不再经过 C 加载程序、ZMQ 和 msgpack。C 加载程序仍可作为后备 (见 agentmanager.StartProbes)。
+package probe
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	"github.com/cilium/ebpf/ringbuf"
+	"github.com/cilium/ebpf/rlimit"
+)
+
+// Event 是一条解码后的探针事件，Data 为 Topic 对应的 models 结构体 (例如 models.VfsOpenEvent)
+type Event struct {
+	Topic string
+	PID   int32
+	Data  interface{}
+}
+
+// Uprobe 描述一个 SEC("uprobe") / SEC("uretprobe") 程序挂载到目标文件的哪个符号
+type Uprobe struct {
+	Program string // BPF 程序 (函数) 名
+	Symbol  string // 目标库或可执行文件中的符号
+	Ret     bool   // uretprobe
+}
+
+// Spec 描述一个探针: 对象文件名、uprobe 目标以及 ring buffer 记录的解码方式。
+// tracepoint/ 和 fentry/、fexit/ 程序按 section 名自动挂载，与 libbpf 的 skeleton attach 一致。
+type Spec struct {
+	Name          string   // bpf/build/<Name>.bpf.o，也是 C 加载程序的文件名
+	DefaultTarget string   // uprobe 的默认目标文件，与 C 加载程序的默认值一致
+	TargetFlag    string   // C 加载程序指定目标文件的参数
+	Uprobes       []Uprobe // 需要手动挂载的 uprobe
+	Stack         bool     // 支持 capture_stack (C 加载程序的 -s)
+	decode        func(raw []byte, ts int64) (Event, error)
+}
+
+// Specs 是所有可以在进程内运行的探针，key 为探针名
+var Specs = map[string]*Spec{
+	"vfs_open":  {Name: "vfs_open", decode: decodeVfsOpen},
+	"syscalls":  {Name: "syscalls", decode: decodeSyscalls},
+	"sched":     {Name: "sched", decode: decodeSched},
+	"execv":     {Name: "execv", decode: decodeExecv},
+	"Ollamabin": {Name: "Ollamabin", DefaultTarget: "/usr/bin/ollama", TargetFlag: "-f", decode: decodeLlamaLog, Uprobes: []Uprobe{{Program: "uprobe_llamaLog", Symbol: "llamaLog"}}},
+	"ggml_cpu": {Name: "ggml_cpu", DefaultTarget: "/usr/lib/ollama/libggml-cpu-alderlake.so", TargetFlag: "-f", decode: decodeGGMLCpu, Uprobes: []Uprobe{
+		{Program: "uprobe_ggml_graph_compute", Symbol: "ggml_graph_compute"},
+		{Program: "uretprobe_ggml_graph_compute", Symbol: "ggml_graph_compute", Ret: true},
+	}},
+	"ggml_cuda": {Name: "ggml_cuda", DefaultTarget: "/usr/lib/ollama/cuda_v12/libggml-cuda.so", TargetFlag: "-f", decode: decodeGGMLCuda, Uprobes: []Uprobe{
+		{Program: "uprobe_ggml_cuda_op_mul_mat_vec_q", Symbol: "_Z26ggml_cuda_op_mul_mat_vec_qR25ggml_backend_cuda_contextPK11ggml_tensorS3_PS1_PKcPKfS6_PfllllP11CUstream_st"},
+		{Program: "uretprobe_ggml_cuda_op_mul_mat_vec_q", Symbol: "_Z26ggml_cuda_op_mul_mat_vec_qR25ggml_backend_cuda_contextPK11ggml_tensorS3_PS1_PKcPKfS6_PfllllP11CUstream_st", Ret: true},
+		{Program: "uprobe_ggml_cuda_op_mul_mat_q", Symbol: "_Z22ggml_cuda_op_mul_mat_qR25ggml_backend_cuda_contextPK11ggml_tensorS3_PS1_PKcPKfS6_PfllllP11CUstream_st"},
+		{Program: "uretprobe_ggml_cuda_op_mul_mat_q", Symbol: "_Z22ggml_cuda_op_mul_mat_qR25ggml_backend_cuda_contextPK11ggml_tensorS3_PS1_PKcPKfS6_PfllllP11CUstream_st", Ret: true},
+	}},
+	"ggml_base": {Name: "ggml_base", DefaultTarget: "/usr/lib/ollama/libggml-base.so", TargetFlag: "-l", Stack: true, decode: decodeGGMLBase, Uprobes: []Uprobe{
+		{Program: "uprobe_ggml_aligned_malloc", Symbol: "ggml_aligned_malloc"},
+		{Program: "uretprobe_ggml_aligned_malloc", Symbol: "ggml_aligned_malloc", Ret: true},
+		{Program: "uprobe_ggml_aligned_free", Symbol: "ggml_aligned_free"},
+	}},
+	"cuda": {Name: "cuda", DefaultTarget: "/opt/cuda/targets/x86_64-linux/lib/libcudart.so", TargetFlag: "-f", Stack: true, decode: decodeCuda, Uprobes: []Uprobe{
+		{Program: "uprobe_cudaMalloc", Symbol: "cudaMalloc"},
+		{Program: "uretprobe_cudaMalloc", Symbol: "cudaMalloc", Ret: true},
+		{Program: "uprobe_cudaFree", Symbol: "cudaFree"},
+		{Program: "uprobe_cudaLaunchKernel", Symbol: "cudaLaunchKernel"},
+		{Program: "uprobe_cudaMemcpy", Symbol: "cudaMemcpy"},
+		{Program: "uretprobe_cudaMemcpy", Symbol: "cudaMemcpy", Ret: true},
+		{Program: "uprobe_cudaDeviceSynchronize", Symbol: "cudaDeviceSynchronize"},
+		{Program: "uretprobe_cudaDeviceSynchronize", Symbol: "cudaDeviceSynchronize", Ret: true},
+	}},
+}
+
+// Names 返回所有探针名，按字母排序
+func Names() []string {
+	names := make([]string, 0, len(Specs))
+	for name := range Specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Options 对应 C 加载程序的命令行参数，写入 BPF 对象的 .rodata
+type Options struct {
+	PID    int32  // filter_pid，0 表示不过滤
+	Comm   string // filter_comm，为空表示不过滤
+	Target string // uprobe 的目标文件，为空时使用 Spec.DefaultTarget
+	Stack  bool   // capture_stack，仅 Spec.Stack 为 true 的探针
+}
+
+// Probe 是一个已加载并挂载的探针
+type Probe struct {
+	spec   *Spec
+	coll   *ebpf.Collection
+	links  []link.Link
+	reader *ringbuf.Reader
+}
+
+// Load 加载 objPath 指向的 BPF 对象，设置过滤参数并挂载所有程序
+func Load(objPath string, spec *Spec, opts Options) (*Probe, error) {
+	if err := rlimit.RemoveMemlock(); err != nil {
+		return nil, fmt.Errorf("failed to remove memlock limit: %w", err)
+	}
+	cs, err := ebpf.LoadCollectionSpec(objPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", objPath, err)
+	}
+
+	if len(opts.Comm) >= taskCommLen {
+		return nil, fmt.Errorf("comm %q too long (max %d)", opts.Comm, taskCommLen-1)
+	}
+	var comm [taskCommLen]byte
+	copy(comm[:], opts.Comm)
+	vars := map[string]interface{}{"filter_pid": opts.PID, "filter_comm": comm}
+	if spec.Stack {
+		vars["capture_stack"] = opts.Stack
+	}
+	for name, value := range vars {
+		v, ok := cs.Variables[name]
+		if !ok {
+			continue
+		}
+		if err := v.Set(value); err != nil {
+			return nil, fmt.Errorf("failed to set %s: %w", name, err)
+		}
+	}
+
+	coll, err := ebpf.NewCollection(cs)
+	if err != nil {
+		var ve *ebpf.VerifierError
+		if errors.As(err, &ve) {
+			return nil, fmt.Errorf("verifier rejected %s: %+v", spec.Name, ve)
+		}
+		return nil, fmt.Errorf("failed to create collection for %s: %w", spec.Name, err)
+	}
+	p := &Probe{spec: spec, coll: coll}
+	if err := p.attach(cs, opts); err != nil {
+		p.Close()
+		return nil, err
+	}
+
+	rb, ok := coll.Maps["rb"]
+	if !ok {
+		p.Close()
+		return nil, fmt.Errorf("%s has no ring buffer map \"rb\"", spec.Name)
+	}
+	if p.reader, err = ringbuf.NewReader(rb); err != nil {
+		p.Close()
+		return nil, fmt.Errorf("failed to open ring buffer of %s: %w", spec.Name, err)
+	}
+	return p, nil
+}
+
+// attach 按 section 名挂载 tracepoint 和 fentry/fexit 程序，按 Spec.Uprobes 挂载 uprobe
+func (p *Probe) attach(cs *ebpf.CollectionSpec, opts Options) error {
+	uprobes := make(map[string]Uprobe, len(p.spec.Uprobes))
+	for _, u := range p.spec.Uprobes {
+		uprobes[u.Program] = u
+	}
+	var exe *link.Executable
+	for name, ps := range cs.Programs {
+		prog := p.coll.Programs[name]
+		var l link.Link
+		var err error
+		section := ps.SectionName
+		switch {
+		case strings.HasPrefix(section, "tracepoint/") || strings.HasPrefix(section, "tp/"):
+			parts := strings.SplitN(section, "/", 3)
+			if len(parts) != 3 {
+				return fmt.Errorf("invalid tracepoint section %q of %s", section, name)
+			}
+			l, err = link.Tracepoint(parts[1], parts[2], prog, nil)
+		case strings.HasPrefix(section, "fentry/") || strings.HasPrefix(section, "fexit/"):
+			l, err = link.AttachTracing(link.TracingOptions{Program: prog})
+		case section == "uprobe" || section == "uretprobe":
+			u, ok := uprobes[name]
+			if !ok {
+				return fmt.Errorf("no uprobe target for program %s", name)
+			}
+			if exe == nil {
+				target := opts.Target
+				if target == "" {
+					target = p.spec.DefaultTarget
+				}
+				if exe, err = link.OpenExecutable(target); err != nil {
+					return fmt.Errorf("failed to open %s: %w", target, err)
+				}
+			}
+			if u.Ret {
+				l, err = exe.Uretprobe(u.Symbol, prog, nil)
+			} else {
+				l, err = exe.Uprobe(u.Symbol, prog, nil)
+			}
+		default:
+			return fmt.Errorf("unsupported section %q of program %s", section, name)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to attach %s (%s): %w", name, section, err)
+		}
+		p.links = append(p.links, l)
+	}
+	return nil
+}
+
+// Run 读取 ring buffer，对每个解码后的事件调用 handle，直到 Close 被调用。
+// 与 C 加载程序一样，事件的时间戳为用户态收到记录时的时间；agent 自身产生的事件被忽略。
+func (p *Probe) Run(handle func(Event)) error {
+	self := int32(os.Getpid())
+	var rec ringbuf.Record
+	for {
+		if err := p.reader.ReadInto(&rec); err != nil {
+			if errors.Is(err, ringbuf.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("failed to read ring buffer of %s: %w", p.spec.Name, err)
+		}
+		event, err := p.spec.decode(rec.RawSample, time.Now().UnixNano())
+		if err != nil {
+			log.Printf("Probe %s: %v", p.spec.Name, err)
+			continue
+		}
+		if event.PID == self {
+			continue
+		}
+		handle(event)
+	}
+}
+
+// Close 停止读取并卸载探针
+func (p *Probe) Close() error {
+	var errs []error
+	if p.reader != nil {
+		errs = append(errs, p.reader.Close())
+	}
+	for _, l := range p.links {
+		errs = append(errs, l.Close())
+	}
+	p.coll.Close()
+	return errors.Join(errs...)
+}
+
+// ObjectPath 返回探针在 bpfDir 下的对象文件路径，与 bpf/Makefile 的输出一致
+func ObjectPath(bpfDir, name string) string {
+	return filepath.Join(bpfDir, "build", name+".bpf.o")
+}
@@ -0,0 +1,62 @@
+// syscalls.go
+package probe
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	syscallNamesOnce sync.Once
+	syscallNames     map[int32]string
+)
+
+// loadSyscallNames 与 syscall_helper.h 的 init_syscall_names 相同: 优先使用 ausyscall --dump，
+// 不可用时使用编译进来的当前架构的表
+func loadSyscallNames() map[int32]string {
+	if out, err := exec.Command("ausyscall", "--dump").Output(); err == nil {
+		if names := parseAusyscallDump(out); len(names) > 0 {
+			return names
+		}
+	}
+	switch runtime.GOARCH {
+	case "amd64":
+		return syscallNamesX86_64
+	case "arm64", "riscv64", "loong64":
+		return syscallNamesGeneric
+	}
+	return nil
+}
+
+// parseAusyscallDump 解析 "Using x86_64 syscall table:" 表头之后的 "<号>\t<名字>" 行
+func parseAusyscallDump(out []byte) map[int32]string {
+	names := make(map[int32]string)
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		num, name, ok := strings.Cut(sc.Text(), "\t")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseInt(num, 10, 32)
+		if err != nil || n < 0 || name == "" {
+			continue
+		}
+		names[int32(n)] = name
+	}
+	return names
+}
+
+// SyscallName 返回系统调用号对应的名字，未知时与 C 程序一样返回 "[unknown: n]"
+func SyscallName(n int32) string {
+	syscallNamesOnce.Do(func() { syscallNames = loadSyscallNames() })
+	if name, ok := syscallNames[n]; ok {
+		return name
+	}
+	return fmt.Sprintf("[unknown: %d]", uint32(n))
+}
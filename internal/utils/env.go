@@ -28,3 +28,18 @@ func GetEnvAsIntOrDefault(key string, defaultValue int) int {
 
 	return intValue
 }
+
+// GetEnvAsBoolOrDefault 获取环境变量并转换为布尔值 (1/0, true/false)，如果不存在或转换失败则返回默认值
+func GetEnvAsBoolOrDefault(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	boolValue, err := strconv.ParseBool(value)
+	if err != nil {
+		return defaultValue
+	}
+
+	return boolValue
+}
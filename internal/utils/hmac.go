@@ -0,0 +1,141 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// center 调用 agent API 时携带的签名头
+const (
+	HeaderNodeID    = "X-Scope-Node"      // 目标节点的 machine id
+	HeaderTimestamp = "X-Scope-Timestamp" // 签名时的 Unix 时间 (秒)
+	HeaderNonce     = "X-Scope-Nonce"     // 每个请求唯一的随机数，用于防重放
+	HeaderSignature = "X-Scope-Signature" // hex(HMAC-SHA256(key, canonical request))
+)
+
+// MaxSignedBodySize 是签名请求体的大小上限
+const MaxSignedBodySize = 8 << 20
+
+var (
+	ErrMissingSignature = errors.New("missing request signature")
+	ErrStaleTimestamp   = errors.New("request timestamp outside the allowed window")
+	ErrReplayedNonce    = errors.New("request nonce already used")
+	ErrBadSignature     = errors.New("request signature mismatch")
+)
+
+// canonicalRequest 是参与签名的内容: 方法、路径、查询串、节点、时间戳、nonce 和请求体的 SHA-256
+func canonicalRequest(r *http.Request, nodeID, timestamp, nonce string, body []byte) []byte {
+	sum := sha256.Sum256(body)
+	var b bytes.Buffer
+	for _, s := range []string{r.Method, r.URL.EscapedPath(), r.URL.RawQuery, nodeID, timestamp, nonce, hex.EncodeToString(sum[:])} {
+		b.WriteString(s)
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+func requestMAC(key, canonical []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(canonical)
+	return mac.Sum(nil)
+}
+
+// SignRequest 用 key 为发往 nodeID 的请求签名，body 必须与请求实际发送的内容一致
+func SignRequest(r *http.Request, nodeID string, key, body []byte) error {
+	nonce, err := GenerateRandomString(16)
+	if err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	r.Header.Set(HeaderNodeID, nodeID)
+	r.Header.Set(HeaderTimestamp, timestamp)
+	r.Header.Set(HeaderNonce, nonce)
+	r.Header.Set(HeaderSignature, hex.EncodeToString(requestMAC(key, canonicalRequest(r, nodeID, timestamp, nonce, body))))
+	return nil
+}
+
+// VerifyRequest 校验 SignRequest 生成的签名: 节点必须是 nodeID，时间戳与 now 相差不超过 maxSkew，
+// nonce 在 nonces 中未出现过。成功时读取的请求体会放回 r.Body。
+func VerifyRequest(r *http.Request, nodeID string, key []byte, now time.Time, maxSkew time.Duration, nonces *NonceCache) error {
+	timestamp := r.Header.Get(HeaderTimestamp)
+	nonce := r.Header.Get(HeaderNonce)
+	signature := r.Header.Get(HeaderSignature)
+	if timestamp == "" || nonce == "" || signature == "" || len(key) == 0 {
+		return ErrMissingSignature
+	}
+	if r.Header.Get(HeaderNodeID) != nodeID {
+		return fmt.Errorf("request is addressed to node %q", r.Header.Get(HeaderNodeID))
+	}
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrStaleTimestamp
+	}
+	if skew := now.Sub(time.Unix(sec, 0)); skew > maxSkew || skew < -maxSkew {
+		return ErrStaleTimestamp
+	}
+
+	var body []byte
+	if r.Body != nil {
+		body, err = io.ReadAll(io.LimitReader(r.Body, MaxSignedBodySize+1))
+		r.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read request body: %w", err)
+		}
+		if len(body) > MaxSignedBodySize {
+			return fmt.Errorf("request body larger than %d bytes", MaxSignedBodySize)
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	want := requestMAC(key, canonicalRequest(r, nodeID, timestamp, nonce, body))
+	got, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(got, want) {
+		return ErrBadSignature
+	}
+	// 签名正确之后才登记 nonce，伪造的请求不能占用 nonce
+	if !nonces.Use(nonce, now) {
+		return ErrReplayedNonce
+	}
+	return nil
+}
+
+// NonceCache 记录 ttl 内用过的 nonce。ttl 不小于时间戳允许的偏差的两倍时，
+// 窗口内的重放都能被发现，窗口外的请求由时间戳拒绝。
+type NonceCache struct {
+	mu   sync.Mutex
+	ttl  time.Duration
+	seen map[string]time.Time
+	last time.Time // 上次清理过期 nonce 的时间
+}
+
+func NewNonceCache(ttl time.Duration) *NonceCache {
+	return &NonceCache{ttl: ttl, seen: make(map[string]time.Time)}
+}
+
+// Use 登记 nonce，已经用过时返回 false
+func (c *NonceCache) Use(nonce string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now.Sub(c.last) > c.ttl {
+		for n, expiry := range c.seen {
+			if now.After(expiry) {
+				delete(c.seen, n)
+			}
+		}
+		c.last = now
+	}
+	if expiry, ok := c.seen[nonce]; ok && !now.After(expiry) {
+		return false
+	}
+	c.seen[nonce] = now.Add(c.ttl)
+	return true
+}
@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newSignedRequest(t *testing.T, method, url, body string, key []byte) *http.Request {
+	t.Helper()
+	r, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	if err := SignRequest(r, "node-1", key, []byte(body)); err != nil {
+		t.Fatalf("SignRequest: %v", err)
+	}
+	return r
+}
+
+func TestVerifyRequest(t *testing.T) {
+	key := []byte("secret")
+	now := time.Now()
+
+	t.Run("valid", func(t *testing.T) {
+		r := newSignedRequest(t, http.MethodPut, "http://agent/rules?x=1", `{"rules":[]}`, key)
+		if err := VerifyRequest(r, "node-1", key, now, time.Minute, NewNonceCache(2*time.Minute)); err != nil {
+			t.Fatalf("VerifyRequest: %v", err)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != `{"rules":[]}` {
+			t.Errorf("body not restored, got %q", body)
+		}
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		nonces := NewNonceCache(2 * time.Minute)
+		r := newSignedRequest(t, http.MethodGet, "http://agent/rules", "", key)
+		if err := VerifyRequest(r, "node-1", key, now, time.Minute, nonces); err != nil {
+			t.Fatalf("first VerifyRequest: %v", err)
+		}
+		replay, _ := http.NewRequest(http.MethodGet, "http://agent/rules", nil)
+		replay.Header = r.Header.Clone()
+		if err := VerifyRequest(replay, "node-1", key, now, time.Minute, nonces); !errors.Is(err, ErrReplayedNonce) {
+			t.Errorf("replay: got %v, want %v", err, ErrReplayedNonce)
+		}
+	})
+
+	tests := []struct {
+		name    string
+		tamper  func(r *http.Request)
+		key     []byte
+		now     time.Time
+		wantErr error
+	}{
+		{"wrong key", func(r *http.Request) {}, []byte("other"), now, ErrBadSignature},
+		{"tampered body", func(r *http.Request) { r.Body = io.NopCloser(strings.NewReader(`{"rules":[1]}`)) }, key, now, ErrBadSignature},
+		{"tampered query", func(r *http.Request) { r.URL.RawQuery = "x=2" }, key, now, ErrBadSignature},
+		{"stale", func(r *http.Request) {}, key, now.Add(2 * time.Minute), ErrStaleTimestamp},
+		{"unsigned", func(r *http.Request) { r.Header.Del(HeaderSignature) }, key, now, ErrMissingSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newSignedRequest(t, http.MethodPut, "http://agent/rules?x=1", `{"rules":[]}`, key)
+			tt.tamper(r)
+			if err := VerifyRequest(r, "node-1", tt.key, tt.now, time.Minute, NewNonceCache(2*time.Minute)); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("other node", func(t *testing.T) {
+		r := newSignedRequest(t, http.MethodGet, "http://agent/rules", "", key)
+		if err := VerifyRequest(r, "node-2", key, now, time.Minute, NewNonceCache(2*time.Minute)); err == nil {
+			t.Error("request for another node was accepted")
+		}
+	})
+}
+
+func TestVerifyRequestBadMACKeepsNonce(t *testing.T) {
+	key := []byte("secret")
+	now := time.Now()
+	nonces := NewNonceCache(2 * time.Minute)
+	genuine := newSignedRequest(t, http.MethodGet, "http://agent/rules", "", key)
+	forged, _ := http.NewRequest(http.MethodGet, "http://agent/rules", nil)
+	forged.Header = genuine.Header.Clone()
+	forged.Header.Set(HeaderSignature, "00ff")
+	if err := VerifyRequest(forged, "node-1", key, now, time.Minute, nonces); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("forged: got %v, want %v", err, ErrBadSignature)
+	}
+	if err := VerifyRequest(genuine, "node-1", key, now, time.Minute, nonces); err != nil {
+		t.Errorf("genuine request after a forged one with the same nonce: %v", err)
+	}
+}
+
+func TestNonceCache(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	c := NewNonceCache(time.Minute)
+	tests := []struct {
+		nonce string
+		at    time.Duration
+		want  bool
+	}{
+		{"a", 0, true},
+		{"a", 30 * time.Second, false}, // ttl 内重放
+		{"b", 30 * time.Second, true},
+		{"a", 61 * time.Second, true},  // 过期后可以再次使用
+		{"b", 80 * time.Second, false}, // b 在 30s 登记，90s 才过期
+		{"b", 91 * time.Second, true},
+	}
+	for _, tt := range tests {
+		if got := c.Use(tt.nonce, now.Add(tt.at)); got != tt.want {
+			t.Errorf("Use(%q, +%v) = %v, want %v", tt.nonce, tt.at, got, tt.want)
+		}
+	}
+}
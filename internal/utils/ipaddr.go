@@ -3,6 +3,7 @@ package utils
 import (
 	"fmt"
 	"net"
+	"strings"
 )
 
 func GetMyIpAddrs() map[string]string {
@@ -35,3 +36,44 @@ func GetMyIpAddrs() map[string]string {
 	}
 	return ipMap
 }
+
+// ResolveListenIPs 把逗号分隔的网卡名或 IP 解析为要监听的 IP，网卡名展开为该网卡的所有地址。
+// spec 为空时返回 nil，表示监听所有地址。
+func ResolveListenIPs(spec string) ([]string, error) {
+	var ips []string
+	seen := make(map[string]bool)
+	add := func(ip string) {
+		if !seen[ip] {
+			seen[ip] = true
+			ips = append(ips, ip)
+		}
+	}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if ip := net.ParseIP(item); ip != nil {
+			add(ip.String())
+			continue
+		}
+		iface, err := net.InterfaceByName(item)
+		if err != nil {
+			return nil, fmt.Errorf("%q is neither an IP address nor a network interface: %w", item, err)
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get addresses of %s: %w", item, err)
+		}
+		n := len(ips)
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLinkLocalUnicast() {
+				add(ipNet.IP.String())
+			}
+		}
+		if len(ips) == n {
+			return nil, fmt.Errorf("interface %s has no usable address", item)
+		}
+	}
+	return ips, nil
+}
@@ -32,3 +32,34 @@ func TestGetMyIpAddrs(t *testing.T) {
 		t.Logf("%s: %s", iface, ip)
 	}
 }
+
+func TestResolveListenIPs(t *testing.T) {
+	ips, err := ResolveListenIPs("")
+	if err != nil || ips != nil {
+		t.Fatalf("empty spec: got %v, %v, want nil, nil", ips, err)
+	}
+
+	ips, err = ResolveListenIPs("127.0.0.1, ::1,127.0.0.1")
+	if err != nil {
+		t.Fatalf("ResolveListenIPs: %v", err)
+	}
+	if len(ips) != 2 || ips[0] != "127.0.0.1" || ips[1] != "::1" {
+		t.Errorf("got %v, want [127.0.0.1 ::1]", ips)
+	}
+
+	if _, err := ResolveListenIPs("no-such-iface0"); err == nil {
+		t.Error("unknown interface was accepted")
+	}
+
+	ips, err = ResolveListenIPs("lo")
+	if err != nil {
+		t.Skipf("no loopback interface named lo: %v", err)
+	}
+	found := false
+	for _, ip := range ips {
+		found = found || ip == "127.0.0.1"
+	}
+	if !found {
+		t.Errorf("lo resolved to %v, want 127.0.0.1 among them", ips)
+	}
+}